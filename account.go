@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnutils"
+	"github.com/ovh/go-ovh/ovh"
+	"gopkg.in/ini.v1"
+)
+
+// ovhConfigPaths are the ovh.conf files go-ovh reads, by increasing priority
+var ovhConfigPaths = []string{"/etc/ovh.conf", filepath.Join(mcnutils.GetHomeDir(), ".ovh.conf"), "ovh.conf"}
+
+// Endpoint returns the URL of the API endpoint the client resolved, from its
+// parameters, the environment or ovh.conf
+func (a *API) Endpoint() string {
+	return a.endpoint
+}
+
+// resolveEndpoint returns the endpoint go-ovh selects when none is given:
+// OVH_ENDPOINT, else the default endpoint of ovh.conf, else ovh-eu
+func resolveEndpoint(endpoint string) string {
+	if endpoint != "" {
+		return endpoint
+	}
+	if endpoint = ovhConfigValue("default", "endpoint"); endpoint != "" {
+		return endpoint
+	}
+	return "ovh-eu"
+}
+
+// ovhConfigValue returns a setting the way go-ovh reads it: OVH_<NAME>, else
+// name in the section of ovh.conf
+func ovhConfigValue(section, name string) string {
+	if value := os.Getenv("OVH_" + strings.ToUpper(name)); value != "" {
+		return value
+	}
+	config := ini.Empty()
+	for _, path := range ovhConfigPaths {
+		if _, err := os.Stat(path); err == nil {
+			config.Append(path)
+		}
+	}
+	return config.Section(section).Key(name).String()
+}
+
+// endpointURL returns the URL of an endpoint given by name or URL
+func endpointURL(endpoint string) string {
+	if strings.Contains(endpoint, "/") {
+		return endpoint
+	}
+	return ovh.Endpoints[endpoint]
+}
+
+// accountKey identifies the endpoint and project the machine works with, to
+// key what machines of different projects must not share
+func (d *Driver) accountKey() string {
+	return endpointURL(d.Endpoint) + " " + d.ProjectID
+}
+
+// pinAccount records the endpoint and application the client resolved from
+// the environment or ovh.conf, so that later operations on the machine keep
+// working with the same account whatever the environment they run in. The
+// application secret and consumer key are not kept in the machine
+// configuration: later operations read them from the environment or ovh.conf
+// again
+func (d *Driver) pinAccount(client *API) {
+	if d.Endpoint == "" {
+		d.Endpoint = resolveEndpoint("")
+	}
+	if d.ApplicationKey == "" && d.ApplicationSecret == "" && d.ConsumerKey == "" {
+		d.ApplicationKey = client.client.AppKey
+		log.Debugf("Using credentials of application %s on endpoint %s from the environment", d.ApplicationKey, endpointURL(d.Endpoint))
+	}
+}
+
+// checkApplication fails when the machine is pinned to an application while
+// the environment or ovh.conf hold the credentials of another one: its secret
+// would sign the calls of the pinned application, which OVH rejects with
+// signature errors only
+func (d *Driver) checkApplication() error {
+	if d.ApplicationKey == "" || d.ApplicationSecret != "" {
+		return nil
+	}
+	key := ovhConfigValue(resolveEndpoint(d.Endpoint), "application_key")
+	if key == "" || key == d.ApplicationKey {
+		return nil
+	}
+	return fmt.Errorf("Machine %s uses application %s, but the environment or ovh.conf hold the credentials of application %s. Please set OVH_APPLICATION_KEY, OVH_APPLICATION_SECRET and OVH_CONSUMER_KEY to those of application %s", d.MachineName, d.ApplicationKey, key, d.ApplicationKey)
+}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/docker/machine/libmachine/log"
 	"github.com/ovh/go-ovh/ovh"
 )
 
@@ -12,9 +19,41 @@ const (
 	CustomerInterface = "https://www.ovh.com/manager/cloud/index.html"
 )
 
-// API is a handle to an instanciated OVH API.
+// API is a handle to an instanciated OVH API. Each API has its own
+// credentials, endpoint and HTTP client, so that machines of several accounts
+// can be handled in the same process
 type API struct {
 	client *ovh.Client
+
+	// endpoint URL, as resolved on creation
+	endpoint string
+
+	// transport of the calls, before instrumentation
+	transport http.RoundTripper
+
+	// recording of the calls, if any
+	recording *Recording
+
+	// client for status polling, when it goes through another endpoint
+	pollClient *ovh.Client
+
+	// client of the v2 API, for the IAM, created on first use
+	v2Client *ovh.Client
+
+	// audit log of mutating calls, disabled if empty
+	auditPath    string
+	auditMachine string
+
+	// longest wait for the end of an API maintenance, disabled if zero
+	maintenanceWait time.Duration
+
+	// responses of the catalog lookups, served instead of the API
+	catalog map[string]json.RawMessage
+
+	// query id of the last response, for support, and its status code
+	queryIDMutex sync.Mutex
+	lastQueryID  string
+	lastStatus   int
 }
 
 // Project is a go representation of a Cloud project
@@ -30,16 +69,52 @@ type Project struct {
 // Projects is a list of project IDs
 type Projects []string
 
+// Monitoring is a go representation of an instance metric time series
+type Monitoring struct {
+	Unit   string `json:"unit"`
+	Values []struct {
+		Timestamp int64   `json:"timestamp"`
+		Value     float64 `json:"value"`
+	} `json:"values"`
+}
+
 // Flavor is a go representation of Cloud Flavor
 type Flavor struct {
-	Region      string `json:"region"`
-	Name        string `json:"name"`
-	ID          string `json:"id"`
-	OS          string `json:"osType"`
-	Vcpus       int    `json:"vcpus"`
-	MemoryGB    int    `json:"ram"`
-	DiskSpaceGB int    `json:"disk"`
-	Type        string `json:"type"`
+	Region       string       `json:"region"`
+	Name         string       `json:"name"`
+	ID           string       `json:"id"`
+	OS           string       `json:"osType"`
+	Vcpus        int          `json:"vcpus"`
+	MemoryGB     int          `json:"ram"`
+	DiskSpaceGB  int          `json:"disk"`
+	Type         string       `json:"type"`
+	InboundMbps  int          `json:"inboundBandwidth"`
+	OutboundMbps int          `json:"outboundBandwidth"`
+	Capabilities []Capability `json:"capabilities"`
+	Quota        *int         `json:"quota"`
+	Available    *bool        `json:"available"`
+	PlanCodes    struct {
+		Hourly  string `json:"hourly"`
+		Monthly string `json:"monthly"`
+	} `json:"planCodes"`
+
+	// GPUs of the flavor, from the order catalog
+	GPUModel string `json:"-"`
+	GPUCount int    `json:"-"`
+}
+
+// bandwidth returns the lowest guaranteed bandwidth of a flavor in Mbps, 0 if unknown
+func (f *Flavor) bandwidth() int {
+	if f.InboundMbps == 0 || (f.OutboundMbps != 0 && f.OutboundMbps < f.InboundMbps) {
+		return f.OutboundMbps
+	}
+	return f.InboundMbps
+}
+
+// memoryMB returns the memory of a flavor, reported in GB, in MB: the unit of
+// image and quota requirements. OVH counts 1000 MB to the GB, b2-7 having 7 GB
+func (f *Flavor) memoryMB() int {
+	return f.MemoryGB * 1000
 }
 
 // Flavors is a list flavors
@@ -54,6 +129,7 @@ type Image struct {
 	CreationDate string `json:"creationDate"`
 	Status       string `json:"status"`
 	MinDisk      int    `json:"minDisk"`
+	MinRAM       int    `json:"minRam"`
 	Visibility   string `json:"visibility"`
 }
 
@@ -75,6 +151,16 @@ type Network struct {
 // Networks is a list of Network
 type Networks []Network
 
+// Subnet is a go representation of a private network subnet
+type Subnet struct {
+	ID        string `json:"id"`
+	CIDR      string `json:"cidr"`
+	GatewayIP string `json:"gatewayIp"`
+}
+
+// Subnets is a list of Subnet
+type Subnets []Subnet
+
 // SshkeyReq defines the fields for an SSH Key upload
 type SshkeyReq struct {
 	Name      string `json:"name"`
@@ -96,8 +182,9 @@ type Sshkeys []Sshkey
 
 // IP is a go representation of a Cloud IP address
 type IP struct {
-	IP   string `json:"ip"`
-	Type string `json:"type"`
+	IP        string `json:"ip"`
+	Type      string `json:"type"`
+	NetworkID string `json:"networkId"`
 }
 
 // IPs is a list of IPs
@@ -119,21 +206,64 @@ type InstanceReq struct {
 	NetworkParams  NetworkParams `json:"networks"`
 	SshkeyID       string        `json:"sshKeyID"`
 	MonthlyBilling bool          `json:"monthlyBilling"`
+	UserData       string        `json:"userData,omitempty"`
+	GroupID        string        `json:"groupId,omitempty"`
+}
+
+// BulkInstanceReq defines the fields for the creation of several identical VMs
+type BulkInstanceReq struct {
+	InstanceReq
+	Number int `json:"number"`
 }
 
 // Instance is a go representation of Cloud instance
 type Instance struct {
-	Name           string        `json:"name"`
-	ID             string        `json:"id"`
-	Status         string        `json:"status"`
-	Created        string        `json:"created"`
-	Region         string        `json:"region"`
-	NetworkParams  NetworkParams `json:"networks"`
-	Image          Image         `json:"image"`
-	Flavor         Flavor        `json:"flavor"`
-	Sshkey         Sshkey        `json:"sshKey"`
-	IPAddresses    IPs           `json:"ipAddresses"`
-	MonthlyBilling bool          `json:"monthlyBilling"`
+	Name           string          `json:"name"`
+	ID             string          `json:"id"`
+	Status         string          `json:"status"`
+	Created        string          `json:"created"`
+	Region         string          `json:"region"`
+	NetworkParams  NetworkParams   `json:"networks"`
+	Image          Image           `json:"image"`
+	Flavor         Flavor          `json:"flavor"`
+	Sshkey         Sshkey          `json:"sshKey"`
+	IPAddresses    IPs             `json:"ipAddresses"`
+	MonthlyBilling *MonthlyBilling `json:"monthlyBilling"`
+}
+
+// MonthlyBilling is the monthly billing of an instance, nil when billed hourly
+type MonthlyBilling struct {
+	Since  string `json:"since"`
+	Status string `json:"status"`
+}
+
+// VolumeReq defines the fields for a block storage volume creation
+type VolumeReq struct {
+	Name   string `json:"name"`
+	Region string `json:"region"`
+	Size   int    `json:"size"`
+	Type   string `json:"type"`
+}
+
+// Volume is a go representation of a Cloud block storage volume
+type Volume struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Region     string   `json:"region"`
+	Size       int      `json:"size"`
+	Type       string   `json:"type"`
+	Status     string   `json:"status"`
+	AttachedTo []string `json:"attachedTo"`
+}
+
+// VolumeAttachReq defines the fields for a volume attachment
+type VolumeAttachReq struct {
+	InstanceID string `json:"instanceId"`
+}
+
+// SnapshotReq defines the fields for an instance snapshot
+type SnapshotReq struct {
+	Name string `json:"snapshotName"`
 }
 
 // RebootReq defines the fields for a VM reboot
@@ -141,21 +271,103 @@ type RebootReq struct {
 	Type string `json:"type"`
 }
 
+// DNSRecord is a go representation of a DNS zone record
+type DNSRecord struct {
+	ID        int    `json:"id,omitempty"`
+	FieldType string `json:"fieldType"`
+	SubDomain string `json:"subDomain"`
+	Target    string `json:"target"`
+	TTL       int    `json:"ttl"`
+}
+
+// APIConfig holds the settings of an API client
+type APIConfig struct {
+	// Endpoint name, such as ovh-eu, or URL
+	Endpoint          string
+	ApplicationKey    string
+	ApplicationSecret string
+	ConsumerKey       string
+
+	// Transport of the calls, http.DefaultTransport if nil
+	Transport http.RoundTripper
+
+	// Recording the calls are recorded to, or replayed from, if not nil
+	Recording *Recording
+}
+
 // NewAPI instanciates a Cloud API driver from credentials, for a given endpoint. See github.com/ovh/go-ovh for more informations
 func NewAPI(endpoint, applicationKey, applicationSecret, consumerKey string) (api *API, err error) {
+	return NewAPIFromConfig(APIConfig{
+		Endpoint:          endpoint,
+		ApplicationKey:    applicationKey,
+		ApplicationSecret: applicationSecret,
+		ConsumerKey:       consumerKey,
+	})
+}
+
+// NewAPIFromConfig instanciates a Cloud API driver from its settings. Missing
+// settings are read from the environment and ovh.conf by go-ovh, here only:
+// the API then depends on nothing global
+func NewAPIFromConfig(config APIConfig) (api *API, err error) {
+	endpoint := resolveEndpoint(config.Endpoint)
+	api = &API{transport: config.Transport, recording: config.Recording, endpoint: endpointURL(endpoint)}
+	api.client, err = api.newClient(endpoint, config.ApplicationKey, config.ApplicationSecret, config.ConsumerKey)
+	return api, err
+}
+
+// newClient creates a go-ovh client with its own HTTP client, over the
+// transport of the API, with the calls instrumented
+func (a *API) newClient(endpoint, applicationKey, applicationSecret, consumerKey string) (*ovh.Client, error) {
 	client, err := ovh.NewClient(endpoint, applicationKey, applicationSecret, consumerKey)
-	return &API{client}, err
+	if err != nil {
+		return client, err
+	}
+	client.Client = &http.Client{Transport: a.transport}
+	if a.recording != nil {
+		recordCalls(client.Client, a.recording)
+	}
+	a.trackQueryIDs(client.Client)
+	traceCalls(client.Client)
+	return client, nil
+}
+
+// SetTimeout bounds the duration of each API call
+func (a *API) SetTimeout(timeout time.Duration) {
+	a.client.Timeout = timeout
+	if a.pollClient != nil {
+		a.pollClient.Timeout = timeout
+	}
+}
+
+// SetPollingEndpoint routes status polling calls through another endpoint,
+// for instance one closer to the host, with the same credentials
+func (a *API) SetPollingEndpoint(endpoint string) (err error) {
+	client, err := a.newClient(endpoint, a.client.AppKey, a.client.AppSecret, a.client.ConsumerKey)
+	if err != nil {
+		return err
+	}
+	client.Timeout = a.client.Timeout
+	a.pollClient = client
+	return nil
+}
+
+// poller returns the client for status polling calls
+func (a *API) poller() *ovh.Client {
+	if a.pollClient != nil {
+		return a.pollClient
+	}
+	return a.client
 }
 
 // GetProjects returns a list of string project ID
 func (a *API) GetProjects() (projects Projects, err error) {
-	err = a.client.Get("/cloud/project", &projects)
+	err = a.get("/cloud/project", &projects)
 	return projects, err
 }
 
 // GetProject return the details of a project given a project id
 func (a *API) GetProject(projectID string) (project *Project, err error) {
-	err = a.client.Get("/cloud/project/"+projectID, &project)
+	err = a.get("/cloud/project/"+projectID, &project)
 	return project, err
 }
 
@@ -199,19 +411,39 @@ func (a *API) GetNetworks(projectID string, privateNet bool) (networks Networks,
 	} else {
 		url = fmt.Sprintf("/cloud/project/%s/network/public", projectID)
 	}
-	err = a.client.Get(url, &networks)
+	err = a.get(url, &networks)
 	return networks, err
 }
 
+// NoPublicNetworkError is returned when a project lists no public network, as
+// in some local zones
+type NoPublicNetworkError struct {
+	ProjectID string
+}
+
+func (e *NoPublicNetworkError) Error() string {
+	return fmt.Sprintf("Project %s has no public network", e.ProjectID)
+}
+
 // GetPublicNetworkID returns the public network id for a given project
 func (a *API) GetPublicNetworkID(projectID string) (publicID string, err error) {
 	networks, err := a.GetNetworks(projectID, false)
 	if err != nil {
 		return "", err
 	}
+	if len(networks) == 0 {
+		return "", &NoPublicNetworkError{ProjectID: projectID}
+	}
 	return networks[0].ID, nil
 }
 
+// AttachInterface attaches a network to an existing instance
+func (a *API) AttachInterface(projectID, instanceID, networkID string) (err error) {
+	reqBody := map[string]string{"networkId": networkID}
+	url := fmt.Sprintf("/cloud/project/%s/instance/%s/interface", projectID, instanceID)
+	return a.post(url, reqBody, nil)
+}
+
 // GetNetworksByName returns the details of a network given its name & project
 func (a *API) GetPrivateNetworkByName(projectID, networkName string) (network *Network, err error) {
 	// Get image list
@@ -235,77 +467,173 @@ func (a *API) GetPrivateNetworkByName(projectID, networkName string) (network *N
 	return nil, fmt.Errorf("Invalid private network %s. List of valid private networks include %s", networkName, strings.Join(networkNames[:], ", "))
 }
 
+// GetSubnets returns the subnets of a private network
+func (a *API) GetSubnets(projectID, networkID string) (subnets Subnets, err error) {
+	url := fmt.Sprintf("/cloud/project/%s/network/private/%s/subnet", projectID, networkID)
+	err = a.get(url, &subnets)
+	return subnets, err
+}
+
 // GetRegions returns the list of valid regions for a given project
 func (a *API) GetRegions(projectID string) (regions Regions, err error) {
 	url := fmt.Sprintf("/cloud/project/%s/region", projectID)
-	err = a.client.Get(url, &regions)
+	err = a.get(url, &regions)
 	return regions, err
 }
 
+// Quota is a go representation of the quotas of a project in a region
+type Quota struct {
+	Region   string `json:"region"`
+	Instance *struct {
+		MaxCores      int `json:"maxCores"`
+		UsedCores     int `json:"usedCores"`
+		MaxInstances  int `json:"maxInstances"`
+		UsedInstances int `json:"usedInstances"`
+		MaxRAM        int `json:"maxRam"`
+		UsedRAM       int `json:"usedRAM"`
+	} `json:"instance"`
+	Volume *struct {
+		MaxGigabytes    int `json:"maxGigabytes"`
+		UsedGigabytes   int `json:"usedGigabytes"`
+		MaxVolumeCount  int `json:"maxVolumeCount"`
+		UsedVolumeCount int `json:"volumeCount"`
+	} `json:"volume"`
+}
+
+// GetQuotas returns the quotas of a project, by region
+func (a *API) GetQuotas(projectID string) (quotas []Quota, err error) {
+	url := fmt.Sprintf("/cloud/project/%s/quota", projectID)
+	err = a.get(url, &quotas)
+	return quotas, err
+}
+
 // GetFlavors returns the list of available flavors for a given project in a giver zone
 func (a *API) GetFlavors(projectID, region string) (flavors Flavors, err error) {
 	url := fmt.Sprintf("/cloud/project/%s/flavor?region=%s", projectID, region)
-	err = a.client.Get(url, &flavors)
+	err = a.get(url, &flavors)
 	return flavors, err
 }
 
-// GetFlavorByName returns the details of a flavor given its name. Slower than getting by id
+// GetFlavorByName returns the details of a flavor given its name. Slower than getting by id.
+// The name may be qualified with its region, as in "GRA7/b2-7", and only flavors of the region match
 func (a *API) GetFlavorByName(projectID, region, flavorName string) (flavor *Flavor, err error) {
+	name := flavorName
+	if parts := strings.SplitN(flavorName, "/", 2); len(parts) == 2 {
+		if parts[0] != region {
+			return nil, fmt.Errorf("Flavor '%s' belongs to region %s but the machine is created in region %s. Please select '--ovh-region %s' or a flavor of region %s", flavorName, parts[0], region, parts[0], region)
+		}
+		name = parts[1]
+	}
+
 	// Get flavor list
 	flavors, err := a.GetFlavors(projectID, region)
 	if err != nil {
 		return nil, err
 	}
 
-	// Find first matching Linux flavor
+	// Find first matching Linux flavor of the region, as aggregated listings
+	// may return the same name for several regions
 	for _, flavor := range flavors {
-		if flavor.OS != "linux" {
+		if flavor.OS != "linux" || (flavor.Region != "" && flavor.Region != region) {
 			continue
 		}
 
-		if flavor.ID == flavorName || flavor.Name == flavorName {
+		if flavor.ID == name || flavor.Name == name {
 			return &flavor, nil
 		}
 	}
 
 	// Ooops
-	return nil, fmt.Errorf("Flavor '%s' does not exist on OVH cloud. To find a list of available flavors, please visit %s", flavorName, CustomerInterface)
+	return nil, fmt.Errorf("Flavor '%s' does not exist in region %s on OVH cloud. To find a list of available flavors, please visit %s", flavorName, region, CustomerInterface)
 }
 
 // GetImages returns a list of images for a given project in a given region
 func (a *API) GetImages(projectID, region string) (images Images, err error) {
 	url := fmt.Sprintf("/cloud/project/%s/image?osType=linux&region=%s", projectID, region)
-	err = a.client.Get(url, &images)
+	err = a.get(url, &images)
 	return images, err
 }
 
-// GetImageByName returns the details of an image given its name, a project and a region. This is slower than id access
-func (a *API) GetImageByName(projectID, region, imageName string) (image *Image, err error) {
+// GetImageByName returns the details of an image given its name, a project and a region. This is slower than id access.
+// With fuzzy matching, names match regardless of case or by a unique prefix
+func (a *API) GetImageByName(projectID, region, imageName string, fuzzy bool) (image *Image, err error) {
 	// Get image list
 	images, err := a.GetImages(projectID, region)
 	if err != nil {
 		return nil, err
 	}
 
-	// Find first matching image
+	// Find first matching Linux image
+	var linux Images
 	for _, image := range images {
-		if image.OS != "linux" {
-			continue
+		if image.OS == "linux" {
+			linux = append(linux, image)
 		}
+	}
+	return matchImage(linux, imageName, fuzzy)
+}
 
-		if image.ID == imageName || image.Name == imageName {
-			return &image, nil
+// CreateSnapshot snapshots an instance into a new image
+func (a *API) CreateSnapshot(projectID, instanceID, name string) (err error) {
+	url := fmt.Sprintf("/cloud/project/%s/instance/%s/snapshot", projectID, instanceID)
+	err = a.post(url, SnapshotReq{Name: name}, nil)
+	return err
+}
+
+// GetSnapshots returns a list of instance snapshots for a given project in a given region
+func (a *API) GetSnapshots(projectID, region string) (snapshots Images, err error) {
+	url := fmt.Sprintf("/cloud/project/%s/snapshot?region=%s", projectID, region)
+	err = a.poll(url, &snapshots)
+	return snapshots, err
+}
+
+// GetBackup returns the details of an instance backup, in any region, given its
+// id or name. Backups are listed along with the snapshots of the project
+func (a *API) GetBackup(projectID, backupID string) (backup *Image, err error) {
+	var backups Images
+	url := fmt.Sprintf("/cloud/project/%s/snapshot", projectID)
+	err = a.get(url, &backups)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, backup := range backups {
+		if backup.ID == backupID || backup.Name == backupID {
+			return &backup, nil
 		}
 	}
+	return nil, fmt.Errorf("Backup '%s' does not exist on OVH cloud. To find a list of available backups, please visit %s", backupID, CustomerInterface)
+}
 
-	// Ooops
-	return nil, fmt.Errorf("Image '%s' does not exist on OVH cloud. To find a list of available images, please visit %s", imageName, CustomerInterface)
+// GetSnapshotByName returns the details of a snapshot given its name, nil if it does not exist (yet)
+func (a *API) GetSnapshotByName(projectID, region, name string) (snapshot *Image, err error) {
+	snapshots, err := a.GetSnapshots(projectID, region)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, snapshot := range snapshots {
+		if snapshot.Name == name {
+			return &snapshot, nil
+		}
+	}
+	return nil, nil
+}
+
+// DeleteSnapshot deletes an instance snapshot
+func (a *API) DeleteSnapshot(projectID, snapshotID string) (err error) {
+	url := fmt.Sprintf("/cloud/project/%s/snapshot/%s", projectID, snapshotID)
+	err = a.delete(url, nil)
+	if apierror, ok := err.(*ovh.APIError); ok && apierror.Code == 404 {
+		err = nil
+	}
+	return err
 }
 
 // GetSshkeys returns a list of sshkeys for a given project in a given region
 func (a *API) GetSshkeys(projectID, region string) (sshkeys Sshkeys, err error) {
 	url := fmt.Sprintf("/cloud/project/%s/sshkey?region=%s", projectID, region)
-	err = a.client.Get(url, &sshkeys)
+	err = a.get(url, &sshkeys)
 	return sshkeys, err
 }
 
@@ -335,22 +663,44 @@ func (a *API) CreateSshkey(projectID, name, pubkey string) (sshkey *Sshkey, err
 	sshkeyreq.PublicKey = pubkey
 
 	url := fmt.Sprintf("/cloud/project/%s/sshkey", projectID)
-	err = a.client.Post(url, sshkeyreq, &sshkey)
+	err = a.post(url, sshkeyreq, &sshkey)
+	if err == nil && sshkey == nil {
+		err = emptyResponseError(url)
+	}
 	return sshkey, err
 }
 
 // DeleteSshkey deletes an existing sshkey
 func (a *API) DeleteSshkey(projectID, instanceID string) (err error) {
 	url := fmt.Sprintf("/cloud/project/%s/sshkey/%s", projectID, instanceID)
-	err = a.client.Delete(url, nil)
-	if apierror, ok := err.(*ovh.APIError); ok && apierror.Code == 404 {
-		err = nil
-	}
-	return err
+	return a.deleteConfirmed(url)
 }
 
 // CreateInstance start a new public cloud instance and returns resulting object
-func (a *API) CreateInstance(projectID, name, pubkeyID, flavorId, ImageID, region string, networkIDs []string, monthlyBilling bool) (instance *Instance, err error) {
+func (a *API) CreateInstance(projectID, name, pubkeyID, flavorId, ImageID, region string, networkIDs []string, monthlyBilling bool, userData, groupID string) (instance *Instance, err error) {
+	instanceReq := newInstanceReq(name, pubkeyID, flavorId, ImageID, region, networkIDs, monthlyBilling, userData, groupID)
+
+	url := fmt.Sprintf("/cloud/project/%s/instance", projectID)
+	err = a.post(url, instanceReq, &instance)
+	if err == nil && instance == nil {
+		err = emptyResponseError(url)
+	}
+	return instance, err
+}
+
+// CreateInstances starts count identical public cloud instances in a single call
+func (a *API) CreateInstances(projectID, name, pubkeyID, flavorId, ImageID, region string, networkIDs []string, monthlyBilling bool, userData, groupID string, count int) (instances []Instance, err error) {
+	var bulkReq BulkInstanceReq
+	bulkReq.InstanceReq = newInstanceReq(name, pubkeyID, flavorId, ImageID, region, networkIDs, monthlyBilling, userData, groupID)
+	bulkReq.Number = count
+
+	url := fmt.Sprintf("/cloud/project/%s/instance/bulk", projectID)
+	err = a.post(url, bulkReq, &instances)
+	return instances, err
+}
+
+// newInstanceReq builds an instance creation request
+func newInstanceReq(name, pubkeyID, flavorId, ImageID, region string, networkIDs []string, monthlyBilling bool, userData, groupID string) InstanceReq {
 	var instanceReq InstanceReq
 	instanceReq.Name = name
 	instanceReq.SshkeyID = pubkeyID
@@ -358,15 +708,20 @@ func (a *API) CreateInstance(projectID, name, pubkeyID, flavorId, ImageID, regio
 	instanceReq.ImageID = ImageID
 	instanceReq.Region = region
 	instanceReq.MonthlyBilling = monthlyBilling
+	instanceReq.UserData = userData
+	instanceReq.GroupID = groupID
 
 	for _, v := range networkIDs {
 		networkParam := NetworkParam{ID: v}
 		instanceReq.NetworkParams = append(instanceReq.NetworkParams, networkParam)
 	}
+	return instanceReq
+}
 
-	url := fmt.Sprintf("/cloud/project/%s/instance", projectID)
-	err = a.client.Post(url, instanceReq, &instance)
-	return instance, err
+// ActivateMonthlyBilling switches an instance to monthly billing
+func (a *API) ActivateMonthlyBilling(projectID, instanceID string) (err error) {
+	url := fmt.Sprintf("/cloud/project/%s/instance/%s/activeMonthlyBilling", projectID, instanceID)
+	return a.post(url, nil, nil)
 }
 
 // RebootInstance reboot an instance
@@ -379,23 +734,235 @@ func (a *API) RebootInstance(projectID, instanceID string, hard bool) (err error
 	}
 
 	url := fmt.Sprintf("/cloud/project/%s/instance/%s/reboot", projectID, instanceID)
-	err = a.client.Post(url, rebootReq, nil)
+	err = a.post(url, rebootReq, nil)
+	return err
+}
+
+// ConfirmResize confirms a pending resize of an instance in VERIFY_RESIZE state
+func (a *API) ConfirmResize(projectID, instanceID string) (err error) {
+	url := fmt.Sprintf("/cloud/project/%s/instance/%s/confirmResize", projectID, instanceID)
+	err = a.post(url, nil, nil)
+	return err
+}
+
+// RevertResize reverts a pending resize of an instance in VERIFY_RESIZE state
+func (a *API) RevertResize(projectID, instanceID string) (err error) {
+	url := fmt.Sprintf("/cloud/project/%s/instance/%s/revertResize", projectID, instanceID)
+	err = a.post(url, nil, nil)
+	return err
+}
+
+// ShelveInstance shelves an instance: it is stopped and its disk is kept as
+// an image until it is unshelved
+func (a *API) ShelveInstance(projectID, instanceID string) (err error) {
+	url := fmt.Sprintf("/cloud/project/%s/instance/%s/shelve", projectID, instanceID)
+	err = a.post(url, nil, nil)
+	return err
+}
+
+// UnshelveInstance brings a shelved instance back on a host
+func (a *API) UnshelveInstance(projectID, instanceID string) (err error) {
+	url := fmt.Sprintf("/cloud/project/%s/instance/%s/unshelve", projectID, instanceID)
+	err = a.post(url, nil, nil)
+	return err
+}
+
+// StartInstance starts a stopped instance
+func (a *API) StartInstance(projectID, instanceID string) (err error) {
+	url := fmt.Sprintf("/cloud/project/%s/instance/%s/start", projectID, instanceID)
+	err = a.post(url, nil, nil)
+	return err
+}
+
+// StopInstance stops an instance. Its resources are kept, and billed
+func (a *API) StopInstance(projectID, instanceID string) (err error) {
+	url := fmt.Sprintf("/cloud/project/%s/instance/%s/stop", projectID, instanceID)
+	err = a.post(url, nil, nil)
+	return err
+}
+
+// RenameInstance changes the name of an instance
+func (a *API) RenameInstance(projectID, instanceID, name string) (err error) {
+	url := fmt.Sprintf("/cloud/project/%s/instance/%s", projectID, instanceID)
+	err = a.put(url, map[string]string{"instanceName": name}, nil)
 	return err
 }
 
 // DeleteInstance stops and destroys a public cloud instance
 func (a *API) DeleteInstance(projectID, instanceID string) (err error) {
 	url := fmt.Sprintf("/cloud/project/%s/instance/%s", projectID, instanceID)
-	err = a.client.Delete(url, nil)
+	return a.deleteConfirmed(url)
+}
+
+// isTransientDeleteError tells whether a failed deletion may succeed later: a
+// conflict, such as an instance still building, or a server side error
+func isTransientDeleteError(err error) bool {
+	apierror, ok := err.(*ovh.APIError)
+	return ok && (apierror.Code == 409 || apierror.Code >= 500)
+}
+
+// deleteConfirmed deletes a resource, retrying with backoff on transient
+// errors, then waits until it is gone. A resource already gone counts as
+// deleted
+func (a *API) deleteConfirmed(url string) error {
+	err := waitWithBackoff(func() (bool, error) {
+		err := a.delete(url, nil)
+		if apierror, ok := err.(*ovh.APIError); ok && apierror.Code == 404 {
+			return true, nil
+		}
+		if isTransientDeleteError(err) {
+			log.Debugf("Retrying deletion of %s: %s", url, err)
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Deletion may be processed asynchronously, e.g. for an instance being
+	// stopped, confirm the resource is actually gone
+	err = waitWithBackoff(func() (bool, error) {
+		err := a.poll(url, nil)
+		if apierror, ok := err.(*ovh.APIError); ok && apierror.Code == 404 {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("Could not confirm deletion of %s: %s", url, err)
+	}
+	return nil
+}
+
+// GetInstances returns the list of instances of a given project
+func (a *API) GetInstances(projectID string) (instances []Instance, err error) {
+	url := fmt.Sprintf("/cloud/project/%s/instance", projectID)
+	err = a.poll(url, &instances)
+	return instances, err
+}
+
+// InstanceExists checks whether an instance is still known to the API
+func (a *API) InstanceExists(projectID, instanceID string) (exists bool, err error) {
+	url := fmt.Sprintf("/cloud/project/%s/instance/%s", projectID, instanceID)
+	err = a.poll(url, nil)
+	if apierror, ok := err.(*ovh.APIError); ok && apierror.Code == 404 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CreateVolume creates a new block storage volume and returns resulting object
+func (a *API) CreateVolume(projectID, name, region, volumeType string, size int) (volume *Volume, err error) {
+	var volumeReq VolumeReq
+	volumeReq.Name = name
+	volumeReq.Region = region
+	volumeReq.Size = size
+	volumeReq.Type = volumeType
+
+	url := fmt.Sprintf("/cloud/project/%s/volume", projectID)
+	err = a.post(url, volumeReq, &volume)
+	if err == nil && volume == nil {
+		err = emptyResponseError(url)
+	}
+	return volume, err
+}
+
+// GetVolume returns the details of a block storage volume
+func (a *API) GetVolume(projectID, volumeID string) (volume *Volume, err error) {
+	url := fmt.Sprintf("/cloud/project/%s/volume/%s", projectID, volumeID)
+	err = a.poll(url, &volume)
+	if err == nil && volume == nil {
+		err = emptyResponseError(url)
+	}
+	return volume, err
+}
+
+// AttachVolume attaches a block storage volume to an instance
+func (a *API) AttachVolume(projectID, volumeID, instanceID string) (err error) {
+	url := fmt.Sprintf("/cloud/project/%s/volume/%s/attach", projectID, volumeID)
+	err = a.post(url, VolumeAttachReq{InstanceID: instanceID}, nil)
+	return err
+}
+
+// DeleteVolume deletes an existing block storage volume
+func (a *API) DeleteVolume(projectID, volumeID string) (err error) {
+	url := fmt.Sprintf("/cloud/project/%s/volume/%s", projectID, volumeID)
+	err = a.delete(url, nil)
 	if apierror, ok := err.(*ovh.APIError); ok && apierror.Code == 404 {
 		err = nil
 	}
 	return err
 }
 
+// InstanceNotFoundError is returned for an instance unknown to the API, such
+// as an instance deleted outside of docker-machine
+type InstanceNotFoundError struct {
+	ProjectID  string
+	InstanceID string
+}
+
+func (e *InstanceNotFoundError) Error() string {
+	return fmt.Sprintf("Instance %s not found in project %s", e.InstanceID, e.ProjectID)
+}
+
+// emptyResponseError is the error of a call answered without the expected
+// object, which callers would otherwise dereference
+func emptyResponseError(url string) error {
+	return fmt.Errorf("OVH API answered %s without content", url)
+}
+
+// isTransientError tells whether a failed read may succeed when sent again: a
+// network error, or a server side error
+func isTransientError(err error) bool {
+	if apierror, ok := err.(*ovh.APIError); ok {
+		return apierror.Code >= 500 || apierror.Code == 429
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
 // GetInstance finds a VM instance given a name or an ID
 func (a *API) GetInstance(projectID, instanceID string) (instance *Instance, err error) {
 	url := fmt.Sprintf("/cloud/project/%s/instance/%s", projectID, instanceID)
-	err = a.client.Get(url, &instance)
-	return instance, nil
+	err = a.poll(url, &instance)
+	if apierror, ok := err.(*ovh.APIError); ok && apierror.Code == 404 {
+		return nil, &InstanceNotFoundError{ProjectID: projectID, InstanceID: instanceID}
+	}
+	if err == nil && instance == nil {
+		err = emptyResponseError(url)
+	}
+	return instance, err
+}
+
+// GetInstanceMonitoring returns the monitoring data of an instance for a
+// period (today, lastday, lastweek...) and a metric type (cpu:used, mem:used...)
+func (a *API) GetInstanceMonitoring(projectID, instanceID, period, metric string) (monitoring *Monitoring, err error) {
+	url := fmt.Sprintf("/cloud/project/%s/instance/%s/monitoring?period=%s&type=%s", projectID, instanceID, period, metric)
+	err = a.get(url, &monitoring)
+	return monitoring, err
+}
+
+// CreateDNSRecord adds a record to a DNS zone, effective once the zone is refreshed
+func (a *API) CreateDNSRecord(zone string, record DNSRecord) (created *DNSRecord, err error) {
+	url := fmt.Sprintf("/domain/zone/%s/record", zone)
+	err = a.post(url, record, &created)
+	return created, err
+}
+
+// DeleteDNSRecord deletes a record of a DNS zone, effective once the zone is
+// refreshed. A record already gone counts as deleted
+func (a *API) DeleteDNSRecord(zone string, recordID int) (err error) {
+	url := fmt.Sprintf("/domain/zone/%s/record/%d", zone, recordID)
+	err = a.delete(url, nil)
+	if apierror, ok := err.(*ovh.APIError); ok && apierror.Code == 404 {
+		err = nil
+	}
+	return err
+}
+
+// RefreshDNSZone applies the pending changes of a DNS zone
+func (a *API) RefreshDNSZone(zone string) (err error) {
+	url := fmt.Sprintf("/domain/zone/%s/refresh", zone)
+	return a.post(url, nil, nil)
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/ovh/go-ovh/ovh"
+)
+
+// maintenanceRetryInterval is the delay between two calls while the API is
+// in maintenance
+const maintenanceRetryInterval = 30 * time.Second
+
+// isMaintenanceError tells whether the API rejected a call because it is in
+// maintenance, with a 503 error or a message mentioning the maintenance
+func isMaintenanceError(err error) bool {
+	apierror, ok := err.(*ovh.APIError)
+	if !ok {
+		return false
+	}
+	return apierror.Code == 503 || isMaintenanceRefusal(err)
+}
+
+// isMaintenanceRefusal tells whether the API refused a call with a message
+// mentioning the maintenance. Such calls were not processed, while a bare 503
+// may come from a gateway after the API processed the call, so that only
+// these are safe to send again for calls changing something
+func isMaintenanceRefusal(err error) bool {
+	apierror, ok := err.(*ovh.APIError)
+	return ok && strings.Contains(strings.ToLower(apierror.Message), "maintenance")
+}
+
+// SetMaintenanceWait makes calls wait up to wait for the end of an API
+// maintenance instead of failing. Zero disables waiting
+func (a *API) SetMaintenanceWait(wait time.Duration) {
+	a.maintenanceWait = wait
+}
+
+// retryMaintenance performs call, then performs it again as long as the API
+// is in maintenance, up to the maintenance wait. Calls which are not
+// idempotent are only sent again when the API explicitly refused them for
+// its maintenance. Each attempt is signed anew
+func (a *API) retryMaintenance(idempotent bool, call func() error) error {
+	retryable := isMaintenanceError
+	if !idempotent {
+		retryable = isMaintenanceRefusal
+	}
+
+	err := call()
+	if !retryable(err) || a.maintenanceWait <= 0 {
+		return err
+	}
+
+	deadline := time.Now().Add(a.maintenanceWait)
+	log.Warnf("OVH API is in maintenance, waiting up to %s for it to come back: %s", a.maintenanceWait, err)
+	for retryable(err) && time.Now().Add(maintenanceRetryInterval).Before(deadline) {
+		time.Sleep(maintenanceRetryInterval)
+		err = call()
+	}
+	if err == nil {
+		log.Info("OVH API is back from maintenance")
+	}
+	return err
+}
+
+// get performs a GET request, waiting out API maintenance
+func (a *API) get(url string, resType interface{}) error {
+	if ok, err := a.catalogResponse(url, resType); ok {
+		return err
+	}
+	return a.retryMaintenance(true, func() error {
+		return a.client.Get(url, resType)
+	})
+}
+
+// poll performs a status polling GET request, waiting out API maintenance
+func (a *API) poll(url string, resType interface{}) error {
+	return a.retryMaintenance(true, func() error {
+		return a.poller().Get(url, resType)
+	})
+}
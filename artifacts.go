@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// artifactCerts are the machine certificates backed up to the artifacts
+// container, once docker-machine generated them. Their private keys are not:
+// the container is no place for credentials to the engine
+var artifactCerts = []string{"ca.pem", "cert.pem", "server.pem"}
+
+// artifactsEndpoint returns the URL of the artifacts container
+func (d *Driver) artifactsEndpoint(o *openStack) (string, error) {
+	region := d.ArtifactsRegion
+	if region == "" {
+		region = d.RegionName
+	}
+	endpoint, ok := o.endpoints("object-store")[region]
+	if !ok {
+		return "", fmt.Errorf("No object storage found in region %s. Please select another region with '--ovh-artifacts-region'", region)
+	}
+	return endpoint + "/" + url.PathEscape(d.ArtifactsContainer), nil
+}
+
+// ensureArtifactsContainer creates the artifacts container, unless it exists
+func (d *Driver) ensureArtifactsContainer() error {
+	if d.ArtifactsContainer == "" {
+		return nil
+	}
+
+	o, err := d.openStack("'--ovh-artifacts-container'")
+	if err != nil {
+		return err
+	}
+	container, err := d.artifactsEndpoint(o)
+	if err != nil {
+		return err
+	}
+	_, err = o.call("PUT", container, nil, nil)
+	if err != nil {
+		return fmt.Errorf("Could not create artifacts container %s: %s", d.ArtifactsContainer, err)
+	}
+	return nil
+}
+
+// uploadArtifacts stores files of the machine under its name in the artifacts
+// container
+func (d *Driver) uploadArtifacts(files map[string][]byte) error {
+	o, err := d.openStack("'--ovh-artifacts-container'")
+	if err != nil {
+		return err
+	}
+	container, err := d.artifactsEndpoint(o)
+	if err != nil {
+		return err
+	}
+	for name, data := range files {
+		_, err = o.call("PUT", container+"/"+url.PathEscape(d.MachineName)+"/"+name, data, nil)
+		if err != nil {
+			return err
+		}
+	}
+	log.Debugf("Uploaded %d artifacts of %s to container %s", len(files), d.MachineName, d.ArtifactsContainer)
+	return nil
+}
+
+// archiveInstance uploads the console and provisioning logs of the instance.
+// Artifacts are an audit aid, failures are only reported
+func (d *Driver) archiveInstance() {
+	if d.ArtifactsContainer == "" || d.InstanceID == "" || d.DeletedOnStop {
+		return
+	}
+
+	log.Infof("Uploading logs of %s to container %s...", d.MachineName, d.ArtifactsContainer)
+	err := d.uploadArtifacts(d.instanceArtifacts())
+	if err != nil {
+		log.Warnf("Could not upload artifacts of %s to container %s: %s", d.MachineName, d.ArtifactsContainer, err)
+	}
+}
+
+// consoleLog returns the console output of the instance. The OVH API has no
+// console output, so this goes through the OpenStack compute API
+func (d *Driver) consoleLog(o *openStack) ([]byte, error) {
+	endpoint, ok := o.endpoints("compute")[d.RegionName]
+	if !ok {
+		return nil, fmt.Errorf("No OpenStack compute endpoint found for region %s", d.RegionName)
+	}
+	var console struct {
+		Output string `json:"output"`
+	}
+	_, err := o.call("POST", endpoint+"/servers/"+d.InstanceID+"/action", map[string]interface{}{"os-getConsoleOutput": map[string]interface{}{}}, &console)
+	return []byte(console.Output), err
+}
+
+// instanceArtifacts returns the console and provisioning logs of the instance
+func (d *Driver) instanceArtifacts() map[string][]byte {
+	files := make(map[string][]byte)
+
+	if o, err := d.openStack("'--ovh-artifacts-container'"); err == nil {
+		if console, err := d.consoleLog(o); err == nil {
+			files["console.log"] = console
+		} else {
+			log.Debugf("Could not read console of %s: %s", d.MachineName, err)
+		}
+	}
+
+	if output, err := drivers.RunSSHCommandFromDriver(d, "sudo cat /var/log/cloud-init-output.log"); err == nil {
+		files["cloud-init-output.log"] = []byte(output)
+	} else {
+		log.Debugf("Could not read provisioning log of %s: %s", d.MachineName, err)
+	}
+	return files
+}
+
+// backupCerts uploads the machine certificates once docker-machine generated
+// them, after create, and again whenever they are regenerated. The digest of
+// the backed up files is recorded in a marker of the machine
+func (d *Driver) backupCerts() {
+	if d.ArtifactsContainer == "" {
+		return
+	}
+
+	files := make(map[string][]byte)
+	var content []byte
+	for _, name := range artifactCerts {
+		data, err := ioutil.ReadFile(filepath.Join(d.StorePath, "machines", d.MachineName, name))
+		if os.IsNotExist(err) {
+			return
+		}
+		if err != nil {
+			log.Debugf("Could not read certificate %s of %s: %s", name, d.MachineName, err)
+			return
+		}
+		files["certs/"+name] = data
+		content = append(content, data...)
+	}
+	digest := inputDigest(string(content))
+	if d.readMarker(markerCertsBackedUp) == digest {
+		return
+	}
+
+	err := d.uploadArtifacts(files)
+	if err != nil {
+		log.Warnf("Could not back up certificates of %s to container %s: %s", d.MachineName, d.ArtifactsContainer, err)
+		return
+	}
+	err = d.writeMarker(markerCertsBackedUp, digest)
+	if err != nil {
+		log.Debugf("Could not record certificates backup of %s: %s", d.MachineName, err)
+	}
+}
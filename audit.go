@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/ovh/go-ovh/ovh"
+)
+
+// AuditLogName is the name of the audit log, in the machine store. It is
+// shared by all machines so that it outlives them
+const AuditLogName = "ovh-audit.log"
+
+// auditEntry is a line of the audit log, recording a mutating API call
+type auditEntry struct {
+	Time        string `json:"time"`
+	Machine     string `json:"machine"`
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	PayloadHash string `json:"payloadSha256,omitempty"`
+	Code        int    `json:"code"`
+	QueryID     string `json:"queryId,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// SetAuditLog enables the audit log of mutating calls, appended to path
+func (a *API) SetAuditLog(path, machineName string) {
+	a.auditPath = path
+	a.auditMachine = machineName
+}
+
+// post performs an audited POST request
+func (a *API) post(url string, reqBody, resType interface{}) error {
+	err := a.retryMaintenance(false, func() error {
+		return a.client.Post(url, reqBody, resType)
+	})
+	a.audit("POST", url, reqBody, err)
+	return err
+}
+
+// put performs an audited PUT request
+func (a *API) put(url string, reqBody, resType interface{}) error {
+	err := a.retryMaintenance(false, func() error {
+		return a.client.Put(url, reqBody, resType)
+	})
+	a.audit("PUT", url, reqBody, err)
+	return err
+}
+
+// delete performs an audited DELETE request
+func (a *API) delete(url string, resType interface{}) error {
+	err := a.retryMaintenance(false, func() error {
+		return a.client.Delete(url, resType)
+	})
+	a.audit("DELETE", url, nil, err)
+	return err
+}
+
+// audit appends a call and its outcome to the audit log, if enabled. Failing
+// to write the audit log is reported but never fails the call itself
+func (a *API) audit(method, url string, reqBody interface{}, callErr error) {
+	if a.auditPath == "" {
+		return
+	}
+
+	code := a.lastStatusCode()
+	if callErr != nil {
+		code = 0
+		if apierror, ok := callErr.(*ovh.APIError); ok {
+			code = apierror.Code
+		}
+	}
+	appendAuditEntry(a.auditPath, auditEntry{
+		Machine: a.auditMachine,
+		Method:  method,
+		Path:    url,
+		Code:    code,
+		QueryID: a.LastQueryID(),
+	}, reqBody, callErr)
+}
+
+// appendAuditEntry completes an entry with the time, the payload hash and the
+// error of the call, and appends it to the audit log at path
+func appendAuditEntry(path string, entry auditEntry, reqBody interface{}, callErr error) {
+	entry.Time = time.Now().UTC().Format(time.RFC3339)
+
+	if reqBody != nil {
+		payload, ok := reqBody.([]byte)
+		if !ok {
+			var err error
+			if payload, err = json.Marshal(reqBody); err != nil {
+				payload = nil
+			}
+		}
+		if payload != nil {
+			sum := sha256.Sum256(payload)
+			entry.PayloadHash = hex.EncodeToString(sum[:])
+		}
+	}
+
+	if callErr != nil {
+		entry.Error = callErr.Error()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Warnf("Could not write audit log: %s", err)
+		return
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Warnf("Could not write audit log: %s", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		log.Warnf("Could not write audit log: %s", err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// authorizedKeysScript appends the team keys to the authorized keys of the
+// SSH user on first boot
+const authorizedKeysScript = `# Authorize team keys
+HOME_DIR=$(getent passwd %[1]s | cut -d: -f6)
+mkdir -p "$HOME_DIR/.ssh"
+cat >> "$HOME_DIR/.ssh/authorized_keys" <<'EOF'
+%[2]sEOF
+chown -R %[1]s: "$HOME_DIR/.ssh"
+chmod 700 "$HOME_DIR/.ssh"
+chmod 600 "$HOME_DIR/.ssh/authorized_keys"
+`
+
+// validAuthorizedKey tells whether line is an authorized_keys line, with
+// optional leading options: a key type followed by a key blob of that type
+func validAuthorizedKey(line string) bool {
+	fields := strings.Fields(line)
+	for i := range fields {
+		blob := authorizedKeyBlob(strings.Join(fields[i:], " "))
+		if blob != nil && bytes.HasPrefix(blob, sshString(nil, []byte(fields[i]))) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadAuthorizedKeys reads the team keys of '--ovh-authorized-keys-file', in
+// authorized_keys format, and keeps them in the driver state so that the keys
+// injected in each machine are known
+func (d *Driver) loadAuthorizedKeys() error {
+	d.AuthorizedKeys = nil
+	if d.AuthorizedKeysFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(d.AuthorizedKeysFile)
+	if err != nil {
+		return fmt.Errorf("Could not read team keys: %s", err)
+	}
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !validAuthorizedKey(line) {
+			return fmt.Errorf("Invalid public key on line %d of %s. Please select a file in authorized_keys format with '--ovh-authorized-keys-file'", n+1, d.AuthorizedKeysFile)
+		}
+		d.AuthorizedKeys = append(d.AuthorizedKeys, line)
+	}
+	if len(d.AuthorizedKeys) == 0 {
+		return fmt.Errorf("No public key in %s. Please select a file in authorized_keys format with '--ovh-authorized-keys-file'", d.AuthorizedKeysFile)
+	}
+	return nil
+}
+
+// authorizedKeysUserData returns the first boot script section authorizing
+// the team keys, along with the key OVH installs at create
+func (d *Driver) authorizedKeysUserData() string {
+	if len(d.AuthorizedKeys) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(authorizedKeysScript, d.SSHUser, strings.Join(d.AuthorizedKeys, "\n")+"\n")
+}
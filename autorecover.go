@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// autoRecoverThreshold is the number of consecutive failed checks, one per
+// minute, before the watchdog reboots the machine
+const autoRecoverThreshold = 3
+
+// autoRecoverMaxBackoff bounds the doublings of the threshold after reboots
+// which did not help, to 3 << 6 checks, about 3 hours
+const autoRecoverMaxBackoff = 6
+
+// recoveryEventsKept is the number of recovery events kept in the driver state
+const recoveryEventsKept = 10
+
+// autoRecoverScript installs the watchdog: every minute, a systemd timer
+// checks that dockerd answers and that the default gateway is reachable.
+// dockerd is restarted on failure, and after several failed checks the
+// instance is hard rebooted through the OpenStack compute API, with an
+// application credential only allowed to act on the instance, or locally
+// when the API cannot be reached. Each reboot that does not bring the
+// machine back doubles the failed checks before the next one
+const autoRecoverScript = `sudo mkdir -p /etc/ovh /var/lib/ovh-recover
+sudo tee /etc/ovh/recover.conf >/dev/null <<'EOF'
+AUTH_URL='%[1]s'
+CREDENTIAL_ID='%[2]s'
+CREDENTIAL_SECRET='%[3]s'
+COMPUTE='%[4]s'
+INSTANCE='%[5]s'
+THRESHOLD=%[6]d
+EOF
+sudo chmod 600 /etc/ovh/recover.conf
+sudo tee /usr/local/sbin/ovh-recover >/dev/null <<'EOF'
+#!/bin/sh
+. /etc/ovh/recover.conf
+STATE=/var/lib/ovh-recover
+
+# Not provisioned yet
+systemctl is-enabled docker >/dev/null 2>&1 || exit 0
+
+REASON=""
+if ! timeout 30 docker info >/dev/null 2>&1; then
+	REASON="dockerd not responding"
+else
+	GATEWAY=$(ip route show default | awk '{print $3; exit}')
+	if [ -z "$GATEWAY" ]; then
+		REASON="no default route"
+	elif ! ping -c 3 -W 5 "$GATEWAY" >/dev/null 2>&1; then
+		REASON="gateway $GATEWAY unreachable"
+	fi
+fi
+
+if [ -z "$REASON" ]; then
+	echo 0 > $STATE/failures
+	echo 0 > $STATE/reboots
+	exit 0
+fi
+
+FAILURES=$(( $(cat $STATE/failures 2>/dev/null || echo 0) + 1 ))
+REBOOTS=$(cat $STATE/reboots 2>/dev/null || echo 0)
+echo $FAILURES > $STATE/failures
+if [ $FAILURES -lt $(( THRESHOLD << (REBOOTS < %[7]d ? REBOOTS : %[7]d) )) ]; then
+	case "$REASON" in dockerd*) systemctl restart docker ;; esac
+	exit 0
+fi
+echo 0 > $STATE/failures
+echo $(( REBOOTS + 1 )) > $STATE/reboots
+
+AUTH='{"auth":{"identity":{"methods":["application_credential"],"application_credential":{"id":"'$CREDENTIAL_ID'","secret":"'$CREDENTIAL_SECRET'"}}}}'
+TOKEN=$(curl -s -m 10 -o /dev/null -D - -H "Content-Type: application/json" -d "$AUTH" "$AUTH_URL/auth/tokens" | tr -d '\r' | awk 'tolower($1) == "x-subject-token:" {print $2}')
+if [ -n "$TOKEN" ] && curl -s -f -m 10 -X POST -H "Content-Type: application/json" -H "X-Auth-Token: $TOKEN" -d '{"reboot":{"type":"HARD"}}' "$COMPUTE/servers/$INSTANCE/action" >/dev/null; then
+	echo "$(date -u +%%FT%%TZ) $REASON: hard reboot through the OpenStack API" >> $STATE/events
+	sync
+else
+	echo "$(date -u +%%FT%%TZ) $REASON: local reboot" >> $STATE/events
+	sync
+	systemctl reboot --force
+fi
+EOF
+sudo chmod 700 /usr/local/sbin/ovh-recover
+sudo tee /etc/systemd/system/ovh-recover.service >/dev/null <<'EOF'
+[Unit]
+Description=OVH instance auto-recovery check
+
+[Service]
+Type=oneshot
+ExecStart=/usr/local/sbin/ovh-recover
+EOF
+sudo tee /etc/systemd/system/ovh-recover.timer >/dev/null <<'EOF'
+[Unit]
+Description=OVH instance auto-recovery checks
+
+[Timer]
+OnBootSec=10min
+OnUnitActiveSec=1min
+
+[Install]
+WantedBy=timers.target
+EOF
+sudo systemctl daemon-reload
+sudo systemctl enable --now ovh-recover.timer
+`
+
+// recoveryEventsCommand prints the last recovery events of the machine
+const recoveryEventsCommand = `tail -n %d /var/lib/ovh-recover/events 2>/dev/null || true`
+
+// validateAutoRecover checks the OpenStack credentials creating the
+// credential of the watchdog
+func (d *Driver) validateAutoRecover() error {
+	if !d.AutoRecover {
+		return nil
+	}
+	o, err := d.openStack("'--ovh-auto-recover'")
+	if err != nil {
+		return err
+	}
+	if _, ok := o.endpoints("compute")[d.RegionName]; !ok {
+		return fmt.Errorf("No OpenStack compute endpoint found for region %s", d.RegionName)
+	}
+	return nil
+}
+
+// setupAutoRecover creates an OpenStack application credential whose access
+// rules only allow actions on the instance, and installs the watchdog using
+// it. The credential is saved in the machine configuration as soon as it
+// exists, so that removing the machine deletes it
+func (d *Driver) setupAutoRecover() error {
+	o, err := d.openStack("'--ovh-auto-recover'")
+	if err != nil {
+		return err
+	}
+	endpoint, ok := o.endpoints("compute")[d.RegionName]
+	if !ok {
+		return fmt.Errorf("No OpenStack compute endpoint found for region %s", d.RegionName)
+	}
+
+	// The secret is only known on creation, a resumed create replaces it
+	if d.AutoRecoverCredential != "" {
+		err = o.deleteApplicationCredential(d.AutoRecoverCredential)
+		if err != nil {
+			return err
+		}
+		d.AutoRecoverCredential = ""
+	}
+
+	credential, err := o.createServerCredential(d.instanceName()+"-recover", "Auto-recovery watchdog of docker-machine "+d.MachineName, endpoint, d.InstanceID)
+	if err != nil {
+		return fmt.Errorf("Could not create the credential of the auto-recovery watchdog: %s", err)
+	}
+	d.AutoRecoverCredential = credential.URL
+	err = d.checkpoint(d.CreatePhase)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Installing auto-recovery watchdog on %s...", d.MachineName)
+	script := fmt.Sprintf(autoRecoverScript, o.authURL, credential.ID, credential.Secret, endpoint, d.InstanceID, autoRecoverThreshold, autoRecoverMaxBackoff)
+	_, err = drivers.RunSSHCommandFromDriver(d, script)
+	if err != nil {
+		return fmt.Errorf("Could not install auto-recovery watchdog: %s", err)
+	}
+	return nil
+}
+
+// deleteAutoRecoverCredential deletes the application credential of the
+// watchdog
+func (d *Driver) deleteAutoRecoverCredential() error {
+	o, err := d.openStack("Deleting the credential of the auto-recovery watchdog")
+	if err != nil {
+		return err
+	}
+	err = o.deleteApplicationCredential(d.AutoRecoverCredential)
+	if err != nil {
+		return err
+	}
+	d.AutoRecoverCredential = ""
+	return nil
+}
+
+// refreshRecoveryEvents reads the recovery events of the machine, reports
+// them, new ones as warnings, and keeps the last ones in the driver state
+func (d *Driver) refreshRecoveryEvents() error {
+	if !d.AutoRecover {
+		return fmt.Errorf("Machine %s has no auto-recovery watchdog", d.MachineName)
+	}
+	output, err := drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(recoveryEventsCommand, recoveryEventsKept))
+	if err != nil {
+		return fmt.Errorf("Could not read the recovery events: %s", err)
+	}
+
+	var events []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line != "" {
+			events = append(events, line)
+		}
+	}
+
+	known := make(map[string]bool)
+	for _, event := range d.RecoveryEvents {
+		known[event] = true
+	}
+	for _, event := range events {
+		if known[event] {
+			log.Infof("Machine %s recovered: %s", d.MachineName, event)
+		} else {
+			log.Warnf("Machine %s recovered: %s", d.MachineName, event)
+		}
+	}
+	if len(events) == 0 {
+		log.Infof("Machine %s did not need to recover", d.MachineName)
+	}
+	d.RecoveryEvents = events
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// resolveBackup finds the instance backup to restore and checks it can boot
+// an instance in the machine region
+func (d *Driver) resolveBackup() (*Image, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	backup, err := client.GetBackup(d.ProjectID, d.RestoreBackup)
+	if err != nil {
+		return nil, err
+	}
+
+	if backup.Region != d.RegionName {
+		return nil, fmt.Errorf("Backup '%s' is stored in region %s but the machine is created in region %s. Please select '--ovh-region %s'", d.RestoreBackup, backup.Region, d.RegionName, backup.Region)
+	}
+	if backup.Status != "active" {
+		return nil, fmt.Errorf("Backup '%s' is not ready to be restored, its status is '%s'", d.RestoreBackup, backup.Status)
+	}
+
+	log.Infof("Restoring backup %s (%s) taken on %s", backup.Name, backup.ID, backup.CreationDate)
+	return backup, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/ovh/go-ovh/ovh"
+)
+
+// hoursPerMonth is the number of hours hourly instances are projected over
+const hoursPerMonth = 730
+
+// catalogPriceUnit is the unit of the prices of the order catalog, in
+// hundred millionths of the currency
+const catalogPriceUnit = 100000000
+
+// budgetAlertDelay is the delay between two mails of a billing alert, in
+// seconds
+const budgetAlertDelay = 86400
+
+// Subsidiaries of the endpoints, for the prices of accounts without access to
+// their own details
+var endpointSubsidiaries = map[string]string{
+	ovh.OvhEU: "FR",
+	ovh.OvhCA: "CA",
+}
+
+// PriceCatalog is the public order catalog of the Public Cloud
+type PriceCatalog struct {
+	Locale struct {
+		CurrencyCode string `json:"currencyCode"`
+	} `json:"locale"`
+	Addons []struct {
+		PlanCode string `json:"planCode"`
+		Pricings []struct {
+			Price int64 `json:"price"`
+		} `json:"pricings"`
+		Blobs struct {
+			Technical struct {
+				GPU struct {
+					Model  string `json:"model"`
+					Number int    `json:"number"`
+				} `json:"gpu"`
+			} `json:"technical"`
+		} `json:"blobs"`
+	} `json:"addons"`
+}
+
+// BudgetAlert is a billing alert of a project
+type BudgetAlert struct {
+	ID               string `json:"id,omitempty"`
+	Email            string `json:"email"`
+	MonthlyThreshold int    `json:"monthlyThreshold"`
+	Delay            int    `json:"delay"`
+}
+
+// GetSubsidiary returns the OVH subsidiary of the account
+func (a *API) GetSubsidiary() (subsidiary string, err error) {
+	var me struct {
+		Subsidiary string `json:"ovhSubsidiary"`
+	}
+	err = a.get("/me", &me)
+	return me.Subsidiary, err
+}
+
+// GetPriceCatalog returns the Public Cloud prices of a subsidiary
+func (a *API) GetPriceCatalog(subsidiary string) (catalog *PriceCatalog, err error) {
+	url := "/order/catalog/public/cloud?ovhSubsidiary=" + subsidiary
+	err = a.get(url, &catalog)
+	if err == nil && catalog == nil {
+		err = emptyResponseError(url)
+	}
+	return catalog, err
+}
+
+// GetBudgetAlerts returns the billing alerts of a project
+func (a *API) GetBudgetAlerts(projectID string) (alerts []BudgetAlert, err error) {
+	var ids []string
+	err = a.get(fmt.Sprintf("/cloud/project/%s/alerting", projectID), &ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		var alert BudgetAlert
+		err = a.get(fmt.Sprintf("/cloud/project/%s/alerting/%s", projectID, id), &alert)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+// CreateBudgetAlert creates a billing alert of a project
+func (a *API) CreateBudgetAlert(projectID string, alert BudgetAlert) (err error) {
+	url := fmt.Sprintf("/cloud/project/%s/alerting", projectID)
+	return a.post(url, alert, nil)
+}
+
+// accountCatalog returns the public order catalog of the subsidiary of the
+// account, or of the endpoint for accounts without access to their details
+func accountCatalog(client *API) (*PriceCatalog, error) {
+	subsidiary, err := client.GetSubsidiary()
+	if err != nil || subsidiary == "" {
+		subsidiary = endpointSubsidiaries[client.Endpoint()]
+		if subsidiary == "" {
+			subsidiary = "FR"
+		}
+		log.Debugf("Using the catalog of subsidiary %s: %v", subsidiary, err)
+	}
+	return client.GetPriceCatalog(subsidiary)
+}
+
+// planPrice returns the price of a plan code, in the currency of the catalog
+func (c *PriceCatalog) planPrice(planCode string) (float64, bool) {
+	for _, addon := range c.Addons {
+		if addon.PlanCode == planCode && len(addon.Pricings) > 0 {
+			return float64(addon.Pricings[0].Price) / catalogPriceUnit, true
+		}
+	}
+	return 0, false
+}
+
+// monthlyCost returns the projected monthly cost of an instance of flavor
+func (c *PriceCatalog) monthlyCost(flavor *Flavor, billingPeriod string) (float64, bool) {
+	if billingPeriod == "monthly" {
+		if price, ok := c.planPrice(flavor.PlanCodes.Monthly); ok {
+			return price, true
+		}
+	}
+	price, ok := c.planPrice(flavor.PlanCodes.Hourly)
+	return price * hoursPerMonth, ok
+}
+
+// checkBudget warns when the projected monthly cost of the machines of the
+// project, with the new ones, crosses '--ovh-budget-warn'. Only the instances
+// are priced, from their flavor and billing period
+func (d *Driver) checkBudget(client *API, flavor *Flavor) error {
+	if d.BudgetWarn <= 0 {
+		return nil
+	}
+
+	catalog, err := accountCatalog(client)
+	if err != nil {
+		return fmt.Errorf("Could not get the prices for '--ovh-budget-warn': %s", err)
+	}
+
+	count := d.Count
+	if count < 1 {
+		count = 1
+	}
+	cost, ok := catalog.monthlyCost(flavor, d.BillingPeriod)
+	if !ok {
+		log.Warnf("Flavor %s has no price, '--ovh-budget-warn' left unchecked", flavor.Name)
+		return nil
+	}
+	total := cost * float64(count)
+
+	machines, err := d.storedMachines()
+	if err != nil {
+		return err
+	}
+	flavors := make(map[string]Flavors)
+	var unpriced []string
+	for _, machine := range machines {
+		if machine.ProjectID != d.ProjectID || machine.InstanceID == "" || machine.DeletedOnStop {
+			continue
+		}
+		if _, ok := flavors[machine.RegionName]; !ok {
+			flavors[machine.RegionName], err = client.GetFlavors(d.ProjectID, machine.RegionName)
+			if err != nil {
+				return err
+			}
+		}
+		priced := false
+		for _, f := range flavors[machine.RegionName] {
+			if f.ID == machine.FlavorID {
+				var price float64
+				price, priced = catalog.monthlyCost(&f, machine.BillingPeriod)
+				total += price
+				break
+			}
+		}
+		if !priced {
+			unpriced = append(unpriced, machine.MachineName)
+		}
+	}
+	if len(unpriced) > 0 {
+		log.Warnf("Machines %s could not be priced and are left out of the budget", strings.Join(unpriced, ", "))
+	}
+
+	currency := catalog.Locale.CurrencyCode
+	log.Infof("Projected monthly cost of the machines of project %s: %.2f %s, %.2f %s for this machine", d.ProjectID, total, currency, cost*float64(count), currency)
+	if total > float64(d.BudgetWarn) {
+		log.Warnf("Projected monthly cost of the machines of project %s, %.2f %s, crosses the budget of %d %s", d.ProjectID, total, currency, d.BudgetWarn, currency)
+	}
+	return nil
+}
+
+// registerBudgetAlert registers a billing alert of the project at the budget
+// for '--ovh-budget-alert-email', unless the address already has one
+func (d *Driver) registerBudgetAlert(client *API) error {
+	if d.BudgetAlertEmail == "" {
+		return nil
+	}
+
+	alerts, err := client.GetBudgetAlerts(d.ProjectID)
+	if err != nil {
+		return fmt.Errorf("Could not list the billing alerts of project %s: %s", d.ProjectID, err)
+	}
+	for _, alert := range alerts {
+		if strings.EqualFold(alert.Email, d.BudgetAlertEmail) {
+			if alert.MonthlyThreshold != d.BudgetWarn {
+				log.Infof("Billing alert of project %s for %s is kept at %d, not %d", d.ProjectID, alert.Email, alert.MonthlyThreshold, d.BudgetWarn)
+			}
+			return nil
+		}
+	}
+
+	err = client.CreateBudgetAlert(d.ProjectID, BudgetAlert{Email: d.BudgetAlertEmail, MonthlyThreshold: d.BudgetWarn, Delay: budgetAlertDelay})
+	if err != nil {
+		return fmt.Errorf("Could not create the billing alert of project %s: %s", d.ProjectID, err)
+	}
+	log.Infof("Registered a billing alert of project %s at %d for %s", d.ProjectID, d.BudgetWarn, d.BudgetAlertEmail)
+	return nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// bulkMachineName returns the name of the i-th machine of a bulk create, the
+// first one being the machine itself
+func (d *Driver) bulkMachineName(i int) string {
+	if i == 0 {
+		return d.MachineName
+	}
+	return fmt.Sprintf("%s-%d", d.MachineName, i+1)
+}
+
+// validateCount checks the bulk create settings and that the names of the
+// additional machines are valid and free
+func (d *Driver) validateCount() error {
+	if d.Count <= 1 {
+		return nil
+	}
+	if d.AttachPrivateNetwork {
+		return fmt.Errorf("'--ovh-count' cannot attach the private network of project %s, which has no public network. Please create the machines one by one", d.ProjectID)
+	}
+
+	for i := 1; i < d.Count; i++ {
+		name := d.bulkMachineName(i)
+		if err := validateMachineName(name); err != nil {
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(d.StorePath, "machines", name)); err == nil {
+			return fmt.Errorf("Machine %s of the bulk create already exists", name)
+		}
+	}
+	return nil
+}
+
+// requestInstances creates the instance of the machine and, for bulk creates,
+// the instances of the additional machines in the same call
+func (d *Driver) requestInstances(client *API) (*Instance, error) {
+	monthlyBilling := d.BillingPeriod == "monthly"
+	if d.PortID != "" {
+		return d.createServerWithPort(client)
+	}
+	if d.Count <= 1 || len(d.BulkInstanceIDs) > 0 {
+		return client.CreateInstance(d.ProjectID, d.instanceName(), d.KeyPairID, d.FlavorID, d.bootImageID(), d.RegionName, d.instanceNetworkIDs(), monthlyBilling, d.userData(), d.InstanceGroupID)
+	}
+
+	log.Infof("Creating %d OVH instances in a single call...", d.Count)
+	instances, err := client.CreateInstances(d.ProjectID, d.instanceName(), d.KeyPairID, d.FlavorID, d.bootImageID(), d.RegionName, d.instanceNetworkIDs(), monthlyBilling, d.userData(), d.InstanceGroupID, d.Count)
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("Bulk creation of %d instances returned none", d.Count)
+	}
+
+	for _, instance := range instances[1:] {
+		d.BulkInstanceIDs = append(d.BulkInstanceIDs, instance.ID)
+	}
+	if len(instances) != d.Count {
+		log.Warnf("Bulk creation returned %d instances out of %d", len(instances), d.Count)
+	}
+	return &instances[0], nil
+}
+
+// registerBulkMachines waits for the additional instances of a bulk create
+// and registers them as docker-machine machines, ready to be provisioned
+func (d *Driver) registerBulkMachines() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Waiting for the %d additional instances...", len(d.BulkInstanceIDs))
+	active := make(map[string]Instance)
+	err = waitWithBackoff(func() (bool, error) {
+		instances, err := client.GetInstances(d.ProjectID)
+		if err != nil {
+			return true, err
+		}
+		for _, instance := range instances {
+			for _, id := range d.BulkInstanceIDs {
+				if instance.ID != id {
+					continue
+				}
+				if instance.Status == "ERROR" {
+					return true, fmt.Errorf("Instance %s of the bulk create is in ERROR state", id)
+				}
+				if instance.Status == "ACTIVE" {
+					active[id] = instance
+				}
+			}
+		}
+		return len(active) == len(d.BulkInstanceIDs), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = d.applyPortSecurity(d.BulkInstanceIDs...)
+	if err != nil {
+		return err
+	}
+	err = d.applyLabels(d.BulkInstanceIDs...)
+	if err != nil {
+		return err
+	}
+	d.applyIAMTags(client, d.BulkInstanceIDs...)
+
+	config, err := ioutil.ReadFile(filepath.Join(d.StorePath, "machines", d.MachineName, "config.json"))
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for i, id := range d.BulkInstanceIDs {
+		name := d.bulkMachineName(i + 1)
+		machine, err := d.bulkMachine(name, active[id])
+		if err == nil {
+			err = machine.setupBulkMachine(client)
+		}
+		if err == nil {
+			err = d.registerBulkMachine(config, machine)
+		}
+		if err != nil {
+			return fmt.Errorf("Could not register machine %s of instance %s: %s", name, id, err)
+		}
+		names = append(names, name)
+	}
+
+	// The instances now belong to their own machines
+	d.BulkInstanceIDs = nil
+
+	log.Infof("Registered machines %s. Provision them with 'docker-machine provision %s'", strings.Join(names, ", "), strings.Join(names, " "))
+	return nil
+}
+
+// bulkMachine returns the driver of an additional machine of a bulk create,
+// derived from the driver of the machine itself
+func (d *Driver) bulkMachine(name string, instance Instance) (*Driver, error) {
+	machine := *d
+	base := *d.BaseDriver
+	machine.BaseDriver = &base
+	machine.MachineName = name
+	machine.InstanceID = instance.ID
+	machine.InstanceName = ""
+	machine.IPAddress = ""
+	machine.PrivateIPAddress = ""
+	machine.SecurityGroupIDs = nil
+	machine.Count = 1
+	machine.BulkInstanceIDs = nil
+	machine.CreatePhase = phaseIPAssigned
+	machine.Health = nil
+	machine.client = nil
+	for _, ip := range instance.IPAddresses {
+		if ip.Type == "public" && machine.IPAddress == "" {
+			machine.IPAddress = ip.IP
+		}
+		if ip.Type == "private" && machine.PrivateIPAddress == "" {
+			machine.PrivateIPAddress = ip.IP
+		}
+	}
+	if machine.NoPublicNetwork {
+		machine.IPAddress = machine.PrivateIPAddress
+	}
+	if machine.IPAddress == "" {
+		return nil, fmt.Errorf("No IP found for instance %s", instance.ID)
+	}
+	return &machine, nil
+}
+
+// setupBulkMachine gives the instance of an additional machine of a bulk
+// create its own name, as the create request named every instance after the
+// machine, and its own security group
+func (d *Driver) setupBulkMachine(client *API) error {
+	err := client.RenameInstance(d.ProjectID, d.InstanceID, d.instanceName())
+	if err != nil {
+		return err
+	}
+	return d.applySecurityGroups()
+}
+
+// registerBulkMachine saves the configuration of an additional machine of a
+// bulk create, derived from the configuration of the machine itself
+func (d *Driver) registerBulkMachine(config []byte, machine *Driver) error {
+	machineDir := filepath.Join(d.StorePath, "machines", d.MachineName)
+	dir := filepath.Join(d.StorePath, "machines", machine.MachineName)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	// The machine shares the key pair, with its own copy of a generated
+	// private key as the machine directory goes away with the machine
+	if d.generatedSSHKey() {
+		machine.SSHKeyPath = filepath.Join(dir, d.KeyPairName)
+		for _, suffix := range []string{"", ".pub"} {
+			data, err := ioutil.ReadFile(d.SSHKeyPath + suffix)
+			if err != nil {
+				return err
+			}
+			err = ioutil.WriteFile(machine.SSHKeyPath+suffix, data, 0600)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	driver, err := json.Marshal(machine)
+	if err != nil {
+		return err
+	}
+
+	// Host options reference files of the machine directory
+	oldDir, _ := json.Marshal(machineDir)
+	newDir, _ := json.Marshal(dir)
+	config = []byte(strings.Replace(string(config), strings.Trim(string(oldDir), `"`), strings.Trim(string(newDir), `"`), -1))
+
+	var host map[string]json.RawMessage
+	err = json.Unmarshal(config, &host)
+	if err != nil {
+		return err
+	}
+	host["Driver"] = driver
+	host["Name"], _ = json.Marshal(machine.MachineName)
+
+	data, err := json.MarshalIndent(host, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "config.json"), data, 0600)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// errInterrupted stops the wait for the instance on an interruption
+var errInterrupted = errors.New("Create interrupted")
+
+// watchInterrupt records an interruption while the instance is being created,
+// until the returned function is called. The handler only closes
+// d.interrupted: the wait for the instance checks it, and the create handles
+// the interruption with abortCreate, so that the machine is only used from the
+// create goroutine
+func (d *Driver) watchInterrupt() func() {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	interrupted := make(chan struct{})
+	d.interrupted = interrupted
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-interrupts:
+		}
+
+		// docker-machine may be gone already, keep deleting on a closed output
+		signal.Ignore(syscall.SIGPIPE)
+		close(interrupted)
+	}()
+
+	return func() {
+		signal.Stop(interrupts)
+		close(done)
+		d.interrupted = nil
+	}
+}
+
+// abortCreate handles an interruption of the create, and exits. With
+// --ovh-delete-on-interrupt, the instance and the generated ssh key are
+// deleted before exiting. Otherwise they are kept, for the next create to
+// resume or for remove to delete them. The driver runs without a terminal, so
+// the flag is the confirmation
+func (d *Driver) abortCreate() {
+	// Let the next operation on the machine start right away
+	exit := func() {
+		if d.StorePath != "" {
+			os.Remove(d.machineLockPath())
+		}
+		os.Exit(130)
+	}
+
+	if !d.DeleteOnInterrupt {
+		log.Warnf("Create of %s interrupted before instance %s is active. Run the create again to resume it, or remove the machine to delete the instance", d.MachineName, d.InstanceID)
+		exit()
+	}
+
+	log.Warnf("Create of %s interrupted, deleting instance %s...", d.MachineName, d.InstanceID)
+	err := removeMachines([]*Driver{d})
+	if err != nil {
+		log.Errorf("Could not delete the resources of %s: %s. Please delete them from %s", d.MachineName, err, CustomerInterface)
+		exit()
+	}
+	if d.StorePath != "" {
+		os.RemoveAll(d.checkpointPath())
+	}
+	log.Infof("Deleted the resources of %s", d.MachineName)
+	exit()
+}
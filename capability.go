@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Capability is a feature advertised by a flavor
+type Capability struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// flavorTypeCapabilities maps hardware capabilities to the flavor type
+// markers OVH uses for them
+var flavorTypeCapabilities = map[string][]string{
+	"gpu":        {"gpu"},
+	"nvme":       {"nvme", "iops"},
+	"local-raid": {"raid"},
+}
+
+// capabilities returns the capabilities of a flavor: the ones advertised by
+// the API, the hardware ones derived from its type, and its GPU model
+func (f *Flavor) capabilities() []string {
+	var capabilities []string
+	for _, capability := range f.Capabilities {
+		if capability.Enabled {
+			capabilities = append(capabilities, capability.Name)
+		}
+	}
+
+	for capability, markers := range flavorTypeCapabilities {
+		if capability == "gpu" && f.GPUCount > 0 {
+			continue
+		}
+		for _, marker := range markers {
+			if strings.Contains(strings.ToLower(f.Type), marker) {
+				capabilities = append(capabilities, capability)
+				break
+			}
+		}
+	}
+
+	if f.GPUCount > 0 {
+		capabilities = append(capabilities, "gpu", fmt.Sprintf("gpu:%dx%s", f.GPUCount, gpuModelName(f.GPUModel)))
+	}
+
+	sort.Strings(capabilities)
+	return capabilities
+}
+
+// gpuModelName returns a GPU model of the catalog as a capability: lower
+// case, without spaces
+func gpuModelName(model string) string {
+	return strings.ToLower(strings.Join(strings.Fields(model), "-"))
+}
+
+// hasCapability tells whether the flavor has a required capability. 'gpu:N'
+// requires N GPUs at least, 'gpu:MODEL' a GPU model containing MODEL
+func (f *Flavor) hasCapability(required string) bool {
+	required = strings.ToLower(required)
+	if strings.HasPrefix(required, "gpu:") {
+		value := strings.TrimPrefix(required, "gpu:")
+		if count, err := strconv.Atoi(value); err == nil {
+			return f.GPUCount >= count
+		}
+		return f.GPUCount > 0 && strings.Contains(gpuModelName(f.GPUModel), gpuModelName(value))
+	}
+
+	for _, capability := range f.capabilities() {
+		if capability == required {
+			return true
+		}
+	}
+	return false
+}
+
+// missingCapabilities returns the required capabilities the flavor lacks
+func (f *Flavor) missingCapabilities(required []string) []string {
+	var missing []string
+	for _, capability := range required {
+		if !f.hasCapability(capability) {
+			missing = append(missing, capability)
+		}
+	}
+	return missing
+}
+
+// requiresGPU tells whether a required capability is about GPUs
+func (d *Driver) requiresGPU() bool {
+	for _, capability := range d.RequiredCapabilities {
+		capability = strings.ToLower(capability)
+		if capability == "gpu" || strings.HasPrefix(capability, "gpu:") {
+			return true
+		}
+	}
+	return false
+}
+
+// setFlavorGPUs sets the GPUs of flavors from the public order catalog, which
+// describes the hardware of their hourly plan
+func setFlavorGPUs(client *API, flavors []*Flavor) error {
+	catalog, err := accountCatalog(client)
+	if err != nil {
+		return fmt.Errorf("Could not get the GPUs of the flavors from the order catalog: %s", err)
+	}
+
+	plans := make(map[string]int)
+	for i, addon := range catalog.Addons {
+		plans[addon.PlanCode] = i
+	}
+	for _, flavor := range flavors {
+		i, ok := plans[flavor.PlanCodes.Hourly]
+		if !ok {
+			continue
+		}
+		gpu := catalog.Addons[i].Blobs.Technical.GPU
+		flavor.GPUModel = gpu.Model
+		flavor.GPUCount = gpu.Number
+	}
+	return nil
+}
+
+// validateFlavorCapabilities checks the flavor has every required capability,
+// suggesting flavors of the region that do
+func (d *Driver) validateFlavorCapabilities(flavor *Flavor) error {
+	if len(d.RequiredCapabilities) == 0 {
+		return nil
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	if d.requiresGPU() {
+		err = setFlavorGPUs(client, []*Flavor{flavor})
+		if err != nil {
+			return err
+		}
+	}
+
+	missing := flavor.missingCapabilities(d.RequiredCapabilities)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	flavors, err := client.GetFlavors(d.ProjectID, d.RegionName)
+	if err != nil {
+		return err
+	}
+	var linux []*Flavor
+	for i := range flavors {
+		if flavors[i].OS == "linux" {
+			linux = append(linux, &flavors[i])
+		}
+	}
+	if d.requiresGPU() {
+		err = setFlavorGPUs(client, linux)
+		if err != nil {
+			return err
+		}
+	}
+
+	var candidates []string
+	for _, candidate := range linux {
+		if len(candidate.missingCapabilities(d.RequiredCapabilities)) == 0 {
+			candidates = append(candidates, candidate.Name)
+		}
+	}
+
+	msg := fmt.Sprintf("Flavor '%s' lacks required capabilities %s (it has: %s).", flavor.Name, strings.Join(missing, ", "), strings.Join(flavor.capabilities(), ", "))
+	if len(candidates) == 0 {
+		return fmt.Errorf("%s No flavor of region %s has them", msg, d.RegionName)
+	}
+	return fmt.Errorf("%s Flavors with them in region %s: %s", msg, d.RegionName, strings.Join(candidates, ", "))
+}
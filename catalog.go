@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// catalogMaxAge is the age beyond which a catalog bundle is reported as stale
+const catalogMaxAge = 30 * 24 * time.Hour
+
+// catalogBundle holds the responses of the lookups of the create in a
+// project: the projects, regions, flavors and images, networks, quotas, ssh
+// keys and backups, to create machines where these GET endpoints are blocked.
+// Status polling stays live
+type catalogBundle struct {
+	Endpoint  string
+	ProjectID string
+	Exported  time.Time
+	Responses map[string]json.RawMessage
+}
+
+// SetCatalog serves the catalog lookups from a bundle exported with the
+// export-catalog operation instead of the API
+func (a *API) SetCatalog(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var bundle catalogBundle
+	err = json.Unmarshal(data, &bundle)
+	if err != nil {
+		return fmt.Errorf("Invalid catalog bundle %s: %s", path, err)
+	}
+	if age := time.Since(bundle.Exported); age > catalogMaxAge {
+		log.Warnf("Catalog bundle %s was exported %d days ago, flavors and images may have changed since", path, int(age.Hours()/24))
+	}
+	a.catalog = bundle.Responses
+	return nil
+}
+
+// catalogResponse unmarshals the bundled response of url into res, and tells
+// whether there is one
+func (a *API) catalogResponse(url string, res interface{}) (bool, error) {
+	data, ok := a.catalog[url]
+	if !ok {
+		return false, nil
+	}
+	log.Debugf("Using catalog bundle for %s", url)
+	if res == nil {
+		return true, nil
+	}
+	return true, json.Unmarshal(data, res)
+}
+
+// exportCatalog saves the catalog lookups of the project in a bundle: the
+// projects of the account, the networks, quotas and backups of the project,
+// and its regions with their flavors, images and ssh keys
+func (d *Driver) exportCatalog(client *API, path string) error {
+	bundle := catalogBundle{
+		Endpoint:  endpointURL(d.Endpoint),
+		ProjectID: d.ProjectID,
+		Exported:  time.Now().UTC(),
+		Responses: make(map[string]json.RawMessage),
+	}
+	fetch := func(url string) (json.RawMessage, error) {
+		var res json.RawMessage
+		err := client.get(url, &res)
+		if err != nil {
+			return nil, fmt.Errorf("Could not export %s: %s", url, err)
+		}
+		bundle.Responses[url] = res
+		return res, nil
+	}
+
+	data, err := fetch("/cloud/project")
+	if err != nil {
+		return err
+	}
+	var projects Projects
+	json.Unmarshal(data, &projects)
+	for _, projectID := range projects {
+		if _, err := fetch("/cloud/project/" + projectID); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Exporting networks, quotas and backups of project %s...", d.ProjectID)
+	if _, err := fetch(fmt.Sprintf("/cloud/project/%s/network/public", d.ProjectID)); err != nil {
+		return err
+	}
+	data, err = fetch(fmt.Sprintf("/cloud/project/%s/network/private", d.ProjectID))
+	if err != nil {
+		return err
+	}
+	var networks Networks
+	json.Unmarshal(data, &networks)
+	for _, network := range networks {
+		if _, err := fetch(fmt.Sprintf("/cloud/project/%s/network/private/%s/subnet", d.ProjectID, network.ID)); err != nil {
+			return err
+		}
+	}
+	if _, err := fetch(fmt.Sprintf("/cloud/project/%s/quota", d.ProjectID)); err != nil {
+		return err
+	}
+	if _, err := fetch(fmt.Sprintf("/cloud/project/%s/snapshot", d.ProjectID)); err != nil {
+		return err
+	}
+
+	data, err = fetch(fmt.Sprintf("/cloud/project/%s/region", d.ProjectID))
+	if err != nil {
+		return err
+	}
+	var regions Regions
+	json.Unmarshal(data, &regions)
+	for _, region := range regions {
+		log.Infof("Exporting flavors, images and ssh keys of region %s...", region)
+		if _, err := fetch(fmt.Sprintf("/cloud/project/%s/flavor?region=%s", d.ProjectID, region)); err != nil {
+			return err
+		}
+		if _, err := fetch(fmt.Sprintf("/cloud/project/%s/image?osType=linux&region=%s", d.ProjectID, region)); err != nil {
+			return err
+		}
+		if _, err := fetch(fmt.Sprintf("/cloud/project/%s/sshkey?region=%s", d.ProjectID, region)); err != nil {
+			return err
+		}
+	}
+
+	data, err = json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// exportStoreCatalog exports the catalog of a project, given by name or id, to
+// a bundle file, with the API credentials of the environment or ovh.conf
+func exportStoreCatalog(storePath string, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("Please give the project and the bundle file")
+	}
+
+	d := &Driver{BaseDriver: &drivers.BaseDriver{StorePath: storePath}, Config: Config{ProjectName: args[0]}}
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	err = d.resolveProject(client)
+	if err != nil {
+		return err
+	}
+	err = d.exportCatalog(client, args[1])
+	if err != nil {
+		return err
+	}
+	log.Infof("Catalog of project %s exported to %s. Create machines with '--ovh-catalog-bundle %s'", d.ProjectID, args[1], args[1])
+	return nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Create phases, in order. Each one is persisted once completed so that an
+// interrupted create can resume from the last one
+const (
+	phaseKeyEnsured        = "key-ensured"
+	phaseInstanceRequested = "instance-requested"
+	phaseActive            = "active"
+	phaseIPAssigned        = "ip-assigned"
+	phaseSSHReady          = "ssh-ready"
+)
+
+var createPhases = []string{
+	phaseKeyEnsured,
+	phaseInstanceRequested,
+	phaseActive,
+	phaseIPAssigned,
+	phaseSSHReady,
+}
+
+// checkpointDir is the directory holding create checkpoints, in the machine
+// store. It lives outside of the machine directory so that it survives it
+const checkpointDir = "ovh-create"
+
+// reached tells whether the create went through phase
+func (d *Driver) reached(phase string) bool {
+	for i, p := range createPhases {
+		if p == phase {
+			return containsString(createPhases[i:], d.CreatePhase)
+		}
+	}
+	return false
+}
+
+// checkpointPath returns the directory of the machine create checkpoint
+func (d *Driver) checkpointPath() string {
+	return filepath.Join(d.StorePath, checkpointDir, d.MachineName)
+}
+
+// checkpoint records phase as completed, in the machine configuration, so that
+// removing the machine cleans up what was already created, and in the create
+// checkpoint, so that a new create resumes from it
+func (d *Driver) checkpoint(phase string) error {
+	d.timePhase(phase)
+	d.CreatePhase = phase
+	log.Debugf("Create phase %s completed", phase)
+
+	if d.StorePath == "" {
+		return nil
+	}
+
+	driver, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	err = d.saveMachineConfig(driver)
+	if err != nil {
+		return fmt.Errorf("Could not save create phase %s: %s", phase, err)
+	}
+
+	path := d.checkpointPath()
+	err = os.MkdirAll(path, 0700)
+	if err != nil {
+		return fmt.Errorf("Could not save create phase %s: %s", phase, err)
+	}
+
+	// Keep a copy of a generated key, which is lost with the machine directory
+	if d.generatedSSHKey() {
+		for _, suffix := range []string{"", ".pub"} {
+			if data, err := ioutil.ReadFile(d.SSHKeyPath + suffix); err == nil {
+				err = ioutil.WriteFile(filepath.Join(path, "id"+suffix), data, 0600)
+				if err != nil {
+					return fmt.Errorf("Could not save create phase %s: %s", phase, err)
+				}
+			}
+		}
+	}
+
+	err = ioutil.WriteFile(filepath.Join(path, "state.json"), driver, 0600)
+	if err != nil {
+		return fmt.Errorf("Could not save create phase %s: %s", phase, err)
+	}
+	return nil
+}
+
+// saveMachineConfig replaces the driver part of the machine configuration,
+// which docker-machine only saves once create succeeded
+func (d *Driver) saveMachineConfig(driver []byte) error {
+	path := filepath.Join(d.StorePath, "machines", d.MachineName, "config.json")
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var config map[string]json.RawMessage
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return err
+	}
+	config["Driver"] = driver
+
+	data, err = json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	// Replace the file at once, so that it is never seen half written
+	err = ioutil.WriteFile(path+".tmp", data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// generatedSSHKey tells whether the machine key is generated in the machine
+// directory
+func (d *Driver) generatedSSHKey() bool {
+	return d.KeyPairName != "" && d.SSHKeyPath == d.ResolveStorePath(d.KeyPairName)
+}
+
+// resumeCreate loads the checkpoint of an interrupted create of the machine,
+// if any, and restores the resources it already created
+func (d *Driver) resumeCreate() error {
+	path := d.checkpointPath()
+	data, err := ioutil.ReadFile(filepath.Join(path, "state.json"))
+	if os.IsNotExist(err) || d.StorePath == "" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var previous Driver
+	err = json.Unmarshal(data, &previous)
+	if err != nil {
+		return fmt.Errorf("Invalid create checkpoint %s: %s", path, err)
+	}
+
+	// Report what changed since. Checkpoints saved before the inputs were
+	// recorded only compare the instance settings
+	current := d.provisionInputs()
+	previousInputs := previous.ProvisionInputs
+	if previousInputs == nil {
+		previousInputs = map[string]string{"ProjectID": previous.ProjectID, "RegionName": previous.RegionName, "FlavorID": previous.FlavorID, "ImageID": previous.ImageID}
+		for name := range current {
+			if _, ok := previousInputs[name]; !ok {
+				delete(current, name)
+			}
+		}
+	}
+	changes, destructive := diffInputs(previousInputs, current)
+	if len(changes) > 0 {
+		log.Infof("Changes since the interrupted create of %s, '!' requiring another instance:\n%s", d.MachineName, strings.Join(changes, "\n"))
+	}
+
+	// Resources are only reused for the same instance settings
+	if destructive && !d.Recreate {
+		var resources []string
+		if previous.InstanceID != "" {
+			resources = append(resources, "instance "+previous.InstanceID)
+		}
+		if previous.KeyPairID != "" && previous.ReusedKeyPair == "" {
+			resources = append(resources, "ssh key "+previous.KeyPairID)
+		}
+		return fmt.Errorf("A previous create of %s was interrupted with a different project, region, flavor or image. Select '--ovh-recreate' to delete the resources it created and start from scratch: %s", d.MachineName, strings.Join(resources, ", "))
+	}
+	if destructive {
+		return d.discardCreate(&previous)
+	}
+	if len(changes) > 0 && previous.reached(phaseInstanceRequested) {
+		log.Warnf("The instance of the interrupted create is kept: changes to its first boot script do not apply to it")
+	}
+
+	if previous.CreatePhase == "" {
+		log.Infof("Resuming interrupted create of %s...", d.MachineName)
+	} else {
+		log.Infof("Resuming interrupted create of %s after phase %s...", d.MachineName, previous.CreatePhase)
+	}
+	d.CreatePhase = previous.CreatePhase
+	d.KeyPairName = previous.KeyPairName
+	d.KeyPairID = previous.KeyPairID
+	d.ReusedKeyPair = previous.ReusedKeyPair
+	d.SSHKeyPath = previous.SSHKeyPath
+	d.SSHUser = previous.SSHUser
+	d.CloneSnapshotID = previous.CloneSnapshotID
+	d.CloneImageID = previous.CloneImageID
+	d.InstanceID = previous.InstanceID
+	d.BulkInstanceIDs = previous.BulkInstanceIDs
+	d.CreateRequestedAt = previous.CreateRequestedAt
+	d.WarmPoolClaimed = previous.WarmPoolClaimed
+	d.IPAddress = previous.IPAddress
+	d.PrivateIPAddress = previous.PrivateIPAddress
+	if previous.InstanceGroupPolicy == d.InstanceGroupPolicy && previous.InstanceGroupAnchor == d.InstanceGroupAnchor {
+		d.InstanceGroupID = previous.InstanceGroupID
+	}
+
+	// Restore the generated key
+	if _, err := os.Stat(d.SSHKeyPath); d.generatedSSHKey() && os.IsNotExist(err) {
+		for _, suffix := range []string{"", ".pub"} {
+			if data, err := ioutil.ReadFile(filepath.Join(path, "id"+suffix)); err == nil {
+				err = ioutil.WriteFile(d.SSHKeyPath+suffix, data, 0600)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Start over if the instance is gone in the meantime
+	if d.reached(phaseInstanceRequested) {
+		exists, err := d.client.InstanceExists(d.ProjectID, d.InstanceID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			log.Infof("Instance %s of the interrupted create is gone, creating a new one", d.InstanceID)
+			d.InstanceID = ""
+			d.CreatePhase = phaseKeyEnsured
+		}
+	}
+
+	return nil
+}
+
+// clearCheckpoint deletes the create checkpoint, once the machine is created
+// or removed
+func (d *Driver) clearCheckpoint() {
+	if d.StorePath == "" {
+		return
+	}
+	err := os.RemoveAll(d.checkpointPath())
+	if err != nil {
+		log.Warnf("Could not delete create checkpoint %s: %s", d.checkpointPath(), err)
+	}
+}
+
+// discardCreate deletes the resources of an interrupted create, for a new
+// create to start from scratch with other instance settings
+func (d *Driver) discardCreate(previous *Driver) error {
+	for _, id := range append([]string{previous.InstanceID}, previous.BulkInstanceIDs...) {
+		if id == "" {
+			continue
+		}
+		exists, err := d.client.InstanceExists(previous.ProjectID, id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		log.Infof("Deleting instance %s of the interrupted create...", id)
+		err = d.client.DeleteInstance(previous.ProjectID, id)
+		if err != nil {
+			return err
+		}
+	}
+	if previous.KeyPairID != "" && previous.ReusedKeyPair == "" && !previous.KeepSSHKey {
+		log.Infof("Deleting ssh key %s of the interrupted create...", previous.KeyPairID)
+		if err := d.client.DeleteSshkey(previous.ProjectID, previous.KeyPairID); err != nil {
+			log.Warnf("Could not delete ssh key %s: %s", previous.KeyPairID, err)
+		}
+	}
+	d.clearCheckpoint()
+	return nil
+}
+
+// Markers of the events the driver handles outside of create, in the machine
+// directory. The machine configuration is docker-machine's to save then, and
+// it does not save it for a state query
+const (
+	markerCertsBackedUp = ".ovh-certs-backed-up"
+	markerProvisioned   = ".ovh-provisioned"
+)
+
+// markerPath returns the path of a marker of the machine
+func (d *Driver) markerPath(name string) string {
+	return filepath.Join(d.StorePath, "machines", d.MachineName, name)
+}
+
+// readMarker returns the content of a marker, empty when it is not set
+func (d *Driver) readMarker(name string) string {
+	data, err := ioutil.ReadFile(d.markerPath(name))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// writeMarker sets a marker, with its content
+func (d *Driver) writeMarker(name, content string) error {
+	return writeFileAtomic(d.markerPath(name), []byte(content))
+}
+
+// claimMarker sets a marker unless it is set already, telling whether this
+// call set it, for events to handle once among concurrent commands
+func (d *Driver) claimMarker(name string) bool {
+	file, err := os.OpenFile(d.markerPath(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return false
+	}
+	file.Close()
+	return true
+}
+
+// clearMarker unsets a marker
+func (d *Driver) clearMarker(name string) {
+	if err := os.Remove(d.markerPath(name)); err != nil && !os.IsNotExist(err) {
+		log.Debugf("Could not remove marker %s of %s: %s", name, d.MachineName, err)
+	}
+}
+
+// writeFileAtomic replaces a file at once
+func writeFileAtomic(path string, data []byte) error {
+	err := ioutil.WriteFile(path+".tmp", data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// loadCloneSource finds the machine to clone. The clone lives in the project
+// of the machine, which holds its snapshot, on its private network and with
+// its SSH user. Its region and flavor are those of the options, a clone in
+// another region booting from a copy of the snapshot
+func (d *Driver) loadCloneSource() (*Driver, error) {
+	machines, err := d.storedMachines()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, source := range machines {
+		if source.MachineName != d.CloneFrom {
+			continue
+		}
+		if source.InstanceID == "" {
+			return nil, fmt.Errorf("Machine '%s' has no instance to clone", d.CloneFrom)
+		}
+		if err := d.checkNamespace("Clone source instance", source.instanceName()); err != nil {
+			return nil, err
+		}
+		if source.Endpoint != "" && endpointURL(source.Endpoint) != endpointURL(d.Endpoint) {
+			return nil, fmt.Errorf("Machine '%s' lives in project %s on %s while this machine uses %s. Please select the same endpoint and credentials with '--ovh-endpoint'", d.CloneFrom, source.ProjectID, endpointURL(source.Endpoint), endpointURL(d.Endpoint))
+		}
+
+		d.ProjectName = source.ProjectID
+		d.PrivateNetworkName = source.PrivateNetworkName
+		d.SSHUser = source.SSHUser
+		return source, nil
+	}
+
+	return nil, fmt.Errorf("Machine '%s' could not be found or is not an OVH machine", d.CloneFrom)
+}
+
+// selectCloneImage selects the image of the machine to clone, for the image
+// checks of the clone: by id in the same region, by name in another one,
+// where the copy of the snapshot needs the OpenStack image API
+func (d *Driver) selectCloneImage(client *API, source *Driver) error {
+	if source.RegionName == d.RegionName {
+		d.ImageID = source.ImageID
+		return nil
+	}
+
+	images, err := client.GetImages(d.ProjectID, source.RegionName)
+	if err != nil {
+		return err
+	}
+	image, err := matchImage(images, source.ImageID, false)
+	if err != nil {
+		return fmt.Errorf("Could not find image %s of machine '%s' in region %s: %s", source.ImageID, source.MachineName, source.RegionName, err)
+	}
+	d.ImageID = image.Name
+
+	o, err := d.openStack(fmt.Sprintf("Cloning machine '%s' from region %s", source.MachineName, source.RegionName))
+	if err != nil {
+		return err
+	}
+	for _, region := range []string{source.RegionName, d.RegionName} {
+		if _, ok := o.endpoints("image")[region]; !ok {
+			return fmt.Errorf("No OpenStack image endpoint found for region %s", region)
+		}
+	}
+	return nil
+}
+
+// bootImageID returns the image the instance boots from: the snapshot of the
+// clone source, or its copy in another region, or else the selected image
+func (d *Driver) bootImageID() string {
+	if d.CloneImageID != "" {
+		return d.CloneImageID
+	}
+	if d.CloneSnapshotID != "" {
+		return d.CloneSnapshotID
+	}
+	return d.ImageID
+}
+
+// snapshotCloneSource snapshots the machine to clone, and copies the
+// snapshot to the region of the clone. Each image is saved in the machine
+// configuration as soon as it exists, so that removing the machine deletes it
+// when the create fails
+func (d *Driver) snapshotCloneSource() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	source, err := d.loadCloneSource()
+	if err != nil {
+		return err
+	}
+
+	if d.CloneSnapshotID == "" {
+		snapshotName := d.snapshotName("clone-of-" + source.MachineName)
+		log.Infof("Snapshotting machine %s...", source.MachineName)
+		err = client.CreateSnapshot(d.ProjectID, source.InstanceID, snapshotName)
+		if err != nil {
+			return err
+		}
+
+		snapshot, err := d.waitForSnapshot(client, source.RegionName, snapshotName)
+		if snapshot != nil {
+			d.CloneSnapshotID = snapshot.ID
+			if err := d.checkpoint(d.CreatePhase); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Snapshot of machine %s failed: %s", source.MachineName, err)
+		}
+	}
+
+	if source.RegionName != d.RegionName && d.CloneImageID == "" {
+		err = d.copyCloneSnapshot(source.RegionName)
+		if err != nil {
+			return fmt.Errorf("Could not copy the snapshot of machine %s to region %s: %s", source.MachineName, d.RegionName, err)
+		}
+	}
+	return nil
+}
+
+// copyCloneSnapshot copies the snapshot of the clone source from its region
+// to the region of the clone, through this host, with the OpenStack image API
+func (d *Driver) copyCloneSnapshot(sourceRegion string) error {
+	o, err := d.openStack("Cloning a machine to another region")
+	if err != nil {
+		return err
+	}
+	from := o.endpoints("image")[sourceRegion]
+	to := o.endpoints("image")[d.RegionName]
+	if from == "" || to == "" {
+		return fmt.Errorf("No OpenStack image endpoint found for regions %s and %s", sourceRegion, d.RegionName)
+	}
+
+	var snapshot struct {
+		Name            string `json:"name"`
+		DiskFormat      string `json:"disk_format"`
+		ContainerFormat string `json:"container_format"`
+		MinDisk         int    `json:"min_disk"`
+		MinRAM          int    `json:"min_ram"`
+	}
+	_, err = o.call("GET", from+"/v2/images/"+d.CloneSnapshotID, nil, &snapshot)
+	if err != nil {
+		return err
+	}
+
+	var image struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	req := map[string]interface{}{
+		"name":             snapshot.Name,
+		"disk_format":      snapshot.DiskFormat,
+		"container_format": snapshot.ContainerFormat,
+		"min_disk":         snapshot.MinDisk,
+		"min_ram":          snapshot.MinRAM,
+		"visibility":       "private",
+	}
+	_, err = o.call("POST", to+"/v2/images", req, &image)
+	if err != nil {
+		return err
+	}
+	d.CloneImageID = image.ID
+	err = d.checkpoint(d.CreatePhase)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Copying snapshot %s from region %s to region %s, which may take a while...", d.CloneSnapshotID, sourceRegion, d.RegionName)
+	err = o.transfer(from+"/v2/images/"+d.CloneSnapshotID+"/file", to+"/v2/images/"+d.CloneImageID+"/file")
+	if err != nil {
+		return err
+	}
+
+	return waitWithBackoff(func() (bool, error) {
+		_, err := o.call("GET", to+"/v2/images/"+d.CloneImageID, nil, &image)
+		if err != nil {
+			return true, err
+		}
+		if image.Status == "killed" || image.Status == "deleted" {
+			return true, fmt.Errorf("image %s is %s", d.CloneImageID, image.Status)
+		}
+		return image.Status == "active", nil
+	})
+}
+
+// transfer streams the data of a GET to a PUT, without the timeout of API
+// calls as images take minutes to transfer
+func (o *openStack) transfer(from, to string) error {
+	client := &http.Client{Transport: o.client.Transport}
+
+	req, err := http.NewRequest("GET", from, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Auth-Token", o.token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return &openStackError{Code: resp.StatusCode, Message: fmt.Sprintf("GET %s: %s", req.URL.Path, resp.Status)}
+	}
+
+	put, err := http.NewRequest("PUT", to, resp.Body)
+	if err != nil {
+		return err
+	}
+	put.ContentLength = resp.ContentLength
+	put.Header.Set("X-Auth-Token", o.token)
+	put.Header.Set("Content-Type", "application/octet-stream")
+	putResp, err := client.Do(put)
+	if err != nil {
+		return err
+	}
+	defer putResp.Body.Close()
+	io.Copy(ioutil.Discard, putResp.Body)
+	if putResp.StatusCode >= 300 {
+		return &openStackError{Code: putResp.StatusCode, Message: fmt.Sprintf("PUT %s: %s", put.URL.Path, putResp.Status)}
+	}
+	return nil
+}
+
+// deleteCloneSnapshot deletes the snapshot, and its copy, once the clone
+// booted from it. Failures are reported only, removing the machine deletes
+// what remains
+func (d *Driver) deleteCloneSnapshot() {
+	if err := d.deleteCloneImages(); err != nil {
+		log.Warnf("Could not delete the snapshot of the clone: %s", err)
+	}
+}
+
+// deleteCloneImages deletes the copy of the snapshot, then the snapshot
+func (d *Driver) deleteCloneImages() error {
+	if d.CloneImageID != "" {
+		o, err := d.openStack("Deleting the copy of the clone snapshot")
+		if err != nil {
+			return err
+		}
+		endpoint, ok := o.endpoints("image")[d.RegionName]
+		if !ok {
+			return fmt.Errorf("No OpenStack image endpoint found for region %s", d.RegionName)
+		}
+		_, err = o.call("DELETE", endpoint+"/v2/images/"+d.CloneImageID, nil, nil)
+		if apierror, ok := err.(*openStackError); ok && apierror.Code == 404 {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		d.CloneImageID = ""
+	}
+
+	if d.CloneSnapshotID != "" {
+		client, err := d.getClient()
+		if err != nil {
+			return err
+		}
+		err = client.DeleteSnapshot(d.ProjectID, d.CloneSnapshotID)
+		if err != nil {
+			return err
+		}
+		d.CloneSnapshotID = ""
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// clusterHostsScript replaces the driver managed block of /etc/hosts
+const clusterHostsScript = `sudo sed -i '/^# BEGIN docker-machine-driver-ovh cluster/,/^# END docker-machine-driver-ovh cluster/d' /etc/hosts
+printf '%%s\n' '# BEGIN docker-machine-driver-ovh cluster %[1]s' %[2]s '# END docker-machine-driver-ovh cluster' | sudo tee -a /etc/hosts >/dev/null
+`
+
+// clusterAddress returns the address peers use to reach the machine: the
+// WireGuard mesh one, or the private network one when available
+func (d *Driver) clusterAddress() string {
+	if d.WireGuardAddress != "" {
+		return d.WireGuardAddress
+	}
+	if d.PrivateIPAddress != "" {
+		return d.PrivateIPAddress
+	}
+	return d.IPAddress
+}
+
+// clusterPeers returns the other machines of the store sharing the cluster label
+func (d *Driver) clusterPeers() ([]*Driver, error) {
+	machines, err := d.storedMachines()
+	if err != nil {
+		return nil, err
+	}
+
+	var peers []*Driver
+	for _, machine := range machines {
+		if machine.Cluster == d.Cluster && machine.clusterAddress() != "" {
+			peers = append(peers, machine)
+		}
+	}
+	return peers, nil
+}
+
+// clusterHostsBlock renders the /etc/hosts update for a set of machines
+func clusterHostsBlock(cluster string, machines []*Driver) string {
+	var lines []string
+	for _, machine := range machines {
+		lines = append(lines, fmt.Sprintf("'%s %s'", machine.clusterAddress(), machine.MachineName))
+	}
+	sort.Strings(lines)
+	return fmt.Sprintf(clusterHostsScript, cluster, strings.Join(lines, " "))
+}
+
+// updateClusterHosts pushes the /etc/hosts block mapping cluster members to
+// their addresses on the machine and on its peers. When removed, the machine
+// is left out of the block. Peers that cannot be reached are only reported
+func (d *Driver) updateClusterHosts(removed bool) error {
+	peers, err := d.clusterPeers()
+	if err != nil {
+		return err
+	}
+
+	members := peers
+	if !removed {
+		members = append(members, d)
+		log.Infof("Adding %s to /etc/hosts of cluster %s...", d.MachineName, d.Cluster)
+		err = drivers.WaitForSSH(d)
+		if err != nil {
+			return err
+		}
+		_, err = drivers.RunSSHCommandFromDriver(d, clusterHostsBlock(d.Cluster, members))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, peer := range peers {
+		_, err := drivers.RunSSHCommandFromDriver(peer, clusterHostsBlock(d.Cluster, members))
+		if err != nil {
+			log.Warnf("Could not update /etc/hosts of cluster peer %s: %s", peer.MachineName, err)
+		}
+	}
+	return nil
+}
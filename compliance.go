@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Compliance frameworks machines may be restricted to
+const (
+	ComplianceHDS         = "hds"
+	ComplianceSecNumCloud = "secnumcloud"
+)
+
+// complianceLabel records the compliance framework of the machine in its
+// instance metadata and engine labels
+const complianceLabel = "ovh-compliance"
+
+// complianceFrameworks are the valid values of '--ovh-compliance'. The OVH
+// API publishes no certification per region or flavor, and the certified
+// offerings depend on the contract, so their regions and flavors must be
+// given with '--ovh-compliant-region' and '--ovh-compliant-flavor'
+var complianceFrameworks = []string{ComplianceHDS, ComplianceSecNumCloud}
+
+// validateCompliance checks the framework, and that its regions and flavors
+// are given
+func (c *Config) validateCompliance() error {
+	if c.Compliance == "" {
+		return nil
+	}
+	if !containsString(complianceFrameworks, c.Compliance) {
+		return fmt.Errorf("Invalid compliance '%s'. Please select one of '%s', '%s'", c.Compliance, ComplianceHDS, ComplianceSecNumCloud)
+	}
+	if len(c.CompliantRegions) == 0 {
+		return fmt.Errorf("The %s regions depend on the contract of the project. Please list them with '--ovh-compliant-region'", c.Compliance)
+	}
+	if len(c.CompliantFlavors) == 0 {
+		return fmt.Errorf("The %s flavors depend on the contract of the project. Please list them with '--ovh-compliant-flavor'", c.Compliance)
+	}
+	return nil
+}
+
+// regionHasPrefix tells whether region is prefix, or a region of its
+// datacenter such as GRA7 or RBX-A for GRA and RBX
+func regionHasPrefix(region, prefix string) bool {
+	if !strings.HasPrefix(region, prefix) {
+		return false
+	}
+	rest := strings.TrimPrefix(region, prefix)
+	return rest == "" || strings.ContainsAny(rest[:1], "0123456789-")
+}
+
+// complianceRegions returns the regions of the list compliant with the
+// selected framework, all of them when there is none
+func (d *Driver) complianceRegions(regions Regions) (Regions, error) {
+	if d.Compliance == "" {
+		return regions, nil
+	}
+	if len(d.CompliantRegions) == 0 {
+		return nil, fmt.Errorf("The %s regions depend on the contract of the project. Please list them with '--ovh-compliant-region'", d.Compliance)
+	}
+
+	var compliant Regions
+	for _, region := range regions {
+		for _, prefix := range d.CompliantRegions {
+			if regionHasPrefix(region, prefix) {
+				compliant = append(compliant, region)
+				break
+			}
+		}
+	}
+	sort.Strings(compliant)
+	if len(compliant) == 0 {
+		return nil, fmt.Errorf("Project %s has no %s region", d.ProjectID, d.Compliance)
+	}
+	return compliant, nil
+}
+
+// checkComplianceFlavor checks that the flavor is one of the compliant ones,
+// given by name or by family such as b3 for b3-8 and b3-8-flex
+func (d *Driver) checkComplianceFlavor(flavor *Flavor) error {
+	if d.Compliance == "" {
+		return nil
+	}
+	for _, compliant := range d.CompliantFlavors {
+		if flavor.Name == compliant || strings.HasPrefix(flavor.Name, compliant+"-") {
+			return nil
+		}
+	}
+	return fmt.Errorf("Flavor '%s' is not %s compliant. Please select one of %s with '--ovh-flavor'", flavor.Name, d.Compliance, strings.Join(d.CompliantFlavors, ", "))
+}
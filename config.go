@@ -0,0 +1,478 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+// Config holds the command line parameters of the driver. It is filled from
+// flags, and its Validate method checks them without calling any API, so
+// that the driver may also be configured programmatically
+type Config struct {
+	ProjectName        string
+	FlavorName         string
+	RegionName         string
+	LatencyProbe       string
+	Compliance         string
+	CompliantRegions   []string
+	CompliantFlavors   []string
+	PrivateNetworkName string
+	NoPublicNetwork    bool
+	PortSecurity       string
+
+	// Ovh specific parameters
+	BillingPeriod string
+	Endpoint      string
+	PollEndpoint  string
+
+	// Gateway fronting the API, and headers it requires. Header values are
+	// not saved, only their names
+	APIBaseURL     string
+	APIHeaders     []string `json:"-"`
+	APIHeaderNames []string
+
+	// Catalog bundle to validate against
+	CatalogBundle string
+
+	// Minimum public bandwidth of the flavor, in Mbps
+	MinBandwidth int
+
+	// Public IP ranges to avoid, and instances to try before giving up
+	ExcludedIPRanges []string
+	IPAttempts       int
+
+	// Sandbox flavors opt-in for production machines
+	AllowSandbox      bool
+	ProductionPattern string
+
+	// Flex variant of the flavor
+	Flex bool
+
+	// Deprecated flavors handling
+	DeprecatedFlavors        string
+	DeprecatedFlavorFamilies []string
+
+	// Required flavor capabilities
+	RequiredCapabilities []string
+
+	APITimeout         int
+	MaintenanceWait    int
+	KeepSSHKey         bool
+	AuthorizedKeysFile string
+	DeleteOnInterrupt  bool
+	Recreate           bool
+	OnStop             string
+	SameHostAs         string
+	DifferentHostThan  string
+	BudgetWarn         int
+	BudgetAlertEmail   string
+	PortID             string
+	WarmPool           string
+	WarmPoolSize       int
+	Vrack              string
+	ReconcileAddress   bool
+	IAMTags            bool
+	SSHAgentForwarding bool
+	FixSudoers         bool
+	CheckSMTP          bool
+	FuzzyImage         bool
+	RootPassword       bool
+	ArtifactsContainer string
+	WebhookURL         string
+	ArtifactsRegion    string
+	EgressLimitMbps    int
+	OfficeHours        string
+	SSHKeyType         string
+	SSHKeyBits         int
+	RebootWindow       string
+	PrivateMTU         int
+	DefaultRoute       string
+	TuningProfile      string
+	Harden             bool
+	GrowRoot           bool
+	DockerMTU          bool
+	EngineEnv          []string
+	RegistryCAFiles    []string
+	InsecureRegistries []string
+
+	// Docker data volume size and encryption
+	DataVolumeSize int
+	VolumeEncrypt  bool
+	VolumeKeyURL   string
+
+	// Instance name derived from an invalid machine name
+	SanitizeName bool
+
+	// Prefix of the names of the resources created by the driver
+	NamePrefix string
+
+	// Labels of the instance metadata and docker engine
+	LabelOptions []string
+
+	// Load balancer pools the machine joins
+	LoadBalancerOptions []string
+
+	// User replacing the image default user once the machine is up
+	RuntimeSSHUser string
+
+	// Watchdog rebooting the machine on failure
+	AutoRecover bool
+
+	// Shelve instead of deleting on removal, and hours before purging
+	SoftRemove          bool
+	SoftRemoveRetention int
+
+	// Snapshots created by the driver
+	SnapshotOnRemove      bool
+	SnapshotRetentionDays int
+	SnapshotKeep          int
+
+	// Clone source
+	CloneFrom string
+
+	// Instance backup to restore
+	RestoreBackup string
+
+	// Machines created at once
+	Count int
+
+	// Cluster membership
+	Cluster      string
+	ClusterHosts bool
+	DNSZone      string
+
+	// WireGuard mesh membership, and its subnet
+	WireGuardMesh   string
+	WireGuardSubnet string
+
+	// Docker port allowed sources
+	DockerAllowedCIDRs []string
+
+	// Overloaded credentials. The secrets are never saved, later operations
+	// read them from the environment or ovh.conf
+	ApplicationKey    string
+	ApplicationSecret string `json:"-"`
+	ConsumerKey       string `json:"-"`
+}
+
+// SetFromFlags assigns the command line parameters as-is
+func (c *Config) SetFromFlags(flags drivers.DriverOptions) {
+	c.ApplicationKey = flags.String("ovh-application-key")
+	c.ApplicationSecret = flags.String("ovh-application-secret")
+	c.ConsumerKey = flags.String("ovh-consumer-key")
+	c.Endpoint = flags.String("ovh-endpoint")
+	c.APITimeout = flags.Int("ovh-api-timeout")
+	c.MaintenanceWait = flags.Int("ovh-api-maintenance-wait")
+	c.PollEndpoint = flags.String("ovh-polling-endpoint")
+	c.APIBaseURL = flags.String("ovh-api-base-url")
+	c.APIHeaders = flags.StringSlice("ovh-api-header")
+	c.CatalogBundle = flags.String("ovh-catalog-bundle")
+	c.ProjectName = flags.String("ovh-project")
+	c.RegionName = flags.String("ovh-region")
+	c.LatencyProbe = flags.String("ovh-latency-probe")
+	c.Compliance = flags.String("ovh-compliance")
+	c.CompliantRegions = flags.StringSlice("ovh-compliant-region")
+	c.CompliantFlavors = flags.StringSlice("ovh-compliant-flavor")
+	c.FlavorName = flags.String("ovh-flavor")
+	c.Flex = flags.Bool("ovh-flex")
+	c.DeprecatedFlavors = flags.String("ovh-deprecated-flavors")
+	c.DeprecatedFlavorFamilies = flags.StringSlice("ovh-deprecated-flavor")
+	c.PrivateNetworkName = flags.String("ovh-private-network")
+	c.NoPublicNetwork = flags.Bool("ovh-no-public-network")
+	c.PortSecurity = flags.String("ovh-port-security")
+	c.SSHKeyType = flags.String("ovh-ssh-key-type")
+	c.SSHKeyBits = flags.Int("ovh-ssh-key-bits")
+	c.BillingPeriod = flags.String("ovh-billing-period")
+	c.MinBandwidth = flags.Int("ovh-min-bandwidth")
+	c.ExcludedIPRanges = flags.StringSlice("ovh-exclude-ip-ranges")
+	c.IPAttempts = flags.Int("ovh-ip-attempts")
+	c.RequiredCapabilities = flags.StringSlice("ovh-require-capability")
+	c.AllowSandbox = flags.Bool("ovh-allow-sandbox")
+	c.ProductionPattern = flags.String("ovh-production-pattern")
+	c.KeepSSHKey = flags.Bool("ovh-keep-ssh-key")
+	c.Recreate = flags.Bool("ovh-recreate")
+	c.OnStop = flags.String("ovh-on-stop")
+	c.SameHostAs = flags.String("ovh-same-host-as")
+	c.DifferentHostThan = flags.String("ovh-different-host-than")
+	c.BudgetWarn = flags.Int("ovh-budget-warn")
+	c.BudgetAlertEmail = flags.String("ovh-budget-alert-email")
+	c.PortID = flags.String("ovh-port-id")
+	c.WarmPool = flags.String("ovh-warm-pool")
+	c.WarmPoolSize = flags.Int("ovh-warm-pool-size")
+	c.Vrack = flags.String("ovh-vrack")
+	c.ReconcileAddress = flags.Bool("ovh-reconcile-address")
+	c.IAMTags = flags.Bool("ovh-iam-tags")
+	c.SSHAgentForwarding = flags.Bool("ovh-ssh-agent-forwarding")
+	c.AuthorizedKeysFile = flags.String("ovh-authorized-keys-file")
+	c.DeleteOnInterrupt = flags.Bool("ovh-delete-on-interrupt")
+	c.FixSudoers = flags.Bool("ovh-fix-sudoers")
+	c.CheckSMTP = flags.Bool("ovh-check-smtp")
+	c.FuzzyImage = flags.Bool("ovh-fuzzy-image")
+	c.RootPassword = flags.Bool("ovh-root-password")
+	c.EgressLimitMbps = flags.Int("ovh-egress-limit-mbps")
+	c.OfficeHours = flags.String("ovh-office-hours")
+	c.ArtifactsContainer = flags.String("ovh-artifacts-container")
+	c.WebhookURL = flags.String("ovh-webhook-url")
+	c.ArtifactsRegion = flags.String("ovh-artifacts-region")
+	c.SoftRemove = flags.Bool("ovh-soft-remove")
+	c.AutoRecover = flags.Bool("ovh-auto-recover")
+	c.SoftRemoveRetention = flags.Int("ovh-soft-remove-retention")
+	c.SnapshotOnRemove = flags.Bool("ovh-snapshot-on-remove")
+	c.SnapshotRetentionDays = flags.Int("ovh-snapshot-retention-days")
+	c.SnapshotKeep = flags.Int("ovh-snapshot-keep")
+	c.RebootWindow = flags.String("ovh-reboot-window")
+	c.DataVolumeSize = flags.Int("ovh-docker-data-volume")
+	c.VolumeEncrypt = flags.Bool("ovh-volume-encrypt")
+	c.VolumeKeyURL = flags.String("ovh-volume-key-url")
+	c.PrivateMTU = flags.Int("ovh-private-mtu")
+	c.DefaultRoute = flags.String("ovh-default-route")
+	c.DockerMTU = flags.Bool("ovh-docker-mtu")
+	c.EngineEnv = flags.StringSlice("ovh-engine-env")
+	c.RegistryCAFiles = flags.StringSlice("ovh-registry-ca-file")
+	c.InsecureRegistries = flags.StringSlice("ovh-insecure-registry")
+	c.TuningProfile = flags.String("ovh-tuning-profile")
+	c.Harden = flags.Bool("ovh-harden")
+	c.GrowRoot = !flags.Bool("ovh-no-grow-root")
+	c.CloneFrom = flags.String("ovh-clone-from")
+	c.RestoreBackup = flags.String("ovh-restore-backup")
+	c.Count = flags.Int("ovh-count")
+	c.Cluster = flags.String("ovh-cluster")
+	c.LabelOptions = flags.StringSlice("ovh-labels")
+	c.LoadBalancerOptions = flags.StringSlice("ovh-loadbalancer")
+	c.ClusterHosts = flags.Bool("ovh-cluster-hosts")
+	c.DNSZone = flags.String("ovh-dns-zone")
+	c.WireGuardMesh = flags.String("ovh-wireguard-mesh")
+	c.WireGuardSubnet = flags.String("ovh-wireguard-subnet")
+	c.DockerAllowedCIDRs = flags.StringSlice("ovh-docker-allowed-cidrs")
+	c.SanitizeName = flags.Bool("ovh-sanitize-name")
+	c.NamePrefix = flags.String("ovh-name-prefix")
+	c.RuntimeSSHUser = flags.String("ovh-runtime-ssh-user")
+}
+
+// Validate checks the ranges, values and combinations of the parameters.
+// Checks needing the API or the machine store are left to PreCreateCheck
+func (c *Config) Validate() error {
+	// Validate billing period
+	if c.BillingPeriod != "monthly" && c.BillingPeriod != "hourly" {
+		return fmt.Errorf("Invalid billing period '%s'. Please select one of 'hourly', 'monthly'", c.BillingPeriod)
+	}
+
+	// Validate numeric ranges
+	if c.APITimeout < 1 {
+		return fmt.Errorf("Invalid API timeout %d. Please select a number of seconds with '--ovh-api-timeout'", c.APITimeout)
+	}
+	if c.MaintenanceWait < 0 {
+		return fmt.Errorf("Invalid API maintenance wait %d. Please select a number of minutes with '--ovh-api-maintenance-wait'", c.MaintenanceWait)
+	}
+	if c.APIBaseURL != "" {
+		if err := validateAPIBaseURL(c.APIBaseURL); err != nil {
+			return err
+		}
+		if c.PollEndpoint != "" {
+			return fmt.Errorf("'--ovh-polling-endpoint' would bypass the gateway of '--ovh-api-base-url'")
+		}
+	}
+	if _, err := parseAPIHeaders(c.APIHeaders); err != nil {
+		return err
+	}
+	if !validOnStop(c.OnStop) {
+		return fmt.Errorf("Invalid stop behavior '%s'. Please select one of '%s', '%s', '%s' with '--ovh-on-stop'", c.OnStop, OnStopStop, OnStopShelve, OnStopDelete)
+	}
+	if err := validateFlavorAlias(c.FlavorName); err != nil {
+		return err
+	}
+	if err := c.validateWarmPool(); err != nil {
+		return err
+	}
+	if c.Vrack != "" && c.PrivateNetworkName == "" {
+		return fmt.Errorf("'--ovh-vrack' attaches the project to a vRack for its private network. Please select the network with '--ovh-private-network'")
+	}
+	if c.BudgetWarn < 0 {
+		return fmt.Errorf("Invalid budget %d. Please select a monthly amount with '--ovh-budget-warn'", c.BudgetWarn)
+	}
+	if c.BudgetAlertEmail != "" {
+		if !strings.Contains(c.BudgetAlertEmail, "@") {
+			return fmt.Errorf("Invalid email '%s'. Please select the address of the billing alert with '--ovh-budget-alert-email'", c.BudgetAlertEmail)
+		}
+		if c.BudgetWarn == 0 {
+			return fmt.Errorf("'--ovh-budget-alert-email' requires the monthly threshold of the alert. Please select it with '--ovh-budget-warn'")
+		}
+	}
+	if c.MinBandwidth < 0 {
+		return fmt.Errorf("Invalid minimum bandwidth %d. Please select a number of Mbps with '--ovh-min-bandwidth'", c.MinBandwidth)
+	}
+	if c.DataVolumeSize < 0 {
+		return fmt.Errorf("Invalid docker data volume size %d. Please select a number of GB with '--ovh-docker-data-volume'", c.DataVolumeSize)
+	}
+	if c.SoftRemove && c.SoftRemoveRetention < 0 {
+		return fmt.Errorf("Invalid soft removal retention %d. Please select a number of hours with '--ovh-soft-remove-retention'", c.SoftRemoveRetention)
+	}
+	if c.SnapshotRetentionDays < 0 {
+		return fmt.Errorf("Invalid snapshot retention %d. Please select a number of days with '--ovh-snapshot-retention-days'", c.SnapshotRetentionDays)
+	}
+	if c.SnapshotKeep < 0 {
+		return fmt.Errorf("Invalid number of snapshots kept %d. Please select a number with '--ovh-snapshot-keep'", c.SnapshotKeep)
+	}
+	err := c.validateEgressLimit()
+	if err != nil {
+		return err
+	}
+
+	// Validate enumerations and formats
+	err = validateTuningProfile(c.TuningProfile)
+	if err != nil {
+		return err
+	}
+	err = validateSSHKeyType(c.SSHKeyType, c.SSHKeyBits)
+	if err != nil {
+		return err
+	}
+	if c.RebootWindow != "" {
+		_, err = parseRebootWindow(c.RebootWindow)
+		if err != nil {
+			return err
+		}
+	}
+	if c.OfficeHours != "" {
+		_, err = parseOfficeHours(c.OfficeHours)
+		if err != nil {
+			return err
+		}
+	}
+	if c.ProductionPattern != "" {
+		_, err = regexp.Compile(c.ProductionPattern)
+		if err != nil {
+			return fmt.Errorf("Invalid production name pattern '%s': %s", c.ProductionPattern, err)
+		}
+	}
+	if c.DeprecatedFlavors != DeprecatedFlavorsWarn && c.DeprecatedFlavors != DeprecatedFlavorsFail {
+		return fmt.Errorf("Invalid deprecated flavors handling '%s'. Please select one of '%s', '%s'", c.DeprecatedFlavors, DeprecatedFlavorsWarn, DeprecatedFlavorsFail)
+	}
+	_, err = c.flavorFamilies()
+	if err != nil {
+		return err
+	}
+	err = c.validateCompliance()
+	if err != nil {
+		return err
+	}
+	err = c.validateExcludedIPRanges()
+	if err != nil {
+		return err
+	}
+	err = validateEngineEnv(c.EngineEnv)
+	if err != nil {
+		return err
+	}
+	_, err = parseLabels(c.LabelOptions)
+	if err != nil {
+		return err
+	}
+	for _, option := range c.LoadBalancerOptions {
+		if _, err := parseLoadBalancerPool(option); err != nil {
+			return err
+		}
+	}
+	if c.WebhookURL != "" {
+		u, err := url.Parse(c.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid webhook URL '%s'. Expected an http or https URL", c.WebhookURL)
+		}
+	}
+
+	// Validate data volume encryption
+	if c.VolumeEncrypt && c.DataVolumeSize == 0 {
+		return fmt.Errorf("'--ovh-volume-encrypt' requires a docker data volume. Please select its size with '--ovh-docker-data-volume'")
+	}
+	if c.VolumeKeyURL != "" {
+		u, err := url.Parse(c.VolumeKeyURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" || strings.Contains(c.VolumeKeyURL, "'") {
+			return fmt.Errorf("Invalid volume key URL '%s'. Expected an https URL", c.VolumeKeyURL)
+		}
+		if !c.VolumeEncrypt {
+			return fmt.Errorf("'--ovh-volume-key-url' requires '--ovh-volume-encrypt'")
+		}
+	}
+
+	// Validate private network settings
+	if c.PrivateNetworkName == "" {
+		switch {
+		case c.NoPublicNetwork:
+			return fmt.Errorf("'--ovh-no-public-network' requires a private network. Please select one with '--ovh-private-network'")
+		case c.PortSecurity == PortSecurityOff:
+			return fmt.Errorf("'--ovh-port-security' requires a private network. Please select one with '--ovh-private-network'")
+		case c.DefaultRoute != "":
+			return fmt.Errorf("'--ovh-default-route' requires a private network. Please select one with '--ovh-private-network'")
+		case c.PrivateMTU != 0:
+			return fmt.Errorf("'--ovh-private-mtu' requires a private network. Please select one with '--ovh-private-network'")
+		}
+	}
+	if c.PortSecurity != PortSecurityOn && c.PortSecurity != PortSecurityOff {
+		return fmt.Errorf("Invalid port security '%s'. Please select one of '%s', '%s'", c.PortSecurity, PortSecurityOn, PortSecurityOff)
+	}
+	if c.DefaultRoute != "" && c.DefaultRoute != DefaultRoutePublic && c.DefaultRoute != DefaultRoutePrivate {
+		return fmt.Errorf("Invalid default route '%s'. Please select one of '%s', '%s'", c.DefaultRoute, DefaultRoutePublic, DefaultRoutePrivate)
+	}
+	if c.DefaultRoute == DefaultRoutePublic && c.NoPublicNetwork {
+		return fmt.Errorf("'--ovh-default-route %s' cannot be combined with '--ovh-no-public-network'", DefaultRoutePublic)
+	}
+	if c.PrivateMTU != 0 && (c.PrivateMTU < 576 || c.PrivateMTU > 9000) {
+		return fmt.Errorf("Invalid private network MTU %d. Please select a value between 576 and 9000", c.PrivateMTU)
+	}
+	if c.DockerMTU && c.PrivateMTU == 0 {
+		return fmt.Errorf("'--ovh-docker-mtu' requires '--ovh-private-mtu'")
+	}
+
+	// Validate mutually exclusive options
+	if c.CloneFrom != "" && c.RestoreBackup != "" {
+		return fmt.Errorf("'--ovh-clone-from' and '--ovh-restore-backup' are mutually exclusive")
+	}
+	if c.Count < 1 {
+		return fmt.Errorf("Invalid machine count %d. Please select at least 1 with '--ovh-count'", c.Count)
+	}
+	if options := c.perMachineOptions(); c.Count > 1 && len(options) > 0 {
+		return fmt.Errorf("'--ovh-count' cannot be combined with %s, which need a create of each machine. Please create the machines one by one", strings.Join(options, ", "))
+	}
+	if c.WireGuardSubnet != "" {
+		if c.WireGuardMesh == "" {
+			return fmt.Errorf("'--ovh-wireguard-subnet' requires a mesh to join. Please select one with '--ovh-wireguard-mesh'")
+		}
+		if err := validateWireGuardSubnet(c.WireGuardSubnet); err != nil {
+			return err
+		}
+	}
+	if c.DNSZone != "" && !validHostname.MatchString(c.Cluster) {
+		return fmt.Errorf("'--ovh-dns-zone' publishes records under the cluster subdomain and requires a cluster label made of letters, digits and hyphens. Please set one with '--ovh-cluster'")
+	}
+	return nil
+}
+
+// perMachineOptions returns the options set that the additional machines of
+// a bulk create would miss: they share the create request of the machine, and
+// are registered once up, without the steps of a create
+func (c *Config) perMachineOptions() []string {
+	var options []string
+	add := func(set bool, option string) {
+		if set {
+			options = append(options, "'--"+option+"'")
+		}
+	}
+	add(len(c.ExcludedIPRanges) > 0, "ovh-exclude-ip-ranges")
+	add(c.PortID != "", "ovh-port-id")
+	add(c.WarmPool != "", "ovh-warm-pool")
+	add(c.CloneFrom != "", "ovh-clone-from")
+	add(c.RootPassword, "ovh-root-password")
+	add(c.RuntimeSSHUser != "", "ovh-runtime-ssh-user")
+	add(c.AutoRecover, "ovh-auto-recover")
+	add(c.OfficeHours != "", "ovh-office-hours")
+	add(c.WireGuardMesh != "", "ovh-wireguard-mesh")
+	add(c.ClusterHosts, "ovh-cluster-hosts")
+	add(c.DNSZone != "", "ovh-dns-zone")
+	add(c.DataVolumeSize > 0, "ovh-docker-data-volume")
+	add(len(c.LoadBalancerOptions) > 0, "ovh-loadbalancer")
+	return options
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/ovh/go-ovh/ovh"
+)
+
+const (
+	// createGuardSkew tolerates a clock of the host running docker-machine
+	// ahead of the OVH one when matching instance creation times
+	createGuardSkew = 5 * time.Minute
+
+	// createGuardWait is how long an instance requested by a call which got
+	// no answer may take to be listed
+	createGuardWait = time.Minute
+)
+
+// requestedInstance returns the instance created by a previous request of the
+// machine, which got no answer: the only instance with the instance name in
+// the region created since the request. The OVH API takes no idempotency key
+// nor metadata on create, the name and request time are the guard
+func (d *Driver) requestedInstance(client *API) (*Instance, error) {
+	instances, err := client.GetInstances(d.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Unix(d.CreateRequestedAt, 0).Add(-createGuardSkew)
+	var found []Instance
+	for _, instance := range instances {
+		if instance.Name != d.instanceName() || instance.Region != d.RegionName {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, instance.Created)
+		if err != nil || created.Before(since) {
+			continue
+		}
+		found = append(found, instance)
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &found[0], nil
+	}
+	var ids []string
+	for _, instance := range found {
+		ids = append(ids, instance.ID)
+	}
+	return nil, fmt.Errorf("Several instances named %s were created since the previous create request: %s. Please delete the extra ones from %s", d.instanceName(), strings.Join(ids, ", "), CustomerInterface)
+}
+
+// requestInstanceOnce requests the instance of the machine, unless a previous
+// request without answer already created it. The request time is saved in the
+// create checkpoint before the call, so that a resumed create finds the
+// instance too. Bulk creates are not guarded, their instances being named by
+// the API
+func (d *Driver) requestInstanceOnce(client *API) (*Instance, error) {
+	if d.Count > 1 && len(d.BulkInstanceIDs) == 0 {
+		return d.requestInstances(client)
+	}
+
+	if d.CreateRequestedAt != 0 {
+		instance, err := d.requestedInstance(client)
+		if err != nil {
+			return nil, err
+		}
+		if instance != nil {
+			log.Infof("Instance %s of the previous create request exists, using it", instance.ID)
+			return instance, nil
+		}
+	}
+
+	d.CreateRequestedAt = time.Now().Unix()
+	err := d.checkpoint(d.CreatePhase)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := d.requestInstances(client)
+	if _, answered := err.(*ovh.APIError); err == nil || answered {
+		return instance, err
+	}
+	if _, answered := err.(*openStackError); answered {
+		return nil, err
+	}
+
+	// Without an answer, the instance may have been created all the same
+	log.Warnf("Create request of instance %s got no answer, checking whether it was created: %s", d.instanceName(), err)
+	deadline := time.Now().Add(createGuardWait)
+	for {
+		found, lookupErr := d.requestedInstance(client)
+		if lookupErr != nil {
+			return nil, fmt.Errorf("%s. Could not check whether the instance was created: %s", err, lookupErr)
+		}
+		if found != nil {
+			log.Infof("Instance %s was created despite the error, using it", found.ID)
+			return found, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(pollInitialInterval)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Handling of deprecated flavors
+const (
+	DeprecatedFlavorsWarn = "warn"
+	DeprecatedFlavorsFail = "fail"
+)
+
+// deprecatedFlavorFamilies maps legacy flavor families, which OVH no longer
+// sells or is retiring, to their current equivalent. OVH publishes no
+// deprecation feed, '--ovh-deprecated-flavor' extends or overrides this map
+var deprecatedFlavorFamilies = map[string]string{
+	"vps-ssd": "d2",
+	"eg":      "b3",
+	"sp":      "b3",
+	"hg":      "c3",
+	"s1":      "d2",
+	"b2":      "b3",
+	"c2":      "c3",
+	"r2":      "r3",
+}
+
+// flavorFamilies returns the deprecated flavor families with the overrides
+// of '--ovh-deprecated-flavor FAMILY=REPLACEMENT'
+func (c *Config) flavorFamilies() (map[string]string, error) {
+	families := make(map[string]string)
+	for family, replacement := range deprecatedFlavorFamilies {
+		families[family] = replacement
+	}
+	for _, option := range c.DeprecatedFlavorFamilies {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid deprecated flavor family '%s'. Expected FAMILY=REPLACEMENT, e.g. b2=b3", option)
+		}
+		if parts[1] == "" {
+			delete(families, parts[0])
+			continue
+		}
+		families[parts[0]] = parts[1]
+	}
+	return families, nil
+}
+
+// flavorFamily returns the deprecated family of a flavor name, if any, the
+// longest family matching first
+func flavorFamily(families map[string]string, name string) string {
+	var family string
+	for f := range families {
+		if strings.HasPrefix(name, f+"-") && len(f) > len(family) {
+			family = f
+		}
+	}
+	return family
+}
+
+// nearestFlavor returns the flavor of family closest to flavor: the smallest
+// one at least as large, or the largest one
+func nearestFlavor(flavors Flavors, family string, flavor *Flavor) *Flavor {
+	var candidates Flavors
+	for _, candidate := range flavors {
+		if candidate.OS == "linux" && strings.HasPrefix(candidate.Name, family+"-") && (candidate.Available == nil || *candidate.Available) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Vcpus != candidates[j].Vcpus {
+			return candidates[i].Vcpus < candidates[j].Vcpus
+		}
+		return candidates[i].MemoryGB < candidates[j].MemoryGB
+	})
+	for _, candidate := range candidates {
+		if candidate.Vcpus >= flavor.Vcpus && candidate.MemoryGB >= flavor.MemoryGB {
+			return &candidate
+		}
+	}
+	return &candidates[len(candidates)-1]
+}
+
+// checkFlavorDeprecation warns, or fails with '--ovh-deprecated-flavors fail',
+// when the flavor is no longer sold or belongs to a deprecated family,
+// suggesting the nearest current flavor of the region
+func (d *Driver) checkFlavorDeprecation(flavor *Flavor) error {
+	families, err := d.flavorFamilies()
+	if err != nil {
+		return err
+	}
+
+	var msg string
+	family := flavorFamily(families, flavor.Name)
+	switch {
+	case flavor.Available != nil && !*flavor.Available:
+		msg = fmt.Sprintf("Flavor '%s' is no longer available in region %s.", flavor.Name, d.RegionName)
+	case family != "":
+		msg = fmt.Sprintf("Flavor '%s' belongs to the deprecated %s family, which OVH is retiring.", flavor.Name, family)
+	default:
+		return nil
+	}
+
+	if replacement, ok := families[family]; ok {
+		client, err := d.getClient()
+		if err != nil {
+			return err
+		}
+		flavors, err := client.GetFlavors(d.ProjectID, d.RegionName)
+		if err != nil {
+			return err
+		}
+		if nearest := nearestFlavor(flavors, replacement, flavor); nearest != nil {
+			msg += fmt.Sprintf(" Its nearest current equivalent in region %s is '%s' (%d vCPUs, %d GB).", d.RegionName, nearest.Name, nearest.Vcpus, nearest.MemoryGB)
+		} else {
+			msg += fmt.Sprintf(" Its current equivalent is the %s family, not available in region %s.", replacement, d.RegionName)
+		}
+	}
+
+	if d.DeprecatedFlavors == DeprecatedFlavorsFail {
+		return fmt.Errorf("%s Please select a current flavor with '--ovh-flavor'", msg)
+	}
+	log.Warn(msg)
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Discovery records of the Swarm managers of a cluster, published under the
+// cluster subdomain of the DNS zone
+const (
+	swarmManagerPort  = 2377
+	swarmSRVSubDomain = "_docker-swarm._tcp"
+	swarmTXTSubDomain = "_docker-swarm-join"
+	discoveryTTL      = 60
+)
+
+// clusterDomain returns the cluster subdomain of the DNS zone
+func (d *Driver) clusterDomain() string {
+	return d.Cluster + "." + d.DNSZone
+}
+
+// managerHostname returns the published hostname of the machine, a manager
+func (d *Driver) managerHostname() string {
+	return d.MachineName + "." + d.clusterDomain()
+}
+
+// discoveryRecords returns the records announcing the machine as a manager of
+// its cluster: its address, a SRV record for the Swarm port and a TXT record
+// naming the machine holding the join tokens. Tokens themselves are secrets
+// and stay off the DNS
+func (d *Driver) discoveryRecords() []DNSRecord {
+	return []DNSRecord{
+		{
+			FieldType: "A",
+			SubDomain: d.MachineName + "." + d.Cluster,
+			Target:    d.clusterAddress(),
+			TTL:       discoveryTTL,
+		},
+		{
+			FieldType: "SRV",
+			SubDomain: swarmSRVSubDomain + "." + d.Cluster,
+			Target:    fmt.Sprintf("0 0 %d %s.", swarmManagerPort, d.managerHostname()),
+			TTL:       discoveryTTL,
+		},
+		{
+			FieldType: "TXT",
+			SubDomain: swarmTXTSubDomain + "." + d.Cluster,
+			Target:    fmt.Sprintf("\"manager=%s:%d machine=%s\"", d.managerHostname(), swarmManagerPort, d.MachineName),
+			TTL:       discoveryTTL,
+		},
+	}
+}
+
+// checkDNSZone checks that the DNS zone is managed by the account
+func (d *Driver) checkDNSZone() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	err = client.get("/domain/zone/"+d.DNSZone, nil)
+	if err != nil {
+		return fmt.Errorf("DNS zone '%s' is not available in this OVH account, or the consumer key lacks access to /domain/zone. Please select a zone of the account with '--ovh-dns-zone': %s", d.DNSZone, err)
+	}
+	return nil
+}
+
+// swarmManagerCommand prints true on a manager of a Swarm mode cluster
+const swarmManagerCommand = "sudo docker info --format '{{.Swarm.ControlAvailable}}'"
+
+// publishDiscovery publishes the discovery records of the machine, once its
+// engine is a manager of a Swarm mode cluster, so that the records never
+// point workers at a port where nothing listens
+func (d *Driver) publishDiscovery() error {
+	if d.DNSZone == "" {
+		return fmt.Errorf("Machine %s was not created with '--ovh-dns-zone'", d.MachineName)
+	}
+	output, err := drivers.RunSSHCommandFromDriver(d, swarmManagerCommand)
+	if err != nil {
+		return fmt.Errorf("Could not read the Swarm state of the engine of %s: %s", d.MachineName, err)
+	}
+	if strings.TrimSpace(output) != "true" {
+		return fmt.Errorf("The engine of %s is not a Swarm manager. Please run 'docker swarm init' or join it as a manager first", d.MachineName)
+	}
+	return d.publishDiscoveryRecords()
+}
+
+// publishDiscoveryRecords publishes the discovery records of a Swarm manager,
+// replacing the records it published before. Each record is saved with the
+// machine once created, so that a failure half way leaks none of them
+func (d *Driver) publishDiscoveryRecords() error {
+	d.unpublishDiscoveryRecords()
+	if len(d.DNSRecordIDs) > 0 {
+		return fmt.Errorf("Could not delete the previous discovery records of %s", d.MachineName)
+	}
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Publishing Swarm discovery records of cluster %s in %s...", d.Cluster, d.DNSZone)
+	for _, record := range d.discoveryRecords() {
+		created, err := client.CreateDNSRecord(d.DNSZone, record)
+		if err != nil {
+			return fmt.Errorf("Could not publish %s record %s.%s: %s", record.FieldType, record.SubDomain, d.DNSZone, err)
+		}
+		d.DNSRecordIDs = append(d.DNSRecordIDs, created.ID)
+
+		driver, err := json.Marshal(d)
+		if err == nil {
+			err = d.saveMachineConfig(driver)
+		}
+		if err != nil {
+			return fmt.Errorf("Could not save DNS record %d of machine %s: %s", created.ID, d.MachineName, err)
+		}
+	}
+	return client.RefreshDNSZone(d.DNSZone)
+}
+
+// unpublishDiscoveryRecords deletes the discovery records of the machine, so
+// that new workers only find the remaining managers. Failures are reported
+// only, the records expiring along with the machine address
+func (d *Driver) unpublishDiscoveryRecords() {
+	if len(d.DNSRecordIDs) == 0 {
+		return
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		log.Warnf("Could not delete Swarm discovery records of %s: %s", d.MachineName, err)
+		return
+	}
+
+	var remaining []int
+	for _, id := range d.DNSRecordIDs {
+		if err := client.DeleteDNSRecord(d.DNSZone, id); err != nil {
+			log.Warnf("Could not delete DNS record %d of zone %s: %s", id, d.DNSZone, err)
+			remaining = append(remaining, id)
+		}
+	}
+	d.DNSRecordIDs = remaining
+
+	if err := client.RefreshDNSZone(d.DNSZone); err != nil {
+		log.Warnf("Could not refresh DNS zone %s: %s", d.DNSZone, err)
+	}
+}
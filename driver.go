@@ -13,12 +13,15 @@ import (
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnflag"
 	"github.com/docker/machine/libmachine/mcnutils"
-	"github.com/docker/machine/libmachine/ssh"
 	"github.com/docker/machine/libmachine/state"
 )
 
 const (
-	statusTimeout = 200
+	statusTimeout       = 200 * time.Second
+	pollInitialInterval = 2 * time.Second
+	pollMaxInterval     = 15 * time.Second
+	removeRetries       = 3
+	removeRetryDelay    = 5 * time.Second
 )
 
 // Driver is a machine driver for OVH.
@@ -26,14 +29,32 @@ type Driver struct {
 	*drivers.BaseDriver
 
 	// Command line parameters
-	ProjectName        string
-	FlavorName         string
-	RegionName         string
-	PrivateNetworkName string
+	Config
 
-	// Ovh specific parameters
-	BillingPeriod string
-	Endpoint      string
+	// Resolved private network settings
+	PrivateCIDRs   []string
+	PrivateGateway string
+
+	// Flavor disk size, and validated private registry CAs
+	DiskSizeGB  int
+	RegistryCAs map[string]string
+
+	// Team keys authorized on first boot, in authorized_keys format
+	AuthorizedKeys []string `json:",omitempty"`
+
+	// Docker data volume, and its encryption key without a KMS
+	DataVolumeID    string
+	DataVolumeMount string
+	DataVolumeKey   string `json:",omitempty"`
+
+	// Instance name, when it differs from the machine name
+	InstanceName string
+
+	// Last completed create phase
+	CreatePhase string
+
+	// OVH side view of the machine, as of the last state query
+	Health *Health `json:",omitempty"`
 
 	// Internal ids
 	ProjectID   string
@@ -44,19 +65,108 @@ type Driver struct {
 	KeyPairID   string
 	NetworkIDs  []string
 
-	// Overloaded credentials
-	ApplicationKey    string
-	ApplicationSecret string
-	ConsumerKey       string
+	// Private network attached once the instance is active
+	AttachPrivateNetwork bool `json:",omitempty"`
+
+	// Labels of the instance metadata and docker engine
+	Labels map[string]string
+
+	// Project key holding the same public key, reused instead of uploading it
+	ReusedKeyPair string
+
+	// Application credential of the auto-recovery watchdog, by URL, and its
+	// last recoveries
+	AutoRecoverCredential string   `json:",omitempty"`
+	RecoveryEvents        []string `json:",omitempty"`
+
+	// Application credential of the office hours script, by URL
+	OfficeHoursCredential string `json:",omitempty"`
+
+	// Snapshot of the clone source, and its copy in the region of the clone
+	CloneSnapshotID string
+	CloneImageID    string `json:",omitempty"`
+
+	// Instances of the other machines created at once
+	BulkInstanceIDs []string
+
+	// Time of the pending instance create request, as a unix timestamp
+	CreateRequestedAt int64 `json:",omitempty"`
+
+	// Effective provisioning inputs, to report what changed on a new run
+	ProvisionInputs map[string]string `json:",omitempty"`
+
+	// Whether the instance was deleted on stop
+	DeletedOnStop bool `json:",omitempty"`
+
+	// Whether the instance is a metal one, deployed on a bare-metal server
+	Metal bool `json:",omitempty"`
+
+	// Whether the instance was claimed from the warm pool and still has to be
+	// handed over to the machine
+	WarmPoolClaimed bool `json:",omitempty"`
+
+	// Instance group of the placement options, with its policy and the
+	// machine it was created for
+	InstanceGroupID     string `json:",omitempty"`
+	InstanceGroupPolicy string `json:",omitempty"`
+	InstanceGroupAnchor string `json:",omitempty"`
+
+	// Private address, used by the cluster members
+	PrivateIPAddress string
+
+	// WireGuard mesh address and public key, and whether the security group
+	// of the machine restricts its port to the mesh
+	WireGuardAddress    string
+	WireGuardPublicKey  string
+	WireGuardRestricted bool `json:",omitempty"`
+
+	// Security group shared by the Swarm cluster, and the security groups of
+	// the public port, the machine one first
+	SwarmGroup       string   `json:",omitempty"`
+	SecurityGroupIDs []string `json:",omitempty"`
+
+	// Swarm discovery records published in the DNS zone
+	DNSRecordIDs []int `json:",omitempty"`
+
+	// Load balancer pools and the member ids of the machine
+	LoadBalancerPools []LoadBalancerPool `json:",omitempty"`
 
 	// internal
 	client *API
+
+	// Root password of the requested instance, and its hash, until printed
+	rootPassword     string
+	rootPasswordHash string
+
+	// Durations of the create phases of this run, and start of the current one
+	phaseDurations map[string]float64
+	phaseStarted   time.Time
+
+	// Closed on an interruption of the create, while watched
+	interrupted chan struct{}
 }
 
 // GetCreateFlags registers the "machine create" flags recognized by this driver, including
 // their help text and defaults.
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar: "OVH_PROFILE_FILE",
+			Name:   "ovh-profile-file",
+			Usage:  "OVH Cloud YAML or JSON file supplying ovh-* options. Environment and command line options take precedence, except when set to their default value or to false",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_TEMPLATE",
+			Name:   "ovh-template",
+			Usage:  "OVH Cloud name of a project template supplying ovh-* options, fetched from the project object storage",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_TEMPLATE_CONTAINER",
+			Name:   "ovh-template-container",
+			Usage:  "OVH Cloud object storage container holding the project templates",
+			Value:  DefaultTemplateContainer,
+		},
 		mcnflag.StringFlag{
 			EnvVar: "OVH_APPLICATION_KEY",
 			Name:   "ovh-application-key",
@@ -76,49 +186,499 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Value:  "",
 		},
 		mcnflag.StringFlag{
-			Name:  "ovh-endpoint",
-			Usage: "OVH Cloud API endpoint. Default: ovh-eu",
-			Value: "",
+			EnvVar: "OVH_ENDPOINT",
+			Name:   "ovh-endpoint",
+			Usage:  "OVH Cloud API endpoint. Default: ovh-eu",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_POLLING_ENDPOINT",
+			Name:   "ovh-polling-endpoint",
+			Usage:  "OVH API endpoint name or URL for status polling, e.g. closer to this host. Default: ovh-endpoint",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_API_BASE_URL",
+			Name:   "ovh-api-base-url",
+			Usage:  "OVH API gateway URL the calls are sent to in place of the endpoint, signed for the endpoint",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "OVH_API_HEADER",
+			Name:   "ovh-api-header",
+			Usage:  "OVH API header sent with every call, KEY=VALUE, e.g. for a gateway. Repeatable",
+			Value:  []string{},
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_API_TIMEOUT",
+			Name:   "ovh-api-timeout",
+			Usage:  "OVH API timeout of each call, in seconds. Default: 30",
+			Value:  DefaultAPITimeout,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_API_MAINTENANCE_WAIT",
+			Name:   "ovh-api-maintenance-wait",
+			Usage:  "OVH API maintenance wait: retry calls refused for maintenance for up to this many minutes. Default: 0, fail",
+			Value:  0,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_CATALOG_BUNDLE",
+			Name:   "ovh-catalog-bundle",
+			Usage:  "OVH Cloud catalog bundle file, exported with the export-catalog operation, serving the lookups of the create instead of the API",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_PROJECT",
+			Name:   "ovh-project",
+			Usage:  "OVH Cloud project name or id",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_REGION",
+			Name:   "ovh-region",
+			Usage:  "OVH Cloud region name, or 'auto-latency' for the region with the lowest latency from this host",
+			Value:  DefaultRegionName,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_COMPLIANCE",
+			Name:   "ovh-compliance",
+			Usage:  "OVH Cloud compliance framework the region must be certified for: 'hds' or 'secnumcloud'",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "OVH_COMPLIANT_REGION",
+			Name:   "ovh-compliant-region",
+			Usage:  "OVH Cloud region, or region prefix, certified for '--ovh-compliance' by the contract of the project. Repeatable",
+			Value:  []string{},
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "OVH_COMPLIANT_FLAVOR",
+			Name:   "ovh-compliant-flavor",
+			Usage:  "OVH Cloud flavor, or flavor family, certified for '--ovh-compliance' by the contract of the project. Repeatable",
+			Value:  []string{},
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_LATENCY_PROBE",
+			Name:   "ovh-latency-probe",
+			Usage:  "OVH Cloud host:port probed in each region with '--ovh-region auto-latency', {region} being the lower case region name",
+			Value:  DefaultLatencyProbe,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_FLAVOR",
+			Name:   "ovh-flavor",
+			Usage:  "OVH Cloud flavor name or id, optionally qualified with its region as in 'GRA7/b3-8', or alias of the newest generation as in 'latest:b' or 'general-2vcpu-7gb'",
+			Value:  DefaultFlavorName,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_FLEX",
+			Name:   "ovh-flex",
+			Usage:  "OVH Cloud use the flex variant of the flavor, with a smaller disk, resizable to other flex flavors",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_DEPRECATED_FLAVORS",
+			Name:   "ovh-deprecated-flavors",
+			Usage:  "OVH Cloud handling of deprecated or unavailable flavors: 'warn' or 'fail'",
+			Value:  DeprecatedFlavorsWarn,
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "OVH_DEPRECATED_FLAVOR",
+			Name:   "ovh-deprecated-flavor",
+			Usage:  "OVH Cloud deprecated flavor family and its replacement, as in 'b2=b3', or 'b2=' to accept a family. Repeatable",
+			Value:  []string{},
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "OVH_REQUIRE_CAPABILITY",
+			Name:   "ovh-require-capability",
+			Usage:  "OVH Cloud capability the flavor must have, e.g. gpu, gpu:<count>, gpu:<model>, nvme, local-raid, resize, snapshot",
+			Value:  []string{},
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_IMAGE",
+			Name:   "ovh-image",
+			Usage:  "OVH Cloud Image name or id. Default: Ubuntu 20.04",
+			Value:  DefaultImageName,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_FUZZY_IMAGE",
+			Name:   "ovh-fuzzy-image",
+			Usage:  "OVH Cloud also match the image name regardless of case, or by a unique prefix",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_PRIVATE_NETWORK",
+			Name:   "ovh-private-network",
+			Usage:  "OVH Cloud (private) network name or vlan number. Default: public network",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_NO_PUBLIC_NETWORK",
+			Name:   "ovh-no-public-network",
+			Usage:  "OVH Cloud only attach the private network. The machine must be reachable on its private address",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_PORT_SECURITY",
+			Name:   "ovh-port-security",
+			Usage:  "OVH Cloud port security of the private network port, 'off' to allow virtual IPs (VRRP). Requires OpenStack OS_USERNAME and OS_PASSWORD",
+			Value:  PortSecurityOn,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_SSH_KEY",
+			Name:   "ovh-ssh-key",
+			Usage:  "OVH Cloud ssh key name or id to use. Default: generate a random name",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_SSH_KEY_TYPE",
+			Name:   "ovh-ssh-key-type",
+			Usage:  "OVH Cloud type of the generated ssh key (rsa or ed25519). Default: rsa",
+			Value:  DefaultSSHKeyType,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_SSH_KEY_BITS",
+			Name:   "ovh-ssh-key-bits",
+			Usage:  "OVH Cloud size of the generated RSA ssh key, in bits. Default: 2048",
+			Value:  DefaultSSHKeyBits,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_SSH_USER",
+			Name:   "ovh-ssh-user",
+			Usage:  "OVH Cloud ssh username to use. Default: machine",
+			Value:  DefaultSSHUserName,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_RUNTIME_SSH_USER",
+			Name:   "ovh-runtime-ssh-user",
+			Usage:  "OVH Cloud ssh user created once the machine is up, replacing the disabled image default user",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_SANITIZE_NAME",
+			Name:   "ovh-sanitize-name",
+			Usage:  "OVH Cloud derive a valid instance hostname from machine names that are not",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_NAME_PREFIX",
+			Name:   "ovh-name-prefix",
+			Usage:  "OVH Cloud prefix of the instance, ssh key, volume and snapshot names created by the driver. Default: none",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_BILLING_PERIOD",
+			Name:   "ovh-billing-period",
+			Usage:  "OVH Cloud billing period (hourly or monthly). Default: hourly",
+			Value:  DefaultBillingPeriod,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_KEEP_SSH_KEY",
+			Name:   "ovh-keep-ssh-key",
+			Usage:  "OVH Cloud keep the ssh key on machine removal so that a new machine with the same name reuses it",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_AUTHORIZED_KEYS_FILE",
+			Name:   "ovh-authorized-keys-file",
+			Usage:  "OVH Cloud file of team public keys, in authorized_keys format, also authorized for the SSH user on first boot",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_WEBHOOK_URL",
+			Name:   "ovh-webhook-url",
+			Usage:  "OVH Cloud URL receiving the machine lifecycle events as JSON POST requests",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_ARTIFACTS_CONTAINER",
+			Name:   "ovh-artifacts-container",
+			Usage:  "OVH Cloud object storage container receiving the console and provisioning logs and the certificates of the machine",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_ARTIFACTS_REGION",
+			Name:   "ovh-artifacts-region",
+			Usage:  "OVH Cloud region of the artifacts container. Default: the machine region",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_OFFICE_HOURS",
+			Name:   "ovh-office-hours",
+			Usage:  "OVH Cloud weekly hours the machine runs, shelved outside of them, e.g. 'Mon-Fri 07:00-20:00 Europe/Paris'",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_EGRESS_LIMIT_MBPS",
+			Name:   "ovh-egress-limit-mbps",
+			Usage:  "OVH Cloud limit of the outbound traffic of the public network, in Mbps. Default: unlimited",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_FIX_SUDOERS",
+			Name:   "ovh-fix-sudoers",
+			Usage:  "OVH Cloud grant passwordless sudo to the ssh user on first boot, for images without it",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_CHECK_SMTP",
+			Name:   "ovh-check-smtp",
+			Usage:  "OVH Cloud check whether outbound SMTP port 25 is blocked once the machine is up",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_ROOT_PASSWORD",
+			Name:   "ovh-root-password",
+			Usage:  "OVH Cloud set a random root password, printed once, for console access when the ssh key is lost",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_DELETE_ON_INTERRUPT",
+			Name:   "ovh-delete-on-interrupt",
+			Usage:  "OVH Cloud delete the instance and its generated ssh key when create is interrupted before the instance is active",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_ON_STOP",
+			Name:   "ovh-on-stop",
+			Usage:  "OVH Cloud what 'docker-machine stop' does with the instance: 'stop', still billed, 'shelve', keeping its disk only, or 'delete'",
+			Value:  OnStopStop,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_SAME_HOST_AS",
+			Name:   "ovh-same-host-as",
+			Usage:  "OVH Cloud machine whose host the instance should preferably share, for chatty services, or the machine itself to start a group",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_DIFFERENT_HOST_THAN",
+			Name:   "ovh-different-host-than",
+			Usage:  "OVH Cloud machine whose host the instance should preferably avoid, for replicas, or the machine itself to start a group",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_PORT_ID",
+			Name:   "ovh-port-id",
+			Usage:  "OVH Cloud ID of a free OpenStack port, pre-created by network admins, to create the instance with. Requires OpenStack OS_USERNAME and OS_PASSWORD",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_BUDGET_WARN",
+			Name:   "ovh-budget-warn",
+			Usage:  "OVH Cloud monthly budget, in the currency of the account, the projected cost of the machines of the project is checked against on create",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_BUDGET_ALERT_EMAIL",
+			Name:   "ovh-budget-alert-email",
+			Usage:  "OVH Cloud email of a billing alert of the project at the '--ovh-budget-warn' budget",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_WARM_POOL",
+			Name:   "ovh-warm-pool",
+			Usage:  "OVH Cloud warm pool of pre-built, shelved instances the machine is taken from, built with the settings of the machine",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_WARM_POOL_SIZE",
+			Name:   "ovh-warm-pool-size",
+			Usage:  "OVH Cloud number of instances kept in the '--ovh-warm-pool' warm pool",
+			Value:  DefaultWarmPoolSize,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_VRACK",
+			Name:   "ovh-vrack",
+			Usage:  "OVH Cloud vRack service name the project is attached to when it is attached to none, for '--ovh-private-network'",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_RECONCILE_ADDRESS",
+			Name:   "ovh-reconcile-address",
+			Usage:  "OVH Cloud move the DNS records, load balancer members and peer firewall rules of the machine along with its address",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_IAM_TAGS",
+			Name:   "ovh-iam-tags",
+			Usage:  "OVH Cloud also set the labels, and a managed-by=docker-machine tag, as IAM resource tags of the instance",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_SSH_AGENT_FORWARDING",
+			Name:   "ovh-ssh-agent-forwarding",
+			Usage:  "OVH Cloud forward the ssh agent in ssh sessions on the machine, through an ssh configuration included from ~/.ssh/config",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_RECREATE",
+			Name:   "ovh-recreate",
+			Usage:  "OVH Cloud delete the resources of an interrupted create run with another project, region, flavor or image, and start from scratch",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_AUTO_RECOVER",
+			Name:   "ovh-auto-recover",
+			Usage:  "OVH Cloud install a watchdog rebooting the instance when dockerd or the network fail",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_SOFT_REMOVE",
+			Name:   "ovh-soft-remove",
+			Usage:  "OVH Cloud shelve the instance on machine removal instead of deleting it, until purged after the retention",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_SOFT_REMOVE_RETENTION",
+			Name:   "ovh-soft-remove-retention",
+			Usage:  "OVH Cloud hours soft removed instances are kept before being purged",
+			Value:  DefaultSoftRemoveRetention,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_SNAPSHOT_ON_REMOVE",
+			Name:   "ovh-snapshot-on-remove",
+			Usage:  "OVH Cloud snapshot the instance on machine removal before deleting it",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_SNAPSHOT_RETENTION_DAYS",
+			Name:   "ovh-snapshot-retention-days",
+			Usage:  "OVH Cloud days snapshots created by the driver are kept before being pruned. Default: 0, forever",
+			Value:  0,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_SNAPSHOT_KEEP",
+			Name:   "ovh-snapshot-keep",
+			Usage:  "OVH Cloud number of snapshots created by the driver kept for each machine. Default: 0, all",
+			Value:  0,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_REBOOT_WINDOW",
+			Name:   "ovh-reboot-window",
+			Usage:  "OVH Cloud window in which restarts are allowed, e.g. 'Sun 03:00-05:00 UTC'. Restarts outside of it are queued on the machine",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_CLONE_FROM",
+			Name:   "ovh-clone-from",
+			Usage:  "OVH Cloud name of an existing OVH machine to snapshot and clone, with the same project, region, flavor and networks",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OVH_RESTORE_BACKUP",
+			Name:   "ovh-restore-backup",
+			Usage:  "OVH Cloud instance backup to create the machine from, by id or name. It must be in the machine region",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_COUNT",
+			Name:   "ovh-count",
+			Usage:  "OVH Cloud number of identical machines to create in a single call, named <name>-2... after the first one",
+			Value:  1,
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "OVH_DOCKER_ALLOWED_CIDRS",
+			Name:   "ovh-docker-allowed-cidrs",
+			Usage:  "OVH Cloud CIDRs allowed to reach the Docker port, 'auto' for the egress IP of this host, 'any' for any source. Default: auto",
+			Value:  []string{},
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "OVH_LABELS",
+			Name:   "ovh-labels",
+			Usage:  "OVH Cloud KEY=VALUE labels set as instance metadata and docker engine labels, also given with --engine-label, e.g. cost-center=edge. Repeatable",
+			Value:  []string{},
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "OVH_LOADBALANCER",
+			Name:   "ovh-loadbalancer",
+			Usage:  "OVH Cloud Load Balancer pool the machine joins, as <load balancer>:<pool>[:<port>]. Repeatable",
+			Value:  []string{},
 		},
 		mcnflag.StringFlag{
-			Name:  "ovh-project",
-			Usage: "OVH Cloud project name or id",
-			Value: "",
+			EnvVar: "OVH_CLUSTER",
+			Name:   "ovh-cluster",
+			Usage:  "OVH Cloud cluster label shared by the machines of a cluster",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_CLUSTER_HOSTS",
+			Name:   "ovh-cluster-hosts",
+			Usage:  "OVH Cloud maintain /etc/hosts entries for the machines of the cluster on each of them",
 		},
 		mcnflag.StringFlag{
-			Name:  "ovh-region",
-			Usage: "OVH Cloud region name",
-			Value: DefaultRegionName,
+			EnvVar: "OVH_DNS_ZONE",
+			Name:   "ovh-dns-zone",
+			Usage:  "OVH DNS zone of the account where the Swarm managers of the cluster publish discovery records, with the publish-discovery operation",
+			Value:  "",
 		},
 		mcnflag.StringFlag{
-			Name:  "ovh-flavor",
-			Usage: "OVH Cloud flavor name or id. Default: b2-7",
-			Value: DefaultFlavorName,
+			EnvVar: "OVH_WIREGUARD_MESH",
+			Name:   "ovh-wireguard-mesh",
+			Usage:  "OVH Cloud name of a WireGuard mesh to join, encrypting traffic between its machines over their public addresses",
 		},
 		mcnflag.StringFlag{
-			Name:  "ovh-image",
-			Usage: "OVH Cloud Image name or id. Default: Ubuntu 20.04",
-			Value: DefaultImageName,
+			EnvVar: "OVH_WIREGUARD_SUBNET",
+			Name:   "ovh-wireguard-subnet",
+			Usage:  "OVH Cloud IPv4 subnet of the WireGuard mesh addresses. Default: subnet of the mesh, or " + DefaultWireGuardSubnet,
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "OVH_EXCLUDE_IP_RANGES",
+			Name:   "ovh-exclude-ip-ranges",
+			Usage:  "OVH Cloud public IP ranges to avoid, as CIDRs. Instances getting such an address are replaced",
+			Value:  []string{},
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_IP_ATTEMPTS",
+			Name:   "ovh-ip-attempts",
+			Usage:  "OVH Cloud number of instances to try to get a public IP outside of the excluded ranges",
+			Value:  DefaultIPAttempts,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_MIN_BANDWIDTH",
+			Name:   "ovh-min-bandwidth",
+			Usage:  "OVH Cloud minimum guaranteed flavor bandwidth, in Mbps. Default: no constraint",
+			Value:  0,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_ALLOW_SANDBOX",
+			Name:   "ovh-allow-sandbox",
+			Usage:  "OVH Cloud allow sandbox flavors for machines whose name matches the production pattern",
 		},
 		mcnflag.StringFlag{
-			Name:  "ovh-private-network",
-			Usage: "OVH Cloud (private) network name or vlan number. Default: public network",
-			Value: "",
+			EnvVar: "OVH_PRODUCTION_PATTERN",
+			Name:   "ovh-production-pattern",
+			Usage:  "OVH Cloud regular expression matching production machine names, which require '--ovh-allow-sandbox' for sandbox flavors",
+			Value:  DefaultProductionPattern,
 		},
 		mcnflag.StringFlag{
-			Name:  "ovh-ssh-key",
-			Usage: "OVH Cloud ssh key name or id to use. Default: generate a random name",
-			Value: "",
+			EnvVar: "OVH_DEFAULT_ROUTE",
+			Name:   "ovh-default-route",
+			Usage:  "OVH Cloud network holding the default route when a private network is attached: 'public' or 'private'. Default: left to the image",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_PRIVATE_MTU",
+			Name:   "ovh-private-mtu",
+			Usage:  "OVH Cloud MTU of the private network interface, e.g. 9000 for the vRack. Default: DHCP provided",
+			Value:  0,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_DOCKER_MTU",
+			Name:   "ovh-docker-mtu",
+			Usage:  "OVH Cloud also apply the private network MTU to the Docker engine",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "OVH_ENGINE_ENV",
+			Name:   "ovh-engine-env",
+			Usage:  "OVH Cloud environment variable of the docker engine, KEY=VALUE, e.g. HTTP_PROXY. Repeatable",
+			Value:  []string{},
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "OVH_REGISTRY_CA_FILE",
+			Name:   "ovh-registry-ca-file",
+			Usage:  "OVH Cloud CA of a private registry trusted by the docker engine, REGISTRY=PATH, e.g. registry.internal:5000=ca.crt. Repeatable",
+			Value:  []string{},
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "OVH_INSECURE_REGISTRY",
+			Name:   "ovh-insecure-registry",
+			Usage:  "OVH Cloud private registry the docker engine reaches without TLS verification, also given with --engine-insecure-registry. Repeatable",
+			Value:  []string{},
 		},
 		mcnflag.StringFlag{
-			Name:  "ovh-ssh-user",
-			Usage: "OVH Cloud ssh username to use. Default: machine",
-			Value: DefaultSSHUserName,
+			EnvVar: "OVH_TUNING_PROFILE",
+			Name:   "ovh-tuning-profile",
+			Usage:  "OVH Cloud kernel tuning profile for container hosts (none, swarm or k8s). Default: none",
+			Value:  DefaultTuningProfile,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_NO_GROW_ROOT",
+			Name:   "ovh-no-grow-root",
+			Usage:  "OVH Cloud do not grow the root filesystem to the flavor disk size on first boot",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_HARDEN",
+			Name:   "ovh-harden",
+			Usage:  "OVH Cloud apply a basic hardening profile on first boot: no SSH password, unattended upgrades, fail2ban, auditd",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OVH_DOCKER_DATA_VOLUME",
+			Name:   "ovh-docker-data-volume",
+			Usage:  "OVH Cloud size in GB of an extra volume to attach and mount on /var/lib/docker. Default: no volume",
+			Value:  0,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OVH_VOLUME_ENCRYPT",
+			Name:   "ovh-volume-encrypt",
+			Usage:  "OVH Cloud encrypt the docker data volume with LUKS, unlocked at boot",
 		},
 		mcnflag.StringFlag{
-			Name:  "ovh-billing-period",
-			Usage: "OVH Cloud billing period (hourly or monthly). Default: hourly",
-			Value: DefaultBillingPeriod,
+			EnvVar: "OVH_VOLUME_KEY_URL",
+			Name:   "ovh-volume-key-url",
+			Usage:  "OVH Cloud KMS https URL the machine fetches the docker data volume key from at boot. Default: key kept in the machine configuration",
+			Value:  "",
 		},
 	}
 }
@@ -131,58 +691,42 @@ func (d *Driver) DriverName() string {
 // getClient returns an OVH API client
 func (d *Driver) getClient() (api *API, err error) {
 	if d.client == nil {
+		if err := d.checkApplication(); err != nil {
+			return nil, err
+		}
 		client, err := NewAPI(d.Endpoint, d.ApplicationKey, d.ApplicationSecret, d.ConsumerKey)
 		if err != nil {
 			return nil, fmt.Errorf("Could not create a connection to OVH API. You may want to visit: https://github.com/yadutaf/docker-machine-driver-ovh#example-usage. The original error was: %s", err)
 		}
+		if d.PollEndpoint != "" {
+			err = client.SetPollingEndpoint(d.PollEndpoint)
+			if err != nil {
+				return nil, fmt.Errorf("Could not create a connection to OVH API polling endpoint %s: %s", d.PollEndpoint, err)
+			}
+		}
+		if d.APITimeout <= 0 {
+			d.APITimeout = DefaultAPITimeout
+		}
+		if d.APIBaseURL != "" || len(d.APIHeaders) > 0 || len(d.APIHeaderNames) > 0 {
+			headers, err := d.apiHeaders()
+			if err != nil {
+				return nil, err
+			}
+			client.SetGateway(d.APIBaseURL, headers)
+		}
+		client.SetTimeout(time.Duration(d.APITimeout) * time.Second)
+		client.SetMaintenanceWait(time.Duration(d.MaintenanceWait) * time.Minute)
+		if d.StorePath != "" {
+			client.SetAuditLog(filepath.Join(d.StorePath, AuditLogName), d.MachineName)
+		}
 		d.client = client
 	}
 
 	return d.client, nil
 }
 
-// SetConfigFromFlags assigns and verifies the command-line arguments presented to the driver.
-func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
-	d.ApplicationKey = flags.String("ovh-application-key")
-	d.ApplicationSecret = flags.String("ovh-application-secret")
-	d.ConsumerKey = flags.String("ovh-consumer-key")
-
-	// Store configuration parameters as-is
-	d.Endpoint = flags.String("ovh-endpoint")
-	d.ProjectName = flags.String("ovh-project")
-	d.RegionName = flags.String("ovh-region")
-	d.FlavorName = flags.String("ovh-flavor")
-	d.ImageID = flags.String("ovh-image")
-	d.PrivateNetworkName = flags.String("ovh-private-network")
-	d.KeyPairName = flags.String("ovh-ssh-key")
-	d.BillingPeriod = flags.String("ovh-billing-period")
-
-	// Swarm configuration, must be in each driver
-	d.SwarmMaster = flags.Bool("swarm-master")
-	d.SwarmHost = flags.String("swarm-host")
-	d.SwarmDiscovery = flags.String("swarm-discovery")
-
-	d.SSHUser = flags.String("ovh-ssh-user")
-
-	return nil
-}
-
-// PreCreateCheck does the network side validation
-func (d *Driver) PreCreateCheck() error {
-	client, err := d.getClient()
-	if err != nil {
-		return err
-	}
-
-	// Validate billing period
-	log.Debug("Validating billing period")
-	if d.BillingPeriod != "monthly" && d.BillingPeriod != "hourly" {
-		return fmt.Errorf("Invalid billing period '%s'. Please select one of 'hourly', 'monthly'", d.BillingPeriod)
-	}
-	log.Debug("Selecting billing period", d.BillingPeriod)
-
-	// Validate project id
-	log.Debug("Validating project")
+// resolveProject finds the id of the selected project, or of the only one
+func (d *Driver) resolveProject(client *API) error {
 	if d.ProjectName != "" {
 		project, err := client.GetProjectByName(d.ProjectName)
 		if err != nil {
@@ -215,6 +759,109 @@ func (d *Driver) PreCreateCheck() error {
 			return fmt.Errorf("Multiple Cloud project found (%s), to select one, use '--ovh-project' option", strings.Join(projectNames[:], ", "))
 		}
 	}
+	return nil
+}
+
+// SetConfigFromFlags assigns and verifies the command-line arguments presented to the driver.
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	// Options from a profile file, overridden by the command line
+	if path := flags.String("ovh-profile-file"); path != "" {
+		profile, err := d.loadProfile(flags, path)
+		if err != nil {
+			return err
+		}
+		flags = profile
+	}
+
+	// Options from a project template, overridden by the above
+	if name := flags.String("ovh-template"); name != "" {
+		template, err := d.loadTemplate(flags, name)
+		if err != nil {
+			return err
+		}
+		flags = template
+	}
+
+	// Store configuration parameters as-is
+	d.Config.SetFromFlags(flags)
+	d.ImageID = flags.String("ovh-image")
+	d.KeyPairName = flags.String("ovh-ssh-key")
+
+	// Validate machine name early, as it becomes the instance hostname
+	if err := validateMachineName(d.MachineName); err != nil {
+		if !d.SanitizeName {
+			return fmt.Errorf("%s. Use '--ovh-sanitize-name' to derive a valid instance name", err)
+		}
+		d.InstanceName = sanitizeMachineName(d.MachineName)
+		if err := validateMachineName(d.InstanceName); err != nil {
+			return err
+		}
+		log.Infof("Using instance name '%s' for machine '%s'", d.InstanceName, d.MachineName)
+	}
+
+	// Validate name prefix, shared by all created resources
+	if err := d.validateNamePrefix(); err != nil {
+		return err
+	}
+
+	// Swarm configuration, must be in each driver
+	d.SwarmMaster = flags.Bool("swarm-master")
+	d.SwarmHost = flags.String("swarm-host")
+	d.SwarmDiscovery = flags.String("swarm-discovery")
+
+	d.SSHUser = flags.String("ovh-ssh-user")
+
+	// Validate parameters before any API call
+	if err := d.Config.Validate(); err != nil {
+		return err
+	}
+	return d.validateRuntimeSSHUser()
+}
+
+// PreCreateCheck does the network side validation
+func (d *Driver) PreCreateCheck() (err error) {
+	defer func() { err = d.supportError(err) }()
+	span := d.traceOperation("PreCreateCheck")
+	defer func() { span.end(err) }()
+
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	d.pinAccount(client)
+
+	// Validate parameters, also when set programmatically
+	err = d.Config.Validate()
+	if err != nil {
+		return err
+	}
+
+	// Catalog lookups of the create, from a bundle
+	if d.CatalogBundle != "" {
+		err = client.SetCatalog(d.CatalogBundle)
+		if err != nil {
+			return fmt.Errorf("Could not load catalog bundle %s: %s", d.CatalogBundle, err)
+		}
+	}
+	log.Debug("Selecting billing period", d.BillingPeriod)
+
+	// Clone source settings take precedence
+	var cloneSource *Driver
+	if d.CloneFrom != "" {
+		log.Debug("Loading clone source")
+		cloneSource, err = d.loadCloneSource()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Validate project id
+	log.Debug("Validating project")
+	err = d.resolveProject(client)
+	if err != nil {
+		return err
+	}
+
 	log.Debug("Found project id ", d.ProjectID)
 
 	// Validate region
@@ -223,73 +870,312 @@ func (d *Driver) PreCreateCheck() error {
 	if err != nil {
 		return err
 	}
-	var ok bool
-	for _, region := range regions {
-		if region == d.RegionName {
-			ok = true
-			break
+	regions, err = d.complianceRegions(regions)
+	if err != nil {
+		return err
+	}
+	if d.RegionName == AutoLatencyRegion {
+		err = d.selectNearestRegion(regions)
+		if err != nil {
+			return err
+		}
+	}
+	err = d.resolveRegion(regions)
+	if err != nil {
+		return err
+	}
+	if cloneSource != nil {
+		err = d.selectCloneImage(client, cloneSource)
+		if err != nil {
+			return err
 		}
 	}
-	if ok != true {
-		return fmt.Errorf("Invalid region %s. For a list of valid ovh regions, please visis %s", d.RegionName, CustomerInterface)
+
+	// Validate placement against other machines
+	err = d.checkPlacement()
+	if err != nil {
+		return err
 	}
 
 	// Validate flavor
 	log.Debug("Validating flavor")
+	err = d.resolveFlavorAlias(client)
+	if err != nil {
+		return err
+	}
 	flavor, err := client.GetFlavorByName(d.ProjectID, d.RegionName, d.FlavorName)
 	if err != nil {
 		return err
 	}
+	if d.Flex {
+		flavor, err = d.selectFlexFlavor(flavor)
+		if err != nil {
+			return err
+		}
+	}
 	d.FlavorID = flavor.ID
+	d.DiskSizeGB = flavor.DiskSpaceGB
 	log.Debug("Found flavor id ", d.FlavorID)
 
+	// Validate flavor compliance
+	err = d.checkComplianceFlavor(flavor)
+	if err != nil {
+		return err
+	}
+
+	// Validate flavor deprecation
+	err = d.checkFlavorDeprecation(flavor)
+	if err != nil {
+		return err
+	}
+
+	// Validate metal flavor options
+	err = d.checkMetalFlavor(flavor)
+	if err != nil {
+		return err
+	}
+
+	// Validate flavor capabilities
+	err = d.validateFlavorCapabilities(flavor)
+	if err != nil {
+		return err
+	}
+
+	// Validate sandbox flavor eligibility
+	err = d.validateSandbox(flavor)
+	if err != nil {
+		return err
+	}
+
+	// Validate flavor bandwidth
+	if flavor.bandwidth() == 0 {
+		log.Warnf("Flavor %s does not advertise its bandwidth", flavor.Name)
+	} else {
+		log.Infof("Flavor %s guarantees %d Mbps inbound, %d Mbps outbound", flavor.Name, flavor.InboundMbps, flavor.OutboundMbps)
+		if d.MinBandwidth > 0 && flavor.bandwidth() < d.MinBandwidth {
+			return fmt.Errorf("Flavor '%s' only guarantees %d Mbps, less than the requested %d Mbps. Please select a larger flavor with '--ovh-flavor'", flavor.Name, flavor.bandwidth(), d.MinBandwidth)
+		}
+	}
+
+	// Validate budget
+	err = d.checkBudget(client, flavor)
+	if err != nil {
+		return err
+	}
+
 	// Validate image
 	log.Debug("Validating image")
-	image, err := client.GetImageByName(d.ProjectID, d.RegionName, d.ImageID)
+	var image *Image
+	if d.RestoreBackup != "" {
+		image, err = d.resolveBackup()
+	} else {
+		image, err = client.GetImageByName(d.ProjectID, d.RegionName, d.ImageID, d.FuzzyImage)
+	}
 	if err != nil {
 		return err
 	}
 	d.ImageID = image.ID
 	log.Debug("Found image id ", d.ImageID)
 
+	// Validate flavor against image requirements. Image minRam is reported in
+	// MB, flavor ram in GB, flavors without local disk boot from volume
+	if flavor.DiskSpaceGB > 0 && image.MinDisk > flavor.DiskSpaceGB {
+		return fmt.Errorf("Image '%s' requires at least %dGB of disk but flavor '%s' only has %dGB. Please select a larger flavor with '--ovh-flavor'", image.Name, image.MinDisk, flavor.Name, flavor.DiskSpaceGB)
+	}
+	if image.MinRAM > flavor.memoryMB() {
+		return fmt.Errorf("Image '%s' requires at least %dMB of RAM but flavor '%s' only has %dMB. Please select a larger flavor with '--ovh-flavor'", image.Name, image.MinRAM, flavor.Name, flavor.memoryMB())
+	}
+
 	// Validate private network
 	log.Debug("Validating private network")
 	if d.PrivateNetworkName != "" {
-		privateNetwork, err := client.GetPrivateNetworkByName(d.ProjectID, d.PrivateNetworkName)
+		err = d.ensureVrack(client)
 		if err != nil {
 			return err
 		}
-		d.NetworkIDs = append(d.NetworkIDs, privateNetwork.ID)
-		log.Debug("Found private network id ", privateNetwork.ID)
-
-		publicNetworkID, err := client.GetPublicNetworkID(d.ProjectID)
+		privateNetworkID, err := d.cachedLookup("private network "+d.PrivateNetworkName, func() (string, error) {
+			privateNetwork, err := client.GetPrivateNetworkByName(d.ProjectID, d.PrivateNetworkName)
+			if err != nil {
+				return "", err
+			}
+			return privateNetwork.ID, nil
+		})
 		if err != nil {
-			return err
+			return d.missingVrackError(client, err)
+		}
+		d.NetworkIDs = append(d.NetworkIDs, privateNetworkID)
+		log.Debug("Found private network id ", privateNetworkID)
+
+		if !d.NoPublicNetwork {
+			publicNetworkID, err := d.cachedLookup("public network", func() (string, error) {
+				return client.GetPublicNetworkID(d.ProjectID)
+			})
+			if _, ok := err.(*NoPublicNetworkError); ok {
+				// Let OVH attach its default public network
+				log.Warnf("%s, the instance gets the default public network and private network %s is attached once it is active", err, d.PrivateNetworkName)
+				d.AttachPrivateNetwork = true
+			} else if err != nil {
+				return err
+			} else {
+				d.NetworkIDs = append(d.NetworkIDs, publicNetworkID)
+				log.Debug("Found public network id ", publicNetworkID)
+			}
 		}
-		d.NetworkIDs = append(d.NetworkIDs, publicNetworkID)
-		log.Debug("Found public network id ", publicNetworkID)
 
 	} else {
 		log.Debug("No private network found. Using public network")
 	}
 
+	// Validate private network port security
+	err = d.validatePortSecurity()
+	if err != nil {
+		return err
+	}
+
+	// Validate pre-created port
+	err = d.validatePort()
+	if err != nil {
+		return err
+	}
+
+	// Restrict swarm ports to the cluster
+	err = d.validateSecurityGroups()
+	if err != nil {
+		return err
+	}
+
+	// Validate soft removal
+	err = d.validateSoftRemove()
+	if err != nil {
+		return err
+	}
+
+	// Restrict docker port
+	log.Debug("Validating docker allowed CIDRs")
+	err = d.resolveDockerAllowedCIDRs()
+	if err != nil {
+		return err
+	}
+
+	// Validate cluster
+	if d.ClusterHosts && d.Cluster == "" {
+		return fmt.Errorf("'--ovh-cluster-hosts' requires a cluster label. Please set one with '--ovh-cluster'")
+	}
+	if d.DNSZone != "" {
+		log.Debug("Validating DNS zone")
+		err = d.checkDNSZone()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Validate default route network
+	if d.DefaultRoute != "" {
+		log.Debug("Validating default route")
+		var privateNetworkID string
+		if d.PrivateNetworkName != "" {
+			privateNetworkID = d.NetworkIDs[0]
+		}
+		err = d.validateDefaultRoute(privateNetworkID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Validate bulk create
+	err = d.validateCount()
+	if err != nil {
+		return err
+	}
+
+	// Validate quotas
+	log.Debug("Checking quotas")
+	err = d.checkQuota(flavor)
+	if err != nil {
+		return err
+	}
+
+	// Validate office hours
+	err = d.validateOfficeHours()
+	if err != nil {
+		return err
+	}
+
+	// Validate labels
+	err = d.validateLabels()
+	if err != nil {
+		return err
+	}
+
+	// Validate auto-recovery
+	err = d.validateAutoRecover()
+	if err != nil {
+		return err
+	}
+
+	// Validate load balancer pools
+	err = d.resolveLoadBalancerPools()
+	if err != nil {
+		return err
+	}
+
+	// Prepare the artifacts container
+	err = d.ensureArtifactsContainer()
+	if err != nil {
+		return err
+	}
+
+	// Validate private registries
+	err = d.validateRegistryCAs()
+	if err != nil {
+		return err
+	}
+
+	// Read team keys
+	err = d.loadAuthorizedKeys()
+	if err != nil {
+		return err
+	}
+
 	// Use a common key or create a machine specific one
 	keyPath := filepath.Join(d.StorePath, "sshkeys", d.KeyPairName)
 	if len(d.KeyPairName) != 0 {
+		err = d.checkNamespace("SSH key", d.KeyPairName)
+		if err != nil {
+			return err
+		}
 		if _, err := os.Stat(keyPath); err == nil {
 			d.SSHKeyPath = keyPath
 		} else {
 			log.Debug("SSH key", keyPath, "does not exist. Assuming the key (", d.KeyPairName, ") is in '~/.ssh/' or in a SSH agent.")
 		}
+	} else if d.KeepSSHKey {
+		// Kept keys are named after the machine and stored outside of the
+		// machine directory so that they survive its removal
+		d.KeyPairName = d.resourceName(d.MachineName)
+		sanitizeKeyPairName(&d.KeyPairName)
+		d.SSHKeyPath = filepath.Join(d.StorePath, "sshkeys", d.KeyPairName)
 	} else {
-		d.KeyPairName = fmt.Sprintf("%s-%s", d.MachineName, mcnutils.GenerateRandomID())
+		d.KeyPairName = d.resourceName(fmt.Sprintf("%s-%s", d.MachineName, mcnutils.GenerateRandomID()))
 		sanitizeKeyPairName(&d.KeyPairName)
 		d.SSHKeyPath = d.ResolveStorePath(d.KeyPairName)
 	}
 
+	d.logPreCreateSummary(image)
 	return nil
 }
 
+// logPreCreateSummary states on a single line what is going to be built, so
+// that logs are unambiguous when a later step fails
+func (d *Driver) logPreCreateSummary(image *Image) {
+	networks := "public"
+	if len(d.NetworkIDs) > 0 {
+		networks = strings.Join(d.NetworkIDs, ",")
+	}
+	log.Infof("Pre-create summary: project=%s region=%s flavor=%s flavor_id=%s image=%q image_id=%s networks=%s key=%s billing=%s",
+		d.ProjectID, d.RegionName, d.FlavorName, d.FlavorID, image.Name, image.ID, networks, d.KeyPairName, d.BillingPeriod)
+}
+
 // copied from openstack driver
 func sanitizeKeyPairName(s *string) {
 	*s = strings.Replace(*s, ".", "_", -1)
@@ -308,6 +1194,9 @@ func (d *Driver) ensureSSHKey() error {
 	if sshKey != nil {
 		d.KeyPairID = sshKey.ID
 		log.Debug("Found key id ", d.KeyPairID)
+		if _, err := os.Stat(d.GetSSHKeyPath()); d.KeepSSHKey && err != nil {
+			log.Warnf("Reusing ssh key %s but its private key %s is missing. Make sure it is available in a SSH agent.", d.KeyPairName, d.GetSSHKeyPath())
+		}
 		return nil
 	}
 
@@ -320,7 +1209,7 @@ func (d *Driver) ensureSSHKey() error {
 		return err
 	}
 
-	err = ssh.GenerateSSHKey(d.GetSSHKeyPath())
+	err = generateSSHKey(d.GetSSHKeyPath(), d.SSHKeyType, d.SSHKeyBits)
 	if err != nil {
 		return err
 	}
@@ -329,6 +1218,18 @@ func (d *Driver) ensureSSHKey() error {
 		return err
 	}
 
+	// OVH rejects a key already uploaded under another name, reuse it
+	sshKeys, err := client.GetSshkeys(d.ProjectID, d.RegionName)
+	if err != nil {
+		return err
+	}
+	if sshKey = findSshkeyByContent(sshKeys, string(publicKey)); sshKey != nil {
+		log.Infof("Public key %s is already in the project as ssh key %s, reusing it", d.publicSSHKeyPath(), sshKey.Name)
+		d.KeyPairID = sshKey.ID
+		d.ReusedKeyPair = sshKey.Name
+		return nil
+	}
+
 	// Upload key
 	sshKey, err = client.CreateSshkey(d.ProjectID, d.KeyPairName, string(publicKey))
 	if err != nil {
@@ -342,8 +1243,21 @@ func (d *Driver) ensureSSHKey() error {
 
 // waitForInstanceStatus waits until instance reaches status. Copied from openstack Driver
 func (d *Driver) waitForInstanceStatus(status string) (instance *Instance, err error) {
-	return instance, mcnutils.WaitForSpecificOrError(func() (bool, error) {
-		instance, err = d.client.GetInstance(d.ProjectID, d.InstanceID)
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	return instance, waitWithBackoffFor(d.statusTimeout(), func() (bool, error) {
+		select {
+		case <-d.interrupted:
+			return true, errInterrupted
+		default:
+		}
+		instance, err = client.GetInstance(d.ProjectID, d.InstanceID)
+		if isTransientError(err) {
+			log.Debugf("Retrying status of instance %s: %s", d.InstanceID, err)
+			return false, nil
+		}
 		if err != nil {
 			return true, err
 		}
@@ -353,7 +1267,7 @@ func (d *Driver) waitForInstanceStatus(status string) (instance *Instance, err e
 		})
 
 		if instance.Status == "ERROR" {
-			return true, fmt.Errorf("Instance creation failed. Instance is in ERROR state")
+			return true, d.instanceFailureError(instance)
 		}
 
 		if instance.Status == status {
@@ -361,7 +1275,39 @@ func (d *Driver) waitForInstanceStatus(status string) (instance *Instance, err e
 		}
 
 		return false, nil
-	}, (statusTimeout / 4), 4*time.Second)
+	})
+}
+
+// waitWithBackoff calls f until it returns true or an error, with exponentially
+// increasing intervals to spare API calls and rate limits, up to statusTimeout
+func waitWithBackoff(f func() (bool, error)) error {
+	return waitWithBackoffFor(statusTimeout, f)
+}
+
+// waitWithBackoffFor is waitWithBackoff up to timeout
+func waitWithBackoffFor(timeout time.Duration, f func() (bool, error)) error {
+	interval := pollInitialInterval
+	deadline := time.Now().Add(timeout)
+
+	for {
+		done, err := f()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("Timed out after %s", timeout)
+		}
+		time.Sleep(interval)
+
+		interval = interval * 3 / 2
+		if interval > pollMaxInterval {
+			interval = pollMaxInterval
+		}
+	}
 }
 
 // GetSSHHostname returns the hostname for SSH
@@ -375,60 +1321,351 @@ func (d *Driver) GetSSHKeyPath() string {
 }
 
 // Create a new docker machine instance on OVH Cloud
-func (d *Driver) Create() error {
-	client, err := d.getClient()
+func (d *Driver) Create() (err error) {
+	defer func() { err = d.supportError(err) }()
+	span := d.traceOperation("Create")
+	defer func() { span.end(err) }()
+
+	unlock, err := d.lockMachine("create")
 	if err != nil {
 		return err
 	}
+	defer unlock()
+	defer func() {
+		if err != nil {
+			d.notify(EventError, err)
+		}
+	}()
+	defer func() {
+		if isMaintenanceError(err) && d.CreatePhase != "" {
+			err = fmt.Errorf("%s. The OVH API is in maintenance: once it is back, delete %s and run the same create again to resume after phase %s", err, d.ResolveStorePath(""), d.CreatePhase)
+		}
+	}()
 
-	// Ensure ssh key
-	err = d.ensureSSHKey()
+	client, err := d.getClient()
 	if err != nil {
 		return err
 	}
 
-	// Create instance
-	log.Debug("Creating OVH instance...")
-	monthlyBilling := d.BillingPeriod == "monthly"
-	instance, err := client.CreateInstance(
-		d.ProjectID,
-		d.MachineName,
-		d.KeyPairID,
-		d.FlavorID,
-		d.ImageID,
-		d.RegionName,
-		d.NetworkIDs,
-		monthlyBilling,
-	)
+	err = d.checkEngineOptions()
 	if err != nil {
 		return err
 	}
-	d.InstanceID = instance.ID
 
-	// Wait until instance is ACTIVE
-	log.Debugf("Waiting for OVH instance...", map[string]interface{}{"MachineID": d.InstanceID})
-	instance, err = d.waitForInstanceStatus("ACTIVE")
+	// Resume an interrupted create, if any
+	var instance *Instance
+	err = d.resumeCreate()
 	if err != nil {
 		return err
 	}
+	d.ProvisionInputs = d.provisionInputs()
+	d.startTiming()
+	claimed := false
+
+	if !d.reached(phaseKeyEnsured) {
+		// Ensure ssh key
+		err = d.ensureSSHKey()
+		if err != nil {
+			return err
+		}
+
+		// Snapshot clone source
+		if d.CloneFrom != "" {
+			err = d.snapshotCloneSource()
+			if err != nil {
+				return err
+			}
+		}
+
+		// Find or create instance group
+		err = d.ensureInstanceGroup()
+		if err != nil {
+			return err
+		}
+
+		err = d.checkpoint(phaseKeyEnsured)
+		if err != nil {
+			return err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		if !d.reached(phaseInstanceRequested) {
+			// Claim an instance of the warm pool, or else create one
+			instance = nil
+			if d.WarmPool != "" {
+				instance, err = d.claimWarmPoolInstance(client)
+				if err != nil {
+					return err
+				}
+				d.WarmPoolClaimed = instance != nil
+				claimed = claimed || d.WarmPoolClaimed
+			}
+			if instance == nil {
+				log.Debug("Creating OVH instance...")
+				err = d.generateRootPassword()
+				if err != nil {
+					return err
+				}
+				instance, err = d.requestInstanceOnce(client)
+				if err != nil {
+					return err
+				}
+			}
+			d.InstanceID = instance.ID
+			d.CreateRequestedAt = 0
+			log.Infof("Created OVH instance %s in service %s. Please mention both when contacting OVH support", d.InstanceID, d.ProjectID)
+			d.printRootPassword()
+
+			err = d.checkpoint(phaseInstanceRequested)
+			if err != nil {
+				return err
+			}
+			d.notify(EventCreated, nil)
+
+			if err := d.registerBudgetAlert(client); err != nil {
+				log.Warn(err)
+			}
+			if d.WarmPool != "" {
+				log.Infof("Run 'docker-machine-driver-ovh refill-pool %s' to replace the instances taken from warm pool %s", d.MachineName, d.WarmPool)
+			}
+		}
+
+		if !d.reached(phaseActive) {
+			// Wait until instance is ACTIVE
+			log.Debugf("Waiting for OVH instance...", map[string]interface{}{"MachineID": d.InstanceID})
+			stopWatching := d.watchInterrupt()
+			instance, err = d.waitForInstanceStatus("ACTIVE")
+			if err == errInterrupted {
+				d.abortCreate()
+			}
+			stopWatching()
+			if err != nil {
+				return err
+			}
+
+			if d.AttachPrivateNetwork {
+				instance, err = d.attachPrivateNetwork(client, instance)
+				if err != nil {
+					return err
+				}
+			}
+
+			d.verifyPlacement()
+
+			err = d.checkpoint(phaseActive)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !d.reached(phaseIPAssigned) {
+			if instance == nil {
+				instance, err = client.GetInstance(d.ProjectID, d.InstanceID)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Save Ip addresses
+			d.IPAddress = ""
+			d.PrivateIPAddress = ""
+			for _, ip := range instance.IPAddresses {
+				if ip.Type == "public" && d.IPAddress == "" {
+					d.IPAddress = ip.IP
+				}
+				if ip.Type == "private" && d.PrivateIPAddress == "" {
+					d.PrivateIPAddress = ip.IP
+				}
+			}
+
+			if d.NoPublicNetwork {
+				d.IPAddress = d.PrivateIPAddress
+			}
+			if d.IPAddress == "" {
+				return fmt.Errorf("No IP found for instance %s", instance.ID)
+			}
+
+			log.Debugf("IP address found", map[string]interface{}{
+				"MachineID": d.InstanceID,
+				"IP":        d.IPAddress,
+			})
+
+			err = d.checkpoint(phaseIPAssigned)
+			if err != nil {
+				return err
+			}
+			d.notify(EventIPAssigned, nil)
+		}
 
-	// Save Ip address
-	d.IPAddress = ""
-	for _, ip := range instance.IPAddresses {
-		if ip.Type == "public" {
-			d.IPAddress = ip.IP
+		// Replace the instance while its public IP is in an excluded range
+		excluded := d.excludedIPRange()
+		if excluded == "" {
 			break
 		}
+		if attempt >= d.IPAttempts {
+			return fmt.Errorf("Public IP %s of instance %s is in excluded range %s after %d attempts. The instance is kept, remove the machine to delete it", d.IPAddress, d.InstanceID, excluded, attempt)
+		}
+		log.Infof("Public IP %s is in excluded range %s, replacing instance %s (attempt %d/%d)...", d.IPAddress, excluded, d.InstanceID, attempt, d.IPAttempts)
+		err = client.DeleteInstance(d.ProjectID, d.InstanceID)
+		if err != nil {
+			return err
+		}
+		instance = nil
+		d.InstanceID = ""
+		d.IPAddress = ""
+		d.PrivateIPAddress = ""
+		err = d.checkpoint(phaseKeyEnsured)
+		if err != nil {
+			return err
+		}
 	}
 
-	if d.IPAddress == "" {
-		return fmt.Errorf("No IP found for instance %s", instance.ID)
+	// Let virtual IPs through the private network port
+	err = d.applyPortSecurity(d.InstanceID)
+	if err != nil {
+		return err
 	}
 
-	log.Debugf("IP address found", map[string]interface{}{
-		"MachineID": d.InstanceID,
-		"IP":        d.IPAddress,
-	})
+	// Restrict ports of the public network port
+	err = d.applySecurityGroups()
+	if err != nil {
+		return err
+	}
+
+	// Label the instance like its engine
+	err = d.applyLabels(d.InstanceID)
+	if err != nil {
+		return err
+	}
+	d.applyIAMTags(client, d.InstanceID)
+
+	// The clone no longer needs its snapshot
+	if d.CloneSnapshotID != "" {
+		d.deleteCloneSnapshot()
+	}
+
+	if !d.reached(phaseSSHReady) {
+		// Metal instances boot well after they are active
+		err = d.waitForMetalSSH()
+		if err != nil {
+			return err
+		}
+
+		// Hand the claimed pool instance over to the machine
+		if d.WarmPoolClaimed {
+			err = d.adoptWarmPoolInstance()
+			if err != nil {
+				return err
+			}
+			d.WarmPoolClaimed = false
+			err = d.checkpoint(d.CreatePhase)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Wait for first boot configuration, before engine installation
+		if d.userData() != "" {
+			err = d.waitForUserData()
+			if err != nil {
+				return err
+			}
+			if d.Harden {
+				d.logHardening()
+			}
+		} else {
+			err = drivers.WaitForSSH(d)
+			if err != nil {
+				return err
+			}
+		}
+		err = d.checkSudo()
+		if err != nil {
+			return err
+		}
+		d.checkRootSize()
+		if d.CheckSMTP {
+			d.checkSMTP()
+		}
+		d.recordHostKeys()
+
+		if d.RuntimeSSHUser != "" {
+			log.Infof("Once docker-machine provisioned %s, switch to ssh user %s with: docker-machine-driver-ovh switch-ssh-user %s", d.MachineName, d.RuntimeSSHUser, d.MachineName)
+		}
+		if d.DNSZone != "" {
+			log.Infof("Once the engine of %s is a Swarm manager, publish its discovery records with: docker-machine-driver-ovh publish-discovery %s", d.MachineName, d.MachineName)
+		}
+		d.updateSSHConfig()
+
+		err = d.checkpoint(phaseSSHReady)
+		if err != nil {
+			return err
+		}
+		d.recordTiming(claimed)
+	}
+
+	// Register the other machines of a bulk create
+	if len(d.BulkInstanceIDs) > 0 {
+		err = d.registerBulkMachines()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Reboot the machine when it stops working
+	if d.AutoRecover {
+		err = d.setupAutoRecover()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Shelve the machine outside of office hours
+	if d.OfficeHours != "" {
+		err = d.setupOfficeHours()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Encrypt traffic with the other machines of the mesh
+	if d.WireGuardMesh != "" && d.WireGuardPublicKey == "" {
+		err = d.joinWireGuardMesh()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Let cluster members address each other by name
+	if d.ClusterHosts {
+		err = d.updateClusterHosts(false)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Relocate docker data onto a dedicated volume, before engine installation
+	if d.DataVolumeSize > 0 && d.DataVolumeMount == "" {
+		err = d.setupDataVolume()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Serve behind the load balancers
+	if len(d.LoadBalancerPools) > 0 {
+		err = d.joinLoadBalancerPools()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Keep the boot logs of the machine
+	d.archiveInstance()
+
+	// The machine is complete, a new create starts from scratch
+	d.clearCheckpoint()
 
 	// All done !
 	return nil
@@ -439,15 +1676,27 @@ func (d *Driver) publicSSHKeyPath() string {
 }
 
 // GetState return instance status
-func (d *Driver) GetState() (state.State, error) {
+func (d *Driver) GetState() (st state.State, err error) {
+	defer func() { err = d.supportError(err) }()
+	span := d.traceOperation("GetState")
+	defer func() { span.end(err) }()
+
 	log.Debugf("Get status for OVH instance...", map[string]interface{}{"MachineID": d.InstanceID})
 
+	// The instance is gone until the machine is removed
+	if d.DeletedOnStop {
+		return state.Stopped, nil
+	}
+
 	client, err := d.getClient()
 	if err != nil {
 		return state.None, err
 	}
 
 	instance, err := client.GetInstance(d.ProjectID, d.InstanceID)
+	if _, ok := err.(*InstanceNotFoundError); ok {
+		return state.Error, fmt.Errorf("Instance %s of machine %s no longer exists. Please remove the machine with 'docker-machine rm %s'", d.InstanceID, d.MachineName, d.MachineName)
+	}
 	if err != nil {
 		return state.None, err
 	}
@@ -456,17 +1705,32 @@ func (d *Driver) GetState() (state.State, error) {
 		"MachineID": d.InstanceID,
 		"State":     instance.Status,
 	})
+	d.refreshHealth(instance)
+	d.warnMaintenance(instance)
+
+	// Back up the certificates docker-machine generated after create
+	if instance.Status == "ACTIVE" {
+		d.warnAddressChange(instance)
+		d.backupCerts()
+		d.notifyProvisioned()
+	}
 
 	switch instance.Status {
-	case "ACTIVE":
+	case "ACTIVE", "MIGRATING":
 		return state.Running, nil
 	case "PAUSED":
 		return state.Paused, nil
 	case "SUSPENDED":
 		return state.Saved, nil
-	case "SHUTOFF":
+	case "SHUTOFF", "SHELVED", "SHELVED_OFFLOADED":
 		return state.Stopped, nil
-	case "BUILDING":
+	case "BUILD", "BUILDING", "REBUILD", "RESIZE", "REBOOT", "HARD_REBOOT":
+		return state.Starting, nil
+	case "VERIFY_RESIZE":
+		if d.Metal {
+			return state.Error, fmt.Errorf("Metal instance %s is pending a resize, which metal instances do not support. Please check it in %s", d.InstanceID, CustomerInterface)
+		}
+		log.Infof("OVH instance %s of machine %s is pending a resize. Run 'docker-machine-driver-ovh confirm-resize %s' or 'docker-machine-driver-ovh revert-resize %s'", d.InstanceID, d.MachineName, d.MachineName, d.MachineName)
 		return state.Starting, nil
 	case "ERROR":
 		return state.Error, nil
@@ -475,6 +1739,47 @@ func (d *Driver) GetState() (state.State, error) {
 	return state.None, nil
 }
 
+// resolveResize confirms, or reverts with revert, the pending resize of the
+// instance to bring it back to a manageable state, and records its flavor
+func (d *Driver) resolveResize(revert bool) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	instance, err := client.GetInstance(d.ProjectID, d.InstanceID)
+	if err != nil {
+		return err
+	}
+	if instance.Status != "VERIFY_RESIZE" {
+		return fmt.Errorf("OVH instance %s of machine %s is %s, with no pending resize", d.InstanceID, d.MachineName, instance.Status)
+	}
+	if d.Metal {
+		return fmt.Errorf("Metal instance %s is pending a resize, which metal instances do not support. Please check it in %s", d.InstanceID, CustomerInterface)
+	}
+
+	if revert {
+		log.Infof("Reverting pending resize of OVH instance %s...", d.InstanceID)
+		err = client.RevertResize(d.ProjectID, d.InstanceID)
+	} else {
+		log.Infof("Confirming pending resize of OVH instance %s...", d.InstanceID)
+		err = client.ConfirmResize(d.ProjectID, d.InstanceID)
+	}
+	if err != nil {
+		return err
+	}
+
+	instance, err = d.waitForInstanceStatus("ACTIVE")
+	if err != nil {
+		return err
+	}
+	d.FlavorID = instance.Flavor.ID
+	if instance.Flavor.Name != "" {
+		d.FlavorName = instance.Flavor.Name
+	}
+	log.Infof("Machine %s runs flavor %s", d.MachineName, d.FlavorName)
+	return nil
+}
+
 // GetURL returns docker daemon URL on this machine
 func (d *Driver) GetURL() (string, error) {
 	if d.IPAddress == "" {
@@ -483,44 +1788,44 @@ func (d *Driver) GetURL() (string, error) {
 	return fmt.Sprintf("tcp://%s", net.JoinHostPort(d.IPAddress, "2376")), nil
 }
 
-// Remove deletes a machine and it's SSH keys from OVH Cloud
-func (d *Driver) Remove() error {
-	log.Debugf("deleting instance...", map[string]interface{}{"MachineID": d.InstanceID})
-	log.Info("Deleting OVH instance...")
+// Remove deletes a machine and it's dependent resources from OVH Cloud
+func (d *Driver) Remove() (err error) {
+	defer func() { err = d.supportError(err) }()
+	span := d.traceOperation("Remove")
+	defer func() { span.end(err) }()
 
-	client, err := d.getClient()
+	unlock, err := d.lockMachine("remove")
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	// Deletes instance, if we created it
-	if d.InstanceID != "" {
-		err = client.DeleteInstance(d.ProjectID, d.InstanceID)
-		if err != nil {
-			return err
-		}
-	}
+	log.Debugf("deleting instance...", map[string]interface{}{"MachineID": d.InstanceID})
+	log.Info("Deleting OVH instance...")
+	return removeMachineSet([]*Driver{d})
+}
 
-	// If key name  does not starts with the machine ID, this is a pre-existing key, keep it
-	if !strings.HasPrefix(d.KeyPairName, d.MachineName) {
-		log.Debugf("keeping key pair...", map[string]interface{}{"KeyPairID": d.KeyPairID})
-		return nil
+// Restart this docker-machine
+func (d *Driver) Restart() (err error) {
+	defer func() { err = d.supportError(err) }()
+
+	unlock, err := d.lockMachine("restart")
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	// Deletes ssh key, if we created it
-	if d.KeyPairID != "" {
-		log.Debugf("deleting key pair...", map[string]interface{}{"KeyPairID": d.KeyPairID})
-		err = client.DeleteSshkey(d.ProjectID, d.KeyPairID)
+	// Queue restarts requested outside of the reboot window
+	if d.RebootWindow != "" {
+		window, err := parseRebootWindow(d.RebootWindow)
 		if err != nil {
 			return err
 		}
+		if !window.contains(time.Now()) {
+			return d.queueReboot(window)
+		}
 	}
 
-	return nil
-}
-
-// Restart this docker-machine
-func (d *Driver) Restart() error {
 	log.Debugf("Restarting OVH instance...", map[string]interface{}{"MachineID": d.InstanceID})
 
 	client, err := d.getClient()
@@ -544,12 +1849,40 @@ func (d *Driver) Kill() (err error) {
 	return fmt.Errorf("Killing machines is not possible on OVH Cloud")
 }
 
-// Start (STUB) start machine
+// Start starts, or unshelves, the instance of a stopped machine
 func (d *Driver) Start() (err error) {
-	return fmt.Errorf("Starting machines is not possible on OVH Cloud")
+	defer func() { err = d.supportError(err) }()
+
+	unlock, err := d.lockMachine("start")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	return d.startInstance(client)
 }
 
-// Stop (STUB) stop machine
+// Stop stops, shelves or deletes the instance, as selected with '--ovh-on-stop'
 func (d *Driver) Stop() (err error) {
-	return fmt.Errorf("Stopping machines is not possible on OVH Cloud")
+	defer func() { err = d.supportError(err) }()
+
+	unlock, err := d.lockMachine("stop")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if d.OnStop == OnStopDelete {
+		return d.deleteOnStop()
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	return d.stopInstance(client)
 }
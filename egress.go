@@ -0,0 +1,72 @@
+package main
+
+import "fmt"
+
+// egressLimitLabel is the engine label recording the egress limit
+const egressLimitLabel = "com.ovh.egress-limit-mbps"
+
+// egressLimitScript installs a boot service shaping the outbound traffic of
+// the public interfaces with a token bucket filter
+const egressLimitScript = `# Limit public egress to %[1]d Mbps
+cat > /usr/local/sbin/ovh-egress-limit <<'EOF'
+#!/bin/sh
+%[2]sfor IF in $(ls /sys/class/net); do
+	[ "$IF" = lo ] && continue
+	case " $PRIVATE_IFS " in *" $IF "*) continue ;; esac
+	case "$IF" in docker*|br-*|veth*) continue ;; esac
+	tc qdisc replace dev "$IF" root tbf rate %[1]dmbit burst %[3]dkb latency 50ms
+done
+exit 0
+EOF
+chmod +x /usr/local/sbin/ovh-egress-limit
+cat > /etc/systemd/system/ovh-egress-limit.service <<'EOF'
+[Unit]
+Description=Public egress limited to %[1]d Mbps
+Wants=network-online.target
+After=network-online.target
+Before=docker.service
+
+[Service]
+Type=oneshot
+ExecStart=/usr/local/sbin/ovh-egress-limit
+
+[Install]
+WantedBy=multi-user.target
+EOF
+systemctl daemon-reload
+systemctl enable --now ovh-egress-limit
+`
+
+// egressLimitEngineLabel returns the engine label recording the egress
+// limit, if any
+func (d *Driver) egressLimitEngineLabel() string {
+	if d.EgressLimitMbps <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s=%d", egressLimitLabel, d.EgressLimitMbps)
+}
+
+// validateEgressLimit checks the egress limit applies to a public interface
+func (c *Config) validateEgressLimit() error {
+	if c.EgressLimitMbps < 0 {
+		return fmt.Errorf("Invalid egress limit %d. Please select a number of Mbps with '--ovh-egress-limit-mbps'", c.EgressLimitMbps)
+	}
+	if c.EgressLimitMbps > 0 && c.NoPublicNetwork {
+		return fmt.Errorf("'--ovh-egress-limit-mbps' limits the public network and cannot be combined with '--ovh-no-public-network'")
+	}
+	return nil
+}
+
+// egressLimitUserData returns the first boot script section limiting the
+// public egress. The burst allows about 10ms of traffic, at least 32kb
+func (d *Driver) egressLimitUserData() string {
+	if d.EgressLimitMbps <= 0 {
+		return ""
+	}
+
+	burst := d.EgressLimitMbps * 10 / 8
+	if burst < 32 {
+		burst = 32
+	}
+	return fmt.Sprintf(egressLimitScript, d.EgressLimitMbps, d.privateInterfaces(), burst)
+}
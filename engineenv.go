@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// engineEnvScript writes the docker engine environment in a systemd drop-in,
+// which applies once the engine gets installed and started
+const engineEnvScript = `# Configure docker engine environment
+mkdir -p /etc/systemd/system/docker.service.d
+cat > /etc/systemd/system/docker.service.d/20-ovh-env.conf <<'EOF'
+[Service]
+%sEOF
+systemctl daemon-reload
+`
+
+var validEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateEngineEnv checks the KEY=VALUE engine environment variables
+func validateEngineEnv(env []string) error {
+	for _, variable := range env {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 || !validEnvName.MatchString(parts[0]) {
+			return fmt.Errorf("Invalid engine environment variable '%s'. Expected KEY=VALUE", variable)
+		}
+		if strings.ContainsAny(parts[1], "\n\r") {
+			return fmt.Errorf("Engine environment variable %s must fit on a single line", parts[0])
+		}
+	}
+	return nil
+}
+
+// engineEnvUserData returns the first boot script section setting the docker
+// engine environment
+func (d *Driver) engineEnvUserData() string {
+	if len(d.EngineEnv) == 0 {
+		return ""
+	}
+
+	// Quote for systemd: escape quotes, backslashes and specifiers
+	quoter := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%")
+	var lines string
+	for _, variable := range d.EngineEnv {
+		lines += fmt.Sprintf("Environment=\"%s\"\n", quoter.Replace(variable))
+	}
+	return fmt.Sprintf(engineEnvScript, lines)
+}
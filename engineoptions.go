@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// engineOptions is the part of the engine options of a machine configuration
+// holding settings the driver options also give to the engine
+type engineOptions struct {
+	Labels           []string
+	InsecureRegistry []string
+}
+
+// loadEngineOptions reads the engine options of the machine configuration,
+// which docker-machine saves before the create and keeps out of the driver
+func (d *Driver) loadEngineOptions() (*engineOptions, error) {
+	data, err := ioutil.ReadFile(filepath.Join(d.StorePath, "machines", d.MachineName, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		HostOptions struct {
+			EngineOptions engineOptions
+		}
+	}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, err
+	}
+	return &config.HostOptions.EngineOptions, nil
+}
+
+// checkEngineOptions checks that the engine settings of the driver options
+// are also engine options of the machine. The provisioning starts the engine
+// with its engine options as flags, and the engine refuses to start with a
+// setting both as a flag and in daemon.json, so the driver cannot set them
+// there itself
+func (d *Driver) checkEngineOptions() error {
+	labels := d.engineLabels()
+	if label := d.egressLimitEngineLabel(); label != "" {
+		labels = append(labels, label)
+	}
+	if len(d.InsecureRegistries) == 0 && len(labels) == 0 {
+		return nil
+	}
+
+	options, err := d.loadEngineOptions()
+	if err != nil {
+		return fmt.Errorf("Could not read the engine options of machine %s: %s", d.MachineName, err)
+	}
+
+	var missing []string
+	for _, label := range labels {
+		if !containsString(options.Labels, label) {
+			missing = append(missing, "--engine-label "+label)
+		}
+	}
+	for _, registry := range d.InsecureRegistries {
+		if !containsString(options.InsecureRegistry, registry) {
+			missing = append(missing, "--engine-insecure-registry "+registry)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("The engine of the machine would not get the settings of the OVH options. Please also pass '%s'", strings.Join(missing, " "))
+	}
+	return nil
+}
+
+// containsString tells whether a list holds a value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// instanceFault is the fault of an OpenStack server in ERROR state
+type instanceFault struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Details string `json:"details"`
+	Created string `json:"created"`
+}
+
+// instanceFault returns the fault of the instance, which the OVH API does not
+// report, through the OpenStack compute API
+func (d *Driver) instanceFault(o *openStack) (*instanceFault, error) {
+	endpoint, ok := o.endpoints("compute")[d.RegionName]
+	if !ok {
+		return nil, fmt.Errorf("No OpenStack compute endpoint found for region %s", d.RegionName)
+	}
+	var server struct {
+		Server struct {
+			Fault *instanceFault `json:"fault"`
+		} `json:"server"`
+	}
+	_, err := o.call("GET", endpoint+"/servers/"+d.InstanceID, nil, &server)
+	if err != nil {
+		return nil, err
+	}
+	return server.Server.Fault, nil
+}
+
+// captureInstanceFailure saves the evidence of an instance in ERROR state
+// under the machine directory: the instance as the OVH API reports it, and its
+// fault and console log when OpenStack credentials are set. It returns the
+// directory and the fault message, if any
+func (d *Driver) captureInstanceFailure(instance *Instance) (dir, fault string) {
+	if d.StorePath == "" {
+		return "", ""
+	}
+	dir = d.ResolveStorePath(filepath.Join("failures", fmt.Sprintf("%s-%s", d.InstanceID, time.Now().UTC().Format("20060102150405"))))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Warnf("Could not save the failure of instance %s: %s", d.InstanceID, err)
+		return "", ""
+	}
+
+	files := make(map[string][]byte)
+	if data, err := json.MarshalIndent(instance, "", "  "); err == nil {
+		files["instance.json"] = data
+	}
+	if o, err := d.openStack("Capturing the fault of the instance"); err != nil {
+		log.Debugf("Not capturing the fault and console of instance %s: %s", d.InstanceID, err)
+	} else {
+		if f, err := d.instanceFault(o); err != nil {
+			log.Debugf("Could not read the fault of instance %s: %s", d.InstanceID, err)
+		} else if f != nil {
+			fault = f.Message
+			files["fault.txt"] = []byte(fmt.Sprintf("%d %s\n%s\n%s\n", f.Code, f.Message, f.Created, f.Details))
+		}
+		if console, err := d.consoleLog(o); err != nil {
+			log.Debugf("Could not read the console of instance %s: %s", d.InstanceID, err)
+		} else {
+			files["console.log"] = console
+		}
+	}
+
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			log.Warnf("Could not save %s of instance %s: %s", name, d.InstanceID, err)
+		}
+	}
+	return dir, fault
+}
+
+// instanceFailureError returns the error of an instance in ERROR state, with
+// its fault and where its evidence was saved
+func (d *Driver) instanceFailureError(instance *Instance) error {
+	dir, fault := d.captureInstanceFailure(instance)
+	message := fmt.Sprintf("Instance creation failed. Instance %s is in ERROR state", d.InstanceID)
+	if fault != "" {
+		message += ": " + fault
+	}
+	if dir != "" {
+		message += fmt.Sprintf(". Its details are saved in %s", dir)
+	}
+	return fmt.Errorf("%s", message)
+}
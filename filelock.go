@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Locks of the store are files created exclusively, holding a description of
+// their holder and a token of their own. The holder keeps touching its lock,
+// so that the lock of a crashed process is broken once it stops, however long
+// the holder works, and only removes the lock while it still holds its token
+const (
+	lockHeartbeat = 10 * time.Second
+	lockStale     = 6 * lockHeartbeat
+	lockPeriod    = 100 * time.Millisecond
+)
+
+// lockFile creates the lock path for holder, waiting up to timeout while
+// another process holds it. The lock is held until the returned function is
+// called
+func lockFile(path, holder string, timeout time.Duration) (unlock func(), err error) {
+	token := randomHex(16)
+	content := []byte(fmt.Sprintf("%s (process %d)\n%s\n", holder, os.Getpid(), token))
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = f.Write(content)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return holdLock(path, token), nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockStale {
+			breakStaleLock(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out after %s, held by %s", timeout, lockHolder(path))
+		}
+		time.Sleep(lockPeriod)
+	}
+}
+
+// holdLock touches the lock until it is released, and then removes it when
+// it still holds token
+func holdLock(path, token string) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lockHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				os.Chtimes(path, now, now)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		data, err := ioutil.ReadFile(path)
+		if err != nil || !strings.Contains(string(data), "\n"+token+"\n") {
+			log.Debugf("Lock %s was taken over, leaving it", path)
+			return
+		}
+		os.Remove(path)
+	}
+}
+
+// breakStaleLock removes the lock of a crashed process. The lock is moved
+// aside first, and back when another process broke it and took it meanwhile
+func breakStaleLock(path string) {
+	stale, _ := ioutil.ReadFile(path)
+	aside := fmt.Sprintf("%s.stale-%d", path, os.Getpid())
+	if err := os.Rename(path, aside); err != nil {
+		return
+	}
+	if moved, _ := ioutil.ReadFile(aside); !bytes.Equal(moved, stale) {
+		os.Link(aside, path)
+	} else {
+		log.Debugf("Breaking stale lock %s of %s", path, lockHolder(aside))
+	}
+	os.Remove(aside)
+}
+
+// lockHolder describes the holder of a lock
+func lockHolder(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return "another process"
+	}
+	return strings.SplitN(string(data), "\n", 2)[0]
+}
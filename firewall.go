@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// egressIPURL returns the public IP address of the caller, as plain text
+	egressIPURL = "https://api.ipify.org"
+
+	// egressIPTimeout bounds the egress IP detection
+	egressIPTimeout = 10 * time.Second
+)
+
+// Keywords of '--ovh-docker-allowed-cidrs': the egress IP of this host, and
+// any source
+const (
+	AllowedCIDRsAuto = "auto"
+	AllowedCIDRsAny  = "any"
+)
+
+// resolveDockerAllowedCIDRs validates the sources allowed to reach the Docker
+// port, in the security group of the machine. Without the option, the port is
+// restricted to the egress IP of this host when the OpenStack credentials
+// managing security groups are set, and left open with a warning otherwise
+func (d *Driver) resolveDockerAllowedCIDRs() error {
+	if d.NoPublicNetwork {
+		d.DockerAllowedCIDRs = nil
+		return nil
+	}
+
+	explicit := len(d.DockerAllowedCIDRs) > 0
+	allowed := d.DockerAllowedCIDRs
+	if !explicit {
+		allowed = []string{AllowedCIDRsAuto}
+	}
+
+	var cidrs []string
+	for _, cidr := range allowed {
+		switch {
+		case cidr == AllowedCIDRsAny:
+			if len(allowed) > 1 {
+				return fmt.Errorf("Invalid '--ovh-docker-allowed-cidrs'. '%s' cannot be combined with other CIDRs", AllowedCIDRsAny)
+			}
+			d.DockerAllowedCIDRs = nil
+			return nil
+		case cidr == AllowedCIDRsAuto:
+			ip, err := getEgressIP()
+			if err != nil {
+				return fmt.Errorf("Could not detect the egress IP of this host, please set '--ovh-docker-allowed-cidrs' explicitly: %s", err)
+			}
+			log.Infof("Allowing Docker port from detected egress IP %s", ip)
+			cidr = ip + "/32"
+		case !strings.Contains(cidr, "/"):
+			cidr = cidr + "/32"
+		}
+
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("Invalid CIDR '%s' in '--ovh-docker-allowed-cidrs'", cidr)
+		}
+		cidrs = append(cidrs, cidr)
+	}
+
+	o, err := d.openStack("'--ovh-docker-allowed-cidrs'")
+	if err != nil && !explicit {
+		log.Warnf("%s. The Docker port is left open to any source, protected by TLS only", err)
+		d.DockerAllowedCIDRs = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := o.endpoints("network")[d.RegionName]; !ok {
+		return fmt.Errorf("No OpenStack networking endpoint found for region %s", d.RegionName)
+	}
+
+	d.DockerAllowedCIDRs = cidrs
+	return nil
+}
+
+// dockerPorts returns the Docker ports of the machine: the engine, and the
+// Swarm manager of a master
+func (d *Driver) dockerPorts() []int {
+	if d.SwarmMaster {
+		return []int{2376, 3376}
+	}
+	return []int{2376}
+}
+
+// getEgressIP returns the public IP address this host connects from
+func getEgressIP() (string, error) {
+	client := &http.Client{Timeout: egressIPTimeout}
+	resp, err := client.Get(egressIPURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	ip := strings.TrimSpace(string(body))
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("unexpected answer from %s", egressIPURL)
+	}
+	return ip, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// neutronPort is an OpenStack networking port
+type neutronPort struct {
+	ID        string `json:"id"`
+	NetworkID string `json:"network_id"`
+	DeviceID  string `json:"device_id"`
+	Status    string `json:"status"`
+	FixedIPs  []struct {
+		IPAddress string `json:"ip_address"`
+	} `json:"fixed_ips"`
+}
+
+// addresses returns the fixed IPs of the port
+func (p *neutronPort) addresses() string {
+	var ips []string
+	for _, ip := range p.FixedIPs {
+		ips = append(ips, ip.IPAddress)
+	}
+	return strings.Join(ips, ", ")
+}
+
+// getPort returns a port of region
+func (o *openStack) getPort(region, portID string) (*neutronPort, error) {
+	endpoint, ok := o.endpoints("network")[region]
+	if !ok {
+		return nil, fmt.Errorf("No OpenStack networking endpoint found for region %s", region)
+	}
+	var port struct {
+		Port neutronPort `json:"port"`
+	}
+	_, err := o.call("GET", endpoint+"/v2.0/ports/"+portID, nil, &port)
+	if apierror, ok := err.(*openStackError); ok && apierror.Code == 404 {
+		return nil, fmt.Errorf("Invalid port '%s'. It could not be found in region %s. Please select a port of the region with '--ovh-port-id'", portID, region)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &port.Port, nil
+}
+
+// validatePort checks that the port of '--ovh-port-id' exists in the region
+// and is free, as ports are bound to a single instance
+func (d *Driver) validatePort() error {
+	if d.PortID == "" {
+		return nil
+	}
+
+	o, err := d.openStack("'--ovh-port-id'")
+	if err != nil {
+		return err
+	}
+	if _, ok := o.endpoints("compute")[d.RegionName]; !ok {
+		return fmt.Errorf("No OpenStack compute endpoint found for region %s", d.RegionName)
+	}
+	port, err := o.getPort(d.RegionName, d.PortID)
+	if err != nil {
+		return err
+	}
+	if port.DeviceID != "" && port.DeviceID != d.interruptedInstanceID() {
+		return fmt.Errorf("Port %s is already bound to %s. Please select a free port with '--ovh-port-id'", d.PortID, port.DeviceID)
+	}
+	log.Infof("Using port %s of network %s with addresses %s", port.ID, port.NetworkID, port.addresses())
+	return nil
+}
+
+// interruptedInstanceID returns the instance of an interrupted create of the
+// machine, which its port may already be attached to
+func (d *Driver) interruptedInstanceID() string {
+	data, err := ioutil.ReadFile(filepath.Join(d.checkpointPath(), "state.json"))
+	if err != nil {
+		return ""
+	}
+	var previous struct {
+		InstanceID string
+	}
+	json.Unmarshal(data, &previous)
+	return previous.InstanceID
+}
+
+// createServerWithPort requests the instance of the machine with the port of
+// '--ovh-port-id' among its networks, so that the guest configures it on
+// first boot like any other interface. The OVH API takes networks, not ports,
+// so this goes through the OpenStack compute API, the instance being billed
+// and managed by OVH as any other
+func (d *Driver) createServerWithPort(client *API) (*Instance, error) {
+	o, err := d.openStack("'--ovh-port-id'")
+	if err != nil {
+		return nil, err
+	}
+	endpoint, ok := o.endpoints("compute")[d.RegionName]
+	if !ok {
+		return nil, fmt.Errorf("No OpenStack compute endpoint found for region %s", d.RegionName)
+	}
+
+	var networks []map[string]string
+	for _, id := range d.instanceNetworkIDs() {
+		networks = append(networks, map[string]string{"uuid": id})
+	}
+	networks = append(networks, map[string]string{"port": d.PortID})
+	server := map[string]interface{}{
+		"name":      d.instanceName(),
+		"flavorRef": d.FlavorID,
+		"imageRef":  d.bootImageID(),
+		"key_name":  d.sshKeyName(),
+		"networks":  networks,
+	}
+	if userData := d.userData(); userData != "" {
+		server["user_data"] = base64.StdEncoding.EncodeToString([]byte(userData))
+	}
+	req := map[string]interface{}{"server": server}
+	if d.InstanceGroupID != "" {
+		req["os:scheduler_hints"] = map[string]string{"group": d.InstanceGroupID}
+	}
+
+	var created struct {
+		Server struct {
+			ID string `json:"id"`
+		} `json:"server"`
+	}
+	log.Infof("Creating instance %s with port %s...", d.instanceName(), d.PortID)
+	_, err = o.call("POST", endpoint+"/servers", req, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.BillingPeriod == "monthly" {
+		err = client.ActivateMonthlyBilling(d.ProjectID, created.Server.ID)
+		if err != nil {
+			log.Warnf("Could not switch instance %s to monthly billing, it is billed hourly: %s", created.Server.ID, err)
+		}
+	}
+	return &Instance{ID: created.Server.ID, Name: d.instanceName(), Status: "BUILD"}, nil
+}
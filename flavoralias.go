@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Flavor aliases, resolved to the newest generation of a flavor class in the
+// region, so that they keep working when OVH rolls out a new generation:
+// latest:b for the smallest general purpose flavor, or general-2vcpu-7gb for
+// the smallest one with at least 2 vCPUs and 7 GB of memory
+const latestFlavorPrefix = "latest:"
+
+// flavorClasses maps the classes of descriptive aliases to their family letter
+var flavorClasses = map[string]string{
+	"general":   "b",
+	"compute":   "c",
+	"memory":    "r",
+	"discovery": "d",
+}
+
+var (
+	latestFlavorAlias      = regexp.MustCompile(`^latest:([a-z])$`)
+	descriptiveFlavorAlias = regexp.MustCompile(`^([a-z]+)-(\d+)vcpu-(\d+)gb$`)
+	generationFlavorName   = regexp.MustCompile(`^([a-z])(\d+)-\d+$`)
+)
+
+// parseFlavorAlias returns the family letter and minimum size of a flavor
+// alias, and whether name is one
+func parseFlavorAlias(name string) (letter string, vcpus, memoryGB int, ok bool) {
+	if m := latestFlavorAlias.FindStringSubmatch(name); m != nil {
+		return m[1], 0, 0, true
+	}
+	if m := descriptiveFlavorAlias.FindStringSubmatch(name); m != nil {
+		if letter, ok := flavorClasses[m[1]]; ok {
+			vcpus, _ = strconv.Atoi(m[2])
+			memoryGB, _ = strconv.Atoi(m[3])
+			return letter, vcpus, memoryGB, true
+		}
+	}
+	return "", 0, 0, false
+}
+
+// validateFlavorAlias checks flavor names looking like aliases
+func validateFlavorAlias(name string) error {
+	if _, _, _, ok := parseFlavorAlias(name); ok {
+		return nil
+	}
+	if strings.HasPrefix(name, latestFlavorPrefix) || descriptiveFlavorAlias.MatchString(name) {
+		var classes []string
+		for class := range flavorClasses {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		return fmt.Errorf("Invalid flavor alias '%s'. Please select 'latest:' and a family letter, e.g. 'latest:b', or a class among %s with its size, e.g. 'general-2vcpu-7gb', with '--ovh-flavor'", name, strings.Join(classes, ", "))
+	}
+	return nil
+}
+
+// resolveFlavorAlias replaces a flavor alias with the smallest flavor of the
+// newest generation of its family in the region, with at least the size of
+// the alias
+func (d *Driver) resolveFlavorAlias(client *API) error {
+	letter, vcpus, memoryGB, ok := parseFlavorAlias(d.FlavorName)
+	if !ok {
+		return nil
+	}
+
+	flavors, err := client.GetFlavors(d.ProjectID, d.RegionName)
+	if err != nil {
+		return err
+	}
+	var newest int
+	for _, flavor := range flavors {
+		m := generationFlavorName.FindStringSubmatch(flavor.Name)
+		if flavor.OS != "linux" || m == nil || m[1] != letter || (flavor.Available != nil && !*flavor.Available) || (flavor.Region != "" && flavor.Region != d.RegionName) {
+			continue
+		}
+		if generation, _ := strconv.Atoi(m[2]); generation > newest {
+			newest = generation
+		}
+	}
+	if newest == 0 {
+		return fmt.Errorf("Flavor alias '%s' matches no flavor of the %s family in region %s. Please select a flavor with '--ovh-flavor'", d.FlavorName, letter, d.RegionName)
+	}
+
+	family := fmt.Sprintf("%s%d", letter, newest)
+	var generation Flavors
+	for _, flavor := range flavors {
+		if generationFlavorName.MatchString(flavor.Name) && (flavor.Region == "" || flavor.Region == d.RegionName) {
+			generation = append(generation, flavor)
+		}
+	}
+	flavor := nearestFlavor(generation, family, &Flavor{Vcpus: vcpus, MemoryGB: memoryGB})
+	if flavor == nil || flavor.Vcpus < vcpus || flavor.MemoryGB < memoryGB {
+		return fmt.Errorf("Flavor alias '%s' matches no %s flavor with %d vCPUs and %d GB in region %s. Please select a flavor with '--ovh-flavor'", d.FlavorName, family, vcpus, memoryGB, d.RegionName)
+	}
+
+	log.Infof("Flavor alias %s resolves to %s in region %s", d.FlavorName, flavor.Name, d.RegionName)
+	d.FlavorName = flavor.Name
+	return nil
+}
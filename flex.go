@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// flexSuffix ends the names of flex flavors, which have a smaller fixed disk
+// so that they can be resized to any other flex flavor
+const flexSuffix = "-flex"
+
+// flexVariant returns the flex variant of the flavor in the region, the
+// flavor itself when it is one, or nil when there is none
+func (d *Driver) flexVariant(flavor *Flavor) (*Flavor, error) {
+	if strings.HasSuffix(flavor.Name, flexSuffix) {
+		return flavor, nil
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	flavors, err := client.GetFlavors(d.ProjectID, d.RegionName)
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range flavors {
+		if candidate.OS == "linux" && candidate.Name == flavor.Name+flexSuffix && (candidate.Region == "" || candidate.Region == d.RegionName) {
+			return &candidate, nil
+		}
+	}
+	return nil, nil
+}
+
+// selectFlexFlavor replaces the flavor with its flex variant, when available
+func (d *Driver) selectFlexFlavor(flavor *Flavor) (*Flavor, error) {
+	flex, err := d.flexVariant(flavor)
+	if err != nil {
+		return nil, err
+	}
+	if flex == nil {
+		log.Warnf("Flavor %s has no flex variant in region %s, using it as is. It may not resize cleanly to flex flavors", flavor.Name, d.RegionName)
+		return flavor, nil
+	}
+	if flex != flavor {
+		log.Infof("Using flex flavor %s instead of %s (%dGB of disk instead of %dGB)", flex.Name, flavor.Name, flex.DiskSpaceGB, flavor.DiskSpaceGB)
+	}
+	return flex, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ovh/go-ovh/ovh"
+)
+
+var validHeaderName = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+.^_|~-]+$`)
+
+// parseAPIHeaders parses the KEY=VALUE headers of '--ovh-api-header'
+func parseAPIHeaders(options []string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, option := range options {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 || !validHeaderName.MatchString(parts[0]) {
+			return nil, fmt.Errorf("Invalid API header '%s'. Please select KEY=VALUE with '--ovh-api-header'", option)
+		}
+		headers.Add(parts[0], parts[1])
+	}
+	return headers, nil
+}
+
+// apiHeaders returns the headers of '--ovh-api-header', and records their
+// names. The machine configuration keeps no header value, which may be a
+// token: later operations read them from OVH_API_HEADER again
+func (d *Driver) apiHeaders() (http.Header, error) {
+	options := d.APIHeaders
+	if len(options) == 0 && os.Getenv("OVH_API_HEADER") != "" {
+		options = strings.Split(os.Getenv("OVH_API_HEADER"), ",")
+	}
+	headers, err := parseAPIHeaders(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d.APIHeaders) > 0 {
+		d.APIHeaderNames = nil
+		for name := range headers {
+			d.APIHeaderNames = append(d.APIHeaderNames, name)
+		}
+		sort.Strings(d.APIHeaderNames)
+	}
+	for _, name := range d.APIHeaderNames {
+		if headers.Get(name) == "" {
+			return nil, fmt.Errorf("Machine %s sends API header %s, whose value its configuration does not keep. Please set it in OVH_API_HEADER", d.MachineName, name)
+		}
+	}
+	return headers, nil
+}
+
+// validateAPIBaseURL checks the URL of '--ovh-api-base-url'
+func validateAPIBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("Invalid API base URL '%s'. Please select the http(s) URL of the gateway with '--ovh-api-base-url'", baseURL)
+	}
+	return nil
+}
+
+// gatewayTransport sends the calls to an OVH API endpoint through a gateway,
+// with additional headers. Calls are signed for the endpoint beforehand, so
+// that the gateway forwards them as they are
+type gatewayTransport struct {
+	base     http.RoundTripper
+	endpoint string
+	gateway  string
+	headers  http.Header
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *gatewayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if t.gateway != "" {
+		if rest := strings.TrimPrefix(req.URL.String(), t.endpoint); rest != req.URL.String() {
+			u, err := url.Parse(t.gateway + rest)
+			if err != nil {
+				return nil, err
+			}
+			req.URL = u
+			req.Host = u.Host
+		}
+	}
+	for name, values := range t.headers {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	return t.base.RoundTrip(req)
+}
+
+// throughGateway routes the calls of client to its endpoint through gateway
+func throughGateway(client *ovh.Client, endpoint, gateway string, headers http.Header) {
+	base := client.Client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Client.Transport = &gatewayTransport{
+		base:     base,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		gateway:  strings.TrimSuffix(gateway, "/"),
+		headers:  headers,
+	}
+}
+
+// SetGateway sends the API calls through a gateway at baseURL in place of the
+// endpoint, when set, with additional headers
+func (a *API) SetGateway(baseURL string, headers http.Header) {
+	throughGateway(a.client, a.endpoint, baseURL, headers)
+}
@@ -5,6 +5,8 @@ go 1.20
 require (
 	github.com/docker/machine v0.7.0-rc2.0.20160405014120-5b4159d0d8a1
 	github.com/ovh/go-ovh v0.0.0-20160411152349-09fe958c5a94
+	golang.org/x/crypto v0.0.0-20160406043751-b8a0f4bb4040
+	gopkg.in/ini.v1 v1.11.0
 )
 
 require (
@@ -14,7 +16,5 @@ require (
 	github.com/docker/go-units v0.5.0 // indirect
 	github.com/smartystreets/goconvey v1.8.1 // indirect
 	github.com/stretchr/testify v1.8.4 // indirect
-	golang.org/x/crypto v0.0.0-20160406043751-b8a0f4bb4040 // indirect
 	golang.org/x/sys v0.6.0 // indirect
-	gopkg.in/ini.v1 v1.11.0 // indirect
 )
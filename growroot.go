@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// growRootScript grows the root partition and filesystem to the size of the
+// flavor disk, for images that do not do it themselves
+const growRootScript = `# Grow root filesystem to the disk size
+ROOT_DEV=$(findmnt -n -o SOURCE /)
+ROOT_DISK=$(lsblk -n -o PKNAME "$ROOT_DEV" | head -n 1)
+ROOT_PART=$(cat /sys/class/block/$(basename "$ROOT_DEV")/partition 2>/dev/null || true)
+if [ -n "$ROOT_DISK" ] && [ -n "$ROOT_PART" ] && command -v growpart >/dev/null; then
+	growpart "/dev/$ROOT_DISK" "$ROOT_PART" || true
+fi
+case $(findmnt -n -o FSTYPE /) in
+	ext2|ext3|ext4) resize2fs "$ROOT_DEV" || true ;;
+	xfs) xfs_growfs / || true ;;
+esac
+`
+
+// rootSizeCommand prints the size of the root filesystem, in KB
+const rootSizeCommand = `df -P -k / | awk 'NR == 2 {print $2}'`
+
+// rootSizeTolerance is the share of the disk a filesystem may use for its
+// own metadata and the partition table without being reported as not grown
+const rootSizeTolerance = 0.9
+
+// growRootUserData returns the first boot script section growing the root
+// filesystem
+func (d *Driver) growRootUserData() string {
+	if !d.GrowRoot {
+		return ""
+	}
+	return growRootScript
+}
+
+// checkRootSize warns when the root filesystem is noticeably smaller than the
+// flavor disk. It never fails the create
+func (d *Driver) checkRootSize() {
+	if d.DiskSizeGB == 0 {
+		return
+	}
+
+	output, err := drivers.RunSSHCommandFromDriver(d, rootSizeCommand)
+	if err != nil {
+		log.Debugf("Could not check the root filesystem size: %s", err)
+		return
+	}
+	sizeKB, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	if err != nil {
+		log.Debugf("Could not check the root filesystem size: unexpected output %q", output)
+		return
+	}
+
+	expectedKB := int64(d.DiskSizeGB) * 1000 * 1000
+	if float64(sizeKB) < float64(expectedKB)*rootSizeTolerance {
+		hint := "Grow it manually with growpart and resize2fs or xfs_growfs"
+		if !d.GrowRoot {
+			hint = "Remove '--ovh-no-grow-root' to grow it on first boot"
+		}
+		log.Warnf("Root filesystem of machine %s is %s while flavor %s has a %d GB disk. %s", d.MachineName, formatKB(sizeKB), d.FlavorName, d.DiskSizeGB, hint)
+	}
+}
+
+// formatKB formats a size in KB as GB
+func formatKB(kb int64) string {
+	return fmt.Sprintf("%.1f GB", float64(kb)/1000/1000)
+}
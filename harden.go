@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// hardeningItem is a single measure of the hardening profile
+type hardeningItem struct {
+	description string
+	script      string
+}
+
+// hardeningItems is the basic hardening applied with --ovh-harden, in order
+var hardeningItems = []hardeningItem{
+	{
+		description: "disable SSH password and keyboard-interactive authentication",
+		script: `cat > /etc/ssh/sshd_config.d/99-ovh-harden.conf <<'EOF' 2>/dev/null || sed -i 's/^#\?PasswordAuthentication.*/PasswordAuthentication no/' /etc/ssh/sshd_config
+PasswordAuthentication no
+KbdInteractiveAuthentication no
+ChallengeResponseAuthentication no
+EOF
+systemctl reload ssh 2>/dev/null || systemctl reload sshd 2>/dev/null || true
+`,
+	},
+	{
+		description: "install and enable unattended security upgrades",
+		script: `if command -v apt-get >/dev/null; then
+	DEBIAN_FRONTEND=noninteractive apt-get install -y -q unattended-upgrades
+	printf 'APT::Periodic::Update-Package-Lists "1";\nAPT::Periodic::Unattended-Upgrade "1";\n' > /etc/apt/apt.conf.d/20auto-upgrades
+else
+	(dnf install -y -q dnf-automatic && systemctl enable --now dnf-automatic-install.timer) || yum install -y -q yum-cron
+fi
+`,
+	},
+	{
+		description: "install and enable fail2ban for SSH",
+		script: `if command -v apt-get >/dev/null; then DEBIAN_FRONTEND=noninteractive apt-get install -y -q fail2ban; else dnf install -y -q fail2ban || yum install -y -q fail2ban; fi
+systemctl enable --now fail2ban
+`,
+	},
+	{
+		description: "install and enable auditd",
+		script: `if command -v apt-get >/dev/null; then DEBIAN_FRONTEND=noninteractive apt-get install -y -q auditd; else dnf install -y -q audit || yum install -y -q audit; fi
+systemctl enable --now auditd
+`,
+	},
+}
+
+// hardeningLog records the outcome of each hardening item on the machine
+const hardeningLog = "/var/log/ovh-harden.log"
+
+// hardenUserData returns the first boot script section applying the
+// hardening profile. Each item runs in a subshell of its own, so that a
+// failing item neither stops the others nor the later sections, and its
+// outcome is recorded in the hardening log
+func (d *Driver) hardenUserData() string {
+	if !d.Harden {
+		return ""
+	}
+
+	script := "# Apply hardening profile\nset +e\ncommand -v apt-get >/dev/null && apt-get update -q\n"
+	for _, item := range hardeningItems {
+		script += "(\nset -e\n" + item.script + ")\n"
+		script += "if [ $? -eq 0 ]; then OUTCOME=applied; else OUTCOME=failed; fi\n"
+		script += "echo \"$(date -u +%FT%TZ) $OUTCOME: " + item.description + "\" >> " + hardeningLog + "\n"
+	}
+	return script + "set -e\n"
+}
+
+// logHardening reports the outcome of the hardening items, as recorded on
+// the machine
+func (d *Driver) logHardening() {
+	output, err := drivers.RunSSHCommandFromDriver(d, "sudo cat "+hardeningLog)
+	if err != nil {
+		log.Warnf("Could not read the hardening log of %s: %s", d.MachineName, err)
+		return
+	}
+
+	var applied, failed []string
+	for _, item := range hardeningItems {
+		switch {
+		case strings.Contains(output, " applied: "+item.description+"\n"):
+			applied = append(applied, item.description)
+		case strings.Contains(output, " failed: "+item.description+"\n"):
+			failed = append(failed, item.description)
+		default:
+			failed = append(failed, item.description+" (not run)")
+		}
+	}
+	if len(applied) > 0 {
+		log.Infof("Applied hardening profile: %s", strings.Join(applied, "; "))
+	}
+	if len(failed) > 0 {
+		log.Warnf("Hardening items failed on %s, see %s: %s", d.MachineName, hardeningLog, strings.Join(failed, "; "))
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Health is the OVH side view of the machine, saved with the machine
+// configuration so that 'docker-machine inspect' reports it. It is refreshed
+// whenever the machine state is queried, and saved when docker-machine saves
+// the machine, as on start, stop or provision
+type Health struct {
+	Status      string          `json:"status"`
+	Maintenance string          `json:"maintenance,omitempty"`
+	Region      string          `json:"region"`
+	Billing     string          `json:"billing"`
+	Flavor      HealthFlavor    `json:"flavor"`
+	Networks    []HealthNetwork `json:"networks"`
+}
+
+// HealthFlavor describes the flavor of the instance
+type HealthFlavor struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Vcpus  int    `json:"vcpus"`
+	RAMMB  int    `json:"ramMB"`
+	DiskGB int    `json:"diskGB"`
+}
+
+// HealthNetwork describes an address of the instance
+type HealthNetwork struct {
+	Type      string `json:"type"`
+	IP        string `json:"ip"`
+	NetworkID string `json:"networkId,omitempty"`
+}
+
+// instanceHealth builds the health report of an instance
+func instanceHealth(instance *Instance) *Health {
+	health := &Health{
+		Status:      instance.Status,
+		Maintenance: maintenanceEvent(instance.Status),
+		Region:      instance.Region,
+		Billing:     "hourly",
+		Flavor: HealthFlavor{
+			Name:   instance.Flavor.Name,
+			Type:   instance.Flavor.Type,
+			Vcpus:  instance.Flavor.Vcpus,
+			RAMMB:  instance.Flavor.memoryMB(),
+			DiskGB: instance.Flavor.DiskSpaceGB,
+		},
+	}
+
+	if instance.MonthlyBilling != nil {
+		health.Billing = fmt.Sprintf("monthly (%s since %s)", instance.MonthlyBilling.Status, instance.MonthlyBilling.Since)
+	}
+
+	for _, ip := range instance.IPAddresses {
+		health.Networks = append(health.Networks, HealthNetwork{Type: ip.Type, IP: ip.IP, NetworkID: ip.NetworkID})
+	}
+	return health
+}
+
+// refreshHealth updates the health report of the machine, saved along with
+// the machine configuration by the next docker-machine command saving it
+func (d *Driver) refreshHealth(instance *Instance) {
+	d.Health = instanceHealth(instance)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/ovh/go-ovh/ovh"
+)
+
+// IAM resource tag marking the instances of the driver, for IAM policies to
+// scope who may delete them
+const (
+	managedByTagKey   = "managed-by"
+	managedByTagValue = "docker-machine"
+
+	// iamIndexTimeout is how long a new instance is looked up in the IAM,
+	// which indexes instances some time after they are created
+	iamIndexTimeout = 2 * time.Minute
+)
+
+// IAMResource is a resource of the OVH IAM, with its tags
+type IAMResource struct {
+	ID   string            `json:"id"`
+	URN  string            `json:"urn"`
+	Name string            `json:"name"`
+	Type string            `json:"type"`
+	Tags map[string]string `json:"tags"`
+}
+
+// iamClient returns a client of the v2 API, which serves the IAM, with the
+// credentials of the API
+func (a *API) iamClient() (*ovh.Client, error) {
+	if a.v2Client != nil {
+		return a.v2Client, nil
+	}
+	if !strings.HasSuffix(a.endpoint, "/1.0") {
+		return nil, fmt.Errorf("IAM resource tags need the v2 API, which endpoint %s does not serve", a.endpoint)
+	}
+	client, err := a.newClient(strings.TrimSuffix(a.endpoint, "/1.0")+"/v2", a.client.AppKey, a.client.AppSecret, a.client.ConsumerKey)
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = a.client.Timeout
+	a.v2Client = client
+	return client, nil
+}
+
+// GetProjectURN returns the IAM resource name of a project
+func (a *API) GetProjectURN(projectID string) (urn string, err error) {
+	var project struct {
+		IAM *struct {
+			URN string `json:"urn"`
+		} `json:"iam"`
+	}
+	err = a.get("/cloud/project/"+projectID, &project)
+	if err == nil && (project.IAM == nil || project.IAM.URN == "") {
+		err = fmt.Errorf("Project %s has no IAM resource name", projectID)
+	}
+	if err != nil {
+		return "", err
+	}
+	return project.IAM.URN, nil
+}
+
+// GetIAMResource returns the IAM resource of a resource name, nil when the
+// IAM does not know it
+func (a *API) GetIAMResource(urn string) (resource *IAMResource, err error) {
+	client, err := a.iamClient()
+	if err != nil {
+		return nil, err
+	}
+	var resources []IAMResource
+	err = a.retryMaintenance(true, func() error {
+		return client.Get("/iam/resource?resourceURN="+url.QueryEscape(urn), &resources)
+	})
+	if err != nil || len(resources) == 0 {
+		return nil, err
+	}
+	return &resources[0], nil
+}
+
+// AddIAMResourceTag sets a tag of an IAM resource
+func (a *API) AddIAMResourceTag(urn, key, value string) (err error) {
+	client, err := a.iamClient()
+	if err != nil {
+		return err
+	}
+	path := "/iam/resource/" + url.PathEscape(urn) + "/tag"
+	reqBody := map[string]string{"key": key, "value": value}
+	err = a.retryMaintenance(false, func() error {
+		return client.Post(path, reqBody, nil)
+	})
+	a.audit("POST", "/v2"+path, reqBody, err)
+	return err
+}
+
+// iamTags returns the IAM resource tags of the instances: the labels, and
+// the tag marking instances of the driver
+func (d *Driver) iamTags() map[string]string {
+	tags := map[string]string{managedByTagKey: managedByTagValue}
+	for key, value := range d.Labels {
+		tags[key] = value
+	}
+	return tags
+}
+
+// applyIAMTags sets the tags of the instances on their IAM resource, with
+// '--ovh-iam-tags'. Instances are IAM resources under their project, looked
+// up until the IAM lists them. When it does not in time, or tagging fails, the
+// instance metadata remains the only copy of the labels, which is reported only
+func (d *Driver) applyIAMTags(client *API, instanceIDs ...string) {
+	if !d.IAMTags {
+		return
+	}
+	projectURN, err := client.GetProjectURN(d.ProjectID)
+	if err != nil {
+		log.Warnf("Could not set the IAM resource tags of the instances: %s", err)
+		return
+	}
+
+	tags := d.iamTags()
+	for _, instanceID := range instanceIDs {
+		urn := fmt.Sprintf("%s/instance/%s", projectURN, instanceID)
+		var resource *IAMResource
+		var lookupErr error
+		err := waitWithBackoffFor(iamIndexTimeout, func() (bool, error) {
+			resource, lookupErr = client.GetIAMResource(urn)
+			return resource != nil, lookupErr
+		})
+		if lookupErr != nil {
+			log.Warnf("Could not find the IAM resource of instance %s: %s", instanceID, lookupErr)
+			continue
+		}
+		if err != nil {
+			log.Warnf("Instance %s is not an IAM resource of this account after %s, its labels are only set as instance metadata", instanceID, iamIndexTimeout)
+			continue
+		}
+		set := 0
+		for key, value := range tags {
+			if resource.Tags[key] != value {
+				if err := client.AddIAMResourceTag(resource.URN, key, value); err != nil {
+					log.Warnf("Could not set IAM resource tag %s of instance %s: %s", key, instanceID, err)
+					continue
+				}
+			}
+			set++
+		}
+		log.Infof("Set %d of %d IAM resource tags on instance %s", set, len(tags), instanceID)
+	}
+}
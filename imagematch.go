@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxImageSuggestions is the number of close image names suggested on a typo
+const maxImageSuggestions = 5
+
+// matchImage finds the image named or identified by name among images. With
+// fuzzy matching, a case-insensitive name or a unique case-insensitive prefix
+// matches too. Failing that, the error suggests the closest names
+func matchImage(images Images, name string, fuzzy bool) (*Image, error) {
+	for i := range images {
+		if images[i].ID == name || images[i].Name == name {
+			return &images[i], nil
+		}
+	}
+
+	if fuzzy {
+		lower := strings.ToLower(name)
+		var prefixed []*Image
+		for i := range images {
+			imageName := strings.ToLower(images[i].Name)
+			if imageName == lower {
+				return &images[i], nil
+			}
+			if strings.HasPrefix(imageName, lower) {
+				prefixed = append(prefixed, &images[i])
+			}
+		}
+		if len(prefixed) == 1 {
+			return prefixed[0], nil
+		}
+		if len(prefixed) > 1 {
+			var names []string
+			for _, image := range prefixed {
+				names = append(names, "'"+image.Name+"'")
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("Image '%s' matches several images: %s. Please select one of them with '--ovh-image'", name, strings.Join(names, ", "))
+		}
+	}
+
+	err := fmt.Errorf("Image '%s' does not exist on OVH cloud. To find a list of available images, please visit %s", name, CustomerInterface)
+	if suggestions := imageSuggestions(images, name); len(suggestions) > 0 {
+		err = fmt.Errorf("%s. Did you mean %s?", err, strings.Join(suggestions, ", "))
+	}
+	return nil, err
+}
+
+// imageSuggestions returns the image names closest to name, ignoring case
+func imageSuggestions(images Images, name string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+
+	seen := make(map[string]bool)
+	var candidates []candidate
+	for _, image := range images {
+		if image.Name == "" || seen[image.Name] {
+			continue
+		}
+		seen[image.Name] = true
+		candidates = append(candidates, candidate{image.Name, levenshtein(strings.ToLower(name), strings.ToLower(image.Name))})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	var suggestions []string
+	for i := 0; i < len(candidates) && i < maxImageSuggestions; i++ {
+		suggestions = append(suggestions, "'"+candidates[i].name+"'")
+	}
+	return suggestions
+}
+
+// levenshtein returns the edit distance between a and b, in runes
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	previous := make([]int, len(t)+1)
+	current := make([]int, len(t)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		current[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(t)]
+}
+
+// min3 returns the smallest of three integers
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// validateExcludedIPRanges checks the excluded public IP ranges, a single
+// address stands for itself
+func (c *Config) validateExcludedIPRanges() error {
+	var ranges []string
+	for _, cidr := range c.ExcludedIPRanges {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() == nil {
+				cidr = cidr + "/128"
+			} else {
+				cidr = cidr + "/32"
+			}
+		}
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("Invalid CIDR '%s' in '--ovh-exclude-ip-ranges'", cidr)
+		}
+		ranges = append(ranges, cidr)
+	}
+	c.ExcludedIPRanges = ranges
+
+	if len(ranges) > 0 && c.IPAttempts < 1 {
+		return fmt.Errorf("Invalid number of IP attempts %c. Please select at least 1 with '--ovh-ip-attempts'", c.IPAttempts)
+	}
+	return nil
+}
+
+// excludedIPRange returns the excluded range holding the public IP of the
+// instance, empty if none does
+func (d *Driver) excludedIPRange() string {
+	ip := net.ParseIP(d.IPAddress)
+	for _, cidr := range d.ExcludedIPRanges {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+			return cidr
+		}
+	}
+	return ""
+}
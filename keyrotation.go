@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// authorizeKeyCommand appends a public key to the authorized keys of the SSH
+// user, once
+const authorizeKeyCommand = `grep -qF '%[1]s' ~/.ssh/authorized_keys || echo '%[2]s' >> ~/.ssh/authorized_keys`
+
+// revokeKeyCommand removes the lines of a public key from the authorized keys
+// of the SSH user, keeping the file itself and its permissions
+const revokeKeyCommand = `grep -vF '%[1]s' ~/.ssh/authorized_keys > ~/.ssh/authorized_keys.rotate || true
+cat ~/.ssh/authorized_keys.rotate > ~/.ssh/authorized_keys
+rm -f ~/.ssh/authorized_keys.rotate`
+
+// rotateSSHKey replaces the key of the machine with a new one: the new public
+// key is authorized on the instance over the current connection and checked,
+// uploaded to the project in place of the current one, and swapped in the
+// machine configuration before the current key is revoked and deleted. Only
+// keys generated for the machine are rotated, under the machine lock
+func (d *Driver) rotateSSHKey() error {
+	if d.ReusedKeyPair != "" || d.KeepSSHKey || !d.generatedSSHKey() || !strings.HasPrefix(d.KeyPairName, d.resourceName(d.MachineName)) {
+		return fmt.Errorf("Ssh key %s of machine %s is not generated for it, rotate it where it is managed", d.KeyPairName, d.MachineName)
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	oldName, oldID, oldPath := d.KeyPairName, d.KeyPairID, d.SSHKeyPath
+	oldPublic, err := ioutil.ReadFile(oldPath + ".pub")
+	if err != nil {
+		return err
+	}
+	oldBlob := strings.Fields(string(oldPublic))
+
+	// Generate the new key next to the current one
+	newName := d.resourceName(fmt.Sprintf("%s-%s", d.MachineName, time.Now().UTC().Format("20060102150405")))
+	newPath := d.ResolveStorePath(newName)
+	log.Infof("Rotating ssh key %s of machine %s...", oldName, d.MachineName)
+	err = generateSSHKey(newPath, d.SSHKeyType, d.SSHKeyBits)
+	if err != nil {
+		return err
+	}
+	cleanup := func() {
+		os.Remove(newPath)
+		os.Remove(newPath + ".pub")
+	}
+	data, err := ioutil.ReadFile(newPath + ".pub")
+	if err != nil {
+		cleanup()
+		return err
+	}
+	newPublic := strings.TrimSpace(string(data))
+	newBlob := strings.Fields(newPublic)[1]
+
+	// Authorize it with the current key, and check it
+	_, err = drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(authorizeKeyCommand, newBlob, newPublic))
+	if err != nil {
+		cleanup()
+		return fmt.Errorf("Could not authorize the new ssh key on machine %s: %s", d.MachineName, err)
+	}
+	d.SSHKeyPath = newPath
+	_, err = drivers.RunSSHCommandFromDriver(d, "true")
+	if err != nil {
+		d.SSHKeyPath = oldPath
+		cleanup()
+		return fmt.Errorf("Could not connect to machine %s with the new ssh key, the current one is kept: %s", d.MachineName, err)
+	}
+
+	// Upload it and swap it in the machine configuration
+	sshKey, err := client.CreateSshkey(d.ProjectID, newName, newPublic)
+	if err != nil {
+		d.SSHKeyPath = oldPath
+		cleanup()
+		return err
+	}
+	d.KeyPairName = newName
+	d.KeyPairID = sshKey.ID
+	driver, err := json.Marshal(d)
+	if err == nil {
+		err = d.saveMachineConfig(driver)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not save the new ssh key %s of machine %s, both keys are authorized: %s", newPath, d.MachineName, err)
+	}
+
+	// Revoke and delete the previous key
+	if len(oldBlob) > 1 {
+		_, err = drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(revokeKeyCommand, oldBlob[1]))
+		if err != nil {
+			log.Warnf("Could not revoke the previous ssh key of machine %s: %s", d.MachineName, err)
+		}
+	}
+	if oldID != "" {
+		err = client.DeleteSshkey(d.ProjectID, oldID)
+		if err != nil {
+			log.Warnf("Could not delete the previous ssh key %s (%s): %s", oldName, oldID, err)
+		}
+	}
+	os.Remove(oldPath)
+	os.Remove(oldPath + ".pub")
+
+	log.Infof("Machine %s now uses ssh key %s (%s)", d.MachineName, newName, sshKey.ID)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// KnownHostsName is the name of the known_hosts file of the machines, in the
+// machine store. It is shared by all machines so that a machine recreated with
+// the same name or address replaces the keys of the previous one
+const KnownHostsName = "ovh-known_hosts"
+
+// hostKeysCommand prints the public host keys of the machine
+const hostKeysCommand = `cat /etc/ssh/ssh_host_*_key.pub`
+
+// knownHostsPath returns the path of the known_hosts file of the machines
+func (d *Driver) knownHostsPath() string {
+	return filepath.Join(d.StorePath, KnownHostsName)
+}
+
+// recordHostKeys replaces the known_hosts entries of the machine name and
+// address with the host keys of the machine. Failures are only reported
+func (d *Driver) recordHostKeys() {
+	output, err := drivers.RunSSHCommandFromDriver(d, hostKeysCommand)
+	if err != nil {
+		log.Warnf("Could not record the host keys of machine %s: %s", d.MachineName, err)
+		return
+	}
+
+	var entries []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		entries = append(entries, d.MachineName+","+d.IPAddress+" "+fields[0]+" "+fields[1])
+	}
+
+	err = d.updateKnownHosts(entries)
+	if err != nil {
+		log.Warnf("Could not record the host keys of machine %s: %s", d.MachineName, err)
+		return
+	}
+	log.Debugf("Recorded %d host keys of machine %s in %s", len(entries), d.MachineName, d.knownHostsPath())
+}
+
+// forgetHostKeys removes the known_hosts entries of the machine
+func (d *Driver) forgetHostKeys() {
+	err := d.updateKnownHosts(nil)
+	if err != nil {
+		log.Warnf("Could not remove the host keys of machine %s: %s", d.MachineName, err)
+	}
+}
+
+// updateKnownHosts replaces the entries matching the machine name or address
+// with entries
+func (d *Driver) updateKnownHosts(entries []string) error {
+	data, err := ioutil.ReadFile(d.knownHostsPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if d.knownHost(fields[0]) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, entries...)
+
+	if len(lines) == 0 {
+		err = os.Remove(d.knownHostsPath())
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return ioutil.WriteFile(d.knownHostsPath(), []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+// knownHost tells whether a known_hosts host pattern list designates the
+// machine
+func (d *Driver) knownHost(hosts string) bool {
+	for _, host := range strings.Split(hosts, ",") {
+		if host == d.MachineName || (d.IPAddress != "" && host == d.IPAddress) {
+			return true
+		}
+	}
+	return false
+}
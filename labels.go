@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+var validLabelKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// parseLabels reads KEY=VALUE labels, each option may hold several separated
+// by commas
+func parseLabels(options []string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, option := range options {
+		for _, label := range strings.Split(option, ",") {
+			label = strings.TrimSpace(label)
+			if label == "" {
+				continue
+			}
+			parts := strings.SplitN(label, "=", 2)
+			if len(parts) != 2 || !validLabelKey.MatchString(parts[0]) || len(parts[0]) > 255 || len(parts[1]) > 255 {
+				return nil, fmt.Errorf("Invalid label '%s'. Expected KEY=VALUE, e.g. cost-center=edge", label)
+			}
+			labels[parts[0]] = parts[1]
+		}
+	}
+	return labels, nil
+}
+
+// validateLabels parses the labels, and checks the OpenStack credentials
+// needed to set them as instance metadata
+func (d *Driver) validateLabels() error {
+	labels, err := parseLabels(d.LabelOptions)
+	if err != nil {
+		return err
+	}
+	if d.Compliance != "" {
+		labels[complianceLabel] = d.Compliance
+	}
+	d.Labels = labels
+	if len(d.Labels) == 0 {
+		return nil
+	}
+
+	// The compliance label alone also needs instance metadata
+	feature := "'--ovh-labels'"
+	if len(d.LabelOptions) == 0 {
+		feature = "'--ovh-compliance'"
+	}
+	o, err := d.openStack(feature)
+	if err != nil {
+		return err
+	}
+	if _, ok := o.endpoints("compute")[d.RegionName]; !ok {
+		return fmt.Errorf("No OpenStack compute endpoint found for region %s", d.RegionName)
+	}
+	return nil
+}
+
+// engineLabels returns the labels in the docker engine format, sorted
+func (d *Driver) engineLabels() []string {
+	var labels []string
+	for key, value := range d.Labels {
+		labels = append(labels, key+"="+value)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// applyLabels sets the labels as metadata of instances. The OVH API has no
+// instance metadata, so this goes through the OpenStack compute API
+func (d *Driver) applyLabels(instanceIDs ...string) error {
+	if len(d.Labels) == 0 {
+		return nil
+	}
+
+	log.Infof("Setting labels %s on OVH instance...", strings.Join(d.engineLabels(), ", "))
+	o, err := d.openStack("'--ovh-labels'")
+	if err != nil {
+		return err
+	}
+	for _, instanceID := range instanceIDs {
+		err = o.setServerMetadata(d.RegionName, instanceID, d.Labels)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setServerMetadata merges metadata into the metadata of a server of region
+func (o *openStack) setServerMetadata(region, serverID string, metadata map[string]string) error {
+	endpoint, ok := o.endpoints("compute")[region]
+	if !ok {
+		return fmt.Errorf("No OpenStack compute endpoint found for region %s", region)
+	}
+	_, err := o.call("POST", endpoint+"/servers/"+serverID+"/metadata", map[string]interface{}{"metadata": metadata}, nil)
+	return err
+}
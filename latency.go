@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// AutoLatencyRegion selects the region with the lowest latency
+	AutoLatencyRegion = "auto-latency"
+
+	// DefaultLatencyProbe is the address probed in each region, {region}
+	// being replaced by the lower case region name
+	DefaultLatencyProbe = "compute.{region}.cloud.ovh.net:443"
+
+	latencyProbeCount   = 3
+	latencyProbeTimeout = 2 * time.Second
+)
+
+// regionLatency is the best connection time measured to a region
+type regionLatency struct {
+	region  string
+	latency time.Duration
+}
+
+// probeAddress returns the address to probe for region
+func (d *Driver) probeAddress(region string) string {
+	probe := d.LatencyProbe
+	if probe == "" {
+		probe = DefaultLatencyProbe
+	}
+	return strings.Replace(probe, "{region}", strings.ToLower(region), -1)
+}
+
+// probeLatency returns the best of a few TCP connection times to address
+func probeLatency(address string) (time.Duration, error) {
+	var best time.Duration
+	var err error
+	for i := 0; i < latencyProbeCount; i++ {
+		start := time.Now()
+		var conn net.Conn
+		conn, err = net.DialTimeout("tcp", address, latencyProbeTimeout)
+		if err != nil {
+			continue
+		}
+		elapsed := time.Since(start)
+		conn.Close()
+		if best == 0 || elapsed < best {
+			best = elapsed
+		}
+	}
+	if best == 0 {
+		return 0, err
+	}
+	return best, nil
+}
+
+// selectNearestRegion probes the regions from this host and selects the one
+// with the lowest latency. Unreachable regions are skipped
+func (d *Driver) selectNearestRegion(regions Regions) error {
+	log.Infof("Probing the latency of %d regions...", len(regions))
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var latencies []regionLatency
+	for _, region := range regions {
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
+			latency, err := probeLatency(d.probeAddress(region))
+			if err != nil {
+				log.Debugf("Could not probe region %s: %s", region, err)
+				return
+			}
+			mutex.Lock()
+			latencies = append(latencies, regionLatency{region, latency})
+			mutex.Unlock()
+		}(region)
+	}
+	wg.Wait()
+
+	if len(latencies) == 0 {
+		return fmt.Errorf("Could not reach any region of project %s at %s. Please select a region with '--ovh-region'", d.ProjectID, d.probeAddress("{region}"))
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i].latency < latencies[j].latency
+	})
+	for _, l := range latencies {
+		log.Debugf("Region %s latency: %s", l.region, l.latency)
+	}
+
+	d.RegionName = latencies[0].region
+	log.Infof("Selected region %s with a latency of %s", d.RegionName, latencies[0].latency.Round(time.Millisecond))
+	return nil
+}
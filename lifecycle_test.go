@@ -0,0 +1,349 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"flag"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/ssh"
+	"github.com/docker/machine/libmachine/state"
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+// The lifecycle tests replay the API calls of the driver flows from the
+// fixtures of testdata, and answer the ssh commands of the driver with a
+// local server. With -record, they run against the OVH API with the
+// credentials of the environment instead, and save the calls as fixtures:
+//
+//	go test -run TestLifecycle -record
+var record = flag.Bool("record", false, "Record the fixtures against the OVH API, with the credentials of the environment")
+
+// testOptions are driver options: the create flags with their defaults,
+// overridden by the given values
+type testOptions map[string]interface{}
+
+func newTestOptions(d *Driver, values map[string]interface{}) testOptions {
+	options := make(testOptions)
+	for _, flag := range d.GetCreateFlags() {
+		options[flag.String()] = flag.Default()
+	}
+	for key, value := range values {
+		options[key] = value
+	}
+	return options
+}
+
+func (o testOptions) String(key string) string {
+	value, _ := o[key].(string)
+	return value
+}
+
+func (o testOptions) StringSlice(key string) []string {
+	value, _ := o[key].([]string)
+	return value
+}
+
+func (o testOptions) Int(key string) int {
+	value, _ := o[key].(int)
+	return value
+}
+
+func (o testOptions) Bool(key string) bool {
+	value, _ := o[key].(bool)
+	return value
+}
+
+// openFixture opens the recording of a flow, for replay, or to record it
+func openFixture(t *testing.T, name string) *Recording {
+	mode := recordingModeReplay
+	if *record {
+		mode = recordingModeRecord
+	}
+	recording, err := OpenRecording(filepath.Join("testdata", name+".json"), mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recording
+}
+
+// checkReplayed fails the test when recorded calls of the fixture were not
+// made, as the driver flow then changed
+func checkReplayed(t *testing.T, recording *Recording) {
+	if *record {
+		return
+	}
+	for _, call := range recording.Unreplayed() {
+		t.Errorf("Recorded call %s was not made", call)
+	}
+}
+
+// newTestDriver returns a driver of machine name, in a store of its own, its
+// API calls going through recording. Replayed calls are signed with dummy
+// credentials
+func newTestDriver(t *testing.T, name string, recording *Recording, values map[string]interface{}) *Driver {
+	t.Setenv("HOME", t.TempDir())
+	d := &Driver{BaseDriver: &drivers.BaseDriver{
+		MachineName: name,
+		StorePath:   t.TempDir(),
+		SSHUser:     DefaultSSHUserName,
+		SSHPort:     22,
+	}}
+	err := d.SetConfigFromFlags(newTestOptions(d, values))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := APIConfig{Recording: recording}
+	if !*record {
+		config = APIConfig{Endpoint: "ovh-eu", ApplicationKey: "key", ApplicationSecret: "secret", ConsumerKey: "consumer", Recording: recording}
+	}
+	d.client, err = NewAPIFromConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// sshServer answers the ssh commands of the driver, with the output of the
+// command prefix matching, and nothing otherwise
+type sshServer struct {
+	port    int
+	hostKey string
+	outputs map[string]string
+
+	mutex    sync.Mutex
+	commands []string
+}
+
+// startSSHServer starts an ssh server on a local port, accepting any key, and
+// makes the driver use the native ssh client
+func startSSHServer(t *testing.T) *sshServer {
+	ssh.SetDefaultClient(ssh.Native)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := cryptossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &cryptossh.ServerConfig{
+		PublicKeyCallback: func(cryptossh.ConnMetadata, cryptossh.PublicKey) (*cryptossh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &sshServer{
+		port:    listener.Addr().(*net.TCPAddr).Port,
+		hostKey: strings.TrimSpace(string(cryptossh.MarshalAuthorizedKey(signer.PublicKey()))),
+	}
+	s.outputs = map[string]string{
+		"cat /etc/ssh/ssh_host_": s.hostKey + " root@lifecycle\n",
+		"df -P -k /":             "50620216\n",
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *sshServer) serve(conn net.Conn, config *cryptossh.ServerConfig) {
+	_, channels, requests, err := cryptossh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go cryptossh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(cryptossh.UnknownChannelType, "")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.session(channel, requests)
+	}
+}
+
+func (s *sshServer) session(channel cryptossh.Channel, requests <-chan *cryptossh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var exec struct{ Command string }
+		cryptossh.Unmarshal(req.Payload, &exec)
+		req.Reply(true, nil)
+
+		s.mutex.Lock()
+		s.commands = append(s.commands, exec.Command)
+		s.mutex.Unlock()
+		for prefix, output := range s.outputs {
+			if strings.HasPrefix(exec.Command, prefix) {
+				channel.Write([]byte(output))
+				break
+			}
+		}
+		channel.SendRequest("exit-status", false, cryptossh.Marshal(struct{ Status uint32 }{0}))
+		return
+	}
+}
+
+// ran tells whether the server ran a command starting with prefix
+func (s *sshServer) ran(prefix string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, command := range s.commands {
+		if strings.HasPrefix(command, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// expectState fails the test when the machine is not in state
+func expectState(t *testing.T, d *Driver, expected state.State) {
+	t.Helper()
+	st, err := d.GetState()
+	if err != nil {
+		t.Fatalf("GetState: %s", err)
+	}
+	if st != expected {
+		t.Fatalf("GetState: got %s, expected %s", st, expected)
+	}
+}
+
+// TestLifecycle creates a machine, stops, starts and restarts it, and removes
+// it
+func TestLifecycle(t *testing.T) {
+	recording := openFixture(t, "lifecycle")
+	d := newTestDriver(t, "lifecycle", recording, map[string]interface{}{
+		"ovh-region":               "GRA7",
+		"ovh-flavor":               "b3-8",
+		"ovh-docker-allowed-cidrs": []string{"any"},
+	})
+	var server *sshServer
+	if !*record {
+		server = startSSHServer(t)
+		d.SSHPort = server.port
+	}
+
+	err := d.PreCreateCheck()
+	if err != nil {
+		t.Fatalf("PreCreateCheck: %s", err)
+	}
+	err = d.Create()
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	if server != nil {
+		if !server.ran("sudo -n true") {
+			t.Errorf("Create did not check sudo on the machine")
+		}
+		knownHosts, _ := ioutil.ReadFile(d.knownHostsPath())
+		if !strings.Contains(string(knownHosts), "lifecycle,127.0.0.1 "+server.hostKey) {
+			t.Errorf("Create did not record the host key of the machine: %q", knownHosts)
+		}
+	}
+	expectState(t, d, state.Running)
+
+	url, err := d.GetURL()
+	if err != nil {
+		t.Fatalf("GetURL: %s", err)
+	}
+	if !*record && url != "tcp://127.0.0.1:2376" {
+		t.Errorf("GetURL: got %s", url)
+	}
+
+	err = d.Stop()
+	if err != nil {
+		t.Fatalf("Stop: %s", err)
+	}
+	expectState(t, d, state.Stopped)
+	err = d.Start()
+	if err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+	expectState(t, d, state.Running)
+	err = d.Restart()
+	if err != nil {
+		t.Fatalf("Restart: %s", err)
+	}
+	err = d.Kill()
+	if err == nil {
+		t.Errorf("Kill: expected an error, OVH cannot kill instances")
+	}
+
+	err = d.Remove()
+	if err != nil {
+		t.Fatalf("Remove: %s", err)
+	}
+	checkReplayed(t, recording)
+}
+
+// TestShelveOnStop shelves the instance of a machine on stop, and unshelves it
+// on start
+func TestShelveOnStop(t *testing.T) {
+	if *record {
+		t.Skip("Shelving needs an existing instance, it is not recorded")
+	}
+	recording := openFixture(t, "shelve")
+	d := newTestDriver(t, "shelve", recording, map[string]interface{}{
+		"ovh-region":  "GRA7",
+		"ovh-on-stop": OnStopShelve,
+	})
+	d.ProjectID = "4a6f8c0e1d2b4c5e9f7a3b8d6e1c2f0a"
+	d.InstanceID = "f3a9c2e1-6b4d-4f8a-9e1c-7d2b5a8f0c3e"
+	d.IPAddress = "127.0.0.1"
+
+	err := d.Stop()
+	if err != nil {
+		t.Fatalf("Stop: %s", err)
+	}
+	err = d.Start()
+	if err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+	if d.IPAddress != "127.0.0.1" {
+		t.Errorf("Start: got address %s", d.IPAddress)
+	}
+	checkReplayed(t, recording)
+}
+
+// TestInvalidRegion rejects a region the project does not have before
+// creating anything
+func TestInvalidRegion(t *testing.T) {
+	recording := openFixture(t, "invalid-region")
+	d := newTestDriver(t, "invalid-region", recording, map[string]interface{}{
+		"ovh-region": "XYZ1",
+	})
+
+	err := d.PreCreateCheck()
+	if err == nil || !strings.Contains(err.Error(), "Invalid region XYZ1. Please select one of BHS5, DE1, GRA7") {
+		t.Fatalf("PreCreateCheck: got %v", err)
+	}
+	checkReplayed(t, recording)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// LoadBalancerPool is a pool of an OVH Load Balancer the machine is a member
+// of
+type LoadBalancerPool struct {
+	LoadBalancer string
+	Pool         string
+	PoolID       string
+	Port         int
+	MemberID     string `json:",omitempty"`
+}
+
+// parseLoadBalancerPool parses a '<load balancer>:<pool>[:<port>]' option.
+// Without a port, members get the port of the pool listener
+func parseLoadBalancerPool(option string) (LoadBalancerPool, error) {
+	parts := strings.Split(option, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return LoadBalancerPool{}, fmt.Errorf("Invalid load balancer pool '%s'. Please select '<load balancer>:<pool>[:<port>]' with '--ovh-loadbalancer'", option)
+	}
+
+	pool := LoadBalancerPool{LoadBalancer: parts[0], Pool: parts[1]}
+	if len(parts) == 3 {
+		port, err := strconv.Atoi(parts[2])
+		if err != nil || port < 1 || port > 65535 {
+			return LoadBalancerPool{}, fmt.Errorf("Invalid load balancer pool port '%s'. Please select a port between 1 and 65535 with '--ovh-loadbalancer'", parts[2])
+		}
+		pool.Port = port
+	}
+	return pool, nil
+}
+
+// findLoadBalancerPool resolves the id of a pool, and the port of its
+// listener when no port is set
+func (o *openStack) findLoadBalancerPool(region string, pool *LoadBalancerPool) error {
+	endpoint, ok := o.endpoints("load-balancer")[region]
+	if !ok {
+		return fmt.Errorf("No OpenStack load balancer endpoint found for region %s", region)
+	}
+
+	var loadBalancers struct {
+		LoadBalancers []struct {
+			ID string `json:"id"`
+		} `json:"loadbalancers"`
+	}
+	query := url.Values{"name": {pool.LoadBalancer}}
+	_, err := o.call("GET", endpoint+"/v2/lbaas/loadbalancers?"+query.Encode(), nil, &loadBalancers)
+	if err != nil {
+		return err
+	}
+	if len(loadBalancers.LoadBalancers) != 1 {
+		return fmt.Errorf("Load balancer '%s' does not exist in region %s, or is not unique. To find a list of available load balancers, please visit %s", pool.LoadBalancer, region, CustomerInterface)
+	}
+
+	var pools struct {
+		Pools []struct {
+			ID        string `json:"id"`
+			Listeners []struct {
+				ID string `json:"id"`
+			} `json:"listeners"`
+		} `json:"pools"`
+	}
+	query = url.Values{"loadbalancer_id": {loadBalancers.LoadBalancers[0].ID}, "name": {pool.Pool}}
+	_, err = o.call("GET", endpoint+"/v2/lbaas/pools?"+query.Encode(), nil, &pools)
+	if err != nil {
+		return err
+	}
+	if len(pools.Pools) != 1 {
+		return fmt.Errorf("Pool '%s' does not exist in load balancer '%s', or is not unique", pool.Pool, pool.LoadBalancer)
+	}
+	pool.PoolID = pools.Pools[0].ID
+
+	if pool.Port == 0 {
+		if len(pools.Pools[0].Listeners) == 0 {
+			return fmt.Errorf("Pool '%s' of load balancer '%s' has no listener to take the port from. Please select '<load balancer>:<pool>:<port>' with '--ovh-loadbalancer'", pool.Pool, pool.LoadBalancer)
+		}
+		var listener struct {
+			Listener struct {
+				ProtocolPort int `json:"protocol_port"`
+			} `json:"listener"`
+		}
+		_, err = o.call("GET", endpoint+"/v2/lbaas/listeners/"+pools.Pools[0].Listeners[0].ID, nil, &listener)
+		if err != nil {
+			return err
+		}
+		pool.Port = listener.Listener.ProtocolPort
+	}
+	return nil
+}
+
+// addLoadBalancerMember adds an address to a pool and returns the member id
+func (o *openStack) addLoadBalancerMember(region string, pool LoadBalancerPool, name, address string) (string, error) {
+	endpoint, ok := o.endpoints("load-balancer")[region]
+	if !ok {
+		return "", fmt.Errorf("No OpenStack load balancer endpoint found for region %s", region)
+	}
+
+	reqBody := map[string]interface{}{
+		"member": map[string]interface{}{
+			"name":          name,
+			"address":       address,
+			"protocol_port": pool.Port,
+		},
+	}
+	var member struct {
+		Member struct {
+			ID string `json:"id"`
+		} `json:"member"`
+	}
+	_, err := o.call("POST", endpoint+"/v2/lbaas/pools/"+pool.PoolID+"/members", reqBody, &member)
+	return member.Member.ID, err
+}
+
+// removeLoadBalancerMember removes a member from a pool. A member already
+// gone counts as removed
+func (o *openStack) removeLoadBalancerMember(region string, pool LoadBalancerPool) error {
+	endpoint, ok := o.endpoints("load-balancer")[region]
+	if !ok {
+		return fmt.Errorf("No OpenStack load balancer endpoint found for region %s", region)
+	}
+
+	_, err := o.call("DELETE", endpoint+"/v2/lbaas/pools/"+pool.PoolID+"/members/"+pool.MemberID, nil, nil)
+	if oerr, ok := err.(*openStackError); ok && oerr.Code == 404 {
+		err = nil
+	}
+	return err
+}
+
+// resolveLoadBalancerPools checks the OpenStack credentials and resolves the
+// pools the machine joins
+func (d *Driver) resolveLoadBalancerPools() error {
+	d.LoadBalancerPools = nil
+	if len(d.LoadBalancerOptions) == 0 {
+		return nil
+	}
+
+	o, err := d.openStack("'--ovh-loadbalancer'")
+	if err != nil {
+		return err
+	}
+	for _, option := range d.LoadBalancerOptions {
+		pool, err := parseLoadBalancerPool(option)
+		if err != nil {
+			return err
+		}
+		err = o.findLoadBalancerPool(d.RegionName, &pool)
+		if err != nil {
+			return err
+		}
+		d.LoadBalancerPools = append(d.LoadBalancerPools, pool)
+	}
+	return nil
+}
+
+// joinLoadBalancerPools adds the machine to its pools, with its private
+// address when it has one, as load balancers usually live in the vRack
+func (d *Driver) joinLoadBalancerPools() error {
+	o, err := d.openStack("'--ovh-loadbalancer'")
+	if err != nil {
+		return err
+	}
+
+	address := d.IPAddress
+	if d.PrivateIPAddress != "" {
+		address = d.PrivateIPAddress
+	}
+	for i := range d.LoadBalancerPools {
+		pool := &d.LoadBalancerPools[i]
+		if pool.MemberID != "" {
+			continue
+		}
+		log.Infof("Adding %s:%d to pool %s of load balancer %s...", address, pool.Port, pool.Pool, pool.LoadBalancer)
+		pool.MemberID, err = o.addLoadBalancerMember(d.RegionName, *pool, d.instanceName(), address)
+		if err != nil {
+			return err
+		}
+
+		// Save the member at once, so that a failed create still removes it
+		driver, err := json.Marshal(d)
+		if err == nil {
+			err = d.saveMachineConfig(driver)
+		}
+		if err != nil {
+			return fmt.Errorf("Could not save member %s of pool %s: %s", pool.MemberID, pool.Pool, err)
+		}
+	}
+	return nil
+}
+
+// leaveLoadBalancerPools removes the machine from its pools, before its
+// instance is deleted. Failures are reported only
+func (d *Driver) leaveLoadBalancerPools() {
+	var members []*LoadBalancerPool
+	for i := range d.LoadBalancerPools {
+		if d.LoadBalancerPools[i].MemberID != "" {
+			members = append(members, &d.LoadBalancerPools[i])
+		}
+	}
+	if len(members) == 0 {
+		return
+	}
+
+	o, err := d.openStack("'--ovh-loadbalancer'")
+	if err != nil {
+		log.Warnf("Could not remove machine %s from its load balancer pools: %s", d.MachineName, err)
+		return
+	}
+	for _, pool := range members {
+		log.Infof("Removing machine %s from pool %s of load balancer %s...", d.MachineName, pool.Pool, pool.LoadBalancer)
+		if err := o.removeLoadBalancerMember(d.RegionName, *pool); err != nil {
+			log.Warnf("Could not remove machine %s from pool %s of load balancer %s: %s", d.MachineName, pool.Pool, pool.LoadBalancer, err)
+			continue
+		}
+		pool.MemberID = ""
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Network lookups are shared by the drivers of the store: concurrent creates
+// resolve each network once, and reuse it for a while
+const (
+	lookupCacheDir         = "ovh-cache"
+	lookupCacheTTL         = 5 * time.Minute
+	lookupCacheLockTimeout = 2 * time.Minute
+)
+
+// lookupEntry is a cached lookup result
+type lookupEntry struct {
+	Value string
+	Time  time.Time
+}
+
+// cachedLookup returns the value of a lookup of the account, from the cache
+// of the store when fresh, otherwise from fetch. Processes looking up the same
+// cache wait for each other, so that only the first one calls the API
+func (d *Driver) cachedLookup(name string, fetch func() (string, error)) (string, error) {
+	if d.StorePath == "" {
+		return fetch()
+	}
+
+	dir := filepath.Join(d.StorePath, lookupCacheDir)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "networks.json")
+	unlock, err := lockFile(path+".lock", "lookup of "+d.MachineName, lookupCacheLockTimeout)
+	if err != nil {
+		return "", fmt.Errorf("Could not lock lookup cache %s: %s", path, err)
+	}
+	defer unlock()
+
+	cache := make(map[string]lookupEntry)
+	if data, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+
+	key := d.accountKey() + " " + name
+	if entry, ok := cache[key]; ok && time.Since(entry.Time) < lookupCacheTTL {
+		log.Debugf("Using cached %s %s", name, entry.Value)
+		return entry.Value, nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		return "", err
+	}
+
+	// Drop expired entries while at it
+	for k, entry := range cache {
+		if time.Since(entry.Time) >= lookupCacheTTL {
+			delete(cache, k)
+		}
+	}
+	cache[key] = lookupEntry{Value: value, Time: time.Now()}
+	data, err := json.Marshal(cache)
+	if err == nil {
+		err = ioutil.WriteFile(path, data, 0600)
+	}
+	if err != nil {
+		log.Debugf("Could not save lookup cache %s: %s", path, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Mutating operations on a machine are serialized across processes by a lock
+// file in the store, outside of the machine directory which Remove deletes.
+// Creates hold it for long, other operations wait for up to an hour
+const (
+	machineLockDir     = "ovh-locks"
+	machineLockTimeout = time.Hour
+)
+
+// machineLockPath returns the path of the machine lock file
+func (d *Driver) machineLockPath() string {
+	return filepath.Join(d.StorePath, machineLockDir, d.MachineName+".lock")
+}
+
+// lockMachine waits until no other process operates on the machine, then
+// holds the lock until the returned function is called
+func (d *Driver) lockMachine(operation string) (unlock func(), err error) {
+	if d.StorePath == "" {
+		return func() {}, nil
+	}
+
+	path := d.machineLockPath()
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		log.Infof("Waiting for %s of machine %s to complete...", lockHolder(path), d.MachineName)
+	}
+	unlock, err = lockFile(path, operation, machineLockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("Could not lock machine %s: %s", d.MachineName, err)
+	}
+	return unlock, nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/drivers/plugin"
 )
@@ -9,14 +11,31 @@ import (
 const (
 	DefaultSecurityGroup = "default"
 	DefaultProjectName   = "docker-machine"
-	DefaultFlavorName    = "b2-7"
-	DefaultRegionName    = "GRA1"
+	DefaultFlavorName    = "general-2vcpu-7gb"
+	DefaultRegionName    = "GRA7"
 	DefaultImageName     = "Ubuntu 20.04"
 	DefaultSSHUserName   = "ubuntu"
 	DefaultBillingPeriod = "hourly"
+	DefaultAPITimeout    = 30
+	DefaultSSHKeyType    = SSHKeyTypeRSA
+	DefaultSSHKeyBits    = 2048
+	DefaultTuningProfile = "none"
+	DefaultIPAttempts    = 3
+	DefaultWarmPoolSize  = 2
+
+	// DefaultSoftRemoveRetention is the time in hours soft removed machines
+	// are kept before being purged
+	DefaultSoftRemoveRetention = 168
+
+	// DefaultProductionPattern matches machine names considered production
+	DefaultProductionPattern = `(^|[-_.])(prod|production|prd)([-_.0-9]|$)`
 )
 
 func main() {
+	if isOperation() {
+		os.Exit(runOperation(os.Args[1:]))
+	}
+
 	plugin.RegisterDriver(&Driver{
 		BaseDriver: &drivers.BaseDriver{
 			SSHUser: DefaultSSHUserName,
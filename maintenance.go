@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/docker/machine/libmachine/log"
+)
+
+// maintenanceStatuses are the instance statuses caused by OVH operations on
+// the underlying host, such as an evacuation, with what they mean
+var maintenanceStatuses = map[string]string{
+	"MIGRATING":   "is being migrated to another host",
+	"REBOOT":      "is rebooting",
+	"HARD_REBOOT": "is being hard rebooted",
+	"RESCUE":      "is in rescue mode",
+	"SUSPENDED":   "has been suspended",
+}
+
+// shelvedStatuses are the statuses of a shelved instance, whose disk is kept
+// as an image, with what they mean
+var shelvedStatuses = map[string]string{
+	"SHELVED":           "is shelved",
+	"SHELVED_OFFLOADED": "is shelved and offloaded from its host, cold",
+}
+
+// maintenanceEvent describes the host operation an instance status reveals,
+// empty if none
+func maintenanceEvent(status string) string {
+	return maintenanceStatuses[status]
+}
+
+// warnMaintenance reports host operations affecting the instance, as
+// containers may die without docker-machine noticing
+func (d *Driver) warnMaintenance(instance *Instance) {
+	if shelved := shelvedStatuses[instance.Status]; shelved != "" {
+		log.Infof("OVH instance %s of machine %s %s (status %s). Run 'docker-machine start %s' to unshelve it, its address may change", d.InstanceID, d.MachineName, shelved, instance.Status, d.MachineName)
+		return
+	}
+	if event := maintenanceEvent(instance.Status); event != "" {
+		log.Warnf("OVH instance %s of machine %s %s (status %s). Containers may be interrupted, see %s", d.InstanceID, d.MachineName, event, instance.Status, CustomerInterface)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Metal instances are bare-metal servers deployed through the Public Cloud:
+// they take tens of minutes to build and boot, and cannot be resized, shelved
+// or placed in soft instance groups
+const (
+	metalFlavorPrefix = "bm-"
+
+	// metalStatusTimeout is how long a metal instance may take to reach a
+	// status, its deployment included
+	metalStatusTimeout = 40 * time.Minute
+
+	// metalSSHTimeout is how long an active metal instance may take to boot
+	// and answer on its SSH port, hardware checks included
+	metalSSHTimeout = 15 * time.Minute
+)
+
+// isMetalFlavor tells whether flavor deploys a metal instance
+func isMetalFlavor(flavor *Flavor) bool {
+	return strings.HasPrefix(flavor.Name, metalFlavorPrefix) || strings.Contains(strings.ToLower(flavor.Type), "metal")
+}
+
+// checkMetalFlavor records whether the flavor deploys a metal instance, and
+// checks the options which need a virtual one
+func (d *Driver) checkMetalFlavor(flavor *Flavor) error {
+	d.Metal = isMetalFlavor(flavor)
+	if !d.Metal {
+		return nil
+	}
+
+	var options []string
+	if d.OnStop == OnStopShelve {
+		options = append(options, "'--ovh-on-stop shelve'")
+	}
+	if d.SoftRemove {
+		options = append(options, "'--ovh-soft-remove'")
+	}
+	if d.WarmPool != "" {
+		options = append(options, "'--ovh-warm-pool'")
+	}
+	if d.Flex {
+		options = append(options, "'--ovh-flex'")
+	}
+	if d.SameHostAs != "" || d.DifferentHostThan != "" {
+		options = append(options, "the placement options")
+	}
+	if len(options) > 0 {
+		return fmt.Errorf("Flavor '%s' deploys a metal instance, which cannot be shelved, resized or placed in an instance group. Please drop %s or select another flavor with '--ovh-flavor'", flavor.Name, strings.Join(options, ", "))
+	}
+	log.Infof("Flavor %s deploys a metal instance, creating it may take up to %s", flavor.Name, metalStatusTimeout)
+	return nil
+}
+
+// statusTimeout returns how long the instance may take to reach a status
+func (d *Driver) statusTimeout() time.Duration {
+	if d.Metal {
+		return metalStatusTimeout
+	}
+	return statusTimeout
+}
+
+// waitForMetalSSH waits for the SSH port of an active metal instance, which
+// boots well past the SSH wait of docker-machine
+func (d *Driver) waitForMetalSSH() error {
+	if !d.Metal {
+		return nil
+	}
+	address := net.JoinHostPort(d.IPAddress, strconv.Itoa(d.SSHPort))
+	log.Infof("Waiting for metal instance %s to boot...", d.InstanceID)
+	err := waitWithBackoffFor(metalSSHTimeout, func() (bool, error) {
+		conn, err := net.DialTimeout("tcp", address, pollMaxInterval)
+		if err != nil {
+			log.Debugf("SSH port of instance %s not open yet: %s", d.InstanceID, err)
+			return false, nil
+		}
+		conn.Close()
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("Metal instance %s did not open its SSH port %s: %s", d.InstanceID, address, err)
+	}
+	return nil
+}
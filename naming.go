@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxHostnameLength is the maximum length of a DNS label, used as hostname
+const maxHostnameLength = 63
+
+var (
+	invalidHostnameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+	validHostname        = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`)
+)
+
+// validateMachineName checks that the machine name can be used as an instance
+// hostname, and reports the first violated constraint
+func validateMachineName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("Machine name must not be empty")
+	case len(name) > maxHostnameLength:
+		return fmt.Errorf("Machine name '%s' is %d characters long, hostnames are limited to %d characters", name, len(name), maxHostnameLength)
+	case strings.HasPrefix(name, "-") || strings.HasSuffix(name, "-"):
+		return fmt.Errorf("Machine name '%s' must not start or end with a hyphen", name)
+	case !validHostname.MatchString(name):
+		return fmt.Errorf("Machine name '%s' may only contain letters, digits and hyphens. Dots and underscores break hostnames and TLS certificates", name)
+	}
+	return nil
+}
+
+// sanitizeMachineName turns a machine name into a valid hostname
+func sanitizeMachineName(name string) string {
+	name = invalidHostnameChars.ReplaceAllString(strings.ToLower(name), "-")
+	if len(name) > maxHostnameLength {
+		name = name[:maxHostnameLength]
+	}
+	return strings.Trim(name, "-")
+}
+
+// instanceName returns the name of the OVH instance
+func (d *Driver) instanceName() string {
+	if d.InstanceName != "" {
+		return d.resourceName(d.InstanceName)
+	}
+	return d.resourceName(d.MachineName)
+}
+
+// resourceName returns the name of a resource created by the driver, in the
+// namespace of the name prefix
+func (d *Driver) resourceName(name string) string {
+	if strings.HasPrefix(name, d.NamePrefix) {
+		return name
+	}
+	return d.NamePrefix + name
+}
+
+// validateNamePrefix checks that the name prefix keeps instance names valid
+// hostnames
+func (d *Driver) validateNamePrefix() error {
+	if d.NamePrefix == "" {
+		return nil
+	}
+	if strings.HasPrefix(d.NamePrefix, "-") || invalidHostnameChars.MatchString(strings.ToLower(d.NamePrefix)) {
+		return fmt.Errorf("Invalid name prefix '%s'. It may only contain letters, digits and hyphens, and must not start with a hyphen", d.NamePrefix)
+	}
+	if err := validateMachineName(d.instanceName()); err != nil {
+		return fmt.Errorf("Invalid instance name with prefix '%s': %s", d.NamePrefix, err)
+	}
+	return nil
+}
+
+// checkNamespace checks that a pre-existing resource reused by the driver
+// belongs to the name prefix namespace
+func (d *Driver) checkNamespace(kind, name string) error {
+	if !strings.HasPrefix(name, d.NamePrefix) {
+		return fmt.Errorf("%s '%s' is outside of the '%s' namespace. Please select one whose name starts with '%s'", kind, name, d.NamePrefix, d.NamePrefix)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// instanceNetworkIDs returns the networks to request the instance with. When
+// the project lists no public network, none is requested so that OVH attaches
+// its default public network, and the private network is attached afterwards
+func (d *Driver) instanceNetworkIDs() []string {
+	if d.AttachPrivateNetwork {
+		return nil
+	}
+	return d.NetworkIDs
+}
+
+// hasPrivateIP tells whether the instance has a private network IP
+func (instance *Instance) hasPrivateIP() bool {
+	for _, ip := range instance.IPAddresses {
+		if ip.Type == "private" {
+			return true
+		}
+	}
+	return false
+}
+
+// attachPrivateNetwork attaches the private network to the active instance,
+// unless a resumed create already did, and waits for its private IP
+func (d *Driver) attachPrivateNetwork(client *API, instance *Instance) (*Instance, error) {
+	if instance != nil && instance.hasPrivateIP() {
+		return instance, nil
+	}
+
+	log.Infof("Attaching private network %s to instance %s...", d.PrivateNetworkName, d.InstanceID)
+	err := client.AttachInterface(d.ProjectID, d.InstanceID, d.NetworkIDs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	err = waitWithBackoff(func() (bool, error) {
+		instance, err = client.GetInstance(d.ProjectID, d.InstanceID)
+		if isTransientError(err) {
+			return false, nil
+		}
+		if err != nil {
+			return true, err
+		}
+		return instance.hasPrivateIP(), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Private network %s did not come up on instance %s: %s", d.PrivateNetworkName, d.InstanceID, err)
+	}
+	return instance, nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// officeHoursDir holds the office hours scripts of the machines, in the store
+const officeHoursDir = "ovh-office-hours"
+
+// officeHoursPeriod is the cron schedule checking the office hours
+const officeHoursPeriod = "*/15 * * * *"
+
+var officeHoursFormat = regexp.MustCompile(`^(\S+)\s+(\d\d):(\d\d)-(\d\d):(\d\d)(?:\s+(\S+))?$`)
+
+var weekDays = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+// officeHours is a parsed weekly schedule
+type officeHours struct {
+	days     []int
+	start    string
+	end      string
+	location string
+}
+
+// parseOfficeHours parses a schedule such as 'Mon-Fri 07:00-20:00 CET'. Days
+// are ranges or lists of week days, the time zone defaults to UTC. Hours
+// ending before they start, such as 'Mon-Fri 22:00-06:00', run overnight
+func parseOfficeHours(schedule string) (*officeHours, error) {
+	invalid := fmt.Errorf("Invalid office hours '%s'. Expected DAYS HH:MM-HH:MM [TIMEZONE], e.g. 'Mon-Fri 07:00-20:00 Europe/Paris'", schedule)
+	m := officeHoursFormat.FindStringSubmatch(strings.TrimSpace(schedule))
+	if m == nil {
+		return nil, invalid
+	}
+
+	hours := &officeHours{start: m[2] + m[3], end: m[4] + m[5], location: m[6]}
+	if hours.location == "" {
+		hours.location = "UTC"
+	}
+	if _, err := time.LoadLocation(hours.location); err != nil {
+		return nil, fmt.Errorf("Invalid office hours time zone '%s': %s", hours.location, err)
+	}
+	if m[2] > "23" || m[4] > "24" || m[3] > "59" || m[5] > "59" || hours.start == hours.end {
+		return nil, invalid
+	}
+
+	for _, days := range strings.Split(strings.ToLower(m[1]), ",") {
+		bounds := strings.SplitN(days, "-", 2)
+		first, last := weekDay(bounds[0]), weekDay(bounds[len(bounds)-1])
+		if first == 0 || last < first {
+			return nil, invalid
+		}
+		for day := first; day <= last; day++ {
+			hours.days = append(hours.days, day)
+		}
+	}
+	return hours, nil
+}
+
+// weekDay returns the ISO number of a week day, 0 if unknown
+func weekDay(name string) int {
+	for i, day := range weekDays {
+		if name == day {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// officeHoursScript shelves the instance when office hours end and unshelves
+// it when they start, through the OpenStack compute API with an application
+// credential only allowed to act on the instance. Hours ending before they
+// start run overnight, from the listed days to the next ones. It acts on
+// transitions only, so that a machine unshelved by hand after hours is left
+// alone until the next ones
+const officeHoursScript = `#!/bin/sh
+# Office hours of machine %[1]s: %[2]s
+AUTH_URL='%[3]s'
+CREDENTIAL_ID='%[4]s'
+CREDENTIAL_SECRET='%[5]s'
+COMPUTE='%[6]s'
+INSTANCE='%[7]s'
+DAYS='%[9]s'
+START=%[10]s
+END=%[11]s
+STATE="$0.state"
+
+DAY=$(TZ='%[8]s' date +%%u)
+PREVIOUS=$(( (DAY + 5) %% 7 + 1 ))
+NOW=$(TZ='%[8]s' date +%%H%%M)
+PHASE=closed
+case " $DAYS " in *" $DAY "*)
+	[ "$NOW" -ge $START ] && { [ $START -gt $END ] || [ "$NOW" -lt $END ]; } && PHASE=open ;;
+esac
+case " $DAYS " in *" $PREVIOUS "*)
+	[ $START -gt $END ] && [ "$NOW" -lt $END ] && PHASE=open ;;
+esac
+
+if [ "$1" = init ] || [ "$(cat "$STATE" 2>/dev/null)" = "$PHASE" ]; then
+	echo $PHASE > "$STATE"
+	exit 0
+fi
+
+ACTION=shelve
+[ $PHASE = open ] && ACTION=unshelve
+AUTH='{"auth":{"identity":{"methods":["application_credential"],"application_credential":{"id":"'$CREDENTIAL_ID'","secret":"'$CREDENTIAL_SECRET'"}}}}'
+TOKEN=$(curl -s -m 10 -o /dev/null -D - -H "Content-Type: application/json" -d "$AUTH" "$AUTH_URL/auth/tokens" | tr -d '\r' | awk 'tolower($1) == "x-subject-token:" {print $2}')
+if [ -n "$TOKEN" ] && curl -s -f -m 10 -X POST -H "Content-Type: application/json" -H "X-Auth-Token: $TOKEN" -d "{\"$ACTION\": null}" "$COMPUTE/servers/$INSTANCE/action" >/dev/null; then
+	echo $PHASE > "$STATE"
+	echo "$(date -u +%%FT%%TZ) office hours $PHASE: $ACTION"
+else
+	echo "$(date -u +%%FT%%TZ) office hours $PHASE: $ACTION failed, retrying" >&2
+fi
+`
+
+// officeHoursPath returns the office hours script of the machine
+func (d *Driver) officeHoursPath() string {
+	return filepath.Join(d.StorePath, officeHoursDir, d.MachineName+".sh")
+}
+
+// officeHoursMarker tags the crontab entry of the machine
+func (d *Driver) officeHoursMarker() string {
+	return "# ovh-office-hours " + d.MachineName
+}
+
+// validateOfficeHours checks the office hours schedule
+func (d *Driver) validateOfficeHours() error {
+	if d.OfficeHours == "" {
+		return nil
+	}
+	if d.StorePath == "" {
+		return fmt.Errorf("'--ovh-office-hours' requires a machine store")
+	}
+	_, err := parseOfficeHours(d.OfficeHours)
+	if err != nil {
+		return err
+	}
+
+	o, err := d.openStack("'--ovh-office-hours'")
+	if err != nil {
+		return err
+	}
+	if _, ok := o.endpoints("compute")[d.RegionName]; !ok {
+		return fmt.Errorf("No OpenStack compute endpoint found for region %s", d.RegionName)
+	}
+	return nil
+}
+
+// setupOfficeHours creates an OpenStack application credential whose access
+// rules only allow actions on the instance, writes the office hours script of
+// the machine using it next to the store, and schedules it in the crontab of
+// this host. The credential is saved in the machine configuration as soon as
+// it exists, so that removing the machine deletes it
+func (d *Driver) setupOfficeHours() error {
+	hours, err := parseOfficeHours(d.OfficeHours)
+	if err != nil {
+		return err
+	}
+
+	o, err := d.openStack("'--ovh-office-hours'")
+	if err != nil {
+		return err
+	}
+	endpoint, ok := o.endpoints("compute")[d.RegionName]
+	if !ok {
+		return fmt.Errorf("No OpenStack compute endpoint found for region %s", d.RegionName)
+	}
+
+	// The secret is only known on creation, a resumed create replaces it
+	if d.OfficeHoursCredential != "" {
+		err = o.deleteApplicationCredential(d.OfficeHoursCredential)
+		if err != nil {
+			return err
+		}
+		d.OfficeHoursCredential = ""
+	}
+
+	credential, err := o.createServerCredential(d.instanceName()+"-office-hours", "Office hours of docker-machine "+d.MachineName, endpoint, d.InstanceID)
+	if err != nil {
+		return fmt.Errorf("Could not create the credential of the office hours: %s", err)
+	}
+	d.OfficeHoursCredential = credential.URL
+	err = d.checkpoint(d.CreatePhase)
+	if err != nil {
+		return err
+	}
+
+	var days []string
+	for _, day := range hours.days {
+		days = append(days, fmt.Sprintf("%d", day))
+	}
+	script := fmt.Sprintf(officeHoursScript, d.MachineName, d.OfficeHours, o.authURL, credential.ID, credential.Secret, endpoint, d.InstanceID, hours.location, strings.Join(days, " "), hours.start, hours.end)
+
+	path := d.officeHoursPath()
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(path, []byte(script), 0700)
+	}
+	if err == nil {
+		err = exec.Command(path, "init").Run()
+	}
+	if err != nil {
+		return fmt.Errorf("Could not write office hours script %s: %s", path, err)
+	}
+
+	entry := fmt.Sprintf("%s %s >> %s.log 2>&1 %s", officeHoursPeriod, path, path, d.officeHoursMarker())
+	err = d.updateCrontab(entry)
+	if err != nil {
+		log.Warnf("Could not schedule office hours of %s: %s. Please add this entry to the crontab of this host:\n%s", d.MachineName, err, entry)
+	} else {
+		log.Infof("Scheduled office hours of %s: %s", d.MachineName, d.OfficeHours)
+	}
+	return nil
+}
+
+// deleteOfficeHoursCredential deletes the application credential of the
+// office hours
+func (d *Driver) deleteOfficeHoursCredential() error {
+	o, err := d.openStack("Deleting the credential of the office hours")
+	if err != nil {
+		return err
+	}
+	err = o.deleteApplicationCredential(d.OfficeHoursCredential)
+	if err != nil {
+		return err
+	}
+	d.OfficeHoursCredential = ""
+	return nil
+}
+
+// removeOfficeHours unschedules the office hours of the machine, if any
+func (d *Driver) removeOfficeHours() {
+	path := d.officeHoursPath()
+	if _, err := os.Stat(path); d.StorePath == "" || os.IsNotExist(err) {
+		return
+	}
+
+	err := d.updateCrontab("")
+	if err != nil {
+		log.Warnf("Could not unschedule office hours of %s: %s. Please remove '%s' from the crontab of this host", d.MachineName, err, d.officeHoursMarker())
+	}
+	for _, suffix := range []string{"", ".state", ".log"} {
+		os.Remove(path + suffix)
+	}
+}
+
+// updateCrontab replaces the crontab entry of the machine with entry, or
+// removes it when entry is empty. A crontab that cannot be read is left
+// alone, as writing it back would drop the other entries
+func (d *Driver) updateCrontab(entry string) error {
+	current, err := exec.Command("crontab", "-l").Output()
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok || !strings.Contains(string(exitErr.Stderr), "no crontab for") {
+			return fmt.Errorf("Could not read the crontab: %s", err)
+		}
+		current = nil
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(current), "\n"), "\n") {
+		if line != "" && !strings.HasSuffix(line, d.officeHoursMarker()) {
+			lines = append(lines, line)
+		}
+	}
+	if entry != "" {
+		lines = append(lines, entry)
+	}
+
+	cmd := exec.Command("crontab", "-")
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
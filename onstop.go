@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// What stopping a machine does
+const (
+	// OnStopStop stops the instance, which is still billed
+	OnStopStop = "stop"
+
+	// OnStopShelve shelves the instance: only its disk image is billed
+	OnStopShelve = "shelve"
+
+	// OnStopDelete deletes the instance, as for ephemeral machines
+	OnStopDelete = "delete"
+)
+
+// validOnStop tells whether behavior is a known stop behavior
+func validOnStop(behavior string) bool {
+	switch behavior {
+	case "", OnStopStop, OnStopShelve, OnStopDelete:
+		return true
+	}
+	return false
+}
+
+// deleteOnStop deletes the instance of the machine on stop, and records it so
+// that the machine is reported as stopped until it is removed. Its other
+// resources are left to the removal
+func (d *Driver) deleteOnStop() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	log.Infof("Deleting OVH instance %s of machine %s on stop, as selected with '--ovh-on-stop'...", d.InstanceID, d.MachineName)
+	err = client.DeleteInstance(d.ProjectID, d.InstanceID)
+	if err != nil {
+		return err
+	}
+
+	d.DeletedOnStop = true
+	driver, err := json.Marshal(d)
+	if err == nil {
+		err = d.saveMachineConfig(driver)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not save the deletion of machine %s: %s", d.MachineName, err)
+	}
+	log.Infof("Instance of machine %s is deleted. Run 'docker-machine rm %s' to remove its other resources", d.MachineName, d.MachineName)
+	return nil
+}
+
+// stopInstance stops or shelves the instance of the machine and waits for it
+func (d *Driver) stopInstance(client *API) error {
+	if d.OnStop == OnStopShelve {
+		log.Infof("Shelving OVH instance %s...", d.InstanceID)
+		err := client.ShelveInstance(d.ProjectID, d.InstanceID)
+		if err != nil {
+			return err
+		}
+		_, err = d.waitForInstanceStatus("SHELVED_OFFLOADED")
+		return err
+	}
+
+	log.Infof("Stopping OVH instance %s...", d.InstanceID)
+	err := client.StopInstance(d.ProjectID, d.InstanceID)
+	if err != nil {
+		return err
+	}
+	_, err = d.waitForInstanceStatus("SHUTOFF")
+	return err
+}
+
+// startInstance starts or unshelves the instance of the machine, depending on
+// how it was stopped, and waits for it
+func (d *Driver) startInstance(client *API) error {
+	if d.DeletedOnStop {
+		return fmt.Errorf("The instance of machine %s was deleted on stop, as selected with '--ovh-on-stop'. Please remove the machine and create it again", d.MachineName)
+	}
+
+	instance, err := client.GetInstance(d.ProjectID, d.InstanceID)
+	if err != nil {
+		return err
+	}
+
+	switch instance.Status {
+	case "ACTIVE":
+		return nil
+	case "SHUTOFF":
+		log.Infof("Starting OVH instance %s...", d.InstanceID)
+		err = client.StartInstance(d.ProjectID, d.InstanceID)
+	case "SHELVED", "SHELVED_OFFLOADED":
+		log.Infof("Unshelving OVH instance %s, which may take a few minutes...", d.InstanceID)
+		err = client.UnshelveInstance(d.ProjectID, d.InstanceID)
+	default:
+		return fmt.Errorf("Machine %s cannot be started while its instance is %s", d.MachineName, instance.Status)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = d.waitForInstanceStatus("ACTIVE")
+	if err != nil {
+		return err
+	}
+	return d.refreshAddress(client)
+}
+
+// refreshAddress waits for the addresses of the started instance, which an
+// unshelved instance gets again on its new host, and moves the machine to
+// them when they changed
+func (d *Driver) refreshAddress(client *API) error {
+	var instance *Instance
+	err := waitWithBackoff(func() (bool, error) {
+		var err error
+		instance, err = client.GetInstance(d.ProjectID, d.InstanceID)
+		if isTransientError(err) {
+			return false, nil
+		}
+		if err != nil {
+			return true, err
+		}
+		return d.instanceAddress(instance) != "", nil
+	})
+	if err != nil {
+		return fmt.Errorf("Instance %s got no address back: %s", d.InstanceID, err)
+	}
+
+	previous, previousPrivate := d.IPAddress, d.PrivateIPAddress
+	for _, ip := range instance.IPAddresses {
+		if ip.Type == "private" {
+			d.PrivateIPAddress = ip.IP
+			break
+		}
+	}
+	if address := d.instanceAddress(instance); address != d.IPAddress {
+		log.Warnf("Machine %s came back at %s instead of %s. Regenerate its engine certificate with: docker-machine regenerate-certs -f %s", d.MachineName, address, d.IPAddress, d.MachineName)
+		d.IPAddress = address
+		d.recordHostKeys()
+		d.updateSSHConfig()
+	}
+	driver, err := json.Marshal(d)
+	if err == nil {
+		err = d.saveMachineConfig(driver)
+	}
+	if err == nil {
+		d.reconcileAddress(previous, previousPrivate)
+	}
+	return err
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultOpenStackAuthURL is the OVH Public Cloud identity endpoint
+const DefaultOpenStackAuthURL = "https://auth.cloud.ovh.net/v3"
+
+// openStack is a minimal OpenStack client, for the settings and services the
+// OVH API does not expose
+type openStack struct {
+	token   string
+	catalog []openStackService
+	client  *http.Client
+
+	// identity endpoint, and the user the token was issued to
+	authURL string
+	userID  string
+
+	// audit log of the mutating calls, and the machine they are made for
+	auditPath    string
+	auditMachine string
+}
+
+// openStackService is a service of the OpenStack catalog
+type openStackService struct {
+	Type      string `json:"type"`
+	Endpoints []struct {
+		Interface string `json:"interface"`
+		Region    string `json:"region"`
+		URL       string `json:"url"`
+	} `json:"endpoints"`
+}
+
+// openStack authenticates against OpenStack for the machine, see newOpenStack.
+// Its mutating calls are recorded in the audit log of the store
+func (d *Driver) openStack(feature string) (*openStack, error) {
+	o, err := newOpenStack(d.ProjectID, feature)
+	if err == nil && d.StorePath != "" {
+		o.auditPath = filepath.Join(d.StorePath, AuditLogName)
+		o.auditMachine = d.MachineName
+	}
+	return o, err
+}
+
+// newOpenStack authenticates against OpenStack with the OS_* credentials of
+// an OpenStack user of the project. feature names the option requiring them
+func newOpenStack(projectID, feature string) (*openStack, error) {
+	username := os.Getenv("OS_USERNAME")
+	password := os.Getenv("OS_PASSWORD")
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("%s requires the OpenStack credentials of a user of the project. Please set OS_USERNAME and OS_PASSWORD", feature)
+	}
+	authURL := os.Getenv("OS_AUTH_URL")
+	if authURL == "" {
+		authURL = DefaultOpenStackAuthURL
+	}
+	domain := os.Getenv("OS_USER_DOMAIN_NAME")
+	if domain == "" {
+		domain = "Default"
+	}
+
+	auth := map[string]interface{}{
+		"auth": map[string]interface{}{
+			"identity": map[string]interface{}{
+				"methods": []string{"password"},
+				"password": map[string]interface{}{
+					"user": map[string]interface{}{
+						"name":     username,
+						"password": password,
+						"domain":   map[string]string{"name": domain},
+					},
+				},
+			},
+			"scope": map[string]interface{}{
+				"project": map[string]string{"id": projectID},
+			},
+		},
+	}
+
+	o := &openStack{client: &http.Client{Timeout: 30 * time.Second}, authURL: strings.TrimSuffix(authURL, "/")}
+	traceCalls(o.client)
+
+	var token struct {
+		Token struct {
+			Catalog []openStackService `json:"catalog"`
+			User    struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"token"`
+	}
+	header, err := o.call("POST", o.authURL+"/auth/tokens", auth, &token)
+	if err != nil {
+		return nil, fmt.Errorf("Could not authenticate against OpenStack: %s", err)
+	}
+	o.token = header.Get("X-Subject-Token")
+	o.catalog = token.Token.Catalog
+	o.userID = token.Token.User.ID
+	return o, nil
+}
+
+// endpoints returns the public endpoints of a service type by region
+func (o *openStack) endpoints(serviceType string) map[string]string {
+	endpoints := make(map[string]string)
+	for _, service := range o.catalog {
+		if service.Type != serviceType {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if endpoint.Interface == "public" {
+				endpoints[endpoint.Region] = strings.TrimSuffix(endpoint.URL, "/")
+			}
+		}
+	}
+	return endpoints
+}
+
+// call performs a JSON request and decodes the response into resType. A
+// []byte reqBody is sent as is, and the raw response is stored when resType
+// is a *[]byte
+func (o *openStack) call(method, url string, reqBody, resType interface{}) (http.Header, error) {
+	return o.callVersion("", method, url, reqBody, resType)
+}
+
+// callVersion performs a call with an OpenStack API microversion, such as
+// "compute 2.64", when set
+func (o *openStack) callVersion(version, method, url string, reqBody, resType interface{}) (http.Header, error) {
+	var body []byte
+	contentType := "application/json"
+	switch b := reqBody.(type) {
+	case nil:
+	case []byte:
+		body = b
+		contentType = "application/octet-stream"
+	default:
+		var err error
+		body, err = json.Marshal(reqBody)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	if o.token != "" {
+		req.Header.Set("X-Auth-Token", o.token)
+	}
+	if version != "" {
+		req.Header.Set("OpenStack-API-Version", version)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		o.audit(method, req.URL.Path, reqBody, 0, err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err == nil && resp.StatusCode >= 300 {
+		err = &openStackError{Code: resp.StatusCode, Message: fmt.Sprintf("%s %s: %s %s", method, req.URL.Path, resp.Status, strings.TrimSpace(string(data)))}
+	}
+	o.audit(method, req.URL.Path, reqBody, resp.StatusCode, err)
+	if err != nil {
+		return nil, err
+	}
+	switch res := resType.(type) {
+	case nil:
+	case *[]byte:
+		*res = data
+	default:
+		err = json.Unmarshal(data, resType)
+	}
+	return resp.Header, err
+}
+
+// audit appends a mutating call and its outcome to the audit log of the
+// machine, as the calls of the OVH API
+func (o *openStack) audit(method, path string, reqBody interface{}, code int, callErr error) {
+	if o.auditPath == "" || method == "GET" || method == "HEAD" {
+		return
+	}
+	appendAuditEntry(o.auditPath, auditEntry{
+		Machine: o.auditMachine,
+		Method:  method,
+		Path:    path,
+		Code:    code,
+	}, reqBody, callErr)
+}
+
+// openStackError is an error answered by an OpenStack API
+type openStackError struct {
+	Code    int
+	Message string
+}
+
+func (e *openStackError) Error() string {
+	return e.Message
+}
+
+// applicationCredential is an OpenStack application credential, by URL, with
+// its secret, which is only known on creation
+type applicationCredential struct {
+	URL    string
+	ID     string
+	Secret string
+}
+
+// createServerCredential creates an application credential of the user whose
+// access rules only allow the actions on a server of a compute endpoint, such
+// as reboot or shelve
+func (o *openStack) createServerCredential(name, description, computeEndpoint, serverID string) (*applicationCredential, error) {
+	computeURL, err := url.Parse(computeEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var created struct {
+		ApplicationCredential struct {
+			ID     string `json:"id"`
+			Secret string `json:"secret"`
+		} `json:"application_credential"`
+	}
+	req := map[string]interface{}{
+		"application_credential": map[string]interface{}{
+			"name":        name,
+			"description": description,
+			"access_rules": []map[string]string{{
+				"service": "compute",
+				"method":  "POST",
+				"path":    computeURL.Path + "/servers/" + serverID + "/action",
+			}},
+		},
+	}
+	credentialsURL := fmt.Sprintf("%s/users/%s/application_credentials", o.authURL, o.userID)
+	_, err = o.call("POST", credentialsURL, req, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &applicationCredential{
+		URL:    credentialsURL + "/" + created.ApplicationCredential.ID,
+		ID:     created.ApplicationCredential.ID,
+		Secret: created.ApplicationCredential.Secret,
+	}, nil
+}
+
+// deleteApplicationCredential deletes an application credential by URL
+func (o *openStack) deleteApplicationCredential(credentialURL string) error {
+	_, err := o.call("DELETE", credentialURL, nil, nil)
+	if apierror, ok := err.(*openStackError); ok && apierror.Code == 404 {
+		return nil
+	}
+	return err
+}
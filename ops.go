@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnutils"
+)
+
+// Operations are run by invoking the driver binary directly, as docker-machine
+// has no command a driver may extend:
+//
+//	docker-machine-driver-ovh [--storage-path PATH] OPERATION [ARGS...]
+//
+// They load the machines from the docker-machine store, and hold the machine
+// lock while changing one, saving the driver part of its configuration
+type operation struct {
+	args        string
+	description string
+	run         func(storePath string, args []string) error
+}
+
+// operations are the operations of the driver binary, by name
+var operations = map[string]operation{
+	"publish-discovery": {
+		args:        "MACHINE...",
+		description: "Publish the Swarm discovery records of Swarm managers",
+		run: eachMachine(lockedMachine("publish-discovery", func(d *Driver) error {
+			return d.publishDiscovery()
+		})),
+	},
+	"create-times": {
+		description: "Print the create durations of the store by region and flavor",
+		run: func(storePath string, args []string) error {
+			return logStoreCreateTimes(storePath)
+		},
+	},
+	"confirm-resize": {
+		args:        "MACHINE...",
+		description: "Confirm the pending resize of machines and record their new flavor",
+		run: eachMachine(lockedMachine("confirm-resize", func(d *Driver) error {
+			return d.resolveResize(false)
+		})),
+	},
+	"drain-pool": {
+		args:        "MACHINE...",
+		description: "Delete the instances and the key of the warm pool of machines",
+		run: eachMachine(func(d *Driver) error {
+			return d.drainWarmPool()
+		}),
+	},
+	"export-catalog": {
+		args:        "PROJECT FILE",
+		description: "Export the catalog of a project to a bundle for '--ovh-catalog-bundle'",
+		run:         exportStoreCatalog,
+	},
+	"prune-snapshots": {
+		args:        "[MACHINE...]",
+		description: "Prune the snapshots of removed machines past their retention",
+		run:         pruneStoreSnapshots,
+	},
+	"refill-pool": {
+		args:        "MACHINE...",
+		description: "Build and shelve the instances missing from the warm pool of machines",
+		run: eachMachine(func(d *Driver) error {
+			return d.refillWarmPool()
+		}),
+	},
+	"purge-trash": {
+		description: "Delete the soft removed instances past their retention",
+		run: func(storePath string, args []string) error {
+			return purgeStoreTrash(storePath)
+		},
+	},
+	"recovery-events": {
+		args:        "MACHINE...",
+		description: "Print the recoveries of the auto-recovery watchdog",
+		run: eachMachine(lockedMachine("recovery-events", func(d *Driver) error {
+			return d.refreshRecoveryEvents()
+		})),
+	},
+	"reconcile-address": {
+		args:        "MACHINE...",
+		description: "Move machines and their registrations to the address of their instance",
+		run: eachMachine(lockedMachine("reconcile-address", func(d *Driver) error {
+			return d.updateAddress("", true)
+		})),
+	},
+	"revert-resize": {
+		args:        "MACHINE...",
+		description: "Revert the pending resize of machines to their former flavor",
+		run: eachMachine(lockedMachine("revert-resize", func(d *Driver) error {
+			return d.resolveResize(true)
+		})),
+	},
+	"remove-cluster": {
+		args:        "PREFIX",
+		description: "Remove the machines whose name starts with PREFIX concurrently",
+		run:         removeStoreCluster,
+	},
+	"rotate-ssh-key": {
+		args:        "MACHINE...",
+		description: "Replace the ssh key generated for machines with a new one",
+		run: eachMachine(lockedMachine("rotate-ssh-key", func(d *Driver) error {
+			return d.rotateSSHKey()
+		})),
+	},
+	"snapshots": {
+		args:        "[MACHINE...]",
+		description: "List the snapshots taken on removal of machines",
+		run:         listStoreSnapshots,
+	},
+	"update-address": {
+		args:        "MACHINE [ADDRESS]",
+		description: "Move a machine to the address of its instance, or to a failover IP",
+		run: func(storePath string, args []string) error {
+			if len(args) == 0 || len(args) > 2 {
+				return fmt.Errorf("Please give the machine, and its new address for a failover IP")
+			}
+			address := ""
+			if len(args) == 2 {
+				address = args[1]
+			}
+			return eachMachine(lockedMachine("update-address", func(d *Driver) error {
+				return d.updateAddress(address, false)
+			}))(storePath, args[:1])
+		},
+	},
+	"stats": {
+		args:        "MACHINE...",
+		description: "Print the CPU, memory and disk usage of running machines",
+		run: eachMachine(func(d *Driver) error {
+			client, err := d.getClient()
+			if err != nil {
+				return err
+			}
+			d.logStatistics(client)
+			return nil
+		}),
+	},
+	"switch-ssh-user": {
+		args:        "MACHINE...",
+		description: "Switch provisioned machines to their runtime ssh user",
+		run: eachMachine(lockedMachine("switch-ssh-user", func(d *Driver) error {
+			return d.switchSSHUser()
+		})),
+	},
+}
+
+// isOperation tells whether the binary was invoked for an operation rather
+// than as a plugin by docker-machine, which passes no argument
+func isOperation() bool {
+	return len(os.Args) > 1
+}
+
+// runOperation runs the operation of the command line, and returns the exit
+// status of the binary
+func runOperation(args []string) int {
+	flags := flag.NewFlagSet("docker-machine-driver-ovh", flag.ContinueOnError)
+	storePath := flags.String("storage-path", defaultStorePath(), "Path of the docker-machine store")
+	flags.StringVar(storePath, "s", *storePath, "Path of the docker-machine store")
+	debug := flags.Bool("debug", os.Getenv("MACHINE_DEBUG") != "", "Print debug messages")
+	flags.BoolVar(debug, "D", *debug, "Print debug messages")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: docker-machine-driver-ovh [--storage-path PATH] [--debug] OPERATION [ARGS...]\n\nOperations:\n")
+		var names []string
+		for name := range operations {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %-40s %s\n", name+" "+operations[name].args, operations[name].description)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	log.SetDebug(*debug)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	op, ok := operations[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown operation '%s'\n\n", flags.Arg(0))
+		flags.Usage()
+		return 2
+	}
+
+	err := op.run(*storePath, flags.Args()[1:])
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	return 0
+}
+
+// defaultStorePath returns the store of docker-machine, as selected by its
+// environment
+func defaultStorePath() string {
+	if path := os.Getenv("MACHINE_STORAGE_PATH"); path != "" {
+		return path
+	}
+	return filepath.Join(mcnutils.GetHomeDir(), ".docker", "machine")
+}
+
+// loadMachine reads the driver of a machine of the store
+func loadMachine(storePath, name string) (*Driver, error) {
+	data, err := ioutil.ReadFile(filepath.Join(storePath, "machines", name, "config.json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Machine '%s' does not exist in store %s", name, storePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var machine storedMachine
+	err = json.Unmarshal(data, &machine)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read machine '%s': %s", name, err)
+	}
+	if machine.DriverName != "ovh" || machine.Driver == nil || machine.Driver.BaseDriver == nil {
+		return nil, fmt.Errorf("Machine '%s' is not an OVH machine", name)
+	}
+	machine.Driver.StorePath = storePath
+	return machine.Driver, nil
+}
+
+// eachMachine returns an operation running fn on each machine of its
+// arguments. Failures are reported, and fail the operation once every
+// machine is done
+func eachMachine(fn func(d *Driver) error) func(storePath string, args []string) error {
+	return func(storePath string, args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("No machine given")
+		}
+
+		var failed []string
+		for _, name := range args {
+			d, err := loadMachine(storePath, name)
+			if err == nil {
+				err = fn(d)
+			}
+			if err != nil {
+				log.Errorf("%s: %s", name, err)
+				failed = append(failed, name)
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("Operation failed for %s", strings.Join(failed, ", "))
+		}
+		return nil
+	}
+}
+
+// lockedMachine returns the function of an operation changing the machine:
+// fn runs under the machine lock on the machine read again, and the machine is
+// saved once it succeeds
+func lockedMachine(name string, fn func(d *Driver) error) func(d *Driver) error {
+	return func(d *Driver) error {
+		unlock, err := d.lockMachine(name)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		d, err = loadMachine(d.StorePath, d.MachineName)
+		if err != nil {
+			return err
+		}
+		err = fn(d)
+		if err != nil {
+			return err
+		}
+		driver, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		return d.saveMachineConfig(driver)
+	}
+}
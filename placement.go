@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Instance group policies of the placement options. Soft policies let the
+// scheduler place the instance elsewhere rather than fail the create
+const (
+	PlacementSameHost      = "soft-affinity"
+	PlacementDifferentHost = "soft-anti-affinity"
+)
+
+// serverGroupVersion is the compute microversion with single policy groups
+const serverGroupVersion = "compute 2.64"
+
+// serverGroup is an OpenStack server group, the instance group of the OVH API
+type serverGroup struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Policy  string   `json:"policy"`
+	Members []string `json:"members"`
+}
+
+// placementReference returns the machine to place the instance against, the
+// option naming it and the policy
+func (d *Driver) placementReference() (machine, option, policy string) {
+	if d.SameHostAs != "" {
+		return d.SameHostAs, "'--ovh-same-host-as'", PlacementSameHost
+	}
+	if d.DifferentHostThan != "" {
+		return d.DifferentHostThan, "'--ovh-different-host-than'", PlacementDifferentHost
+	}
+	return "", "", ""
+}
+
+// loadPlacementReference finds the machine to place the instance against,
+// nil when the machine names itself to start a group
+func (d *Driver) loadPlacementReference() (*Driver, error) {
+	name, option, _ := d.placementReference()
+	if name == "" || name == d.MachineName {
+		return nil, nil
+	}
+
+	machines, err := d.storedMachines()
+	if err != nil {
+		return nil, err
+	}
+	for _, reference := range machines {
+		if reference.MachineName != name {
+			continue
+		}
+		if reference.InstanceID == "" {
+			return nil, fmt.Errorf("Machine '%s' has no instance to place this machine against", name)
+		}
+		if reference.ProjectID != d.ProjectID || reference.RegionName != d.RegionName {
+			return nil, fmt.Errorf("Machine '%s' lives in project %s, region %s. Please select the same project and region with '--ovh-project' and '--ovh-region' to use %s", name, reference.ProjectID, reference.RegionName, option)
+		}
+		return reference, nil
+	}
+
+	return nil, fmt.Errorf("Machine '%s' could not be found or is not an OVH machine. Please select an existing machine with %s", name, option)
+}
+
+// checkPlacement selects the instance group of the machine: the group of the
+// referenced machine, which must be in a group of the same policy, as
+// instances only join groups on create, or a new group anchored on the
+// machine when it names itself. Groups are managed through the OpenStack
+// compute API, the OVH API only lets instances join them
+func (d *Driver) checkPlacement() error {
+	_, option, policy := d.placementReference()
+	if option == "" {
+		return nil
+	}
+	if d.SameHostAs != "" && d.DifferentHostThan != "" {
+		return fmt.Errorf("An instance joins a single group. Please select either '--ovh-same-host-as' or '--ovh-different-host-than'")
+	}
+	reference, err := d.loadPlacementReference()
+	if err != nil {
+		return err
+	}
+	d.InstanceGroupPolicy = policy
+	if reference == nil {
+		d.InstanceGroupAnchor = d.MachineName
+	} else {
+		if reference.InstanceGroupID == "" || reference.InstanceGroupPolicy != policy {
+			return fmt.Errorf("Machine '%s' is not in a %s instance group, and its instance cannot join one anymore. Please select a machine created with %s, or start a group by naming this machine itself with %s", reference.MachineName, policy, option, option)
+		}
+		d.InstanceGroupID = reference.InstanceGroupID
+		d.InstanceGroupAnchor = reference.InstanceGroupAnchor
+	}
+
+	o, err := d.openStack(option)
+	if err != nil {
+		return err
+	}
+	if _, ok := o.endpoints("compute")[d.RegionName]; !ok {
+		return fmt.Errorf("No OpenStack compute endpoint found for region %s", d.RegionName)
+	}
+	return nil
+}
+
+// ensureInstanceGroup finds or creates the instance group anchored on the
+// machine, named after it and the policy. Machines placed against another
+// machine have its group already
+func (d *Driver) ensureInstanceGroup() error {
+	if d.InstanceGroupPolicy == "" || d.InstanceGroupID != "" {
+		return nil
+	}
+	_, option, _ := d.placementReference()
+	o, err := d.openStack(option)
+	if err != nil {
+		return err
+	}
+	endpoint, ok := o.endpoints("compute")[d.RegionName]
+	if !ok {
+		return fmt.Errorf("No OpenStack compute endpoint found for region %s", d.RegionName)
+	}
+
+	name := d.resourceName(fmt.Sprintf("%s-%s", d.InstanceGroupAnchor, d.InstanceGroupPolicy))
+	var groups struct {
+		ServerGroups []serverGroup `json:"server_groups"`
+	}
+	_, err = o.callVersion(serverGroupVersion, "GET", endpoint+"/os-server-groups", nil, &groups)
+	if err != nil {
+		return fmt.Errorf("Could not list instance groups: %s", err)
+	}
+	for _, group := range groups.ServerGroups {
+		if group.Name == name && group.Policy == d.InstanceGroupPolicy {
+			d.InstanceGroupID = group.ID
+			log.Infof("Joining instance group %s (%s) with %d instances", name, group.ID, len(group.Members))
+			return nil
+		}
+	}
+
+	var created struct {
+		ServerGroup serverGroup `json:"server_group"`
+	}
+	req := map[string]interface{}{"server_group": map[string]string{"name": name, "policy": d.InstanceGroupPolicy}}
+	_, err = o.callVersion(serverGroupVersion, "POST", endpoint+"/os-server-groups", req, &created)
+	if err != nil {
+		return fmt.Errorf("Could not create instance group %s: %s", name, err)
+	}
+	d.InstanceGroupID = created.ServerGroup.ID
+	log.Infof("Created %s instance group %s (%s)", d.InstanceGroupPolicy, name, d.InstanceGroupID)
+	return nil
+}
+
+// verifyPlacement reports whether the scheduler honoured the soft policy
+// against the referenced machine, comparing the host IDs of both instances
+func (d *Driver) verifyPlacement() {
+	name, option, policy := d.placementReference()
+	if name == "" || name == d.MachineName {
+		return
+	}
+	reference, err := d.loadPlacementReference()
+	var o *openStack
+	if err == nil {
+		o, err = d.openStack(option)
+	}
+	var hosts []string
+	if err == nil {
+		endpoint := o.endpoints("compute")[d.RegionName]
+		for _, id := range []string{d.InstanceID, reference.InstanceID} {
+			var server struct {
+				Server struct {
+					HostID string `json:"hostId"`
+				} `json:"server"`
+			}
+			if _, err = o.call("GET", endpoint+"/servers/"+id, nil, &server); err != nil {
+				break
+			}
+			hosts = append(hosts, server.Server.HostID)
+		}
+	}
+	if err != nil {
+		log.Warnf("Could not check the placement of machine %s against %s: %s", d.MachineName, name, err)
+		return
+	}
+
+	sameHost := hosts[0] == hosts[1]
+	switch {
+	case policy == PlacementSameHost && sameHost:
+		log.Infof("Machine %s shares its host with %s", d.MachineName, name)
+	case policy == PlacementSameHost:
+		log.Warnf("Machine %s could not be placed on the host of %s, which had no room left", d.MachineName, name)
+	case !sameHost:
+		log.Infof("Machine %s runs on another host than %s", d.MachineName, name)
+	default:
+		log.Warnf("Machine %s shares its host with %s, no other host was available", d.MachineName, name)
+	}
+}
+
+// releaseInstanceGroup deletes the instance group of the machine once it has
+// no member left
+func (d *Driver) releaseInstanceGroup() error {
+	_, option, _ := d.placementReference()
+	o, err := d.openStack(option)
+	if err != nil {
+		return err
+	}
+	endpoint, ok := o.endpoints("compute")[d.RegionName]
+	if !ok {
+		return fmt.Errorf("No OpenStack compute endpoint found for region %s", d.RegionName)
+	}
+
+	var group struct {
+		ServerGroup serverGroup `json:"server_group"`
+	}
+	_, err = o.callVersion(serverGroupVersion, "GET", endpoint+"/os-server-groups/"+d.InstanceGroupID, nil, &group)
+	if apierror, ok := err.(*openStackError); ok && apierror.Code == 404 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(group.ServerGroup.Members) > 0 {
+		log.Debugf("Keeping instance group %s of %d instances", d.InstanceGroupID, len(group.ServerGroup.Members))
+		return nil
+	}
+	_, err = o.callVersion(serverGroupVersion, "DELETE", endpoint+"/os-server-groups/"+d.InstanceGroupID, nil, nil)
+	if apierror, ok := err.(*openStackError); ok && apierror.Code == 404 {
+		err = nil
+	}
+	return err
+}
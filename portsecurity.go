@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Port security settings of the private network port
+const (
+	PortSecurityOn  = "on"
+	PortSecurityOff = "off"
+)
+
+// disablePortSecurity disables port security, and removes the security
+// groups it requires, on the ports of an instance in a network of region
+func (o *openStack) disablePortSecurity(region, instanceID, networkID string) error {
+	endpoint, ok := o.endpoints("network")[region]
+	if !ok {
+		return fmt.Errorf("No OpenStack networking endpoint found for region %s", region)
+	}
+
+	var ports struct {
+		Ports []struct {
+			ID                  string `json:"id"`
+			PortSecurityEnabled bool   `json:"port_security_enabled"`
+		} `json:"ports"`
+	}
+	query := url.Values{"device_id": {instanceID}, "network_id": {networkID}}
+	_, err := o.call("GET", endpoint+"/v2.0/ports?"+query.Encode(), nil, &ports)
+	if err != nil {
+		return err
+	}
+	if len(ports.Ports) == 0 {
+		return fmt.Errorf("No port of instance %s found in network %s", instanceID, networkID)
+	}
+
+	update := map[string]interface{}{
+		"port": map[string]interface{}{
+			"port_security_enabled": false,
+			"security_groups":       []string{},
+		},
+	}
+	for _, port := range ports.Ports {
+		if !port.PortSecurityEnabled {
+			continue
+		}
+		log.Debugf("Disabling port security of port %s", port.ID)
+		_, err = o.call("PUT", endpoint+"/v2.0/ports/"+port.ID, update, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validatePortSecurity checks the OpenStack credentials needed to change the
+// port security
+func (d *Driver) validatePortSecurity() error {
+	if d.PortSecurity != PortSecurityOff {
+		return nil
+	}
+
+	o, err := d.openStack("'--ovh-port-security'")
+	if err != nil {
+		return err
+	}
+	if _, ok := o.endpoints("network")[d.RegionName]; !ok {
+		return fmt.Errorf("No OpenStack networking endpoint found for region %s", d.RegionName)
+	}
+	return nil
+}
+
+// applyPortSecurity disables port security on the private network port of
+// instances, when requested
+func (d *Driver) applyPortSecurity(instanceIDs ...string) error {
+	if d.PortSecurity != PortSecurityOff {
+		return nil
+	}
+
+	log.Infof("Disabling port security on private network %s...", d.PrivateNetworkName)
+	o, err := d.openStack("'--ovh-port-security'")
+	if err != nil {
+		return err
+	}
+	for _, instanceID := range instanceIDs {
+		err = o.disablePortSecurity(d.RegionName, instanceID, d.NetworkIDs[0])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/mcnflag"
+)
+
+// profileOptions supplies driver options from a profile file. Options set in
+// the environment, and options given on the command line with a value other
+// than their default, take precedence over the profile. The driver only sees
+// option values: a command line option set to its default value, or a boolean
+// set to false, cannot be told from an absent one and loses to the profile
+type profileOptions struct {
+	flags   drivers.DriverOptions
+	profile map[string]string
+	lists   map[string][]string
+	known   map[string]mcnflag.Flag
+}
+
+// loadProfile reads a profile file, in JSON or in a flat YAML subset made of
+// "key: value" lines, and "- item" lines for lists:
+//
+//	region: GRA7
+//	flavor: b2-15
+//	private-network: 3
+//
+// Option names may omit the "ovh-" prefix.
+func (d *Driver) loadProfile(flags drivers.DriverOptions, path string) (*profileOptions, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read profile file: %s", err)
+	}
+
+	p, err := d.parseProfile(flags, path, data)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid profile file %s: %s", path, err)
+	}
+	return p, nil
+}
+
+// parseProfile reads profile options from data, in the format given by the
+// name suffix or the content
+func (d *Driver) parseProfile(flags drivers.DriverOptions, name string, data []byte) (*profileOptions, error) {
+	p := &profileOptions{
+		flags:   flags,
+		profile: make(map[string]string),
+		lists:   make(map[string][]string),
+		known:   make(map[string]mcnflag.Flag),
+	}
+	for _, flag := range d.GetCreateFlags() {
+		p.known[flag.String()] = flag
+	}
+
+	var err error
+	if strings.HasSuffix(name, ".json") || bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = p.parseJSON(data)
+	} else {
+		err = p.parseYAML(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// parseJSON reads a JSON object of options
+func (p *profileOptions) parseJSON(data []byte) error {
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+
+	for key, value := range values {
+		if list, ok := value.([]interface{}); ok {
+			var items []string
+			for _, item := range list {
+				items = append(items, fmt.Sprint(item))
+			}
+			if err := p.set(key, "", items); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := p.set(key, fmt.Sprint(value), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseYAML reads flat "key: value" lines and "- item" lists
+func (p *profileOptions) parseYAML(data []byte) error {
+	var listKey string
+	var list []string
+
+	flush := func() error {
+		if listKey == "" {
+			return nil
+		}
+		err := p.set(listKey, "", list)
+		listKey, list = "", nil
+		return err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "- ") {
+			if listKey == "" {
+				return fmt.Errorf("line %d: list item without a key", n)
+			}
+			list = append(list, unquote(strings.TrimPrefix(line, "- ")))
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("line %d: expected 'key: value'", n)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if value == "" {
+			listKey = key
+			continue
+		}
+		if err := p.set(key, unquote(value), nil); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// set records an option value, checking it against the driver flags
+func (p *profileOptions) set(key, value string, list []string) error {
+	if !strings.HasPrefix(key, "ovh-") {
+		key = "ovh-" + key
+	}
+
+	flag, ok := p.known[key]
+	if !ok {
+		return fmt.Errorf("unknown option '%s'", key)
+	}
+
+	switch flag.(type) {
+	case mcnflag.StringSliceFlag:
+		if list == nil {
+			list = strings.Split(value, ",")
+		}
+		p.lists[key] = list
+		return nil
+	case mcnflag.IntFlag:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("option '%s' must be an integer", key)
+		}
+	case mcnflag.BoolFlag:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("option '%s' must be a boolean", key)
+		}
+	}
+	if list != nil {
+		return fmt.Errorf("option '%s' does not accept a list", key)
+	}
+
+	p.profile[key] = value
+	return nil
+}
+
+// unquote strips optional quotes around a YAML scalar
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// fromEnv reports whether an option is set by its environment variable
+func (p *profileOptions) fromEnv(key string) bool {
+	var envVar string
+	switch flag := p.known[key].(type) {
+	case mcnflag.StringFlag:
+		envVar = flag.EnvVar
+	case mcnflag.IntFlag:
+		envVar = flag.EnvVar
+	case mcnflag.BoolFlag:
+		envVar = flag.EnvVar
+	case mcnflag.StringSliceFlag:
+		envVar = flag.EnvVar
+	}
+	if envVar == "" {
+		return false
+	}
+	_, ok := os.LookupEnv(envVar)
+	return ok
+}
+
+// String returns a string option
+func (p *profileOptions) String(key string) string {
+	value := p.flags.String(key)
+	if profile, ok := p.profile[key]; ok && value == p.known[key].Default() && !p.fromEnv(key) {
+		return profile
+	}
+	return value
+}
+
+// StringSlice returns a list option
+func (p *profileOptions) StringSlice(key string) []string {
+	value := p.flags.StringSlice(key)
+	if profile, ok := p.lists[key]; ok && len(value) == 0 && !p.fromEnv(key) {
+		return profile
+	}
+	return value
+}
+
+// Int returns an integer option
+func (p *profileOptions) Int(key string) int {
+	value := p.flags.Int(key)
+	if profile, ok := p.profile[key]; ok && value == p.known[key].Default() && !p.fromEnv(key) {
+		n, _ := strconv.Atoi(profile)
+		return n
+	}
+	return value
+}
+
+// Bool returns a boolean option
+func (p *profileOptions) Bool(key string) bool {
+	value := p.flags.Bool(key)
+	if profile, ok := p.profile[key]; ok && !value && !p.fromEnv(key) {
+		b, _ := strconv.ParseBool(profile)
+		return b
+	}
+	return value
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Options holding secrets, recorded as digests only
+var secretInputs = map[string]bool{
+	"ApplicationKey":    true,
+	"ApplicationSecret": true,
+	"ConsumerKey":       true,
+	"WebhookURL":        true,
+	"VolumeKeyURL":      true,
+}
+
+// Options which do not change what is provisioned
+var ignoredInputs = map[string]bool{
+	"Recreate":           true,
+	"CatalogBundle":      true,
+	"APITimeout":         true,
+	"MaintenanceWait":    true,
+	"PollEndpoint":       true,
+	"APIBaseURL":         true,
+	"APIHeaders":         true,
+	"APIHeaderNames":     true,
+	"BudgetWarn":         true,
+	"BudgetAlertEmail":   true,
+	"WarmPool":           true,
+	"WarmPoolSize":       true,
+	"Vrack":              true,
+	"ReconcileAddress":   true,
+	"IAMTags":            true,
+	"SSHAgentForwarding": true,
+}
+
+// Inputs which cannot change without creating another instance
+var destructiveInputs = []string{"ProjectID", "RegionName", "FlavorID", "ImageID"}
+
+// inputDigest returns a short digest of a provisioning input
+func inputDigest(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return fmt.Sprintf("sha256:%x", sum[:8])
+}
+
+// provisionInputs returns the effective provisioning inputs of the machine:
+// its options, the resolved project, flavor and image, and the digest of its
+// first boot script. The generated root password is left out of the script,
+// as it changes on every run
+func (d *Driver) provisionInputs() map[string]string {
+	inputs := make(map[string]string)
+	config := reflect.ValueOf(d.Config)
+	for i := 0; i < config.NumField(); i++ {
+		name := config.Type().Field(i).Name
+		if ignoredInputs[name] {
+			continue
+		}
+		var value string
+		switch field := config.Field(i).Interface().(type) {
+		case []string:
+			value = strings.Join(field, ",")
+		default:
+			value = fmt.Sprint(field)
+		}
+		if secretInputs[name] && value != "" {
+			value = inputDigest(value)
+		}
+		inputs[name] = value
+	}
+
+	inputs["ProjectID"] = d.ProjectID
+	inputs["FlavorID"] = d.FlavorID
+	inputs["ImageID"] = d.ImageID
+
+	hash := d.rootPasswordHash
+	d.rootPasswordHash = ""
+	inputs["UserData"] = inputDigest(d.userData())
+	d.rootPasswordHash = hash
+	return inputs
+}
+
+// diffInputs returns the changes from previous to current inputs, one line
+// each, and whether one of them requires another instance
+func diffInputs(previous, current map[string]string) (changes []string, destructive bool) {
+	var names []string
+	for name := range current {
+		if previous[name] != current[name] {
+			names = append(names, name)
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok && previous[name] != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		marker := " "
+		for _, input := range destructiveInputs {
+			if name == input {
+				marker = "!"
+				destructive = true
+			}
+		}
+		changes = append(changes, fmt.Sprintf("%s %s: '%s' -> '%s'", marker, name, previous[name], current[name]))
+	}
+	return changes, destructive
+}
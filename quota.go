@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// checkQuota checks that the project quotas in the region leave room for the
+// instances, their cores, memory and volumes. The flavor quota covers limits
+// specific to the flavor, such as GPUs, which otherwise surface as instances
+// in ERROR state
+func (d *Driver) checkQuota(flavor *Flavor) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	count := d.Count
+	if count < 1 {
+		count = 1
+	}
+
+	if flavor.Quota != nil && *flavor.Quota < count {
+		return fmt.Errorf("Flavor '%s' quota of project %s in region %s allows %d more instances, %d requested. Flavors with GPUs have their own quota, raise it from %s", flavor.Name, d.ProjectID, d.RegionName, *flavor.Quota, count, CustomerInterface)
+	}
+
+	quotas, err := client.GetQuotas(d.ProjectID)
+	if err != nil {
+		// Quotas only help failing early, the create may still succeed
+		log.Debugf("Could not check quotas: %s", err)
+		return nil
+	}
+
+	var exceeded []string
+	for _, quota := range quotas {
+		if quota.Region != d.RegionName {
+			continue
+		}
+		if q := quota.Instance; q != nil {
+			exceeded = appendExceeded(exceeded, "instances", q.MaxInstances-q.UsedInstances, count)
+			exceeded = appendExceeded(exceeded, "cores", q.MaxCores-q.UsedCores, flavor.Vcpus*count)
+			exceeded = appendExceeded(exceeded, "MB of RAM", q.MaxRAM-q.UsedRAM, flavor.memoryMB()*count)
+		}
+		if q := quota.Volume; q != nil && d.DataVolumeSize > 0 {
+			exceeded = appendExceeded(exceeded, "volumes", q.MaxVolumeCount-q.UsedVolumeCount, count)
+			exceeded = appendExceeded(exceeded, "GB of volume storage", q.MaxGigabytes-q.UsedGigabytes, d.DataVolumeSize*count)
+		}
+	}
+
+	if len(exceeded) > 0 {
+		return fmt.Errorf("Quota of project %s in region %s exceeded: %s. Raise it from %s", d.ProjectID, d.RegionName, strings.Join(exceeded, ", "), CustomerInterface)
+	}
+	return nil
+}
+
+// appendExceeded records a quota that has less room than needed
+func appendExceeded(exceeded []string, resource string, available, needed int) []string {
+	if needed <= available {
+		return exceeded
+	}
+	if available < 0 {
+		available = 0
+	}
+	return append(exceeded, fmt.Sprintf("%d %s needed, %d available", needed, resource, available))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// rebootTimerUnit is the systemd unit of reboots queued for the reboot window
+const rebootTimerUnit = "docker-machine-ovh-reboot"
+
+// queueRebootScript replaces any queued reboot by one at the next window start
+const queueRebootScript = `sudo systemctl stop %[1]s.timer 2>/dev/null || true
+sudo systemctl reset-failed %[1]s.service 2>/dev/null || true
+sudo systemd-run --unit=%[1]s --on-calendar='%[2]s' /bin/systemctl reboot
+`
+
+// rebootWindow is a recurring time range in which restarts are allowed
+type rebootWindow struct {
+	// day of the week, every day if nil
+	day *time.Weekday
+
+	// start and end, in minutes after midnight. The window wraps around
+	// midnight when end is before start
+	start int
+	end   int
+
+	location *time.Location
+}
+
+// parseRebootWindow parses a window such as "Sun 03:00-05:00 UTC". The day
+// is optional, the time zone defaults to UTC
+func parseRebootWindow(value string) (*rebootWindow, error) {
+	invalid := fmt.Errorf("Invalid reboot window '%s'. Expected a window such as 'Sun 03:00-05:00 UTC'", value)
+
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 3 {
+		return nil, invalid
+	}
+
+	window := &rebootWindow{location: time.UTC}
+
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(fields[0], day.String()[:3]) || strings.EqualFold(fields[0], day.String()) {
+			day := day
+			window.day = &day
+			fields = fields[1:]
+			break
+		}
+	}
+	if len(fields) == 0 {
+		return nil, invalid
+	}
+
+	if len(fields) == 2 {
+		location, err := time.LoadLocation(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid reboot window time zone '%s': %s", fields[1], err)
+		}
+		window.location = location
+	} else if len(fields) > 2 {
+		return nil, invalid
+	}
+
+	bounds := strings.Split(fields[0], "-")
+	if len(bounds) != 2 {
+		return nil, invalid
+	}
+	var err error
+	if window.start, err = parseClock(bounds[0]); err != nil {
+		return nil, invalid
+	}
+	if window.end, err = parseClock(bounds[1]); err != nil {
+		return nil, invalid
+	}
+	if window.start == window.end {
+		return nil, invalid
+	}
+
+	return window, nil
+}
+
+// parseClock parses a HH:MM time of day, in minutes after midnight
+func parseClock(value string) (int, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// contains tells whether t falls in the window
+func (w *rebootWindow) contains(t time.Time) bool {
+	t = t.In(w.location)
+	minute := t.Hour()*60 + t.Minute()
+
+	if w.start < w.end {
+		return (w.day == nil || t.Weekday() == *w.day) && minute >= w.start && minute < w.end
+	}
+
+	// Window wrapping around midnight starts on its day and ends the next one
+	if minute >= w.start {
+		return w.day == nil || t.Weekday() == *w.day
+	}
+	if minute < w.end {
+		return w.day == nil || t.Weekday() == (*w.day+1)%7
+	}
+	return false
+}
+
+// calendar returns the window start as a systemd calendar event
+func (w *rebootWindow) calendar() string {
+	day := ""
+	if w.day != nil {
+		day = w.day.String()[:3] + " "
+	}
+	return fmt.Sprintf("%s*-*-* %02d:%02d:00 %s", day, w.start/60, w.start%60, w.location)
+}
+
+// queueReboot schedules a reboot of the machine at the next window start,
+// replacing any reboot queued before
+func (d *Driver) queueReboot(window *rebootWindow) error {
+	log.Infof("Restart of %s requested outside of its reboot window '%s', queuing it on the machine...", d.MachineName, d.RebootWindow)
+
+	_, err := drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(queueRebootScript, rebootTimerUnit, window.calendar()))
+	if err != nil {
+		return fmt.Errorf("Could not queue reboot for the next window: %s", err)
+	}
+
+	log.Infof("Reboot queued for %s, cancel it with 'docker-machine ssh %s sudo systemctl stop %s.timer'", window.calendar(), d.MachineName, rebootTimerUnit)
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// instanceAddress returns the address docker-machine reaches the instance at,
+// as selected on create
+func (d *Driver) instanceAddress(instance *Instance) string {
+	var public, private string
+	for _, ip := range instance.IPAddresses {
+		if ip.Type == "public" && public == "" {
+			public = ip.IP
+		}
+		if ip.Type == "private" && private == "" {
+			private = ip.IP
+		}
+	}
+	if d.NoPublicNetwork {
+		return private
+	}
+	return public
+}
+
+// warnAddressChange reports an address of the instance other than the one of
+// the machine, after a rebuild for instance, which the engine certificate
+// does not cover
+func (d *Driver) warnAddressChange(instance *Instance) {
+	address := d.instanceAddress(instance)
+	if address == "" || address == d.IPAddress {
+		return
+	}
+	log.Warnf("Machine %s is now at %s instead of %s. Update its address with: docker-machine-driver-ovh update-address %s, then its engine certificate with: docker-machine regenerate-certs -f %s", d.MachineName, address, d.IPAddress, d.MachineName, d.MachineName)
+}
+
+// updateAddress moves the machine to address, e.g. a failover IP, or to the
+// current address of its instance when empty. Its registrations are moved
+// along with reconcile or '--ovh-reconcile-address'. The engine certificate is
+// left to docker-machine regenerate-certs, which uses the address of the machine
+func (d *Driver) updateAddress(address string, reconcile bool) error {
+	privateAddress := d.PrivateIPAddress
+	if address == "" {
+		client, err := d.getClient()
+		if err != nil {
+			return err
+		}
+		instance, err := client.GetInstance(d.ProjectID, d.InstanceID)
+		if err != nil {
+			return err
+		}
+		address = d.instanceAddress(instance)
+		for _, ip := range instance.IPAddresses {
+			if ip.Type == "private" {
+				privateAddress = ip.IP
+				break
+			}
+		}
+	}
+	if net.ParseIP(address) == nil {
+		return fmt.Errorf("Invalid address '%s'. Please give the new IP address of machine %s", address, d.MachineName)
+	}
+	if address == d.IPAddress && privateAddress == d.PrivateIPAddress {
+		log.Infof("Machine %s is still at %s", d.MachineName, address)
+		return nil
+	}
+
+	log.Infof("Moving machine %s from %s to %s...", d.MachineName, d.IPAddress, address)
+	previous, previousPrivate := d.IPAddress, d.PrivateIPAddress
+	d.IPAddress, d.PrivateIPAddress = address, privateAddress
+	d.recordHostKeys()
+	d.updateSSHConfig()
+	if reconcile {
+		d.moveRegistrations(previous, previousPrivate)
+	} else {
+		d.reconcileAddress(previous, previousPrivate)
+	}
+	if address != previous {
+		log.Infof("Regenerate the engine certificate of machine %s for %s with: docker-machine regenerate-certs -f %s", d.MachineName, address, d.MachineName)
+	}
+	return nil
+}
+
+// reconcileAddress moves the registrations of the machine to its new
+// addresses with '--ovh-reconcile-address'
+func (d *Driver) reconcileAddress(previous, previousPrivate string) {
+	if d.ReconcileAddress {
+		d.moveRegistrations(previous, previousPrivate)
+	}
+}
+
+// moveRegistrations moves the registrations the driver made for the machine
+// to its new addresses: the Swarm discovery records and the /etc/hosts block
+// of its cluster, and its load balancer pool members. Failures are reported
+// only, the machine itself being moved already
+func (d *Driver) moveRegistrations(previous, previousPrivate string) {
+	former := *d
+	former.IPAddress = previous
+	former.PrivateIPAddress = previousPrivate
+	if former.clusterAddress() != d.clusterAddress() {
+		if len(d.DNSRecordIDs) > 0 {
+			if err := d.publishDiscoveryRecords(); err != nil {
+				log.Warnf("Could not publish the Swarm discovery records of %s at %s: %s", d.MachineName, d.clusterAddress(), err)
+			}
+		}
+		if d.ClusterHosts {
+			if err := d.updateClusterHosts(false); err != nil {
+				log.Warnf("Could not update /etc/hosts of cluster %s: %s", d.Cluster, err)
+			}
+		}
+	}
+
+	memberAddress := func(public, private string) string {
+		if private != "" {
+			return private
+		}
+		return public
+	}
+	if memberAddress(previous, previousPrivate) != memberAddress(d.IPAddress, d.PrivateIPAddress) {
+		// Members cannot change address, they are replaced
+		d.leaveLoadBalancerPools()
+		if err := d.joinLoadBalancerPools(); err != nil {
+			log.Warnf("Could not add machine %s back to its load balancer pools: %s", d.MachineName, err)
+		}
+	}
+
+	driver, err := json.Marshal(d)
+	if err == nil {
+		err = d.saveMachineConfig(driver)
+	}
+	if err != nil {
+		log.Warnf("Could not save the registrations of machine %s: %s", d.MachineName, err)
+	}
+}
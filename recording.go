@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// API calls are recorded to, or replayed from, the recording given to the API
+// constructor. Replaying runs the driver flows without credentials nor
+// network, as the tests do
+const (
+	recordingModeRecord = "record"
+	recordingModeReplay = "replay"
+
+	redacted = "REDACTED"
+)
+
+// recordedHeaders are the response headers kept in recordings, the driver
+// reads no other one. Secrets among them are redacted
+var recordedHeaders = []string{"Content-Type", queryIDHeader}
+
+// secretKeys are the JSON keys whose values are redacted from recordings,
+// compared in lower case
+var secretKeys = map[string]bool{
+	"password":          true,
+	"consumerkey":       true,
+	"applicationkey":    true,
+	"applicationsecret": true,
+	"secret":            true,
+	"validationurl":     true,
+	"userdata":          true,
+}
+
+// addressKeys are the JSON keys of instance addresses, recorded as loopback
+// addresses so that replayed machines are reached on a local ssh server
+var addressKeys = map[string]bool{
+	"ip": true,
+}
+
+// interaction is a recorded API call
+type interaction struct {
+	Method       string            `json:"method"`
+	URL          string            `json:"url"`
+	RequestBody  json.RawMessage   `json:"requestBody,omitempty"`
+	Status       int               `json:"status"`
+	Header       map[string]string `json:"header,omitempty"`
+	ResponseBody json.RawMessage   `json:"responseBody,omitempty"`
+}
+
+// Recording is the list of recorded calls, in order, along with the number of
+// calls of each method and URL already replayed
+type Recording struct {
+	mutex        sync.Mutex
+	path         string
+	mode         string
+	Interactions []interaction `json:"interactions"`
+	replayed     map[string]int
+}
+
+// OpenRecording opens the recording at path. In replay mode, its calls are
+// read from it. In record mode, it starts empty and each call is saved to it
+func OpenRecording(path, mode string) (*Recording, error) {
+	r := &Recording{path: path, mode: mode, replayed: make(map[string]int)}
+	switch mode {
+	case recordingModeRecord:
+		return r, nil
+	case recordingModeReplay:
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(data, r)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read recording %s: %s", path, err)
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("Invalid recording mode '%s'. Please select one of '%s', '%s'", mode, recordingModeRecord, recordingModeReplay)
+}
+
+// Unreplayed returns the recorded calls which were never replayed, by method
+// and URL
+func (r *Recording) Unreplayed() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var calls []string
+	seen := make(map[string]bool)
+	for _, call := range r.Interactions {
+		key := call.Method + " " + call.URL
+		if r.replayed[key] == 0 && !seen[key] {
+			calls = append(calls, key)
+		}
+		seen[key] = true
+	}
+	return calls
+}
+
+// recordingTransport records or replays each call
+type recordingTransport struct {
+	base      http.RoundTripper
+	recording *Recording
+}
+
+// RoundTrip records the call performed by base, or replays the next recorded
+// call with the same method and URL
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	if t.recording.mode != recordingModeRecord {
+		return t.recording.replay(req)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	err = t.recording.record(req, reqBody, resp, respBody)
+	return resp, err
+}
+
+// record appends a call to the recording, without its secrets, and saves it
+func (r *Recording) record(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte) error {
+	call := interaction{
+		Method:       req.Method,
+		URL:          req.URL.String(),
+		RequestBody:  sanitizeBody(reqBody),
+		Status:       resp.StatusCode,
+		Header:       make(map[string]string),
+		ResponseBody: sanitizeBody(respBody),
+	}
+	for _, name := range recordedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			if secretKeys[strings.ToLower(name)] {
+				value = redacted
+			}
+			call.Header[name] = value
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Interactions = append(r.Interactions, call)
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(r.path, data, 0600)
+	if err != nil {
+		return fmt.Errorf("Could not save recording %s: %s", r.path, err)
+	}
+	return nil
+}
+
+// replay returns the response of the next recorded call with the same method
+// and URL. Once all of them are replayed, the last one is replayed again, so
+// that status polling ends on the last recorded status
+func (r *Recording) replay(req *http.Request) (*http.Response, error) {
+	key := req.Method + " " + req.URL.String()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var matches []interaction
+	for _, call := range r.Interactions {
+		if call.Method+" "+call.URL == key {
+			matches = append(matches, call)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("No recorded response in %s for %s", r.path, key)
+	}
+
+	index := r.replayed[key]
+	if index >= len(matches) {
+		index = len(matches) - 1
+	}
+	r.replayed[key] = index + 1
+
+	call := matches[index]
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", call.Status, http.StatusText(call.Status)),
+		StatusCode: call.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(bytes.NewReader(call.body())),
+		Request:    req,
+	}
+	for name, value := range call.Header {
+		resp.Header.Set(name, value)
+	}
+	return resp, nil
+}
+
+// body returns the recorded response body, as sent
+func (call interaction) body() []byte {
+	var text string
+	if !strings.Contains(call.Header["Content-Type"], "json") && json.Unmarshal(call.ResponseBody, &text) == nil {
+		return []byte(text)
+	}
+	return call.ResponseBody
+}
+
+// sanitizeBody redacts the secrets of a JSON body. Other bodies, such as
+// console logs, are recorded as a JSON string
+func sanitizeBody(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		value = string(body)
+	}
+	data, err := json.Marshal(redactSecrets(value))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// redactSecrets replaces the values of secretKeys, and instance addresses,
+// at any depth
+func redactSecrets(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if secretKeys[strings.ToLower(key)] {
+				v[key] = redacted
+			} else if address, ok := item.(string); ok && addressKeys[strings.ToLower(key)] {
+				v[key] = loopbackAddress(address)
+			} else {
+				v[key] = redactSecrets(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactSecrets(item)
+		}
+	}
+	return value
+}
+
+// loopbackAddress returns the loopback address of the family of address
+func loopbackAddress(address string) string {
+	if strings.Contains(address, ":") {
+		return "::1"
+	}
+	return "127.0.0.1"
+}
+
+// recordCalls records or replays the calls of client. It must wrap the
+// transport first, so that replayed calls are still traced and their query
+// ids tracked
+func recordCalls(client *http.Client, recording *Recording) {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &recordingTransport{base: base, recording: recording}
+}
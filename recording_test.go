@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeBody(t *testing.T) {
+	body := []byte(`{
+		"name": "worker-1",
+		"userData": "#cloud-config\nwrite_files: []",
+		"applicationSecret": "secret",
+		"credentials": {"password": "password"},
+		"ipAddresses": [{"ip": "51.68.10.20", "type": "public"}, {"ip": "2001:41d0:304:200::1", "type": "public"}]
+	}`)
+
+	var sanitized struct {
+		Name              string `json:"name"`
+		UserData          string `json:"userData"`
+		ApplicationSecret string `json:"applicationSecret"`
+		Credentials       struct {
+			Password string `json:"password"`
+		} `json:"credentials"`
+		IPAddresses []IP `json:"ipAddresses"`
+	}
+	err := json.Unmarshal(sanitizeBody(body), &sanitized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sanitized.Name != "worker-1" {
+		t.Errorf("name: got %q", sanitized.Name)
+	}
+	for key, value := range map[string]string{
+		"userData":          sanitized.UserData,
+		"applicationSecret": sanitized.ApplicationSecret,
+		"password":          sanitized.Credentials.Password,
+	} {
+		if value != redacted {
+			t.Errorf("%s: got %q, expected it redacted", key, value)
+		}
+	}
+	if len(sanitized.IPAddresses) != 2 || sanitized.IPAddresses[0].IP != "127.0.0.1" || sanitized.IPAddresses[1].IP != "::1" {
+		t.Errorf("ipAddresses: got %v, expected loopback addresses", sanitized.IPAddresses)
+	}
+}
+
+func TestSanitizeTextBody(t *testing.T) {
+	var text string
+	err := json.Unmarshal(sanitizeBody([]byte("[    0.000000] Linux version 5.15.0")), &text)
+	if err != nil || text != "[    0.000000] Linux version 5.15.0" {
+		t.Errorf("got %q, %v", text, err)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(queryIDHeader, "EU.ext-1.test")
+		w.Header().Set("X-Internal", "dropped")
+		w.Write([]byte(`{"id": "instance-1", "ipAddresses": [{"ip": "51.68.10.20", "type": "public"}]}`))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "recording.json")
+
+	// Recorded calls get the actual responses
+	recorder, err := OpenRecording(path, recordingModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{}
+	recordCalls(client, recorder)
+	body := post(t, client, server.URL+"/instance")
+	if !strings.Contains(body, "51.68.10.20") {
+		t.Errorf("recorded call: got %s", body)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"secret-data", "51.68.10.20", "X-Internal"} {
+		if strings.Contains(string(data), leaked) {
+			t.Errorf("recording holds %s: %s", leaked, data)
+		}
+	}
+
+	// Replayed calls get the sanitized responses, without the server
+	server.Close()
+	replayer, err := OpenRecording(path, recordingModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := replayer.Unreplayed(); len(calls) != 1 || calls[0] != "POST "+server.URL+"/instance" {
+		t.Errorf("unreplayed calls before replay: got %v", calls)
+	}
+	client = &http.Client{}
+	recordCalls(client, replayer)
+	body = post(t, client, server.URL+"/instance")
+	if !strings.Contains(body, `"instance-1"`) || !strings.Contains(body, "127.0.0.1") {
+		t.Errorf("replayed call: got %s", body)
+	}
+	if calls := replayer.Unreplayed(); len(calls) != 0 {
+		t.Errorf("unreplayed calls after replay: got %v", calls)
+	}
+
+	_, err = client.Get(server.URL + "/instance")
+	if err == nil || !strings.Contains(err.Error(), "No recorded response") {
+		t.Errorf("call not recorded: got %v", err)
+	}
+}
+
+func TestOpenRecordingMode(t *testing.T) {
+	_, err := OpenRecording(filepath.Join(t.TempDir(), "recording.json"), "playback")
+	if err == nil || !strings.Contains(err.Error(), "Invalid recording mode 'playback'") {
+		t.Errorf("got %v", err)
+	}
+}
+
+// post performs a POST request with a secret in its body, and returns the
+// response body
+func post(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Post(url, "application/json", strings.NewReader(`{"userData": "secret-data"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
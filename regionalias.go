@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// legacyRegions maps the region names OVH retired to their successors, in
+// order of preference, so that scripts written with the old names keep
+// working. Other region names are current, and never translated
+var legacyRegions = map[string][]string{
+	"GRA1": {"GRA7", "GRA9"},
+	"GRA3": {"GRA7", "GRA9"},
+	"SBG1": {"SBG5"},
+	"SBG3": {"SBG5"},
+	"BHS1": {"BHS5"},
+	"BHS3": {"BHS5"},
+}
+
+// hasRegion tells whether region is in the list
+func hasRegion(regions Regions, region string) bool {
+	for _, r := range regions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
+
+// translateRegion returns the region of the project to use for region:
+// itself, or the first successor the project offers when it is retired
+func translateRegion(regions Regions, region string) (string, bool) {
+	if hasRegion(regions, region) {
+		return region, true
+	}
+	for _, successor := range legacyRegions[region] {
+		if hasRegion(regions, successor) {
+			return successor, true
+		}
+	}
+	return "", false
+}
+
+// resolveRegion checks the region against the regions of the project and
+// translates legacy region names
+func (d *Driver) resolveRegion(regions Regions) error {
+	region, ok := translateRegion(regions, d.RegionName)
+	if ok {
+		if region != d.RegionName {
+			log.Infof("Region %s was retired by OVH, using its successor %s", d.RegionName, region)
+			d.RegionName = region
+		}
+		return nil
+	}
+
+	valid := strings.Join(regions, ", ")
+	if successors, legacy := legacyRegions[d.RegionName]; legacy {
+		current := strings.Join(successors, " or ")
+		if d.Compliance != "" {
+			return fmt.Errorf("Region %s, retired for %s, is not %s compliant. Please select one of %s with '--ovh-region'", d.RegionName, current, d.Compliance, valid)
+		}
+		return fmt.Errorf("Invalid region %s, retired for %s, which is not available in this project either. Please select one of %s with '--ovh-region'", d.RegionName, current, valid)
+	}
+	if d.Compliance != "" {
+		return fmt.Errorf("Region %s is not %s compliant. Please select one of %s with '--ovh-region'", d.RegionName, d.Compliance, valid)
+	}
+	return fmt.Errorf("Invalid region %s. Please select one of %s with '--ovh-region'", d.RegionName, valid)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// registryCAScript installs the CA of a registry where the docker engine
+// looks for it, /etc/docker/certs.d/<registry>/ca.crt
+const registryCAScript = `mkdir -p /etc/docker/certs.d/%[1]s
+cat > /etc/docker/certs.d/%[1]s/ca.crt <<'EOF'
+%[2]sEOF
+`
+
+var validRegistry = regexp.MustCompile(`^[A-Za-z0-9.-]+(:[0-9]+)?$`)
+
+// validateRegistryCAs reads the REGISTRY=PATH registry CA files and keeps
+// their content, and checks the insecure registries
+func (d *Driver) validateRegistryCAs() error {
+	d.RegistryCAs = make(map[string]string)
+	for _, option := range d.RegistryCAFiles {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 || !validRegistry.MatchString(parts[0]) {
+			return fmt.Errorf("Invalid registry CA '%s'. Expected REGISTRY=PATH, e.g. registry.internal:5000=ca.crt", option)
+		}
+
+		data, err := ioutil.ReadFile(parts[1])
+		if err != nil {
+			return fmt.Errorf("Could not read CA of registry %s: %s", parts[0], err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "CERTIFICATE" {
+			return fmt.Errorf("CA of registry %s in %s is not a PEM certificate", parts[0], parts[1])
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("CA of registry %s in %s is not a valid certificate: %s", parts[0], parts[1], err)
+		}
+
+		content := string(data)
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		d.RegistryCAs[parts[0]] = content
+	}
+
+	for _, registry := range d.InsecureRegistries {
+		if !validRegistry.MatchString(registry) {
+			return fmt.Errorf("Invalid insecure registry '%s'. Expected a host name with an optional port", registry)
+		}
+	}
+	return nil
+}
+
+// registryUserData returns the first boot script section installing the
+// registry CAs, before the engine starts
+func (d *Driver) registryUserData() string {
+	if len(d.RegistryCAs) == 0 {
+		return ""
+	}
+
+	var registries []string
+	for registry := range d.RegistryCAs {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+
+	script := "# Trust private registry CAs\n"
+	for _, registry := range registries {
+		script += fmt.Sprintf(registryCAScript, registry, d.RegistryCAs[registry])
+	}
+	return script
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// removalStep is a resource owned by the machine, deleted by Remove
+type removalStep struct {
+	name   string
+	remove func() error
+}
+
+// removalPlan lists the resources of a machine in dependency order: the
+// instance first, then anything it was using once it is gone
+type removalPlan struct {
+	machine    *Driver
+	client     *API
+	instance   []removalStep
+	dependents []removalStep
+	err        error
+}
+
+// removalPlan builds the removal plan of the machine
+func (d *Driver) removalPlan() (*removalPlan, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	plan := &removalPlan{machine: d, client: client}
+
+	// Deletes instance, if we created it
+	if d.InstanceID != "" {
+		plan.instance = append(plan.instance, removalStep{
+			name: fmt.Sprintf("instance %s", d.InstanceID),
+			remove: func() error {
+				return client.DeleteInstance(d.ProjectID, d.InstanceID)
+			},
+		})
+	}
+
+	// Deletes the other instances of an interrupted bulk create, unless
+	// already registered as machines
+	for i, id := range d.BulkInstanceIDs {
+		id := id
+		if _, err := os.Stat(filepath.Join(d.StorePath, "machines", d.bulkMachineName(i+1))); err == nil {
+			continue
+		}
+		plan.instance = append(plan.instance, removalStep{
+			name: fmt.Sprintf("instance %s", id),
+			remove: func() error {
+				return client.DeleteInstance(d.ProjectID, id)
+			},
+		})
+	}
+
+	// Deletes the snapshot of the clone source left by a failed create
+	if d.CloneSnapshotID != "" || d.CloneImageID != "" {
+		plan.dependents = append(plan.dependents, removalStep{
+			name: fmt.Sprintf("clone snapshot %s", d.CloneSnapshotID),
+			remove: func() error {
+				return d.deleteCloneImages()
+			},
+		})
+	}
+
+	// Deletes docker data volume, once detached by instance deletion
+	if d.DataVolumeID != "" {
+		plan.dependents = append(plan.dependents, removalStep{
+			name: fmt.Sprintf("volume %s", d.DataVolumeID),
+			remove: func() error {
+				return client.DeleteVolume(d.ProjectID, d.DataVolumeID)
+			},
+		})
+	}
+
+	// If key name  does not starts with the machine ID, or the key was reused, this is a pre-existing key, keep it
+	if d.KeepSSHKey || d.ReusedKeyPair != "" || !strings.HasPrefix(d.KeyPairName, d.resourceName(d.MachineName)) {
+		log.Debugf("keeping key pair...", map[string]interface{}{"KeyPairID": d.KeyPairID})
+	} else if d.KeyPairID != "" {
+		// Deletes ssh key, if we created it
+		plan.dependents = append(plan.dependents, removalStep{
+			name: fmt.Sprintf("ssh key %s", d.KeyPairID),
+			remove: func() error {
+				log.Debugf("deleting key pair...", map[string]interface{}{"KeyPairID": d.KeyPairID})
+				return client.DeleteSshkey(d.ProjectID, d.KeyPairID)
+			},
+		})
+	}
+
+	// Deletes security groups, once the port of the instance is gone
+	if len(d.SecurityGroupIDs) > 0 {
+		plan.dependents = append(plan.dependents, removalStep{
+			name: fmt.Sprintf("security group %s", d.SecurityGroupIDs[0]),
+			remove: func() error {
+				return d.releaseSecurityGroups()
+			},
+		})
+	}
+
+	// Deletes the credential of the auto-recovery watchdog
+	if d.AutoRecoverCredential != "" {
+		plan.dependents = append(plan.dependents, removalStep{
+			name: "auto-recovery credential",
+			remove: func() error {
+				return d.deleteAutoRecoverCredential()
+			},
+		})
+	}
+
+	// Deletes the credential of the office hours
+	if d.OfficeHoursCredential != "" {
+		plan.dependents = append(plan.dependents, removalStep{
+			name: "office hours credential",
+			remove: func() error {
+				return d.deleteOfficeHoursCredential()
+			},
+		})
+	}
+
+	// Deletes instance group, once its last member is gone
+	if d.InstanceGroupID != "" {
+		plan.dependents = append(plan.dependents, removalStep{
+			name: fmt.Sprintf("instance group %s", d.InstanceGroupID),
+			remove: func() error {
+				return d.releaseInstanceGroup()
+			},
+		})
+	}
+
+	return plan, nil
+}
+
+// removeMachineSet removes the machines, locked by the caller: their instances
+// are deleted concurrently, or shelved when soft removed, and their
+// registrations and local state are dropped
+func removeMachineSet(machines []*Driver) (err error) {
+	for _, machine := range machines {
+		// Remaining cluster members forget about this machine
+		if machine.ClusterHosts {
+			err = machine.updateClusterHosts(true)
+			if err != nil {
+				log.Warnf("Could not update /etc/hosts of cluster %s: %s", machine.Cluster, err)
+			}
+		}
+
+		// Remaining mesh members stop peering with this machine
+		if machine.WireGuardMesh != "" {
+			err = machine.leaveWireGuardMesh()
+			if err != nil {
+				log.Warnf("Could not update WireGuard mesh %s: %s", machine.WireGuardMesh, err)
+			}
+		}
+	}
+
+	// Stop sending traffic to the machines, then keep their last logs
+	for _, machine := range machines {
+		machine.leaveLoadBalancerPools()
+		machine.archiveInstance()
+	}
+
+	// Soft removed machines are only shelved until purged
+	var removed []*Driver
+	purged := make(map[string]bool)
+	for _, machine := range machines {
+		if !machine.SoftRemove || machine.DeletedOnStop {
+			if machine.SnapshotOnRemove && machine.InstanceID != "" && !machine.DeletedOnStop {
+				err = machine.snapshotBeforeRemove()
+				if err != nil {
+					return err
+				}
+			}
+			removed = append(removed, machine)
+			continue
+		}
+		err = machine.softRemove()
+		if err != nil {
+			return err
+		}
+	}
+	if len(removed) > 0 {
+		err = removeMachines(removed)
+		if err != nil {
+			return err
+		}
+	}
+	for _, machine := range machines {
+		if machine.SoftRemove && !purged[machine.ProjectID] {
+			purged[machine.ProjectID] = true
+			if err := machine.purgeTrash(); err != nil {
+				log.Warnf("Could not purge soft removed machines: %s", err)
+			}
+		}
+	}
+	for _, machine := range removed {
+		if err := machine.pruneSnapshots(); err != nil {
+			log.Warnf("Could not prune the snapshots of machine %s: %s", machine.MachineName, err)
+		}
+	}
+
+	// Removed machines leave no host keys nor schedules behind, and an
+	// interrupted create no longer has anything to resume
+	for _, machine := range machines {
+		machine.forgetHostKeys()
+		machine.forgetSSHConfig()
+		machine.removeOfficeHours()
+		machine.unpublishDiscoveryRecords()
+		machine.notify(EventRemoved, nil)
+		machine.clearCheckpoint()
+	}
+	return nil
+}
+
+// removeStoreCluster removes the OVH machines of the store whose name starts
+// with the prefix, concurrently, and their docker-machine entries. Each machine
+// is locked for the whole removal. Machines without an instance are left to
+// docker-machine rm
+func removeStoreCluster(storePath string, args []string) error {
+	if len(args) != 1 || args[0] == "" {
+		return fmt.Errorf("Please give the common prefix of the machine names")
+	}
+	prefix := args[0]
+
+	paths, err := filepath.Glob(filepath.Join(storePath, "machines", prefix+"*", "config.json"))
+	if err != nil {
+		return err
+	}
+	var machines []*Driver
+	var names []string
+	for _, path := range paths {
+		name := filepath.Base(filepath.Dir(path))
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		d, err := loadMachine(storePath, name)
+		if err != nil {
+			log.Debugf("Skipping machine %s: %s", name, err)
+			continue
+		}
+		unlock, err := d.lockMachine("remove-cluster")
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		d, err = loadMachine(storePath, name)
+		if err != nil {
+			return err
+		}
+		if d.InstanceID == "" {
+			log.Infof("Skipping machine %s, which has no instance. Remove it with docker-machine rm", name)
+			continue
+		}
+		machines = append(machines, d)
+		names = append(names, name)
+	}
+	if len(machines) == 0 {
+		return fmt.Errorf("No OVH machine of store %s starts with '%s'", storePath, prefix)
+	}
+
+	log.Infof("Removing machines %s...", strings.Join(names, ", "))
+	err = removeMachineSet(machines)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := os.RemoveAll(filepath.Join(storePath, "machines", name)); err != nil {
+			return err
+		}
+		log.Infof("Removed machine %s", name)
+	}
+	return nil
+}
+
+// removeMachines deletes the instances of all machines concurrently, waits for
+// them collectively, then deletes their dependent resources concurrently
+func removeMachines(machines []*Driver) error {
+	var plans []*removalPlan
+	for _, machine := range machines {
+		plan, err := machine.removalPlan()
+		if err != nil {
+			return err
+		}
+		plans = append(plans, plan)
+	}
+
+	if len(plans) > 1 {
+		log.Infof("Deleting %d OVH machines concurrently...", len(plans))
+	}
+
+	// Delete instances, then wait until all of them are gone
+	forEachPlan(plans, func(plan *removalPlan) {
+		steps := append(append([]removalStep{}, plan.instance...), plan.dependents...)
+		plan.err = removeInOrder(steps, len(plan.instance))
+	})
+	waitForInstancesDeletion(plans)
+
+	// Delete resources depending on the instances
+	forEachPlan(plans, func(plan *removalPlan) {
+		plan.err = removeInOrder(plan.dependents, len(plan.dependents))
+	})
+
+	var failures []string
+	for _, plan := range plans {
+		if plan.err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", plan.machine.MachineName, plan.err))
+		}
+	}
+	if len(failures) == 1 && len(plans) == 1 {
+		return plans[0].err
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("Failed to delete %d of %d machines:\n%s", len(failures), len(plans), strings.Join(failures, "\n"))
+	}
+
+	return nil
+}
+
+// forEachPlan runs f concurrently on every plan that did not fail yet
+func forEachPlan(plans []*removalPlan, f func(plan *removalPlan)) {
+	var wg sync.WaitGroup
+	for _, plan := range plans {
+		if plan.err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(plan *removalPlan) {
+			defer wg.Done()
+			f(plan)
+		}(plan)
+	}
+	wg.Wait()
+}
+
+// waitForInstancesDeletion waits until the instances of all plans are gone
+// from the API. Instances of a same project, on the same endpoint, are
+// checked with a single call
+func waitForInstancesDeletion(plans []*removalPlan) {
+	pending := make(map[*removalPlan]bool)
+	for _, plan := range plans {
+		if plan.err == nil && len(plan.instance) > 0 {
+			pending[plan] = true
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	err := waitWithBackoff(func() (bool, error) {
+		existing := make(map[string]map[string]bool)
+		for plan := range pending {
+			account := plan.machine.accountKey()
+			if _, ok := existing[account]; !ok {
+				instances, err := plan.client.GetInstances(plan.machine.ProjectID)
+				if err != nil {
+					return true, fmt.Errorf("Could not list instances of project %s on %s: %s", plan.machine.ProjectID, endpointURL(plan.machine.Endpoint), err)
+				}
+				existing[account] = make(map[string]bool)
+				for _, instance := range instances {
+					existing[account][instance.ID] = true
+				}
+			}
+
+			if !existing[account][plan.machine.InstanceID] {
+				delete(pending, plan)
+			}
+		}
+		return len(pending) == 0, nil
+	})
+
+	for plan := range pending {
+		remaining := []string{fmt.Sprintf("instance %s", plan.machine.InstanceID)}
+		for _, step := range plan.dependents {
+			remaining = append(remaining, step.name)
+		}
+		plan.err = fmt.Errorf("Failed to wait for instance %s deletion: %s. The following resources remain and must be deleted manually from %s: %s", plan.machine.InstanceID, err, CustomerInterface, strings.Join(remaining, ", "))
+	}
+}
+
+// removeInOrder runs the first n removal steps with retries. On failure, it
+// stops and reports every resource that still remains, as later steps depend
+// on earlier ones
+func removeInOrder(steps []removalStep, n int) error {
+	for i, step := range steps[:n] {
+		var err error
+		for attempt := 1; attempt <= removeRetries; attempt++ {
+			err = step.remove()
+			if err == nil {
+				break
+			}
+			log.Debugf("Failed to delete %s (attempt %d/%d): %s", step.name, attempt, removeRetries, err)
+			if attempt < removeRetries {
+				time.Sleep(removeRetryDelay)
+			}
+		}
+
+		if err != nil {
+			var remaining []string
+			for _, s := range steps[i:] {
+				remaining = append(remaining, s.name)
+			}
+			return fmt.Errorf("Failed to delete %s: %s. The following resources remain and must be deleted manually from %s: %s", step.name, err, CustomerInterface, strings.Join(remaining, ", "))
+		}
+		log.Debugf("Deleted %s", step.name)
+	}
+
+	return nil
+}
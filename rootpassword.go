@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"fmt"
+	"math/big"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	rootPasswordLength   = 24
+	rootPasswordAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+	// cryptAlphabet is the base64 alphabet of crypt(3) hashes
+	cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	cryptRounds   = 5000
+)
+
+// sha512CryptOrder is the order in which crypt(3) encodes the digest bytes,
+// three at a time
+var sha512CryptOrder = [][3]int{
+	{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+	{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+	{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+	{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+	{62, 20, 41},
+}
+
+// rootPasswordScript sets the root password from its hash, for console access
+// only: SSH keeps refusing root passwords
+const rootPasswordScript = `# Set the root password for console access
+usermod -p '%s' root
+if [ -d /etc/ssh/sshd_config.d ]; then
+	echo 'PermitRootLogin prohibit-password' > /etc/ssh/sshd_config.d/90-ovh-root-console.conf
+	systemctl reload ssh 2>/dev/null || systemctl reload sshd 2>/dev/null || true
+fi
+`
+
+// generateRootPassword generates the root password of the instance to
+// request. Only its hash is sent to the instance, as user data can be read
+// back from the instance metadata service, and nothing is stored
+func (d *Driver) generateRootPassword() error {
+	if !d.RootPassword || d.rootPassword != "" {
+		return nil
+	}
+
+	password, err := randomString(rootPasswordLength, rootPasswordAlphabet)
+	if err != nil {
+		return fmt.Errorf("Could not generate root password: %s", err)
+	}
+	salt, err := randomString(16, cryptAlphabet)
+	if err != nil {
+		return fmt.Errorf("Could not generate root password: %s", err)
+	}
+
+	d.rootPassword = password
+	d.rootPasswordHash = sha512Crypt(password, salt)
+	return nil
+}
+
+// rootPasswordUserData returns the first boot script section setting the root
+// password
+func (d *Driver) rootPasswordUserData() string {
+	if d.rootPasswordHash == "" {
+		return ""
+	}
+	return fmt.Sprintf(rootPasswordScript, d.rootPasswordHash)
+}
+
+// printRootPassword prints the root password once the instance is requested,
+// as it is not stored. An instance requested again gets a new one
+func (d *Driver) printRootPassword() {
+	if d.rootPassword == "" {
+		return
+	}
+	log.Warnf("Root password of machine %s, for console access only: %s", d.MachineName, d.rootPassword)
+	log.Warnf("This password is not stored and will not be shown again. Please keep it in a safe place")
+	d.rootPassword = ""
+}
+
+// randomString returns n random characters of alphabet
+func randomString(n int, alphabet string) (string, error) {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(alphabet)))
+	for i := range b {
+		index, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[index.Int64()]
+	}
+	return string(b), nil
+}
+
+// sha512Crypt returns the SHA-512 crypt(3) hash of password, '$6$' hashes
+// understood by usermod and /etc/shadow, with the default number of rounds
+func sha512Crypt(password, salt string) string {
+	p := []byte(password)
+	s := []byte(salt)
+
+	alternate := sha512.New()
+	alternate.Write(p)
+	alternate.Write(s)
+	alternate.Write(p)
+	b := alternate.Sum(nil)
+
+	digest := sha512.New()
+	digest.Write(p)
+	digest.Write(s)
+	for i := len(p); i > 0; i -= 64 {
+		if i > 64 {
+			digest.Write(b)
+		} else {
+			digest.Write(b[:i])
+		}
+	}
+	for i := len(p); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			digest.Write(b)
+		} else {
+			digest.Write(p)
+		}
+	}
+	a := digest.Sum(nil)
+
+	dp := sha512.New()
+	for range p {
+		dp.Write(p)
+	}
+	pSeq := repeatBytes(dp.Sum(nil), len(p))
+
+	ds := sha512.New()
+	for i := 0; i < 16+int(a[0]); i++ {
+		ds.Write(s)
+	}
+	sSeq := repeatBytes(ds.Sum(nil), len(s))
+
+	c := a
+	for i := 0; i < cryptRounds; i++ {
+		round := sha512.New()
+		if i&1 != 0 {
+			round.Write(pSeq)
+		} else {
+			round.Write(c)
+		}
+		if i%3 != 0 {
+			round.Write(sSeq)
+		}
+		if i%7 != 0 {
+			round.Write(pSeq)
+		}
+		if i&1 != 0 {
+			round.Write(c)
+		} else {
+			round.Write(pSeq)
+		}
+		c = round.Sum(nil)
+	}
+
+	hash := []byte("$6$" + salt + "$")
+	encode := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for ; n > 0; n-- {
+			hash = append(hash, cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	for _, group := range sha512CryptOrder {
+		encode(c[group[0]], c[group[1]], c[group[2]], 4)
+	}
+	encode(0, 0, c[63], 2)
+	return string(hash)
+}
+
+// repeatBytes repeats b up to n bytes
+func repeatBytes(b []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		if n-len(out) > len(b) {
+			out = append(out, b...)
+		} else {
+			out = append(out, b[:n-len(out)]...)
+		}
+	}
+	return out
+}
@@ -0,0 +1,12 @@
+package main
+
+import "testing"
+
+func TestSHA512Crypt(t *testing.T) {
+	// Reference vector of the SHA-crypt specification, with the default rounds
+	got := sha512Crypt("Hello world!", "saltstring")
+	want := "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Networks that can hold the default route
+const (
+	DefaultRoutePublic  = "public"
+	DefaultRoutePrivate = "private"
+)
+
+// privateInterfacesScript lists in PRIVATE_IFS the interfaces attached to the
+// private network subnets, found by their on-link route
+const privateInterfacesScript = `# Find private network interfaces
+PRIVATE_IFS=""
+for CIDR in %s; do
+	PRIVATE_IFS="$PRIVATE_IFS $(ip -4 route show to exact "$CIDR" proto kernel | awk '{for (i = 1; i < NF; i++) if ($i == "dev") print $(i+1)}')"
+done
+`
+
+// defaultRouteInterfacesScript lists in PRIVATE_IFS every interface but the
+// one holding the default route, when private subnets are unknown
+const defaultRouteInterfacesScript = `PUBLIC_IF=$(ip route show default | awk '{print $5; exit}')
+PRIVATE_IFS=$(ls /sys/class/net | grep -v -x -e lo -e "$PUBLIC_IF")
+`
+
+// defaultRouteScript installs a boot service moving the default route onto
+// the selected network, and persists the choice in netplan when available so
+// that DHCP renewals do not bring other default routes back
+const defaultRouteScript = `# Move default route to the %[1]s network
+cat > /usr/local/sbin/ovh-default-route <<'EOF'
+#!/bin/sh
+%[2]sfor IF in $(ls /sys/class/net); do
+	[ "$IF" = lo ] && continue
+	case " $PRIVATE_IFS " in *" $IF "*) NET=private ;; *) NET=public ;; esac
+	[ "$NET" = "%[1]s" ] && continue
+	while ip -4 route del default dev "$IF" 2>/dev/null; do :; done
+	if [ -d /etc/netplan ]; then
+		cat > /etc/netplan/98-ovh-default-route-$IF.yaml <<NETPLAN
+network:
+  version: 2
+  ethernets:
+    $IF:
+      dhcp4-overrides:
+        use-routes: false
+NETPLAN
+	fi
+done
+GATEWAY="%[3]s"
+if [ -n "$GATEWAY" ]; then
+	for IF in $PRIVATE_IFS; do
+		ip -4 route replace default via "$GATEWAY" dev "$IF"
+		if [ -d /etc/netplan ]; then
+			cat > /etc/netplan/98-ovh-default-route-$IF.yaml <<NETPLAN
+network:
+  version: 2
+  ethernets:
+    $IF:
+      routes:
+        - to: 0.0.0.0/0
+          via: $GATEWAY
+NETPLAN
+		fi
+		break
+	done
+fi
+exit 0
+EOF
+chmod +x /usr/local/sbin/ovh-default-route
+cat > /etc/systemd/system/ovh-default-route.service <<'EOF'
+[Unit]
+Description=Default route on the %[1]s network
+Wants=network-online.target
+After=network-online.target
+Before=docker.service
+
+[Service]
+Type=oneshot
+ExecStart=/usr/local/sbin/ovh-default-route
+
+[Install]
+WantedBy=multi-user.target
+EOF
+systemctl daemon-reload
+systemctl enable --now ovh-default-route
+[ -d /etc/netplan ] && netplan apply || true
+`
+
+// validateDefaultRoute checks the default route selection. Routing through
+// the private network requires a subnet gateway
+func (d *Driver) validateDefaultRoute(privateNetworkID string) error {
+	if d.DefaultRoute == "" {
+		return nil
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	subnets, err := client.GetSubnets(d.ProjectID, privateNetworkID)
+	if err != nil {
+		return err
+	}
+
+	d.PrivateCIDRs = nil
+	d.PrivateGateway = ""
+	for _, subnet := range subnets {
+		d.PrivateCIDRs = append(d.PrivateCIDRs, subnet.CIDR)
+		if d.PrivateGateway == "" {
+			d.PrivateGateway = subnet.GatewayIP
+		}
+	}
+
+	if len(d.PrivateCIDRs) == 0 {
+		return fmt.Errorf("Private network '%s' has no subnet", d.PrivateNetworkName)
+	}
+	if d.DefaultRoute == DefaultRoutePrivate && d.PrivateGateway == "" {
+		return fmt.Errorf("Private network '%s' has no gateway to route through. Please add one to its subnet or use '--ovh-default-route %s'", d.PrivateNetworkName, DefaultRoutePublic)
+	}
+	return nil
+}
+
+// defaultRouteUserData returns the first boot script section selecting the
+// network of the default route
+func (d *Driver) defaultRouteUserData() string {
+	if d.DefaultRoute == "" {
+		return ""
+	}
+
+	gateway := ""
+	if d.DefaultRoute == DefaultRoutePrivate {
+		gateway = d.PrivateGateway
+	}
+	return fmt.Sprintf(defaultRouteScript, d.DefaultRoute, d.privateInterfaces(), gateway)
+}
+
+// privateInterfaces returns the script snippet listing the private network
+// interfaces in PRIVATE_IFS
+func (d *Driver) privateInterfaces() string {
+	if len(d.PrivateCIDRs) == 0 {
+		return defaultRouteInterfacesScript
+	}
+	return fmt.Sprintf(privateInterfacesScript, strings.Join(d.PrivateCIDRs, " "))
+}
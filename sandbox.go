@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// isSandbox tells whether a flavor is a sandbox one: no guaranteed resources
+// and not eligible for monthly billing
+func (f *Flavor) isSandbox() bool {
+	return strings.HasPrefix(strings.ToLower(f.Name), "s1-") || strings.Contains(strings.ToLower(f.Type), "sandbox")
+}
+
+// validateSandbox checks the use of a sandbox flavor: it cannot be billed
+// monthly, and machines whose name matches the production pattern require
+// an explicit opt-in
+func (d *Driver) validateSandbox(flavor *Flavor) error {
+	if !flavor.isSandbox() {
+		return nil
+	}
+
+	if d.BillingPeriod == "monthly" {
+		return fmt.Errorf("Sandbox flavor '%s' is not eligible for monthly billing. Please select '--ovh-billing-period hourly' or another flavor with '--ovh-flavor'", flavor.Name)
+	}
+
+	if d.ProductionPattern != "" {
+		production, err := regexp.Compile(d.ProductionPattern)
+		if err != nil {
+			return fmt.Errorf("Invalid production name pattern '%s': %s", d.ProductionPattern, err)
+		}
+		if production.MatchString(d.MachineName) && !d.AllowSandbox {
+			return fmt.Errorf("Machine %s looks like a production one but flavor '%s' is a sandbox flavor without guaranteed resources. Please select another flavor with '--ovh-flavor' or confirm with '--ovh-allow-sandbox'", d.MachineName, flavor.Name)
+		}
+	}
+
+	log.Warn("****************************************************************")
+	log.Warnf("Flavor %s is a sandbox flavor: its resources are NOT guaranteed", flavor.Name)
+	log.Warn("and it is not eligible for monthly billing. Do not use it for")
+	log.Warn("production workloads.")
+	log.Warn("****************************************************************")
+	return nil
+}
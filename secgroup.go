@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Swarm ports, restricted to the machines of the same cluster discovery
+var (
+	swarmTCPPorts = []int{2377, 7946}
+	swarmUDPPorts = []int{7946, 4789}
+)
+
+// securityRule is an ingress rule of a security group. Without remote IP
+// prefix nor remote group, it allows any source
+type securityRule struct {
+	Protocol      string
+	PortMin       int
+	PortMax       int
+	RemoteIP      string
+	RemoteGroupID string
+}
+
+// restrictedPort is a port of the machine only reachable from some sources:
+// IP prefixes, or the members of a security group
+type restrictedPort struct {
+	Protocol string
+	Port     int
+	Sources  []string
+	GroupID  string
+}
+
+// securityGroup is a Neutron security group
+type securityGroup struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Rules []struct {
+		ID        string `json:"id"`
+		Direction string `json:"direction"`
+	} `json:"security_group_rules"`
+}
+
+// swarmGroupName returns the name of the security group shared by the
+// machines of the Swarm cluster, after a digest of its discovery, which may
+// hold a token. A manager without discovery has a group of its own
+func (d *Driver) swarmGroupName() string {
+	key := d.SwarmDiscovery
+	if key == "" {
+		key = d.MachineName
+	}
+	return d.resourceName("swarm-" + strings.TrimPrefix(inputDigest(key), "sha256:"))
+}
+
+// restrictedPorts returns the ports of the machine only reachable from some
+// sources, once the shared groups are known by name. The WireGuard port is
+// reachable from the addresses of the other members of the mesh, which may
+// live in other regions than the security groups
+func (d *Driver) restrictedPorts(groupIDs map[string]string, meshSources []string) []restrictedPort {
+	var ports []restrictedPort
+	if d.WireGuardRestricted {
+		ports = append(ports, restrictedPort{Protocol: "udp", Port: WireGuardPort, Sources: meshSources})
+	}
+	if len(d.DockerAllowedCIDRs) > 0 {
+		for _, port := range d.dockerPorts() {
+			ports = append(ports, restrictedPort{Protocol: "tcp", Port: port, Sources: d.DockerAllowedCIDRs})
+		}
+	}
+	if id := groupIDs[d.SwarmGroup]; d.SwarmGroup != "" && id != "" {
+		for _, port := range swarmTCPPorts {
+			ports = append(ports, restrictedPort{Protocol: "tcp", Port: port, GroupID: id})
+		}
+		for _, port := range swarmUDPPorts {
+			ports = append(ports, restrictedPort{Protocol: "udp", Port: port, GroupID: id})
+		}
+	}
+	return ports
+}
+
+// securityRules returns the rules of the security group of the machine:
+// restricted ports from their sources only, anything else from anywhere, as
+// with the default group it replaces
+func securityRules(restricted []restrictedPort) []securityRule {
+	var rules []securityRule
+	closed := map[string][]int{}
+	for _, port := range restricted {
+		closed[port.Protocol] = append(closed[port.Protocol], port.Port)
+		if port.GroupID != "" {
+			rules = append(rules, securityRule{Protocol: port.Protocol, PortMin: port.Port, PortMax: port.Port, RemoteGroupID: port.GroupID})
+		}
+		for _, source := range port.Sources {
+			rules = append(rules, securityRule{Protocol: port.Protocol, PortMin: port.Port, PortMax: port.Port, RemoteIP: source})
+		}
+	}
+
+	for _, protocol := range []string{"tcp", "udp"} {
+		ports := closed[protocol]
+		sort.Ints(ports)
+		from := 1
+		for _, port := range ports {
+			if port > from {
+				rules = append(rules, securityRule{Protocol: protocol, PortMin: from, PortMax: port - 1})
+			}
+			if port+1 > from {
+				from = port + 1
+			}
+		}
+		if from <= 65535 {
+			rules = append(rules, securityRule{Protocol: protocol, PortMin: from, PortMax: 65535})
+		}
+	}
+	return append(rules, securityRule{Protocol: "icmp"})
+}
+
+// usesSecurityGroups tells whether the public port of the machine gets the
+// security groups of the driver in place of the default one
+func (d *Driver) usesSecurityGroups() bool {
+	return !d.NoPublicNetwork && (d.SwarmGroup != "" || d.WireGuardRestricted || len(d.DockerAllowedCIDRs) > 0)
+}
+
+// validateSecurityGroups selects the shared groups of the machine, and checks
+// the OpenStack credentials managing them. Swarm and WireGuard ports are only
+// left open, with a warning, when there are none
+func (d *Driver) validateSecurityGroups() error {
+	d.SwarmGroup = ""
+	d.WireGuardRestricted = false
+	if d.NoPublicNetwork || (!d.isSwarmNode() && d.WireGuardMesh == "") {
+		return nil
+	}
+
+	o, err := d.openStack("Restricting the Swarm and WireGuard ports")
+	if err != nil {
+		log.Warnf("%s. Swarm and WireGuard ports are left open", err)
+		return nil
+	}
+	if _, ok := o.endpoints("network")[d.RegionName]; !ok {
+		return fmt.Errorf("No OpenStack networking endpoint found for region %s", d.RegionName)
+	}
+	if d.isSwarmNode() {
+		d.SwarmGroup = d.swarmGroupName()
+		log.Debugf("Restricting swarm ports to the members of security group %s", d.SwarmGroup)
+	}
+	d.WireGuardRestricted = d.WireGuardMesh != ""
+	return nil
+}
+
+// applySecurityGroups sets the security groups of the machine, allowing the
+// WireGuard port from the members of the mesh in the store
+func (d *Driver) applySecurityGroups() error {
+	if !d.usesSecurityGroups() {
+		return nil
+	}
+
+	var sources []string
+	if d.WireGuardRestricted {
+		members, err := d.meshMembers()
+		if err != nil {
+			return err
+		}
+		sources = meshSources(d, members)
+	}
+	return d.setSecurityGroups(sources)
+}
+
+// setSecurityGroups creates the security group of the machine, finds or
+// creates the shared ones, and sets them on the public port of the instance
+// in place of the default group
+func (d *Driver) setSecurityGroups(meshSources []string) error {
+	log.Infof("Setting the security groups of OVH instance %s...", d.InstanceID)
+	o, err := d.openStack("Restricting the machine ports")
+	if err != nil {
+		return err
+	}
+	endpoint, ok := o.endpoints("network")[d.RegionName]
+	if !ok {
+		return fmt.Errorf("No OpenStack networking endpoint found for region %s", d.RegionName)
+	}
+
+	shared := make(map[string]string)
+	var sharedIDs []string
+	for _, name := range []string{d.SwarmGroup} {
+		if name == "" {
+			continue
+		}
+		group, err := o.ensureSecurityGroup(endpoint, name, "Members of a docker-machine cluster")
+		if err != nil {
+			return err
+		}
+		shared[name] = group.ID
+		sharedIDs = append(sharedIDs, group.ID)
+	}
+
+	group, err := o.ensureSecurityGroup(endpoint, d.instanceName(), "Ports of docker-machine "+d.MachineName)
+	if err != nil {
+		return err
+	}
+	d.SecurityGroupIDs = append([]string{group.ID}, sharedIDs...)
+	err = o.replaceSecurityRules(endpoint, group, securityRules(d.restrictedPorts(shared, meshSources)))
+	if err != nil {
+		return fmt.Errorf("Could not set the rules of security group %s: %s", group.ID, err)
+	}
+	return o.setPortSecurityGroups(endpoint, d.InstanceID, d.IPAddress, d.SecurityGroupIDs)
+}
+
+// ensureSecurityGroup finds a security group by name, or creates it
+func (o *openStack) ensureSecurityGroup(endpoint, name, description string) (*securityGroup, error) {
+	var groups struct {
+		SecurityGroups []securityGroup `json:"security_groups"`
+	}
+	_, err := o.call("GET", endpoint+"/v2.0/security-groups?"+url.Values{"name": {name}}.Encode(), nil, &groups)
+	if err != nil {
+		return nil, fmt.Errorf("Could not list security groups: %s", err)
+	}
+	if len(groups.SecurityGroups) > 0 {
+		return &groups.SecurityGroups[0], nil
+	}
+
+	var created struct {
+		SecurityGroup securityGroup `json:"security_group"`
+	}
+	req := map[string]interface{}{"security_group": map[string]string{"name": name, "description": description}}
+	_, err = o.call("POST", endpoint+"/v2.0/security-groups", req, &created)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create security group %s: %s", name, err)
+	}
+	log.Debugf("Created security group %s (%s)", name, created.SecurityGroup.ID)
+	return &created.SecurityGroup, nil
+}
+
+// replaceSecurityRules replaces the ingress rules of a security group. Rules
+// without remote apply to IPv4 and IPv6 sources
+func (o *openStack) replaceSecurityRules(endpoint string, group *securityGroup, rules []securityRule) error {
+	for _, rule := range group.Rules {
+		if rule.Direction != "ingress" {
+			continue
+		}
+		_, err := o.call("DELETE", endpoint+"/v2.0/security-group-rules/"+rule.ID, nil, nil)
+		if apierror, ok := err.(*openStackError); ok && apierror.Code == 404 {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var requests []map[string]interface{}
+	for _, rule := range rules {
+		ethertypes := []string{"IPv4", "IPv6"}
+		if strings.Contains(rule.RemoteIP, ":") {
+			ethertypes = []string{"IPv6"}
+		} else if rule.RemoteIP != "" {
+			ethertypes = []string{"IPv4"}
+		}
+		for _, ethertype := range ethertypes {
+			request := map[string]interface{}{
+				"security_group_id": group.ID,
+				"direction":         "ingress",
+				"ethertype":         ethertype,
+				"protocol":          rule.Protocol,
+			}
+			if rule.Protocol == "icmp" && ethertype == "IPv6" {
+				request["protocol"] = "ipv6-icmp"
+			}
+			if rule.PortMin > 0 {
+				request["port_range_min"] = rule.PortMin
+				request["port_range_max"] = rule.PortMax
+			}
+			if rule.RemoteIP != "" {
+				request["remote_ip_prefix"] = rule.RemoteIP
+			}
+			if rule.RemoteGroupID != "" {
+				request["remote_group_id"] = rule.RemoteGroupID
+			}
+			requests = append(requests, request)
+		}
+	}
+	_, err := o.call("POST", endpoint+"/v2.0/security-group-rules", map[string]interface{}{"security_group_rules": requests}, nil)
+	return err
+}
+
+// setPortSecurityGroups sets the security groups of the port of an instance
+// holding address
+func (o *openStack) setPortSecurityGroups(endpoint, instanceID, address string, groupIDs []string) error {
+	var ports struct {
+		Ports []struct {
+			ID                  string `json:"id"`
+			PortSecurityEnabled bool   `json:"port_security_enabled"`
+			FixedIPs            []struct {
+				IPAddress string `json:"ip_address"`
+			} `json:"fixed_ips"`
+		} `json:"ports"`
+	}
+	_, err := o.call("GET", endpoint+"/v2.0/ports?"+url.Values{"device_id": {instanceID}}.Encode(), nil, &ports)
+	if err != nil {
+		return err
+	}
+	for _, port := range ports.Ports {
+		for _, ip := range port.FixedIPs {
+			if ip.IPAddress != address {
+				continue
+			}
+			if !port.PortSecurityEnabled {
+				return fmt.Errorf("Port %s of instance %s has no port security, security groups do not apply to it", port.ID, instanceID)
+			}
+			update := map[string]interface{}{"port": map[string]interface{}{"security_groups": groupIDs}}
+			_, err = o.call("PUT", endpoint+"/v2.0/ports/"+port.ID, update, nil)
+			return err
+		}
+	}
+	return fmt.Errorf("No port of instance %s holds address %s", instanceID, address)
+}
+
+// releaseSecurityGroups deletes the security group of the machine, and the
+// shared groups once they have no member left
+func (d *Driver) releaseSecurityGroups() error {
+	o, err := d.openStack("Removing the security groups of the machine")
+	if err != nil {
+		return err
+	}
+	endpoint, ok := o.endpoints("network")[d.RegionName]
+	if !ok {
+		return fmt.Errorf("No OpenStack networking endpoint found for region %s", d.RegionName)
+	}
+
+	for i, id := range d.SecurityGroupIDs {
+		_, err = o.call("DELETE", endpoint+"/v2.0/security-groups/"+id, nil, nil)
+		apierror, ok := err.(*openStackError)
+		switch {
+		case ok && apierror.Code == 404:
+		case ok && apierror.Code == 409 && i > 0:
+			log.Debugf("Keeping security group %s, still in use", id)
+		case err != nil:
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// smtpProbeHost is a mail server listening on both the SMTP port and the
+// submission over TLS port, to tell a blocked port from an unreachable host
+const smtpProbeHost = "smtp.gmail.com"
+
+// smtpProbeCommand prints, for each port, whether a connection succeeds
+const smtpProbeCommand = `probe() {
+	if command -v nc >/dev/null; then
+		nc -z -w 5 %[1]s $1 >/dev/null 2>&1
+	else
+		timeout 5 bash -c "exec 3<>/dev/tcp/%[1]s/$1" >/dev/null 2>&1
+	fi
+}
+for port in 25 465; do
+	if probe $port; then echo "$port open"; else echo "$port closed"; fi
+done
+`
+
+// checkSMTP checks whether the machine can send mail on port 25. OVH blocks
+// it by default on Public Cloud instances, and containers sending mail
+// directly then time out without an explicit error
+func (d *Driver) checkSMTP() {
+	output, err := drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(smtpProbeCommand, smtpProbeHost))
+	if err != nil {
+		log.Warnf("Could not check outbound SMTP of machine %s: %s", d.MachineName, err)
+		return
+	}
+
+	switch {
+	case strings.Contains(output, "25 open"):
+		log.Infof("Outbound SMTP port 25 of machine %s is open", d.MachineName)
+	case strings.Contains(output, "465 open"):
+		log.Warnf("Outbound SMTP port 25 of machine %s is blocked by OVH. Containers sending mail directly will time out. "+
+			"Either relay mail through a provider on port 465 or 587, or ask OVH to unblock it: there is no API for it, open a support ticket "+
+			"from the OVH Control Panel (%s) mentioning project %s, instance %s and address %s, and the purpose of the mail sent", d.MachineName, CustomerInterface, d.ProjectID, d.InstanceID, d.IPAddress)
+	default:
+		log.Warnf("Could not check outbound SMTP of machine %s: %s is not reachable on port 25 nor 465", d.MachineName, smtpProbeHost)
+	}
+}
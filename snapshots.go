@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// snapshotTag marks the name of a snapshot created by the driver, followed by
+// its creation time as a unix timestamp
+const snapshotTag = " docker-machine-snapshot="
+
+// snapshotRemoved is the purpose of the snapshots taken on machine removal
+const snapshotRemoved = "removed"
+
+// driverSnapshot is a snapshot created by the driver
+type driverSnapshot struct {
+	Image
+
+	// Name without the tag, shared by the snapshots of a same purpose
+	base    string
+	created time.Time
+}
+
+// snapshotName returns the name of a new snapshot of the machine, prefixed
+// and tagged so that it can be told apart and pruned
+func (d *Driver) snapshotName(purpose string) string {
+	return d.resourceName(fmt.Sprintf("%s-%s%s%d", d.MachineName, purpose, snapshotTag, time.Now().Unix()))
+}
+
+// waitForSnapshot waits until a snapshot of region is active. The snapshot is
+// returned as soon as it is listed, even on failure, so that it can be deleted
+func (d *Driver) waitForSnapshot(client *API, region, name string) (snapshot *Image, err error) {
+	err = waitWithBackoff(func() (bool, error) {
+		found, err := client.GetSnapshotByName(d.ProjectID, region, name)
+		if err != nil {
+			return true, err
+		}
+		if found == nil {
+			return false, nil
+		}
+
+		snapshot = found
+		log.Debugf("Snapshot", map[string]interface{}{
+			"ID":    snapshot.ID,
+			"State": snapshot.Status,
+		})
+		if snapshot.Status == "error" {
+			return true, fmt.Errorf("Snapshot %s failed", name)
+		}
+		return snapshot.Status == "active", nil
+	})
+	return snapshot, err
+}
+
+// snapshotBeforeRemove snapshots the instance of the machine before it is
+// deleted
+func (d *Driver) snapshotBeforeRemove() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	name := d.snapshotName(snapshotRemoved)
+	log.Infof("Snapshotting machine %s before removal...", d.MachineName)
+	err = client.CreateSnapshot(d.ProjectID, d.InstanceID, name)
+	if err != nil {
+		return err
+	}
+	snapshot, err := d.waitForSnapshot(client, d.RegionName, name)
+	if err != nil {
+		return fmt.Errorf("Could not snapshot machine %s, it is not removed: %s", d.MachineName, err)
+	}
+	log.Infof("Machine %s is kept as snapshot %s (%s)", d.MachineName, snapshot.Name, snapshot.ID)
+
+	// Keep the machine configuration, for its snapshots to be listed and
+	// pruned with its own retention once it is removed
+	err = d.keepSnapshotOwner()
+	if err != nil {
+		log.Warnf("Could not keep the configuration of machine %s with its snapshots: %s", d.MachineName, err)
+	}
+	return nil
+}
+
+// snapshotOwnersPath returns the directory keeping the configuration of the
+// removed machines with snapshots, by machine name
+func (d *Driver) snapshotOwnersPath() string {
+	return filepath.Join(d.StorePath, "ovh-snapshots")
+}
+
+// keepSnapshotOwner copies the configuration of the machine, being removed,
+// to the snapshot owners
+func (d *Driver) keepSnapshotOwner() error {
+	data, err := ioutil.ReadFile(filepath.Join(d.StorePath, "machines", d.MachineName, "config.json"))
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(d.snapshotOwnersPath(), d.MachineName)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "config.json"), data, 0600)
+}
+
+// snapshotOwners returns the machines of a store, and the removed machines
+// with snapshots, of the given names or all of them. Machines of the store
+// own the snapshots of removed machines of the same name
+func snapshotOwners(storePath string, names []string) ([]*Driver, error) {
+	store := &Driver{BaseDriver: &drivers.BaseDriver{StorePath: storePath}}
+	machines, err := store.storedMachines()
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]bool)
+	for _, machine := range machines {
+		stored[machine.MachineName] = true
+	}
+	paths, err := filepath.Glob(filepath.Join(store.snapshotOwnersPath(), "*", "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if machine := readTrashedMachine(path); machine != nil && !stored[machine.MachineName] {
+			machines = append(machines, machine)
+		}
+	}
+
+	var owners []*Driver
+	for _, machine := range machines {
+		if len(names) == 0 || containsString(names, machine.MachineName) {
+			machine.StorePath = storePath
+			owners = append(owners, machine)
+		}
+	}
+	for _, name := range names {
+		if !containsOwner(owners, name) {
+			return nil, fmt.Errorf("Machine '%s' does not exist in store %s, nor among its removed machines with snapshots", name, storePath)
+		}
+	}
+	return owners, nil
+}
+
+// containsOwner tells whether machines hold a machine of the name
+func containsOwner(machines []*Driver, name string) bool {
+	for _, machine := range machines {
+		if machine.MachineName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// listStoreSnapshots prints the snapshots of the machines of a store,
+// removed ones included
+func listStoreSnapshots(storePath string, names []string) error {
+	owners, err := snapshotOwners(storePath, names)
+	if err != nil {
+		return err
+	}
+	for _, d := range owners {
+		client, err := d.getClient()
+		if err != nil {
+			log.Errorf("%s: %s", d.MachineName, err)
+			continue
+		}
+		d.logSnapshots(client)
+	}
+	return nil
+}
+
+// pruneStoreSnapshots prunes the snapshots of the machines of a store,
+// removed ones included, with the retention of each, and forgets removed
+// machines left without snapshots
+func pruneStoreSnapshots(storePath string, names []string) error {
+	owners, err := snapshotOwners(storePath, names)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, d := range owners {
+		err := d.pruneSnapshots()
+		if err == nil {
+			err = d.forgetSnapshotOwner()
+		}
+		if err != nil {
+			log.Errorf("%s: %s", d.MachineName, err)
+			failed = append(failed, d.MachineName)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Pruning failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// forgetSnapshotOwner removes the configuration of a removed machine once
+// none of its snapshots is left
+func (d *Driver) forgetSnapshotOwner() error {
+	dir := filepath.Join(d.snapshotOwnersPath(), d.MachineName)
+	if _, err := os.Stat(dir); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(d.StorePath, "machines", d.MachineName)); err == nil {
+		return nil
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	snapshots, err := d.driverSnapshots(client)
+	if err != nil || len(snapshots) > 0 {
+		return err
+	}
+	log.Debugf("Forgetting removed machine %s, none of its snapshots is left", d.MachineName)
+	return os.RemoveAll(dir)
+}
+
+// driverSnapshots lists the snapshots taken by the driver on removal of the
+// machine, or of a removed machine of the same name, in the machine region,
+// newest first. Snapshots of clone sources belong to the clone flow
+func (d *Driver) driverSnapshots(client *API) ([]driverSnapshot, error) {
+	snapshots, err := client.GetSnapshots(d.ProjectID, d.RegionName)
+	if err != nil {
+		return nil, err
+	}
+
+	base := d.resourceName(d.MachineName + "-" + snapshotRemoved)
+	var found []driverSnapshot
+	for _, snapshot := range snapshots {
+		i := strings.LastIndex(snapshot.Name, snapshotTag)
+		if i < 0 || snapshot.Name[:i] != base {
+			continue
+		}
+		created, err := strconv.ParseInt(snapshot.Name[i+len(snapshotTag):], 10, 64)
+		if err != nil {
+			continue
+		}
+		found = append(found, driverSnapshot{Image: snapshot, base: snapshot.Name[:i], created: time.Unix(created, 0)})
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].created.After(found[j].created)
+	})
+	return found, nil
+}
+
+// pruneSnapshots deletes the snapshots of the machine beyond its retention:
+// older than the retention days, or beyond the number kept. Snapshots in
+// progress are left alone
+func (d *Driver) pruneSnapshots() error {
+	if d.SnapshotRetentionDays == 0 && d.SnapshotKeep == 0 {
+		return nil
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	snapshots, err := d.driverSnapshots(client)
+	if err != nil {
+		return err
+	}
+
+	retention := time.Duration(d.SnapshotRetentionDays) * 24 * time.Hour
+	kept := make(map[string]int)
+	for _, snapshot := range snapshots {
+		if snapshot.Status != "active" && snapshot.Status != "error" {
+			continue
+		}
+		kept[snapshot.base]++
+		tooOld := d.SnapshotRetentionDays > 0 && time.Since(snapshot.created) > retention
+		tooMany := d.SnapshotKeep > 0 && kept[snapshot.base] > d.SnapshotKeep
+		if !tooOld && !tooMany {
+			continue
+		}
+
+		log.Infof("Pruning snapshot %s (%s) taken on %s...", snapshot.base, snapshot.ID, snapshot.created.UTC().Format(time.RFC3339))
+		err = client.DeleteSnapshot(d.ProjectID, snapshot.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logSnapshots prints the snapshots of the machine
+func (d *Driver) logSnapshots(client *API) {
+	snapshots, err := d.driverSnapshots(client)
+	if err != nil {
+		log.Warnf("Could not list snapshots: %s", err)
+		return
+	}
+	if len(snapshots) == 0 {
+		log.Infof("No snapshot of machine %s in region %s", d.MachineName, d.RegionName)
+		return
+	}
+
+	var lines []string
+	for _, snapshot := range snapshots {
+		lines = append(lines, fmt.Sprintf("%s  %s  %s  %s", snapshot.ID, snapshot.created.UTC().Format(time.RFC3339), snapshot.Status, snapshot.base))
+	}
+	log.Infof("Snapshots of machine %s in region %s:\n%s", d.MachineName, d.RegionName, strings.Join(lines, "\n"))
+}
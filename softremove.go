@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// pendingDeleteKey is the metadata key of a soft removed instance, holding
+// the removal time as a unix timestamp
+const pendingDeleteKey = "pending-delete"
+
+// trashPath returns the directory keeping the configuration of soft removed
+// machines, by instance id, so that they can be restored or purged
+func (d *Driver) trashPath() string {
+	return filepath.Join(d.StorePath, "ovh-trash")
+}
+
+// validateSoftRemove checks the OpenStack credentials tagging soft removed
+// instances
+func (d *Driver) validateSoftRemove() error {
+	if !d.SoftRemove {
+		return nil
+	}
+	o, err := d.openStack("'--ovh-soft-remove'")
+	if err != nil {
+		return err
+	}
+	if _, ok := o.endpoints("compute")[d.RegionName]; !ok {
+		return fmt.Errorf("No OpenStack compute endpoint found for region %s", d.RegionName)
+	}
+	return nil
+}
+
+// softRemove shelves the instance and tags it for deletion instead of
+// deleting it, and keeps a copy of the machine directory in the trash. Its
+// other resources are left untouched
+func (d *Driver) softRemove() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	if d.InstanceID == "" {
+		return nil
+	}
+	o, err := d.openStack("Soft removing the machine")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(d.trashPath(), d.InstanceID)
+	err = copyDir(filepath.Join(d.StorePath, "machines", d.MachineName), dir)
+	if err != nil {
+		return fmt.Errorf("Could not keep the configuration of machine %s: %s", d.MachineName, err)
+	}
+
+	log.Infof("Shelving OVH instance %s, it is deleted after %d hours...", d.InstanceID, d.SoftRemoveRetention)
+	err = client.ShelveInstance(d.ProjectID, d.InstanceID)
+	if err != nil {
+		return err
+	}
+	err = o.setServerMetadata(d.RegionName, d.InstanceID, map[string]string{pendingDeleteKey: strconv.FormatInt(time.Now().Unix(), 10)})
+	if err != nil {
+		return fmt.Errorf("Could not tag instance %s for deletion: %s", d.InstanceID, err)
+	}
+
+	log.Infof("To restore machine %s, unshelve instance %s from %s, delete its %s metadata and move %s back to %s", d.MachineName, d.InstanceID, CustomerInterface, pendingDeleteKey, dir, filepath.Join(d.StorePath, "machines", d.MachineName))
+	return nil
+}
+
+// pendingDeletes returns the removal times of the soft removed instances of
+// the project, in every region, by instance id
+func (o *openStack) pendingDeletes() (map[string]time.Time, error) {
+	removals := make(map[string]time.Time)
+	for region, endpoint := range o.endpoints("compute") {
+		var servers struct {
+			Servers []struct {
+				ID       string            `json:"id"`
+				Metadata map[string]string `json:"metadata"`
+			} `json:"servers"`
+		}
+		_, err := o.call("GET", endpoint+"/servers/detail", nil, &servers)
+		if err != nil {
+			return nil, fmt.Errorf("Could not list the instances of region %s: %s", region, err)
+		}
+		for _, server := range servers.Servers {
+			removed, err := strconv.ParseInt(server.Metadata[pendingDeleteKey], 10, 64)
+			if err == nil {
+				removals[server.ID] = time.Unix(removed, 0)
+			}
+		}
+	}
+	return removals, nil
+}
+
+// purgeTrash deletes the soft removed instances of the project past their
+// retention window, the one of their machine when it is in the trash, with
+// the resources of their machine
+func (d *Driver) purgeTrash() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	o, err := d.openStack("Purging soft removed machines")
+	if err != nil {
+		return err
+	}
+	removals, err := o.pendingDeletes()
+	if err != nil {
+		return err
+	}
+	instances, err := client.GetInstances(d.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	var machines []*Driver
+	for _, instance := range instances {
+		removed, ok := removals[instance.ID]
+		if !ok {
+			continue
+		}
+
+		machine := d.trashedMachine(instance.ID)
+		retention := d.SoftRemoveRetention
+		if machine != nil {
+			retention = machine.SoftRemoveRetention
+		}
+		if time.Since(removed) < time.Duration(retention)*time.Hour {
+			continue
+		}
+		if machine == nil {
+			// Only the instance is known without the machine configuration
+			base := *d.BaseDriver
+			base.MachineName = instance.Name
+			machine = &Driver{BaseDriver: &base, ProjectID: d.ProjectID, InstanceID: instance.ID, Config: Config{KeepSSHKey: true}, client: client}
+		}
+		log.Infof("Purging soft removed instance %s (%s)...", instance.ID, instance.Name)
+		machines = append(machines, machine)
+	}
+	if len(machines) == 0 {
+		return nil
+	}
+
+	err = removeMachines(machines)
+	for _, machine := range machines {
+		if exists, _ := client.InstanceExists(d.ProjectID, machine.InstanceID); !exists {
+			os.RemoveAll(filepath.Join(d.trashPath(), machine.InstanceID))
+		}
+	}
+	return err
+}
+
+// purgeStoreTrash purges the soft removed instances of the projects of the
+// machines in the trash of a store
+func purgeStoreTrash(storePath string) error {
+	paths, err := filepath.Glob(filepath.Join(storePath, "ovh-trash", "*", "config.json"))
+	if err != nil {
+		return err
+	}
+
+	purged := make(map[string]bool)
+	var failed []string
+	for _, path := range paths {
+		d := readTrashedMachine(path)
+		if d == nil || purged[d.ProjectID] {
+			continue
+		}
+		purged[d.ProjectID] = true
+		d.StorePath = storePath
+		if err := d.purgeTrash(); err != nil {
+			log.Errorf("Could not purge the soft removed instances of project %s: %s", d.ProjectID, err)
+			failed = append(failed, d.ProjectID)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Purge failed for projects %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// trashedMachine loads the machine of a soft removed instance from the trash,
+// nil if it is not there
+func (d *Driver) trashedMachine(instanceID string) *Driver {
+	return readTrashedMachine(filepath.Join(d.trashPath(), instanceID, "config.json"))
+}
+
+// readTrashedMachine loads a machine configuration of the trash, nil if it
+// cannot be read
+func readTrashedMachine(path string) *Driver {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var machine storedMachine
+	if err := json.Unmarshal(data, &machine); err != nil || machine.Driver == nil || machine.Driver.BaseDriver == nil {
+		log.Debugf("Skipping trashed machine %s: %v", path, err)
+		return nil
+	}
+	return machine.Driver
+}
+
+// copyDir copies the files of a directory, not recursively
+func copyDir(src, dst string) error {
+	err := os.MkdirAll(dst, 0700)
+	if err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(src, file.Name()))
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(dst, file.Name()), data, file.Mode().Perm())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
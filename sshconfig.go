@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnutils"
+)
+
+// SSHConfigName is the name of the ssh configuration of the machines with
+// agent forwarding, in the machine store. It is included from the ssh
+// configuration of the user, which ssh, scp and docker-machine ssh read
+const SSHConfigName = "ovh-ssh_config"
+
+// sshConfigBlock configures ssh for the machine, by name and address: its
+// key and known hosts, and agent forwarding
+const sshConfigBlock = `# BEGIN %[1]s
+Host %[1]s %[2]s
+  HostName %[2]s
+  User %[3]s
+  Port %[4]d
+  IdentityFile "%[5]s"
+  IdentitiesOnly yes
+  UserKnownHostsFile "%[6]s"
+  ForwardAgent yes
+# END %[1]s`
+
+// sshConfigInclude marks the include of the driver configuration in the ssh
+// configuration of the user
+const sshConfigInclude = "# docker-machine-driver-ovh agent forwarding"
+
+// opensshVersion matches the version reported by ssh -V
+var opensshVersion = regexp.MustCompile(`OpenSSH_(\d+)\.(\d+)`)
+
+// sshConfigPath returns the path of the ssh configuration of the machines
+func (d *Driver) sshConfigPath() string {
+	return filepath.Join(d.StorePath, SSHConfigName)
+}
+
+// userSSHConfigPath returns the path of the ssh configuration of the user,
+// resolved when it is a link, e.g. to a dotfiles repository, so that writing
+// it keeps the link
+func userSSHConfigPath() string {
+	path := filepath.Join(mcnutils.GetHomeDir(), ".ssh", "config")
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// updateSSHConfig writes the ssh configuration block of the machine, with
+// '--ovh-ssh-agent-forwarding', and includes the configuration from the one
+// of the user. Failures are only reported
+func (d *Driver) updateSSHConfig() {
+	if !d.SSHAgentForwarding || d.StorePath == "" {
+		return
+	}
+	block := fmt.Sprintf(sshConfigBlock, d.MachineName, d.IPAddress, d.GetSSHUsername(), d.SSHPort, d.GetSSHKeyPath(), d.knownHostsPath())
+	err := d.replaceSSHConfigBlock(block)
+	if err == nil {
+		err = d.includeSSHConfig()
+	}
+	if err != nil {
+		log.Warnf("Could not configure ssh agent forwarding for machine %s: %s", d.MachineName, err)
+	}
+}
+
+// forgetSSHConfig removes the ssh configuration block of the machine, and the
+// include of the configuration once it has no machine left
+func (d *Driver) forgetSSHConfig() {
+	if d.StorePath == "" {
+		return
+	}
+	err := d.replaceSSHConfigBlock("")
+	if err == nil {
+		err = d.excludeSSHConfig()
+	}
+	if err != nil {
+		log.Warnf("Could not remove the ssh configuration of machine %s: %s", d.MachineName, err)
+	}
+}
+
+// includeSSHConfig includes the configuration of the machines at the top of
+// the ssh configuration of the user, once, so that it applies to every host.
+// OpenSSH before 7.3 rejects a configuration with an Include, so the include
+// is then left to the user
+func (d *Driver) includeSSHConfig() error {
+	path := userSSHConfigPath()
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	include := fmt.Sprintf("Include \"%s\"", d.sshConfigPath())
+	if strings.Contains(string(data), include) {
+		return nil
+	}
+
+	output, _ := exec.Command("ssh", "-V").CombinedOutput()
+	version := opensshVersion.FindStringSubmatch(string(output))
+	if version == nil {
+		return fmt.Errorf("ssh is not OpenSSH, include %s from your ssh configuration if it supports Include", d.sshConfigPath())
+	}
+	major, _ := strconv.Atoi(version[1])
+	minor, _ := strconv.Atoi(version[2])
+	if major < 7 || major == 7 && minor < 3 {
+		return fmt.Errorf("OpenSSH %s.%s does not support Include, which needs 7.3 or later. Point ssh to %s with -F instead", version[1], version[2], d.sshConfigPath())
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	log.Infof("Including %s in %s", d.sshConfigPath(), path)
+	return writeFileAtomic(path, []byte(sshConfigInclude+"\n"+include+"\n\n"+string(data)))
+}
+
+// excludeSSHConfig removes the configuration of the machines, and its include
+// from the ssh configuration of the user, once no machine is left in it
+func (d *Driver) excludeSSHConfig() error {
+	data, err := ioutil.ReadFile(d.sshConfigPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil || strings.TrimSpace(string(data)) != "" {
+		return err
+	}
+	err = os.Remove(d.sshConfigPath())
+	if err != nil {
+		return err
+	}
+
+	path := userSSHConfigPath()
+	data, err = ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	include := fmt.Sprintf("Include \"%s\"", d.sshConfigPath())
+	block := sshConfigInclude + "\n" + include + "\n\n"
+	content := string(data)
+	switch {
+	case strings.Contains(content, block):
+		content = strings.Replace(content, block, "", 1)
+	case strings.Contains(content, include):
+		content = strings.Replace(content, include+"\n", "", 1)
+	default:
+		return nil
+	}
+	log.Infof("Removing the include of %s from %s", d.sshConfigPath(), path)
+	return writeFileAtomic(path, []byte(content))
+}
+
+// replaceSSHConfigBlock replaces the block of the machine with block
+func (d *Driver) replaceSSHConfigBlock(block string) error {
+	data, err := ioutil.ReadFile(d.sshConfigPath())
+	if os.IsNotExist(err) && block == "" {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var lines []string
+	skipping := false
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		switch {
+		case line == "# BEGIN "+d.MachineName:
+			skipping = true
+		case line == "# END "+d.MachineName:
+			skipping = false
+		case !skipping && line != "":
+			lines = append(lines, line)
+		}
+	}
+	if block != "" {
+		lines = append(lines, strings.Split(block, "\n")...)
+	}
+	if len(lines) == 0 {
+		return writeFileAtomic(d.sshConfigPath(), nil)
+	}
+	return writeFileAtomic(d.sshConfigPath(), []byte(strings.Join(lines, "\n")+"\n"))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Supported SSH key types
+const (
+	SSHKeyTypeRSA     = "rsa"
+	SSHKeyTypeED25519 = "ed25519"
+
+	sshAlgoED25519 = "ssh-ed25519"
+)
+
+// validateSSHKeyType checks the requested key type and size
+func validateSSHKeyType(keyType string, bits int) error {
+	switch keyType {
+	case SSHKeyTypeRSA:
+		if bits < 2048 || bits > 8192 {
+			return fmt.Errorf("Invalid RSA key size %d. Please select a size between 2048 and 8192 bits", bits)
+		}
+	case SSHKeyTypeED25519:
+	default:
+		return fmt.Errorf("Invalid ssh key type '%s'. Please select one of '%s', '%s'", keyType, SSHKeyTypeRSA, SSHKeyTypeED25519)
+	}
+	return nil
+}
+
+// generateSSHKey generates a key pair of the requested type at path, and its
+// public key in authorized_keys format at path.pub. Existing keys are kept
+func generateSSHKey(path, keyType string, bits int) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	var private *pem.Block
+	var public []byte
+	switch keyType {
+	case SSHKeyTypeED25519:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return fmt.Errorf("Error generating key pair: %s", err)
+		}
+		private, public = marshalED25519(pub, priv)
+	default:
+		priv, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return fmt.Errorf("Error generating key pair: %s", err)
+		}
+		pub, err := gossh.NewPublicKey(&priv.PublicKey)
+		if err != nil {
+			return fmt.Errorf("Error generating key pair: %s", err)
+		}
+		private = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}
+		public = gossh.MarshalAuthorizedKey(pub)
+	}
+
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(private), 0600); err != nil {
+		return fmt.Errorf("Error writing keys to file(s): %s", err)
+	}
+	if err := ioutil.WriteFile(path+".pub", public, 0600); err != nil {
+		return fmt.Errorf("Error writing keys to file(s): %s", err)
+	}
+	return nil
+}
+
+// marshalED25519 encodes an ed25519 key pair in the OpenSSH formats, as the
+// vendored ssh package predates ed25519 support
+func marshalED25519(pub ed25519.PublicKey, priv ed25519.PrivateKey) (*pem.Block, []byte) {
+	publicBlob := sshString(nil, []byte(sshAlgoED25519))
+	publicBlob = sshString(publicBlob, pub)
+
+	check := make([]byte, 4)
+	rand.Read(check)
+	privateBlob := append(append([]byte{}, check...), check...)
+	privateBlob = sshString(privateBlob, []byte(sshAlgoED25519))
+	privateBlob = sshString(privateBlob, pub)
+	privateBlob = sshString(privateBlob, priv)
+	privateBlob = sshString(privateBlob, nil)
+	for i := byte(1); len(privateBlob)%8 != 0; i++ {
+		privateBlob = append(privateBlob, i)
+	}
+
+	key := append([]byte("openssh-key-v1"), 0)
+	key = sshString(key, []byte("none"))
+	key = sshString(key, []byte("none"))
+	key = sshString(key, nil)
+	key = binary.BigEndian.AppendUint32(key, 1)
+	key = sshString(key, publicBlob)
+	key = sshString(key, privateBlob)
+
+	authorized := sshAlgoED25519 + " " + base64.StdEncoding.EncodeToString(publicBlob) + "\n"
+	return &pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: key}, []byte(authorized)
+}
+
+// sshString appends a length prefixed string, as defined by RFC 4251
+func sshString(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// findSshkeyByContent returns the key of keys holding the same public key as
+// publicKey, in authorized_keys format, whatever its name. Keys are compared
+// by key blob, or by MD5 fingerprint when the API does not return the key
+func findSshkeyByContent(keys Sshkeys, publicKey string) *Sshkey {
+	blob := authorizedKeyBlob(publicKey)
+	if blob == nil {
+		return nil
+	}
+	sum := md5.Sum(blob)
+	fingerprint := fmt.Sprintf("% x", sum[:])
+	fingerprint = strings.Replace(fingerprint, " ", ":", -1)
+
+	for i, key := range keys {
+		if other := authorizedKeyBlob(key.PublicKey); other != nil && bytes.Equal(other, blob) {
+			return &keys[i]
+		}
+		if strings.EqualFold(strings.TrimPrefix(key.Fingerprint, "MD5:"), fingerprint) {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+// authorizedKeyBlob decodes the key blob of an authorized_keys line, nil if
+// it is not one
+func authorizedKeyBlob(line string) []byte {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil
+	}
+	return blob
+}
+
+// sshKeyName returns the name of the project key of the machine, which OVH
+// also gives to its OpenStack keypair
+func (d *Driver) sshKeyName() string {
+	if d.ReusedKeyPair != "" {
+		return d.ReusedKeyPair
+	}
+	return d.KeyPairName
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+var validUserName = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// runtimeUserScript creates the runtime user with the authorized keys of the
+// provisioning user. The runtime user gets passwordless sudo, which
+// docker-machine needs for the later provisioning commands such as
+// regenerate-certs, and which logs what it runs, but not the docker group,
+// which grants the same rights unaudited
+const runtimeUserScript = `set -e
+id -u %[1]s >/dev/null 2>&1 || sudo useradd --create-home --shell /bin/bash %[1]s
+sudo passwd -l %[1]s >/dev/null
+echo '%[1]s ALL=(ALL) NOPASSWD:ALL' | sudo tee /etc/sudoers.d/90-ovh-%[1]s >/dev/null
+sudo chmod 440 /etc/sudoers.d/90-ovh-%[1]s
+sudo install -d -m 700 -o %[1]s -g %[1]s /home/%[1]s/.ssh
+sudo install -m 600 -o %[1]s -g %[1]s ~/.ssh/authorized_keys /home/%[1]s/.ssh/authorized_keys
+`
+
+// removeRuntimeUserScript undoes runtimeUserScript, from the provisioning user
+const removeRuntimeUserScript = `sudo rm -f /etc/sudoers.d/90-ovh-%[1]s
+sudo userdel -r %[1]s 2>/dev/null || true
+`
+
+// lockUserScript disables the provisioning user, from the runtime user, as a
+// single step: its key and sudoers drop-in are set aside, so that
+// unlockUserScript restores them
+const lockUserScript = `sudo sh -e -c '
+usermod --expiredate 1 --shell /usr/sbin/nologin %[1]s
+if [ -f /etc/sudoers.d/90-cloud-init-users ]; then mv /etc/sudoers.d/90-cloud-init-users /root/.ovh-90-cloud-init-users; fi
+if [ -f /home/%[1]s/.ssh/authorized_keys ]; then mv /home/%[1]s/.ssh/authorized_keys /home/%[1]s/.ssh/authorized_keys.ovh-disabled; fi
+'
+`
+
+// unlockUserScript undoes lockUserScript, from the runtime user
+const unlockUserScript = `sudo sh -c '
+usermod --expiredate "" --shell /bin/bash %[1]s
+if [ -f /root/.ovh-90-cloud-init-users ]; then mv /root/.ovh-90-cloud-init-users /etc/sudoers.d/90-cloud-init-users; fi
+if [ -f /home/%[1]s/.ssh/authorized_keys.ovh-disabled ]; then mv /home/%[1]s/.ssh/authorized_keys.ovh-disabled /home/%[1]s/.ssh/authorized_keys; fi
+'
+`
+
+// validateRuntimeSSHUser checks the runtime user name
+func (d *Driver) validateRuntimeSSHUser() error {
+	if d.RuntimeSSHUser == "" {
+		return nil
+	}
+	if !validUserName.MatchString(d.RuntimeSSHUser) {
+		return fmt.Errorf("Invalid runtime ssh user '%s'. Expected a lowercase user name", d.RuntimeSSHUser)
+	}
+	if d.RuntimeSSHUser == d.SSHUser || d.RuntimeSSHUser == "root" {
+		return fmt.Errorf("Runtime ssh user must differ from the provisioning user '%s' and root", d.SSHUser)
+	}
+	return nil
+}
+
+// switchSSHUser creates the runtime user, switches the driver to it and
+// disables the image default user. It runs once docker-machine provisioned
+// the machine with the default user, and either completes or leaves the
+// machine with the default user only
+func (d *Driver) switchSSHUser() error {
+	if d.RuntimeSSHUser == "" {
+		return fmt.Errorf("Machine %s has no runtime ssh user. Please select one with '--ovh-runtime-ssh-user' on create", d.MachineName)
+	}
+	if d.SSHUser == d.RuntimeSSHUser {
+		log.Infof("Machine %s already uses ssh user %s", d.MachineName, d.SSHUser)
+		return nil
+	}
+
+	provisioningUser := d.SSHUser
+	log.Infof("Switching ssh user of %s from %s to %s...", d.MachineName, provisioningUser, d.RuntimeSSHUser)
+	removeRuntimeUser := func() {
+		d.SSHUser = provisioningUser
+		if _, err := drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(removeRuntimeUserScript, d.RuntimeSSHUser)); err != nil {
+			log.Warnf("Could not remove runtime ssh user %s: %s", d.RuntimeSSHUser, err)
+		}
+	}
+
+	_, err := drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(runtimeUserScript, d.RuntimeSSHUser))
+	if err != nil {
+		removeRuntimeUser()
+		return fmt.Errorf("Could not create runtime ssh user %s: %s", d.RuntimeSSHUser, err)
+	}
+
+	// Lock the provisioning user only once the runtime user works
+	d.SSHUser = d.RuntimeSSHUser
+	_, err = drivers.RunSSHCommandFromDriver(d, "sudo -n true")
+	if err != nil {
+		removeRuntimeUser()
+		return fmt.Errorf("Runtime ssh user %s cannot connect and run sudo: %s", d.RuntimeSSHUser, err)
+	}
+	_, err = drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(lockUserScript, provisioningUser))
+	if err != nil {
+		if _, unlockErr := drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(unlockUserScript, provisioningUser)); unlockErr != nil {
+			return fmt.Errorf("Could not disable provisioning ssh user %s: %s. Restoring it failed too, the machine keeps ssh user %s: %s", provisioningUser, err, d.RuntimeSSHUser, unlockErr)
+		}
+		removeRuntimeUser()
+		return fmt.Errorf("Could not disable provisioning ssh user %s: %s", provisioningUser, err)
+	}
+	d.updateSSHConfig()
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// StatsPeriod is the monitoring period of the usage statistics
+const StatsPeriod = "today"
+
+// diskUsageCommand prints the size and used space of the root filesystem, in KB
+const diskUsageCommand = `df -P -k / | awk 'NR == 2 {print $2, $3}'`
+
+// usage summarizes a monitoring metric over the period
+type usage struct {
+	last    float64
+	average float64
+	unit    string
+}
+
+// metricUsage fetches a metric of the instance, nil when it has no value
+func (d *Driver) metricUsage(client *API, metric string) (*usage, error) {
+	monitoring, err := client.GetInstanceMonitoring(d.ProjectID, d.InstanceID, StatsPeriod, metric)
+	if err != nil {
+		return nil, err
+	}
+	if monitoring == nil || len(monitoring.Values) == 0 {
+		return nil, nil
+	}
+
+	u := &usage{unit: monitoring.Unit}
+	for _, value := range monitoring.Values {
+		u.average += value.Value
+	}
+	u.average /= float64(len(monitoring.Values))
+	u.last = monitoring.Values[len(monitoring.Values)-1].Value
+	return u, nil
+}
+
+// logStatistics prints the CPU and memory usage reported by the OVH
+// monitoring, and the disk usage read on the machine
+func (d *Driver) logStatistics(client *API) {
+	var lines []string
+	for _, metric := range []struct{ name, used, max string }{
+		{"CPU", "cpu:used", "cpu:max"},
+		{"Memory", "mem:used", "mem:max"},
+	} {
+		used, err := d.metricUsage(client, metric.used)
+		if err != nil {
+			log.Warnf("Could not get %s usage of machine %s: %s", metric.name, d.MachineName, err)
+			continue
+		}
+		if used == nil {
+			lines = append(lines, fmt.Sprintf("%s: no data", metric.name))
+			continue
+		}
+		line := fmt.Sprintf("%s: %.1f %s (average %.1f %s)", metric.name, used.last, used.unit, used.average, used.unit)
+		if max, err := d.metricUsage(client, metric.max); err == nil && max != nil && max.last > 0 && max.unit == used.unit {
+			line += fmt.Sprintf(" of %.1f %s, %.0f%%", max.last, max.unit, 100*used.last/max.last)
+		}
+		lines = append(lines, line)
+	}
+
+	output, err := drivers.RunSSHCommandFromDriver(d, diskUsageCommand)
+	var sizeKB, usedKB int64
+	if err == nil {
+		_, err = fmt.Sscan(output, &sizeKB, &usedKB)
+	}
+	if err != nil || sizeKB == 0 {
+		log.Warnf("Could not get disk usage of machine %s: %v", d.MachineName, err)
+	} else {
+		lines = append(lines, fmt.Sprintf("Disk: %s used of %s, %.0f%%", formatKB(usedKB), formatKB(sizeKB), 100*float64(usedKB)/float64(sizeKB)))
+	}
+
+	log.Infof("Usage of machine %s (%s):\n  %s", d.MachineName, StatsPeriod, strings.Join(lines, "\n  "))
+}
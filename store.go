@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// storedMachine is the part of a machine configuration saved by docker-machine
+// that is relevant to this driver
+type storedMachine struct {
+	Name       string
+	DriverName string
+	Driver     *Driver
+}
+
+// storedMachines returns the configuration of the other OVH machines found in
+// the docker-machine store. Unreadable machines are skipped
+func (d *Driver) storedMachines() ([]*Driver, error) {
+	paths, err := filepath.Glob(filepath.Join(d.StorePath, "machines", "*", "config.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var machines []*Driver
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Debugf("Skipping machine %s: %s", path, err)
+			continue
+		}
+
+		var machine storedMachine
+		if err := json.Unmarshal(data, &machine); err != nil {
+			log.Debugf("Skipping machine %s: %s", path, err)
+			continue
+		}
+
+		if machine.DriverName != "ovh" || machine.Driver == nil || machine.Driver.BaseDriver == nil || machine.Name == d.MachineName {
+			continue
+		}
+		machines = append(machines, machine.Driver)
+	}
+
+	return machines, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// fixSudoersScript grants passwordless sudo to the ssh user on first boot,
+// validating the drop-in before installing it
+const fixSudoersScript = `# Grant passwordless sudo to %[1]s
+echo '%[1]s ALL=(ALL) NOPASSWD:ALL' > /tmp/90-ovh-sudo-%[1]s
+if visudo -cf /tmp/90-ovh-sudo-%[1]s >/dev/null; then
+	install -m 440 /tmp/90-ovh-sudo-%[1]s /etc/sudoers.d/90-ovh-sudo-%[1]s
+fi
+rm -f /tmp/90-ovh-sudo-%[1]s
+`
+
+// sudoDiagnosisScript reports why the ssh user cannot use sudo
+const sudoDiagnosisScript = `id
+command -v sudo >/dev/null || { echo "sudo is not installed"; exit 0; }
+sudo -n -l 2>&1 | head -20
+grep -s '^#includedir\|^@includedir' /etc/sudoers || echo "/etc/sudoers does not include /etc/sudoers.d"
+`
+
+// fixSudoersUserData returns the first boot script section granting
+// passwordless sudo to the ssh user
+func (d *Driver) fixSudoersUserData() string {
+	if !d.FixSudoers || d.SSHUser == "root" {
+		return ""
+	}
+	return fmt.Sprintf(fixSudoersScript, d.SSHUser)
+}
+
+// checkSudo checks that the ssh user runs sudo without a password, as
+// docker-machine provisioning otherwise hangs on the password prompt
+func (d *Driver) checkSudo() error {
+	if d.SSHUser == "root" {
+		return nil
+	}
+
+	log.Debugf("Checking passwordless sudo for %s...", d.SSHUser)
+	_, err := drivers.RunSSHCommandFromDriver(d, "sudo -n true")
+	if err == nil {
+		return nil
+	}
+
+	diagnosis, _ := drivers.RunSSHCommandFromDriver(d, sudoDiagnosisScript)
+	msg := fmt.Sprintf("User %s of image %s cannot run sudo without a password, which docker-machine needs to provision the engine:\n%s", d.SSHUser, d.ImageID, strings.TrimSpace(diagnosis))
+	if d.FixSudoers {
+		return fmt.Errorf("%s\nThe sudoers drop-in of '--ovh-fix-sudoers' did not apply, please check /var/log/cloud-init-output.log", msg)
+	}
+	return fmt.Errorf("%s\nPlease select '--ovh-fix-sudoers' to grant it on first boot", msg)
+}
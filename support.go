@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// queryIDHeader identifies a call in OVH logs, support asks for it
+const queryIDHeader = "X-Ovh-QueryId"
+
+// queryIDTransport records the query id and status code of each API response
+type queryIDTransport struct {
+	base http.RoundTripper
+	api  *API
+}
+
+// RoundTrip performs the request and records its query id and status code
+func (t *queryIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if resp != nil {
+		t.api.queryIDMutex.Lock()
+		if id := resp.Header.Get(queryIDHeader); id != "" {
+			t.api.lastQueryID = id
+		}
+		t.api.lastStatus = resp.StatusCode
+		t.api.queryIDMutex.Unlock()
+	}
+	return resp, err
+}
+
+// trackQueryIDs records the query ids of the responses received by client
+func (a *API) trackQueryIDs(client *http.Client) {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &queryIDTransport{base: base, api: a}
+}
+
+// LastQueryID returns the query id of the last API response
+func (a *API) LastQueryID() string {
+	a.queryIDMutex.Lock()
+	defer a.queryIDMutex.Unlock()
+	return a.lastQueryID
+}
+
+// lastStatusCode returns the status code of the last API response
+func (a *API) lastStatusCode() int {
+	a.queryIDMutex.Lock()
+	defer a.queryIDMutex.Unlock()
+	return a.lastStatus
+}
+
+// supportError adds the references OVH support asks for to an error: the
+// service name, which is the project id, the instance id and the last query
+// id, along with the endpoint as machines may use different accounts
+func (d *Driver) supportError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var refs []string
+	if endpoint := endpointURL(d.Endpoint); endpoint != "" {
+		refs = append(refs, "endpoint: "+endpoint)
+	}
+	if d.ProjectID != "" {
+		refs = append(refs, "service: "+d.ProjectID)
+	}
+	if d.InstanceID != "" {
+		refs = append(refs, "instance: "+d.InstanceID)
+	}
+	if d.client != nil {
+		if id := d.client.LastQueryID(); id != "" {
+			refs = append(refs, "query id: "+id)
+		}
+	}
+
+	if len(refs) == 0 {
+		return err
+	}
+	return fmt.Errorf("%s (%s)", err, strings.Join(refs, ", "))
+}
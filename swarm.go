@@ -0,0 +1,6 @@
+package main
+
+// isSwarmNode tells whether the machine takes part in a Swarm cluster
+func (d *Driver) isSwarmNode() bool {
+	return d.SwarmMaster || d.SwarmDiscovery != ""
+}
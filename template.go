@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// DefaultTemplateContainer is the object storage container holding the
+// templates of a project
+const DefaultTemplateContainer = "docker-machine-templates"
+
+// loadTemplate fetches a template from the object storage of the project.
+// Templates are profiles shared by the project: options given on the command
+// line or in a profile file take precedence over them
+func (d *Driver) loadTemplate(flags drivers.DriverOptions, name string) (*profileOptions, error) {
+	// The template lives in the project, which cannot come from the template
+	d.ApplicationKey = flags.String("ovh-application-key")
+	d.ApplicationSecret = flags.String("ovh-application-secret")
+	d.ConsumerKey = flags.String("ovh-consumer-key")
+	d.Endpoint = flags.String("ovh-endpoint")
+	d.APITimeout = flags.Int("ovh-api-timeout")
+	d.PollEndpoint = flags.String("ovh-polling-endpoint")
+	d.ProjectName = flags.String("ovh-project")
+
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	err = d.resolveProject(client)
+	if err != nil {
+		return nil, err
+	}
+	// Connection settings may still change with the template
+	d.client = nil
+
+	o, err := d.openStack("'--ovh-template'")
+	if err != nil {
+		return nil, err
+	}
+
+	container := flags.String("ovh-template-container")
+	endpoints := o.endpoints("object-store")
+	var regions []string
+	for region := range endpoints {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	for _, region := range regions {
+		var data []byte
+		_, err := o.call("GET", endpoints[region]+"/"+url.PathEscape(container)+"/"+url.PathEscape(name), nil, &data)
+		if apierror, ok := err.(*openStackError); ok && apierror.Code == 404 {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not fetch template %s: %s", name, err)
+		}
+
+		p, err := d.parseProfile(flags, name, data)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid template %s: %s", name, err)
+		}
+		log.Infof("Using template %s from container %s in region %s", name, container, region)
+		return p, nil
+	}
+	return nil, fmt.Errorf("Template %s not found in object storage container %s of the project", name, container)
+}
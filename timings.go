@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// CreateTimingsName is the name of the history of create durations, in the
+// machine store. It is shared by all machines so that it outlives them
+const CreateTimingsName = "ovh-create-times.jsonl"
+
+// createTiming is a line of the create history: the duration of each create
+// phase, in seconds, of a create run from scratch
+type createTiming struct {
+	Time     string             `json:"time"`
+	Machine  string             `json:"machine"`
+	Region   string             `json:"region"`
+	Flavor   string             `json:"flavor"`
+	WarmPool bool               `json:"warmPool,omitempty"`
+	Phases   map[string]float64 `json:"phases"`
+	Total    float64            `json:"total"`
+}
+
+// startTiming starts timing a create run. Resumed creates are not timed, as
+// their first phases ran in another run
+func (d *Driver) startTiming() {
+	if d.CreatePhase != "" {
+		return
+	}
+	d.phaseStarted = time.Now()
+	d.phaseDurations = make(map[string]float64)
+}
+
+// timePhase records the duration of the phase completed by the checkpoint.
+// Phases run again, as when an instance is replaced, add up
+func (d *Driver) timePhase(phase string) {
+	if d.phaseDurations == nil || phase == d.CreatePhase {
+		return
+	}
+	now := time.Now()
+	d.phaseDurations[phase] += now.Sub(d.phaseStarted).Seconds()
+	d.phaseStarted = now
+}
+
+// recordTiming appends the phase durations of the create run to the history.
+// It runs when the driver hands the machine over to docker-machine, so the
+// engine provisioning that follows is not part of the durations
+func (d *Driver) recordTiming(claimed bool) {
+	if d.phaseDurations == nil || d.StorePath == "" {
+		return
+	}
+	timing := createTiming{
+		Time:     time.Now().UTC().Format(time.RFC3339),
+		Machine:  d.MachineName,
+		Region:   d.RegionName,
+		Flavor:   d.FlavorName,
+		WarmPool: claimed,
+		Phases:   d.phaseDurations,
+	}
+	for phase, duration := range d.phaseDurations {
+		d.phaseDurations[phase] = math.Round(duration*10) / 10
+		timing.Total += d.phaseDurations[phase]
+	}
+	d.phaseDurations = nil
+
+	line, err := json.Marshal(timing)
+	if err == nil {
+		var f *os.File
+		f, err = os.OpenFile(filepath.Join(d.StorePath, CreateTimingsName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = f.Write(append(line, '\n'))
+			f.Close()
+		}
+	}
+	if err != nil {
+		log.Warnf("Could not record the create duration of machine %s: %s", d.MachineName, err)
+	}
+}
+
+// percentile returns the nearest rank percentile of sorted values
+func percentile(values []float64, p float64) float64 {
+	rank := int(math.Ceil(p/100*float64(len(values)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return values[rank]
+}
+
+// logStoreCreateTimes prints the p50 and p95 create durations of the history
+// of the store, by region and flavor, with the p50 of each phase. Creates from
+// the warm pool are summarized apart, as they skip the build
+func logStoreCreateTimes(storePath string) error {
+	f, err := os.Open(filepath.Join(storePath, CreateTimingsName))
+	if os.IsNotExist(err) {
+		log.Infof("No create duration recorded yet in %s", storePath)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	totals := make(map[string][]float64)
+	phases := make(map[string]map[string][]float64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var timing createTiming
+		if err := json.Unmarshal(scanner.Bytes(), &timing); err != nil {
+			log.Debugf("Skipping create duration %q: %s", scanner.Text(), err)
+			continue
+		}
+		key := fmt.Sprintf("%s %s", timing.Region, timing.Flavor)
+		if timing.WarmPool {
+			key += " (warm pool)"
+		}
+		totals[key] = append(totals[key], timing.Total)
+		if phases[key] == nil {
+			phases[key] = make(map[string][]float64)
+		}
+		for phase, duration := range timing.Phases {
+			phases[key][phase] = append(phases[key][phase], duration)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	var keys []string
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var lines []string
+	for _, key := range keys {
+		sort.Float64s(totals[key])
+		line := fmt.Sprintf("%s: %d creates, p50 %.0fs, p95 %.0fs", key, len(totals[key]), percentile(totals[key], 50), percentile(totals[key], 95))
+		var details []string
+		for _, phase := range createPhases {
+			if durations := phases[key][phase]; len(durations) > 0 {
+				sort.Float64s(durations)
+				details = append(details, fmt.Sprintf("%s %.0fs", phase, percentile(durations, 50)))
+			}
+		}
+		lines = append(lines, line+" ("+strings.Join(details, ", ")+")")
+	}
+	log.Infof("Create durations by region and flavor, up to SSH ready, p50 by phase:\n  %s", strings.Join(lines, "\n  "))
+	return nil
+}
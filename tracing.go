@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Tracing follows the OpenTelemetry conventions: spans are exported with the
+// OTLP/HTTP JSON encoding when OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set, and join the trace of the
+// calling pipeline when it passes a W3C TRACEPARENT
+const (
+	tracerName         = "docker-machine-driver-ovh"
+	traceExportTimeout = 5 * time.Second
+
+	spanKindInternal = 1
+	spanKindClient   = 3
+
+	spanStatusOK    = 1
+	spanStatusError = 2
+)
+
+// span is a traced operation
+type span struct {
+	name       string
+	kind       int
+	traceID    string
+	spanID     string
+	parentID   string
+	start      time.Time
+	attributes map[string]interface{}
+	parent     *span
+}
+
+// tracer collects the spans of driver operations, and exports them once the
+// outermost one ends
+type tracer struct {
+	mutex    sync.Mutex
+	endpoint string
+	headers  map[string]string
+	active   *span
+	ended    []map[string]interface{}
+}
+
+var defaultTracer = newTracer()
+
+// newTracer configures tracing from the OpenTelemetry environment variables,
+// it is disabled when no endpoint is set
+func newTracer() *tracer {
+	t := &tracer{endpoint: os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")}
+	if t.endpoint == "" {
+		if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+			t.endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+		}
+	}
+
+	t.headers = make(map[string]string)
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if parts := strings.SplitN(header, "=", 2); len(parts) == 2 {
+			t.headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return t
+}
+
+// startSpan starts a span, child of the active one, or of the pipeline
+// TRACEPARENT for the outermost one. It returns nil when tracing is disabled
+func startSpan(name string, kind int, attributes map[string]interface{}) *span {
+	t := defaultTracer
+	if t.endpoint == "" {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	s := &span{
+		name:       name,
+		kind:       kind,
+		spanID:     randomHex(8),
+		start:      time.Now(),
+		attributes: attributes,
+		parent:     t.active,
+	}
+	if t.active != nil {
+		s.traceID = t.active.traceID
+		s.parentID = t.active.spanID
+	} else if parts := strings.Split(os.Getenv("TRACEPARENT"), "-"); len(parts) == 4 && len(parts[1]) == 32 && len(parts[2]) == 16 {
+		s.traceID = parts[1]
+		s.parentID = parts[2]
+	} else {
+		s.traceID = randomHex(16)
+	}
+
+	// Client spans are leaves, possibly concurrent, they never become active
+	if kind != spanKindClient {
+		t.active = s
+	}
+	return s
+}
+
+// end ends the span with the outcome of the operation, and exports the spans
+// when it is the outermost one
+func (s *span) end(err error) {
+	if s == nil {
+		return
+	}
+	t := defaultTracer
+
+	status := map[string]interface{}{"code": spanStatusOK}
+	if err != nil {
+		status = map[string]interface{}{"code": spanStatusError, "message": err.Error()}
+	}
+
+	var attributes []map[string]interface{}
+	for key, value := range s.attributes {
+		attributes = append(attributes, otlpAttribute(key, value))
+	}
+
+	exported := map[string]interface{}{
+		"traceId":           s.traceID,
+		"spanId":            s.spanID,
+		"name":              s.name,
+		"kind":              s.kind,
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(time.Now().UnixNano(), 10),
+		"attributes":        attributes,
+		"status":            status,
+	}
+	if s.parentID != "" {
+		exported["parentSpanId"] = s.parentID
+	}
+
+	t.mutex.Lock()
+	t.ended = append(t.ended, exported)
+	var spans []map[string]interface{}
+	if t.active == s {
+		t.active = s.parent
+	}
+	if t.active == nil {
+		spans, t.ended = t.ended, nil
+	}
+	t.mutex.Unlock()
+
+	if spans != nil {
+		t.export(spans)
+	}
+}
+
+// export sends spans to the collector. Failures are only reported, tracing
+// never fails an operation
+func (t *tracer) export(spans []map[string]interface{}) {
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = tracerName
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []interface{}{otlpAttribute("service.name", serviceName)},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": tracerName},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		log.Debugf("Could not export traces: %s", err)
+		return
+	}
+
+	req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		log.Debugf("Could not export traces: %s", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{Timeout: traceExportTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Debugf("Could not export traces: %s", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Debugf("Could not export traces: collector answered %s", resp.Status)
+	}
+}
+
+// traceOperation starts the span of a driver operation
+func (d *Driver) traceOperation(name string) *span {
+	attributes := map[string]interface{}{"docker.machine.name": d.MachineName}
+	if d.ProjectID != "" {
+		attributes["ovh.service"] = d.ProjectID
+	}
+	if d.InstanceID != "" {
+		attributes["ovh.instance"] = d.InstanceID
+	}
+	return startSpan(name, spanKindInternal, attributes)
+}
+
+// otlpAttribute encodes an attribute as an OTLP key value
+func otlpAttribute(key string, value interface{}) map[string]interface{} {
+	var encoded map[string]interface{}
+	switch v := value.(type) {
+	case int:
+		encoded = map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case bool:
+		encoded = map[string]interface{}{"boolValue": v}
+	default:
+		encoded = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+	return map[string]interface{}{"key": key, "value": encoded}
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tracingTransport records a client span for each API call
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip performs the request within a client span
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s := startSpan(req.Method+" "+req.URL.Path, spanKindClient, map[string]interface{}{
+		"http.request.method": req.Method,
+		"url.full":            req.URL.String(),
+		"server.address":      req.URL.Host,
+	})
+
+	resp, err := t.base.RoundTrip(req)
+	spanErr := err
+	if s != nil && resp != nil {
+		s.attributes["http.response.status_code"] = resp.StatusCode
+		if id := resp.Header.Get(queryIDHeader); id != "" {
+			s.attributes["ovh.query_id"] = id
+		}
+		if resp.StatusCode >= 400 {
+			spanErr = fmt.Errorf("%s", resp.Status)
+		}
+	}
+	s.end(spanErr)
+	return resp, err
+}
+
+// traceCalls records a client span for each call of client, when tracing is
+// enabled
+func traceCalls(client *http.Client) {
+	if defaultTracer.endpoint == "" {
+		return
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &tracingTransport{base: base}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// tuningProfile is a set of kernel settings recommended for a container host
+type tuningProfile struct {
+	modules     []string
+	sysctls     []string
+	disableSwap bool
+}
+
+// tuningProfiles are the profiles selectable with --ovh-tuning-profile
+var tuningProfiles = map[string]tuningProfile{
+	"none": {},
+	"swarm": {
+		modules: []string{"br_netfilter", "overlay"},
+		sysctls: []string{
+			"net.ipv4.ip_forward = 1",
+			"net.bridge.bridge-nf-call-iptables = 1",
+			"net.netfilter.nf_conntrack_max = 262144",
+			"fs.inotify.max_user_watches = 524288",
+			"fs.inotify.max_user_instances = 512",
+			"vm.max_map_count = 262144",
+		},
+	},
+	"k8s": {
+		modules: []string{"br_netfilter", "overlay"},
+		sysctls: []string{
+			"net.ipv4.ip_forward = 1",
+			"net.bridge.bridge-nf-call-iptables = 1",
+			"net.bridge.bridge-nf-call-ip6tables = 1",
+			"net.netfilter.nf_conntrack_max = 1048576",
+			"fs.inotify.max_user_watches = 1048576",
+			"fs.inotify.max_user_instances = 8192",
+			"vm.max_map_count = 262144",
+			"kernel.panic = 10",
+			"kernel.panic_on_oops = 1",
+		},
+		disableSwap: true,
+	},
+}
+
+// tuningScript loads kernel modules, applies sysctls on every boot and
+// optionally disables swap
+const tuningScript = `# Apply %[1]s tuning profile
+cat > /etc/modules-load.d/99-ovh-%[1]s.conf <<'EOF'
+%[2]s
+EOF
+for MODULE in %[3]s; do modprobe "$MODULE" || true; done
+cat > /etc/sysctl.d/99-ovh-%[1]s.conf <<'EOF'
+%[4]s
+EOF
+sysctl --system >/dev/null
+`
+
+// disableSwapScript turns swap off, now and for next boots
+const disableSwapScript = `swapoff -a
+sed -i '/\sswap\s/s/^/#/' /etc/fstab
+`
+
+// validateTuningProfile checks the requested tuning profile exists
+func validateTuningProfile(name string) error {
+	if _, ok := tuningProfiles[name]; ok {
+		return nil
+	}
+
+	var names []string
+	for name := range tuningProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("Invalid tuning profile '%s'. Please select one of '%s'", name, strings.Join(names, "', '"))
+}
+
+// tuningUserData returns the first boot script section applying the tuning profile
+func (d *Driver) tuningUserData() string {
+	profile := tuningProfiles[d.TuningProfile]
+	if len(profile.sysctls) == 0 {
+		return ""
+	}
+
+	script := fmt.Sprintf(tuningScript, d.TuningProfile,
+		strings.Join(profile.modules, "\n"),
+		strings.Join(profile.modules, " "),
+		strings.Join(profile.sysctls, "\n"))
+	if profile.disableSwap {
+		script += disableSwapScript
+	}
+	return script
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// userDataHeader starts the first boot script passed to cloud-init
+const userDataHeader = `#!/bin/sh
+# Generated by docker-machine-driver-ovh
+set -e
+`
+
+// privateMTUScript configures the MTU of the private network interfaces, with
+// DHCP, and persists it with netplan or ifupdown
+const privateMTUScript = `# Configure private network MTU
+%[2]sfor IF in $PRIVATE_IFS; do
+	ip link set dev "$IF" mtu %[1]d
+	if [ -d /etc/netplan ]; then
+		cat > /etc/netplan/99-ovh-private-$IF.yaml <<EOF
+network:
+  version: 2
+  ethernets:
+    $IF:
+      dhcp4: true
+      mtu: %[1]d
+EOF
+	else
+		cat > /etc/network/interfaces.d/99-ovh-private-$IF.cfg <<EOF
+auto $IF
+iface $IF inet dhcp
+	mtu %[1]d
+EOF
+	fi
+done
+[ -d /etc/netplan ] && netplan apply || true
+`
+
+// dockerDaemonConfigScript writes the docker engine configuration file
+const dockerDaemonConfigScript = `# Configure docker engine
+mkdir -p /etc/docker
+cat > /etc/docker/daemon.json <<'EOF'
+%s
+EOF
+`
+
+// waitForUserDataScript waits until cloud-init is done with first boot
+const waitForUserDataScript = `for i in $(seq 150); do
+	[ -f /var/lib/cloud/instance/boot-finished ] && exit 0
+	sleep 2
+done
+echo "Timed out waiting for cloud-init" >&2
+exit 1
+`
+
+// userData returns the first boot script for the instance, empty if none is needed
+func (d *Driver) userData() string {
+	var sections []string
+
+	if sudoers := d.fixSudoersUserData(); sudoers != "" {
+		sections = append(sections, sudoers)
+	}
+
+	if password := d.rootPasswordUserData(); password != "" {
+		sections = append(sections, password)
+	}
+
+	if keys := d.authorizedKeysUserData(); keys != "" {
+		sections = append(sections, keys)
+	}
+
+	if grow := d.growRootUserData(); grow != "" {
+		sections = append(sections, grow)
+	}
+
+	if d.PrivateMTU > 0 {
+		sections = append(sections, fmt.Sprintf(privateMTUScript, d.PrivateMTU, d.privateInterfaces()))
+	}
+
+	if route := d.defaultRouteUserData(); route != "" {
+		sections = append(sections, route)
+	}
+
+	if egress := d.egressLimitUserData(); egress != "" {
+		sections = append(sections, egress)
+	}
+
+	if harden := d.hardenUserData(); harden != "" {
+		sections = append(sections, harden)
+	}
+
+	if tuning := d.tuningUserData(); tuning != "" {
+		sections = append(sections, tuning)
+	}
+
+	if env := d.engineEnvUserData(); env != "" {
+		sections = append(sections, env)
+	}
+
+	if registry := d.registryUserData(); registry != "" {
+		sections = append(sections, registry)
+	}
+
+	if config := d.dockerDaemonConfig(); len(config) > 0 {
+		content, _ := json.MarshalIndent(config, "", "  ")
+		sections = append(sections, fmt.Sprintf(dockerDaemonConfigScript, content))
+	}
+
+	if len(sections) == 0 {
+		return ""
+	}
+	return userDataHeader + strings.Join(sections, "\n")
+}
+
+// dockerDaemonConfig returns the docker engine settings to write in daemon.json
+func (d *Driver) dockerDaemonConfig() map[string]interface{} {
+	config := make(map[string]interface{})
+
+	if d.DockerMTU {
+		config["mtu"] = d.PrivateMTU
+	}
+
+	return config
+}
+
+// waitForUserData waits until the first boot script completed
+func (d *Driver) waitForUserData() error {
+	log.Debugf("Waiting for first boot configuration...", map[string]interface{}{"MachineID": d.InstanceID})
+
+	err := drivers.WaitForSSH(d)
+	if err != nil {
+		return err
+	}
+
+	_, err = drivers.RunSSHCommandFromDriver(d, waitForUserDataScript)
+	return err
+}
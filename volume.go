@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// DockerDataRoot is where the docker engine stores images and containers
+	DockerDataRoot = "/var/lib/docker"
+
+	dataVolumeType = "classic"
+)
+
+// mountDataVolumeScript formats the volume, unless it already holds a
+// filesystem, and mounts it on the docker data root. OpenStack exposes the
+// first 20 characters of the volume id in the device name. The fstab entry is
+// only added once, for the script to be run again on a resumed create.
+const mountDataVolumeScript = `set -e
+for i in $(seq 30); do
+	DEV=$(ls /dev/disk/by-id/*%[1]s* 2>/dev/null | head -n1)
+	[ -n "$DEV" ] && break
+	sleep 2
+done
+[ -n "$DEV" ] || { echo "Volume %[1]s not found" >&2; exit 1; }
+sudo blkid "$DEV" >/dev/null || sudo mkfs.ext4 -q "$DEV"
+sudo mkdir -p %[2]s
+UUID=$(sudo blkid -s UUID -o value "$DEV")
+grep -q "UUID=$UUID" /etc/fstab || echo "UUID=$UUID %[2]s ext4 defaults,nofail 0 2" | sudo tee -a /etc/fstab >/dev/null
+mountpoint -q %[2]s || sudo mount %[2]s
+`
+
+// setupDataVolume creates a volume, attaches it to the instance and mounts it
+// on the docker data root. A resumed create goes on with the volume of the
+// interrupted one
+func (d *Driver) setupDataVolume() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	if d.DataVolumeID == "" {
+		log.Infof("Creating %dGB docker data volume...", d.DataVolumeSize)
+		volume, err := client.CreateVolume(d.ProjectID, d.resourceName(d.MachineName+"-docker-data"), d.RegionName, dataVolumeType, d.DataVolumeSize)
+		if err != nil {
+			return err
+		}
+		d.DataVolumeID = volume.ID
+
+		// Record the volume at once, for remove to delete it
+		err = d.checkpoint(d.CreatePhase)
+		if err != nil {
+			return err
+		}
+	} else {
+		log.Infof("Resuming with docker data volume %s...", d.DataVolumeID)
+	}
+
+	volume, err := client.GetVolume(d.ProjectID, d.DataVolumeID)
+	if err != nil {
+		return err
+	}
+	if volume.Status == "in-use" {
+		if !containsString(volume.AttachedTo, d.InstanceID) {
+			return fmt.Errorf("Docker data volume %s is attached to another instance than %s", d.DataVolumeID, d.InstanceID)
+		}
+	} else {
+		err = d.waitForVolumeStatus("available")
+		if err != nil {
+			return err
+		}
+
+		log.Debugf("Attaching docker data volume...", map[string]interface{}{"VolumeID": d.DataVolumeID})
+		err = client.AttachVolume(d.ProjectID, d.DataVolumeID, d.InstanceID)
+		if err != nil {
+			return err
+		}
+
+		err = d.waitForVolumeStatus("in-use")
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Debugf("Mounting docker data volume...", map[string]interface{}{"VolumeID": d.DataVolumeID})
+	err = drivers.WaitForSSH(d)
+	if err != nil {
+		return err
+	}
+
+	deviceID := d.DataVolumeID
+	if len(deviceID) > 20 {
+		deviceID = deviceID[:20]
+	}
+	command := fmt.Sprintf(mountDataVolumeScript, deviceID, DockerDataRoot)
+	if d.VolumeEncrypt {
+		log.Infof("Encrypting docker data volume...")
+		command = d.encryptDataVolumeCommand(deviceID)
+	}
+	_, err = drivers.RunSSHCommandFromDriver(d, command)
+	if err != nil {
+		return err
+	}
+	d.DataVolumeMount = DockerDataRoot
+
+	return nil
+}
+
+// waitForVolumeStatus waits until the docker data volume reaches status
+func (d *Driver) waitForVolumeStatus(status string) error {
+	return waitWithBackoff(func() (bool, error) {
+		volume, err := d.client.GetVolume(d.ProjectID, d.DataVolumeID)
+		if isTransientError(err) {
+			return false, nil
+		}
+		if err != nil {
+			return true, err
+		}
+
+		if volume.Status == "error" {
+			return true, fmt.Errorf("Volume %s is in error state", d.DataVolumeID)
+		}
+
+		return volume.Status == status, nil
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	// dataVolumeMapper is the device mapper name of the unlocked volume
+	dataVolumeMapper = "ovh-docker-data"
+
+	// Location of the key on the machine, without a KMS
+	dataVolumeKeyDir  = "/etc/ovh-docker-data"
+	dataVolumeKeyFile = dataVolumeKeyDir + "/key"
+)
+
+// encryptDataVolumeScript installs a boot service unlocking the LUKS volume
+// and mounting it on the docker data root, before the docker engine starts.
+// The service formats the volume on its first run
+const encryptDataVolumeScript = `set -e
+for i in $(seq 30); do
+	DEV=$(ls /dev/disk/by-id/*%[1]s* 2>/dev/null | head -n1)
+	[ -n "$DEV" ] && break
+	sleep 2
+done
+[ -n "$DEV" ] || { echo "Volume %[1]s not found" >&2; exit 1; }
+if ! command -v cryptsetup >/dev/null; then
+	if command -v apt-get >/dev/null; then sudo DEBIAN_FRONTEND=noninteractive apt-get install -y -q cryptsetup; else sudo dnf install -y -q cryptsetup || sudo yum install -y -q cryptsetup; fi
+fi
+%[4]s
+sudo tee /usr/local/sbin/ovh-docker-data-unlock >/dev/null <<'EOF'
+#!/bin/sh
+set -e
+DEV=$(ls /dev/disk/by-id/*%[1]s* | head -n1)
+key() {
+	%[3]s
+}
+if ! cryptsetup isLuks "$DEV"; then
+	key | cryptsetup luksFormat -q --key-file=- "$DEV"
+	key | cryptsetup open --key-file=- "$DEV" %[5]s
+	mkfs.ext4 -q /dev/mapper/%[5]s
+elif [ ! -e /dev/mapper/%[5]s ]; then
+	key | cryptsetup open --key-file=- "$DEV" %[5]s
+fi
+mkdir -p %[2]s
+mountpoint -q %[2]s || mount /dev/mapper/%[5]s %[2]s
+EOF
+sudo chmod 700 /usr/local/sbin/ovh-docker-data-unlock
+sudo tee /etc/systemd/system/ovh-docker-data-unlock.service >/dev/null <<'EOF'
+[Unit]
+Description=Unlock and mount the docker data volume
+Wants=network-online.target
+After=network-online.target
+Before=docker.service
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/usr/local/sbin/ovh-docker-data-unlock
+
+[Install]
+WantedBy=multi-user.target
+EOF
+sudo mkdir -p /etc/systemd/system/docker.service.d
+printf '[Unit]\nRequires=ovh-docker-data-unlock.service\nAfter=ovh-docker-data-unlock.service\n' | sudo tee /etc/systemd/system/docker.service.d/ovh-docker-data.conf >/dev/null
+sudo systemctl daemon-reload
+sudo systemctl enable ovh-docker-data-unlock.service
+sudo systemctl start ovh-docker-data-unlock.service
+`
+
+// dataVolumeKeyCommands returns the command printing the volume key on the
+// machine, and the command storing the key there when it is kept in the
+// driver state. With a KMS, the key is fetched on every boot and never
+// stored on the machine
+func (d *Driver) dataVolumeKeyCommands() (keyCommand, storeCommand string) {
+	if d.VolumeKeyURL != "" {
+		return fmt.Sprintf("curl -fsS --retry 10 --retry-connrefused '%s'", d.VolumeKeyURL), ""
+	}
+	storeCommand = fmt.Sprintf("sudo mkdir -p -m 700 %s\necho '%s' | sudo tee %s >/dev/null\nsudo chmod 400 %s", dataVolumeKeyDir, d.DataVolumeKey, dataVolumeKeyFile, dataVolumeKeyFile)
+	return "cat " + dataVolumeKeyFile, storeCommand
+}
+
+// encryptDataVolumeCommand returns the script encrypting the docker data
+// volume with LUKS and mounting it. Without a KMS URL, the key is generated
+// and kept in the driver state
+func (d *Driver) encryptDataVolumeCommand(deviceID string) string {
+	if d.VolumeKeyURL == "" && d.DataVolumeKey == "" {
+		d.DataVolumeKey = randomHex(32)
+	}
+
+	keyCommand, storeCommand := d.dataVolumeKeyCommands()
+	return fmt.Sprintf(encryptDataVolumeScript, deviceID, DockerDataRoot, keyCommand, storeCommand, dataVolumeMapper)
+}
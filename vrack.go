@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/ovh/go-ovh/ovh"
+)
+
+// Vrack is the vRack a project is attached to
+type Vrack struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// VrackTask is an asynchronous task of a vRack
+type VrackTask struct {
+	ID       int    `json:"id"`
+	Function string `json:"function"`
+	Status   string `json:"status"`
+}
+
+// GetProjectVrack returns the vRack of a project, nil when it has none
+func (a *API) GetProjectVrack(projectID string) (vrack *Vrack, err error) {
+	err = a.get(fmt.Sprintf("/cloud/project/%s/vrack", projectID), &vrack)
+	if apierror, ok := err.(*ovh.APIError); ok && apierror.Code == 404 {
+		return nil, nil
+	}
+	return vrack, err
+}
+
+// GetVracks returns the service names of the vRacks of the account
+func (a *API) GetVracks() (vracks []string, err error) {
+	err = a.get("/vrack", &vracks)
+	return vracks, err
+}
+
+// AttachVrack attaches a project to a vRack
+func (a *API) AttachVrack(vrack, projectID string) (task *VrackTask, err error) {
+	url := fmt.Sprintf("/vrack/%s/cloudProject", vrack)
+	err = a.post(url, map[string]string{"project": projectID}, &task)
+	if err == nil && task == nil {
+		err = emptyResponseError(url)
+	}
+	return task, err
+}
+
+// GetVrackTask returns a task of a vRack, nil once it is over
+func (a *API) GetVrackTask(vrack string, taskID int) (task *VrackTask, err error) {
+	err = a.get(fmt.Sprintf("/vrack/%s/task/%d", vrack, taskID), &task)
+	if apierror, ok := err.(*ovh.APIError); ok && apierror.Code == 404 {
+		return nil, nil
+	}
+	return task, err
+}
+
+// ensureVrack attaches the project to the vRack of '--ovh-vrack' when it is
+// attached to none, and waits for it
+func (d *Driver) ensureVrack(client *API) error {
+	if d.Vrack == "" {
+		return nil
+	}
+
+	current, err := client.GetProjectVrack(d.ProjectID)
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		if current.Name != d.Vrack && current.ID != d.Vrack {
+			return fmt.Errorf("Project %s is already attached to vRack %s. Please select it with '--ovh-vrack', or detach the project first", d.ProjectID, current.Name)
+		}
+		log.Debugf("Project %s is attached to vRack %s", d.ProjectID, current.Name)
+		return nil
+	}
+
+	vracks, err := client.GetVracks()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, vrack := range vracks {
+		found = found || vrack == d.Vrack
+	}
+	if !found {
+		return fmt.Errorf("Invalid vRack '%s'. Please select one of %s with '--ovh-vrack'", d.Vrack, strings.Join(vracks, ", "))
+	}
+
+	log.Infof("Attaching project %s to vRack %s, which may take a few minutes...", d.ProjectID, d.Vrack)
+	task, err := client.AttachVrack(d.Vrack, d.ProjectID)
+	if err != nil {
+		return fmt.Errorf("Could not attach project %s to vRack %s: %s", d.ProjectID, d.Vrack, err)
+	}
+	err = waitWithBackoff(func() (bool, error) {
+		pending, err := client.GetVrackTask(d.Vrack, task.ID)
+		if isTransientError(err) {
+			return false, nil
+		}
+		if err != nil {
+			return true, err
+		}
+		if pending == nil || pending.Status == "done" {
+			return true, nil
+		}
+		if pending.Status == "error" || pending.Status == "cancelled" {
+			return true, fmt.Errorf("task %d is %s", pending.ID, pending.Status)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("Project %s could not be attached to vRack %s: %s", d.ProjectID, d.Vrack, err)
+	}
+	log.Infof("Project %s is attached to vRack %s", d.ProjectID, d.Vrack)
+	return nil
+}
+
+// missingVrackError explains a missing private network of a project attached
+// to no vRack, or returns err
+func (d *Driver) missingVrackError(client *API, err error) error {
+	if d.Vrack != "" {
+		return err
+	}
+	if vrack, vrackErr := client.GetProjectVrack(d.ProjectID); vrackErr == nil && vrack == nil {
+		return fmt.Errorf("Project %s is attached to no vRack and has no private network %s. Please select the vRack to attach it to with '--ovh-vrack', then create the private network", d.ProjectID, d.PrivateNetworkName)
+	}
+	return err
+}
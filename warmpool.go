@@ -0,0 +1,409 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Warm pool instances are pre-built with the settings of the machines of the
+// pool and kept shelved, so that only their disk image is billed. Instances
+// cannot be tagged, so their name marks them: the pool, a digest of their
+// settings and their creation time
+const (
+	warmPoolDir = "ovh-pool"
+
+	// warmPoolSettle is how long a new pool instance is left running before
+	// it is shelved, for its first boot configuration to complete
+	warmPoolSettle = 10 * time.Minute
+
+	// warmPoolLockTimeout is how long a claim waits for the other claims and
+	// refills of the pool
+	warmPoolLockTimeout = 10 * time.Minute
+)
+
+// resetIdentityCommand gives a claimed pool instance the identity of the
+// machine: its hostname, a new machine id and new ssh host keys, and drops the
+// engine identity of the image
+const resetIdentityCommand = `sudo hostnamectl set-hostname %[1]s 2>/dev/null || sudo hostname %[1]s
+echo %[1]s | sudo tee /etc/hostname > /dev/null
+sudo rm -f /etc/machine-id /var/lib/dbus/machine-id
+sudo systemd-machine-id-setup > /dev/null 2>&1 || sudo dbus-uuidgen --ensure=/etc/machine-id
+sudo rm -f /etc/ssh/ssh_host_*_key /etc/ssh/ssh_host_*_key.pub
+sudo ssh-keygen -A
+sudo systemctl restart ssh 2>/dev/null || sudo systemctl restart sshd 2>/dev/null || sudo service ssh restart
+sudo rm -f /etc/docker/key.json`
+
+// warmPoolPath returns the directory of the pool in the store, holding its
+// key and lock
+func (d *Driver) warmPoolPath() string {
+	return filepath.Join(d.StorePath, warmPoolDir, d.WarmPool)
+}
+
+// warmPoolKeyName returns the project ssh key the pool instances are built
+// with
+func (d *Driver) warmPoolKeyName() string {
+	return d.resourceName("pool-" + d.WarmPool)
+}
+
+// warmPoolMemberName matches the end of the names of pool instances, after the
+// pool name: the digest of their settings and their creation time
+var warmPoolMemberName = regexp.MustCompile(`^-[0-9a-f]{16}-[0-9]+$`)
+
+// isWarmPoolMember reports whether an instance belongs to the pool, whatever
+// its settings. Pool names may contain hyphens, so the whole name is matched:
+// the instances of pool web-db are not members of pool web
+func (d *Driver) isWarmPoolMember(name string) bool {
+	prefix := d.resourceName("pool-" + d.WarmPool)
+	return strings.HasPrefix(name, prefix) && warmPoolMemberName.MatchString(name[len(prefix):])
+}
+
+// warmPoolPrefix returns the name prefix of the pool instances built with the
+// settings of the machine: only those can be claimed by it
+func (d *Driver) warmPoolPrefix() string {
+	hash := d.rootPasswordHash
+	d.rootPasswordHash = ""
+	settings := strings.Join([]string{d.RegionName, d.FlavorID, d.ImageID, d.BillingPeriod, strings.Join(d.instanceNetworkIDs(), ","), d.userData()}, "\n")
+	d.rootPasswordHash = hash
+	return d.resourceName(fmt.Sprintf("pool-%s-%s-", d.WarmPool, strings.TrimPrefix(inputDigest(settings), "sha256:")))
+}
+
+// validateWarmPool checks the options of '--ovh-warm-pool'. Pool instances are
+// built ahead of the machines, so options depending on the machine itself are
+// left out
+func (c *Config) validateWarmPool() error {
+	if c.WarmPool == "" {
+		return nil
+	}
+	if !validHostname.MatchString(c.WarmPool) {
+		return fmt.Errorf("Invalid warm pool '%s'. Please select a name of letters, digits and hyphens with '--ovh-warm-pool'", c.WarmPool)
+	}
+	if c.WarmPoolSize < 0 {
+		return fmt.Errorf("Invalid warm pool size %d. Please select a number of instances with '--ovh-warm-pool-size'", c.WarmPoolSize)
+	}
+	switch {
+	case c.Count > 1:
+		return fmt.Errorf("'--ovh-warm-pool' cannot be combined with '--ovh-count'")
+	case c.RootPassword:
+		return fmt.Errorf("'--ovh-warm-pool' cannot be combined with '--ovh-root-password', pool instances are built before the machine")
+	case c.CloneFrom != "" || c.RestoreBackup != "":
+		return fmt.Errorf("'--ovh-warm-pool' builds instances from an image and cannot be combined with '--ovh-clone-from' or '--ovh-restore-backup'")
+	case c.SameHostAs != "" || c.DifferentHostThan != "":
+		return fmt.Errorf("'--ovh-warm-pool' cannot be combined with the placement options, pool instances join no instance group")
+	}
+	return nil
+}
+
+// ensureWarmPoolKey finds or creates the ssh key of the pool, kept in the
+// store for the machines claiming pool instances
+func (d *Driver) ensureWarmPoolKey(client *API) (string, error) {
+	keyPath := filepath.Join(d.warmPoolPath(), "id_"+d.SSHKeyType)
+	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
+		err = os.MkdirAll(d.warmPoolPath(), 0700)
+		if err != nil {
+			return "", err
+		}
+		err = generateSSHKey(keyPath, d.SSHKeyType, d.SSHKeyBits)
+		if err != nil {
+			return "", err
+		}
+	}
+	publicKey, err := ioutil.ReadFile(keyPath + ".pub")
+	if err != nil {
+		return "", err
+	}
+
+	sshKeys, err := client.GetSshkeys(d.ProjectID, d.RegionName)
+	if err != nil {
+		return "", err
+	}
+	if sshKey := findSshkeyByContent(sshKeys, string(publicKey)); sshKey != nil {
+		return sshKey.ID, nil
+	}
+	sshKey, err := client.CreateSshkey(d.ProjectID, d.warmPoolKeyName(), string(publicKey))
+	if err != nil {
+		return "", fmt.Errorf("Could not upload the ssh key of warm pool %s: %s", d.WarmPool, err)
+	}
+	return sshKey.ID, nil
+}
+
+// lockWarmPool serializes the claims and refills of the pool between the
+// machines of the store
+func (d *Driver) lockWarmPool(holder string) (func(), error) {
+	err := os.MkdirAll(d.warmPoolPath(), 0700)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(d.warmPoolPath(), "lock")
+	unlock, err := lockFile(path, holder+" of "+d.MachineName, warmPoolLockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("Could not lock warm pool %s: %s", d.WarmPool, err)
+	}
+	return unlock, nil
+}
+
+// claimWarmPoolInstance takes an instance of the pool built with the settings
+// of the machine, unshelves it and renames it after the machine. It returns
+// nil when the pool has none. The instance is unshelved first: until renamed,
+// it is still a member of the pool and cannot leak
+func (d *Driver) claimWarmPoolInstance(client *API) (*Instance, error) {
+	unlock, err := d.lockWarmPool("claim")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	instances, err := client.GetInstances(d.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	prefix := d.warmPoolPrefix()
+	var claimed *Instance
+	for i, instance := range instances {
+		if !strings.HasPrefix(instance.Name, prefix) || !d.isWarmPoolMember(instance.Name) {
+			continue
+		}
+		// Shelved instances first, running ones may still be configuring
+		if instance.Status == "SHELVED_OFFLOADED" || instance.Status == "SHELVED" {
+			claimed = &instances[i]
+			break
+		}
+		if instance.Status == "ACTIVE" && claimed == nil {
+			claimed = &instances[i]
+		}
+	}
+	if claimed == nil {
+		log.Infof("Warm pool %s has no instance ready for machine %s, building one", d.WarmPool, d.MachineName)
+		return nil, nil
+	}
+
+	log.Infof("Claiming instance %s of warm pool %s...", claimed.ID, d.WarmPool)
+	if claimed.Status != "ACTIVE" {
+		err = client.UnshelveInstance(d.ProjectID, claimed.ID)
+		if err != nil {
+			return nil, fmt.Errorf("Could not unshelve instance %s of warm pool %s: %s", claimed.ID, d.WarmPool, err)
+		}
+	}
+	err = client.RenameInstance(d.ProjectID, claimed.ID, d.instanceName())
+	if err != nil {
+		if claimed.Status != "ACTIVE" {
+			if err := client.ShelveInstance(d.ProjectID, claimed.ID); err != nil {
+				log.Warnf("Could not shelve instance %s of warm pool %s back: %s", claimed.ID, d.WarmPool, err)
+			}
+		}
+		return nil, fmt.Errorf("Could not claim instance %s of warm pool %s: %s", claimed.ID, d.WarmPool, err)
+	}
+	return claimed, nil
+}
+
+// adoptWarmPoolInstance authorizes the key of the machine on the claimed
+// instance with the key of the pool, resets its identity and revokes the key
+// of the pool
+func (d *Driver) adoptWarmPoolInstance() error {
+	public, err := ioutil.ReadFile(d.publicSSHKeyPath())
+	if err != nil {
+		return err
+	}
+	machineKey := strings.TrimSpace(string(public))
+	poolPath := filepath.Join(d.warmPoolPath(), "id_"+d.SSHKeyType)
+	public, err = ioutil.ReadFile(poolPath + ".pub")
+	if err != nil {
+		return fmt.Errorf("Could not read the ssh key of warm pool %s: %s", d.WarmPool, err)
+	}
+	poolBlob := strings.Fields(string(public))[1]
+
+	keyPath := d.SSHKeyPath
+	d.SSHKeyPath = poolPath
+	err = drivers.WaitForSSH(d)
+	if err == nil {
+		_, err = drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(authorizeKeyCommand, strings.Fields(machineKey)[1], machineKey))
+	}
+	d.SSHKeyPath = keyPath
+	if err != nil {
+		return fmt.Errorf("Could not authorize the ssh key of machine %s on warm pool instance %s: %s", d.MachineName, d.InstanceID, err)
+	}
+
+	_, err = drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(resetIdentityCommand, sanitizeMachineName(d.MachineName)))
+	if err != nil {
+		return fmt.Errorf("Could not reset the identity of warm pool instance %s: %s", d.InstanceID, err)
+	}
+	_, err = drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(revokeKeyCommand, poolBlob))
+	if err != nil {
+		return fmt.Errorf("Could not revoke the ssh key of warm pool %s on machine %s: %s", d.WarmPool, d.MachineName, err)
+	}
+	log.Infof("Machine %s took over instance %s of warm pool %s", d.MachineName, d.InstanceID, d.WarmPool)
+	return nil
+}
+
+// refillWarmPool requests the instances missing from the pool, replacing
+// those in ERROR, and waits for the pool instances to be done with their first
+// boot to shelve them. The pool is only locked while it is changed, so that
+// machines may claim its instances meanwhile
+func (d *Driver) refillWarmPool() error {
+	if d.WarmPool == "" {
+		return fmt.Errorf("Machine %s was not created with '--ovh-warm-pool'", d.MachineName)
+	}
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	unlock, err := d.lockWarmPool("refill")
+	if err != nil {
+		return err
+	}
+	err = d.requestWarmPoolInstances(client)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	err = waitWithBackoffFor(warmPoolSettle+statusTimeout, func() (bool, error) {
+		unlock, err := d.lockWarmPool("refill")
+		if err != nil {
+			return false, err
+		}
+		defer unlock()
+		return d.shelveWarmPoolInstances(client)
+	})
+	if err != nil {
+		return fmt.Errorf("Could not shelve the instances of warm pool %s: %s", d.WarmPool, err)
+	}
+	log.Infof("Warm pool %s holds %d shelved instances for machine %s", d.WarmPool, d.WarmPoolSize, d.MachineName)
+	return nil
+}
+
+// requestWarmPoolInstances requests the instances missing from the pool,
+// without waiting for them. Instances in ERROR are replaced
+func (d *Driver) requestWarmPoolInstances(client *API) error {
+	keyID, err := d.ensureWarmPoolKey(client)
+	if err != nil {
+		return err
+	}
+	instances, err := client.GetInstances(d.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	prefix := d.warmPoolPrefix()
+	members := 0
+	for _, instance := range instances {
+		if !strings.HasPrefix(instance.Name, prefix) || !d.isWarmPoolMember(instance.Name) {
+			continue
+		}
+		if instance.Status == "ERROR" {
+			log.Warnf("Deleting instance %s of warm pool %s, in ERROR state", instance.ID, d.WarmPool)
+			if err := client.DeleteInstance(d.ProjectID, instance.ID); err != nil {
+				log.Warnf("Could not delete instance %s: %s", instance.ID, err)
+			}
+			continue
+		}
+		members++
+	}
+
+	monthlyBilling := d.BillingPeriod == "monthly"
+	for ; members < d.WarmPoolSize; members++ {
+		name := fmt.Sprintf("%s%d", prefix, time.Now().UnixNano())
+		instance, err := client.CreateInstance(d.ProjectID, name, keyID, d.FlavorID, d.ImageID, d.RegionName, d.instanceNetworkIDs(), monthlyBilling, d.userData(), "")
+		if err != nil {
+			return fmt.Errorf("Could not refill warm pool %s: %s", d.WarmPool, err)
+		}
+		log.Infof("Building instance %s for warm pool %s", instance.ID, d.WarmPool)
+	}
+	return nil
+}
+
+// shelveWarmPoolInstances shelves the running pool instances done with their
+// first boot. It reports whether every pool instance is shelved
+func (d *Driver) shelveWarmPoolInstances(client *API) (bool, error) {
+	instances, err := client.GetInstances(d.ProjectID)
+	if err != nil {
+		return false, err
+	}
+
+	prefix := d.warmPoolPrefix()
+	shelved := true
+	for _, instance := range instances {
+		if !strings.HasPrefix(instance.Name, prefix) || !d.isWarmPoolMember(instance.Name) {
+			continue
+		}
+		switch instance.Status {
+		case "SHELVED", "SHELVED_OFFLOADED":
+			continue
+		case "ERROR":
+			return false, fmt.Errorf("Instance %s is in ERROR state", instance.ID)
+		case "ACTIVE":
+			created, err := time.Parse(time.RFC3339, instance.Created)
+			if err == nil && time.Since(created) > warmPoolSettle {
+				log.Infof("Shelving instance %s of warm pool %s", instance.ID, d.WarmPool)
+				if err := client.ShelveInstance(d.ProjectID, instance.ID); err != nil {
+					return false, err
+				}
+			}
+		}
+		shelved = false
+	}
+	return shelved, nil
+}
+
+// drainWarmPool deletes every instance of the pool, whatever the settings it
+// was built with, and the pool key, in the project and in the store
+func (d *Driver) drainWarmPool() error {
+	if d.WarmPool == "" {
+		return fmt.Errorf("Machine %s was not created with '--ovh-warm-pool'", d.MachineName)
+	}
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	unlock, err := d.lockWarmPool("drain")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	instances, err := client.GetInstances(d.ProjectID)
+	if err != nil {
+		return err
+	}
+	for _, instance := range instances {
+		if !d.isWarmPoolMember(instance.Name) {
+			continue
+		}
+		log.Infof("Deleting instance %s of warm pool %s", instance.ID, d.WarmPool)
+		if err := client.DeleteInstance(d.ProjectID, instance.ID); err != nil {
+			return fmt.Errorf("Could not delete instance %s of warm pool %s: %s", instance.ID, d.WarmPool, err)
+		}
+	}
+
+	sshKeys, err := client.GetSshkeys(d.ProjectID, d.RegionName)
+	if err != nil {
+		return err
+	}
+	for _, sshKey := range sshKeys {
+		if sshKey.Name != d.warmPoolKeyName() {
+			continue
+		}
+		log.Infof("Deleting ssh key %s of warm pool %s", sshKey.ID, d.WarmPool)
+		if err := client.DeleteSshkey(d.ProjectID, sshKey.ID); err != nil {
+			return fmt.Errorf("Could not delete the ssh key of warm pool %s: %s", d.WarmPool, err)
+		}
+	}
+
+	keys, _ := filepath.Glob(filepath.Join(d.warmPoolPath(), "id_*"))
+	for _, key := range keys {
+		if err := os.Remove(key); err != nil {
+			return err
+		}
+	}
+	log.Infof("Warm pool %s is drained", d.WarmPool)
+	return nil
+}
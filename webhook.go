@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Machine lifecycle events sent to the webhook
+const (
+	EventCreated     = "created"
+	EventIPAssigned  = "ip-assigned"
+	EventProvisioned = "provisioned"
+	EventRemoved     = "removed"
+	EventError       = "error"
+)
+
+// webhookTimeout bounds each webhook call
+const webhookTimeout = 10 * time.Second
+
+// webhookEvent is the JSON body posted to the webhook
+type webhookEvent struct {
+	Event            string            `json:"event"`
+	Time             string            `json:"time"`
+	Machine          string            `json:"machine"`
+	Project          string            `json:"project"`
+	Region           string            `json:"region"`
+	Flavor           string            `json:"flavor"`
+	Image            string            `json:"image"`
+	InstanceID       string            `json:"instanceId,omitempty"`
+	IPAddress        string            `json:"ipAddress,omitempty"`
+	PrivateIPAddress string            `json:"privateIpAddress,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	Error            string            `json:"error,omitempty"`
+}
+
+// notify posts a lifecycle event of the machine to the webhook, if any. The
+// webhook keeps inventories in sync, its failures are only reported
+func (d *Driver) notify(event string, cause error) {
+	if d.WebhookURL == "" {
+		return
+	}
+
+	body := webhookEvent{
+		Event:            event,
+		Time:             time.Now().UTC().Format(time.RFC3339),
+		Machine:          d.MachineName,
+		Project:          d.ProjectID,
+		Region:           d.RegionName,
+		Flavor:           d.FlavorName,
+		Image:            d.ImageID,
+		InstanceID:       d.InstanceID,
+		IPAddress:        d.IPAddress,
+		PrivateIPAddress: d.PrivateIPAddress,
+		Labels:           d.Labels,
+	}
+	if cause != nil {
+		body.Error = cause.Error()
+	}
+
+	err := postWebhook(d.WebhookURL, body)
+	if err != nil {
+		log.Warnf("Could not send %s event of %s to webhook: %s", event, d.MachineName, err)
+		return
+	}
+	log.Debugf("Sent %s event of %s to webhook", event, d.MachineName)
+}
+
+// postWebhook posts body as JSON to url
+func postWebhook(url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	traceCalls(client)
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return nil
+}
+
+// notifyProvisioned sends the provisioned event once, when docker-machine
+// generated the engine certificates after create
+func (d *Driver) notifyProvisioned() {
+	if d.WebhookURL == "" {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(d.StorePath, "machines", d.MachineName, "server.pem")); err != nil {
+		return
+	}
+
+	if d.claimMarker(markerProvisioned) {
+		d.notify(EventProvisioned, nil)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// WireGuard mesh settings
+const (
+	WireGuardInterface     = "wg-ovh"
+	WireGuardPort          = 51820
+	DefaultWireGuardSubnet = "10.99.0.0/24"
+)
+
+// wireGuardLockTimeout is how long a change of the mesh waits for the others
+const wireGuardLockTimeout = 10 * time.Minute
+
+// wireGuardInstallScript installs WireGuard
+const wireGuardInstallScript = `if command -v apt-get >/dev/null; then
+	sudo apt-get update -q && sudo DEBIAN_FRONTEND=noninteractive apt-get install -y -q wireguard-tools
+else
+	sudo dnf install -y -q wireguard-tools || sudo yum install -y -q wireguard-tools
+fi
+sudo systemctl enable wg-quick@%[1]s
+`
+
+// wireGuardKeyScript generates the private key of the machine on the machine
+// itself, unless it has one already, and prints its public key
+const wireGuardKeyScript = `sudo mkdir -p /etc/wireguard
+sudo sh -c 'umask 077; [ -s /etc/wireguard/%[1]s.key ] || wg genkey > /etc/wireguard/%[1]s.key'
+sudo wg pubkey < /etc/wireguard/%[1]s.key
+`
+
+// wireGuardConfigScript replaces the mesh configuration and restarts the
+// interface. The private key stays in its own file, so that the
+// configuration can be rendered for peers without it
+const wireGuardConfigScript = `sudo tee /etc/wireguard/%[1]s.conf >/dev/null <<'EOF'
+%[2]sEOF
+sudo chmod 600 /etc/wireguard/%[1]s.conf
+sudo systemctl restart wg-quick@%[1]s
+`
+
+// validateWireGuardSubnet checks the mesh subnet is an IPv4 one with room for
+// a few machines
+func validateWireGuardSubnet(subnet string) error {
+	ip, network, err := net.ParseCIDR(subnet)
+	if err == nil && ip.To4() == nil {
+		err = fmt.Errorf("not an IPv4 subnet")
+	}
+	if err == nil {
+		if ones, _ := network.Mask.Size(); ones > 30 {
+			err = fmt.Errorf("too small")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid WireGuard mesh subnet '%s': %s. Please select an IPv4 CIDR with '--ovh-wireguard-subnet'", subnet, err)
+	}
+	return nil
+}
+
+// meshMembers returns the other machines of the store in the mesh, including
+// the ones still joining it
+func (d *Driver) meshMembers() ([]*Driver, error) {
+	machines, err := d.storedMachines()
+	if err != nil {
+		return nil, err
+	}
+
+	var members []*Driver
+	for _, machine := range machines {
+		if machine.WireGuardMesh == d.WireGuardMesh && machine.WireGuardAddress != "" {
+			members = append(members, machine)
+		}
+	}
+	return members, nil
+}
+
+// meshPeers returns the members of the mesh that joined it, with a key
+func meshPeers(members []*Driver) []*Driver {
+	var peers []*Driver
+	for _, member := range members {
+		if member.WireGuardPublicKey != "" && member.IPAddress != "" {
+			peers = append(peers, member)
+		}
+	}
+	return peers
+}
+
+// meshSubnet returns the subnet of the mesh: the one of its members, which
+// the machine must not contradict, or else the selected one
+func (d *Driver) meshSubnet(members []*Driver) (string, error) {
+	subnet := d.WireGuardSubnet
+	for _, member := range members {
+		existing := member.WireGuardSubnet
+		if existing == "" {
+			existing = DefaultWireGuardSubnet
+		}
+		if subnet == "" {
+			subnet = existing
+		}
+		if subnet != existing {
+			return "", fmt.Errorf("Invalid WireGuard mesh subnet '%s'. Mesh %s uses %s, as machine %s. Please select it with '--ovh-wireguard-subnet'", subnet, d.WireGuardMesh, existing, member.MachineName)
+		}
+	}
+	if subnet == "" {
+		subnet = DefaultWireGuardSubnet
+	}
+	return subnet, nil
+}
+
+// meshAddress returns the first address of the subnet not used by members
+func meshAddress(subnet string, members []*Driver) (string, error) {
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return "", err
+	}
+	used := make(map[string]bool)
+	for _, member := range members {
+		used[member.WireGuardAddress] = true
+	}
+
+	base := binary.BigEndian.Uint32(network.IP.To4())
+	ones, bits := network.Mask.Size()
+	for i := uint32(1); i < 1<<uint(bits-ones)-1; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, base+i)
+		if !used[ip.String()] {
+			return ip.String(), nil
+		}
+	}
+	return "", fmt.Errorf("No address left in WireGuard mesh subnet %s", subnet)
+}
+
+// meshSources returns the public addresses of the members of the mesh other
+// than machine, allowed to reach its WireGuard port
+func meshSources(machine *Driver, members []*Driver) []string {
+	var sources []string
+	for _, member := range members {
+		if member.MachineName != machine.MachineName && member.IPAddress != "" {
+			sources = append(sources, member.IPAddress+"/32")
+		}
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// wireGuardConfig renders the mesh configuration of machine, peering with
+// every other member over their public address
+func wireGuardConfig(machine *Driver, members []*Driver) string {
+	subnet := machine.WireGuardSubnet
+	if subnet == "" {
+		subnet = DefaultWireGuardSubnet
+	}
+	_, network, _ := net.ParseCIDR(subnet)
+	ones, _ := network.Mask.Size()
+
+	config := fmt.Sprintf("[Interface]\nAddress = %s/%d\nListenPort = %d\nPostUp = wg set %%i private-key /etc/wireguard/%s.key\n", machine.WireGuardAddress, ones, WireGuardPort, WireGuardInterface)
+
+	sorted := append([]*Driver{}, members...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].MachineName < sorted[j].MachineName })
+	for _, member := range sorted {
+		if member.MachineName == machine.MachineName {
+			continue
+		}
+		config += fmt.Sprintf("\n[Peer]\n# %s\nPublicKey = %s\nEndpoint = %s:%d\nAllowedIPs = %s/32\nPersistentKeepalive = 25\n", member.MachineName, member.WireGuardPublicKey, member.IPAddress, WireGuardPort, member.WireGuardAddress)
+	}
+	return config
+}
+
+// lockWireGuardMesh serializes the changes of the mesh across processes,
+// from the address allocation to the update of every member
+func (d *Driver) lockWireGuardMesh() (func(), error) {
+	path := filepath.Join(d.StorePath, machineLockDir, "wireguard-"+d.WireGuardMesh+".lock")
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockFile(path, "change of "+d.MachineName, wireGuardLockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("Could not lock WireGuard mesh %s: %s", d.WireGuardMesh, err)
+	}
+	return unlock, nil
+}
+
+// joinWireGuardMesh installs WireGuard, generates the key pair on the machine,
+// configures the mesh on the machine and adds the machine to its peers. Peers
+// that cannot be reached are only reported
+func (d *Driver) joinWireGuardMesh() error {
+	log.Infof("Installing WireGuard on %s...", d.MachineName)
+	err := drivers.WaitForSSH(d)
+	if err != nil {
+		return err
+	}
+	_, err = drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(wireGuardInstallScript, WireGuardInterface))
+	if err != nil {
+		return fmt.Errorf("Could not install WireGuard: %s", err)
+	}
+	output, err := drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(wireGuardKeyScript, WireGuardInterface))
+	if err != nil {
+		return fmt.Errorf("Could not generate the WireGuard key: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	publicKey := strings.TrimSpace(lines[len(lines)-1])
+	if key, err := base64.StdEncoding.DecodeString(publicKey); err != nil || len(key) != 32 {
+		return fmt.Errorf("Could not read the WireGuard public key of %s: '%s'", d.MachineName, publicKey)
+	}
+
+	unlock, err := d.lockWireGuardMesh()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	members, err := d.meshMembers()
+	if err != nil {
+		return err
+	}
+	d.WireGuardSubnet, err = d.meshSubnet(members)
+	if err != nil {
+		return err
+	}
+	if d.WireGuardAddress == "" {
+		d.WireGuardAddress, err = meshAddress(d.WireGuardSubnet, members)
+		if err != nil {
+			return err
+		}
+	}
+	d.WireGuardPublicKey = publicKey
+
+	log.Infof("Adding %s to WireGuard mesh %s with address %s...", d.MachineName, d.WireGuardMesh, d.WireGuardAddress)
+	peers := meshPeers(members)
+	_, err = drivers.RunSSHCommandFromDriver(d, fmt.Sprintf(wireGuardConfigScript, WireGuardInterface, wireGuardConfig(d, append(peers, d))))
+	if err != nil {
+		d.WireGuardPublicKey = ""
+		return fmt.Errorf("Could not configure WireGuard mesh: %s", err)
+	}
+
+	if d.WireGuardRestricted {
+		err = d.setSecurityGroups(meshSources(d, members))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Members see the machine once saved, before the lock is released
+	err = d.checkpoint(d.CreatePhase)
+	if err != nil {
+		return err
+	}
+	d.updateMeshPeers(peers, append(members, d))
+	return nil
+}
+
+// leaveWireGuardMesh removes the machine from the configuration of its peers,
+// and their WireGuard port from its address
+func (d *Driver) leaveWireGuardMesh() error {
+	unlock, err := d.lockWireGuardMesh()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	members, err := d.meshMembers()
+	if err != nil {
+		return err
+	}
+	d.updateMeshPeers(meshPeers(members), members)
+	return nil
+}
+
+// updateMeshPeers pushes the mesh configuration of members to each peer, and
+// allows the members through the security group of the peer
+func (d *Driver) updateMeshPeers(peers []*Driver, members []*Driver) {
+	var names []string
+	for _, peer := range peers {
+		_, err := drivers.RunSSHCommandFromDriver(peer, fmt.Sprintf(wireGuardConfigScript, WireGuardInterface, wireGuardConfig(peer, meshPeers(members))))
+		if err != nil {
+			log.Warnf("Could not update WireGuard mesh peer %s: %s", peer.MachineName, err)
+			continue
+		}
+		if peer.WireGuardRestricted {
+			err = peer.setSecurityGroups(meshSources(peer, members))
+			if err != nil {
+				log.Warnf("Could not allow the WireGuard mesh through the security group of peer %s: %s", peer.MachineName, err)
+				continue
+			}
+		}
+		names = append(names, peer.MachineName)
+	}
+	if len(names) > 0 {
+		log.Debugf("Updated WireGuard mesh peers %s", strings.Join(names, ", "))
+	}
+}